@@ -0,0 +1,159 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/kubedeskpro/kubedesk-helper/internal/logging"
+)
+
+// authTokenGrace is how long the previous token keeps working after POST /auth/rotate,
+// so requests the app already sent (or is about to send) with it don't fail
+const authTokenGrace = time.Minute
+
+// authTokenBytes is the size of a generated token before hex encoding
+const authTokenBytes = 32
+
+// TokenAuth requires "Authorization: Bearer <token>" on every API request when
+// HELPER_AUTH_TOKEN_FILE is set. The token is generated at startup and written to that
+// file, which the app reads; POST /auth/rotate replaces it without a restart
+type TokenAuth struct {
+	path string
+	now  func() time.Time // Overridden in tests
+
+	mu              sync.RWMutex
+	token           string
+	previous        string    // Token replaced by the last rotation; "" before the first one
+	previousExpires time.Time // When previous stops being accepted
+}
+
+// AuthRotateResponse is the POST /auth/rotate response
+type AuthRotateResponse struct {
+	Token              string    `json:"token"`              // Send this from now on; also written to the token file
+	PreviousValidUntil time.Time `json:"previousValidUntil"` // The token used for this call works until then
+}
+
+// NewTokenAuth generates a token and writes it to path, readable only by the current user
+func NewTokenAuth(path string) (*TokenAuth, error) {
+	a := &TokenAuth{path: path, now: time.Now}
+	token, err := newAuthToken()
+	if err != nil {
+		return nil, err
+	}
+	if err := a.writeToken(token); err != nil {
+		return nil, err
+	}
+	a.token = token
+	return a, nil
+}
+
+// Register adds POST /auth/rotate and requires the token on every route of r
+// /health stays open for liveness probes, and /debug keeps its own HELPER_DEBUG_TOKEN
+func (a *TokenAuth) Register(r *mux.Router) {
+	r.HandleFunc("/auth/rotate", a.Rotate).Methods("POST")
+	r.Use(a.middleware)
+}
+
+// middleware rejects requests without a valid bearer token
+func (a *TokenAuth) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" || strings.HasPrefix(r.URL.Path, "/debug/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || !a.valid(got) {
+			logging.FromContext(r.Context()).Warn("Rejected request without a valid auth token", "path", r.URL.Path)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// valid reports whether got is the current token, or the previous one within its grace window
+func (a *TokenAuth) valid(got string) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if subtle.ConstantTimeCompare([]byte(got), []byte(a.token)) == 1 {
+		return true
+	}
+	return a.previous != "" && a.now().Before(a.previousExpires) &&
+		subtle.ConstantTimeCompare([]byte(got), []byte(a.previous)) == 1
+}
+
+// Rotate handles POST /auth/rotate
+// The middleware has already checked the caller's token. The new token is written to the token
+// file before it is accepted, so a failed write leaves the current token in place
+func (a *TokenAuth) Rotate(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	token, err := newAuthToken()
+	if err != nil {
+		logger.Error("Failed to generate auth token", "error", err)
+		http.Error(w, "Failed to generate auth token", http.StatusInternalServerError)
+		return
+	}
+
+	a.mu.Lock()
+	if err := a.writeToken(token); err != nil {
+		a.mu.Unlock()
+		logger.Error("Failed to write auth token file", "path", a.path, "error", err)
+		http.Error(w, "Failed to write auth token file", http.StatusInternalServerError)
+		return
+	}
+	// Only the token being replaced gets a grace window; an older one stops working now
+	a.previous = a.token
+	a.previousExpires = a.now().Add(authTokenGrace)
+	a.token = token
+	response := AuthRotateResponse{Token: token, PreviousValidUntil: a.previousExpires}
+	a.mu.Unlock()
+
+	logger.Info("Rotated auth token", "path", a.path, "previousValidUntil", response.PreviousValidUntil)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(response)
+}
+
+// writeToken replaces the token file atomically, so the app never reads a partial token
+func (a *TokenAuth) writeToken(token string) error {
+	// CreateTemp makes the file 0600 whatever was left at the path before
+	f, err := os.CreateTemp(filepath.Dir(a.path), ".auth-token-*")
+	if err != nil {
+		return fmt.Errorf("failed to create auth token file: %w", err)
+	}
+	_, err = f.WriteString(token + "\n")
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), a.path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("failed to write auth token file: %w", err)
+	}
+	return nil
+}
+
+// newAuthToken returns a random hex token
+func newAuthToken() (string, error) {
+	b := make([]byte, authTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate auth token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
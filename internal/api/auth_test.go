@@ -0,0 +1,179 @@
+package api
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/config"
+	"github.com/kubedeskpro/kubedesk-helper/internal/session"
+)
+
+func TestTokenAuth_RequiresToken(t *testing.T) {
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+
+	path := filepath.Join(t.TempDir(), "token")
+	auth, err := NewTokenAuth(path)
+	if err != nil {
+		t.Fatalf("NewTokenAuth: %v", err)
+	}
+	router := NewRouter("test", sessionMgr, config.Default())
+	auth.Register(router)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("token file not written: %v", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("token file permissions = %o, want 600", info.Mode().Perm())
+	}
+
+	get := func(path, header string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		header string
+		want   int
+	}{
+		{"missing header", "/status", "", http.StatusUnauthorized},
+		{"wrong token", "/status", "Bearer nope", http.StatusUnauthorized},
+		{"not bearer", "/status", "Basic " + token, http.StatusUnauthorized},
+		{"ok", "/status", "Bearer " + token, http.StatusOK},
+		{"health stays open", "/health", "", http.StatusOK},
+		{"debug keeps its own token", "/debug/sessions", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := get(tt.path, tt.header); got != tt.want {
+				t.Errorf("GET %s = %d, want %d", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenAuth_Rotate(t *testing.T) {
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+
+	path := filepath.Join(t.TempDir(), "token")
+	auth, err := NewTokenAuth(path)
+	if err != nil {
+		t.Fatalf("NewTokenAuth: %v", err)
+	}
+	now := time.Unix(1700000000, 0)
+	auth.now = func() time.Time { return now }
+	router := NewRouter("test", sessionMgr, config.Default())
+	auth.Register(router)
+
+	do := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	data, _ := os.ReadFile(path)
+	oldToken := strings.TrimSpace(string(data))
+
+	if rec := do(http.MethodPost, "/auth/rotate", "nope"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("rotate with a wrong token = %d, want 401", rec.Code)
+	}
+
+	rec := do(http.MethodPost, "/auth/rotate", oldToken)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("rotate = %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp AuthRotateResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Token == "" || resp.Token == oldToken {
+		t.Fatalf("rotate returned token %q, want a new one", resp.Token)
+	}
+	if !resp.PreviousValidUntil.Equal(now.Add(authTokenGrace)) {
+		t.Errorf("previousValidUntil = %s, want %s", resp.PreviousValidUntil, now.Add(authTokenGrace))
+	}
+	if data, _ := os.ReadFile(path); strings.TrimSpace(string(data)) != resp.Token {
+		t.Errorf("token file = %q, want the new token", strings.TrimSpace(string(data)))
+	}
+
+	// Both tokens work during the grace window; only the new one after it
+	if rec := do(http.MethodGet, "/status", resp.Token); rec.Code != http.StatusOK {
+		t.Errorf("new token = %d, want 200", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/status", oldToken); rec.Code != http.StatusOK {
+		t.Errorf("old token within grace = %d, want 200", rec.Code)
+	}
+	now = now.Add(authTokenGrace)
+	if rec := do(http.MethodGet, "/status", oldToken); rec.Code != http.StatusUnauthorized {
+		t.Errorf("old token after grace = %d, want 401", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/status", resp.Token); rec.Code != http.StatusOK {
+		t.Errorf("new token after grace = %d, want 200", rec.Code)
+	}
+
+	// A failed write keeps the current token
+	os.RemoveAll(filepath.Dir(path))
+	if rec := do(http.MethodPost, "/auth/rotate", resp.Token); rec.Code != http.StatusInternalServerError {
+		t.Errorf("rotate with unwritable token file = %d, want 500", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/status", resp.Token); rec.Code != http.StatusOK {
+		t.Errorf("token after failed rotation = %d, want 200", rec.Code)
+	}
+}
+
+func TestTokenAuth_ProxyDoesNotForwardHelperToken(t *testing.T) {
+	var gotAuth []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Values("Authorization")
+		w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	sess, _ := sessionMgr.CreateForCluster(session.TypeProxy, "abc123")
+	sess.Port = upstream.Listener.Addr().(*net.TCPAddr).Port
+
+	cfg := config.Default()
+	cfg.AuthTokenFile = filepath.Join(t.TempDir(), "token")
+	auth, err := NewTokenAuth(cfg.AuthTokenFile)
+	if err != nil {
+		t.Fatalf("NewTokenAuth: %v", err)
+	}
+	router := NewRouter("test", sessionMgr, cfg)
+	auth.Register(router)
+
+	data, _ := os.ReadFile(cfg.AuthTokenFile)
+	token := strings.TrimSpace(string(data))
+	req := httptest.NewRequest(http.MethodGet, "/proxy/abc123/api/v1/pods", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+	// kubectl proxy would send it on instead of the cluster's own credentials
+	if len(gotAuth) != 0 {
+		t.Errorf("upstream Authorization = %q, want none", gotAuth)
+	}
+}
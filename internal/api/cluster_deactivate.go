@@ -0,0 +1,69 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/logging"
+	"github.com/kubedeskpro/kubedesk-helper/internal/session"
+)
+
+// maxDeactivateGrace caps gracePeriodSeconds on /cluster/deactivate
+const maxDeactivateGrace = 60
+
+// ClusterDeactivateRequest represents a cluster deactivation request
+type ClusterDeactivateRequest struct {
+	ClusterHash        string `json:"clusterHash"`
+	GracePeriodSeconds int    `json:"gracePeriodSeconds,omitempty"` // Wait between SIGTERM and SIGKILL (default: 5)
+}
+
+// ClusterDeactivateResponse lists the sessions a deactivation stopped
+type ClusterDeactivateResponse struct {
+	ClusterHash     string               `json:"clusterHash"`
+	SessionsStopped int                  `json:"sessionsStopped"`
+	Sessions        []session.StopResult `json:"sessions"`
+}
+
+// Deactivate handles POST /cluster/deactivate
+// Gracefully stops every session of a cluster the app switched away from; unlike
+// /sessions/cleanup, processes get SIGTERM first and each session's outcome is reported
+func (h *SessionCleanupHandler) Deactivate(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	var req ClusterDeactivateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("Failed to decode deactivate request", "error", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.ClusterHash == "" {
+		http.Error(w, "clusterHash is required", http.StatusBadRequest)
+		return
+	}
+	if req.GracePeriodSeconds < 0 || req.GracePeriodSeconds > maxDeactivateGrace {
+		http.Error(w, fmt.Sprintf("gracePeriodSeconds must be between 0 and %d", maxDeactivateGrace), http.StatusBadRequest)
+		return
+	}
+	grace := session.DefaultStopGrace
+	if req.GracePeriodSeconds > 0 {
+		grace = time.Duration(req.GracePeriodSeconds) * time.Second
+	}
+
+	// Draining in-flight proxy requests plus the grace period can outlast the write timeout
+	clearWriteDeadline(logger, w)
+
+	logger.Info("Deactivating cluster", "clusterHash", req.ClusterHash, "grace", grace)
+	results := h.sessionMgr.DeactivateCluster(req.ClusterHash, grace)
+
+	response := ClusterDeactivateResponse{
+		ClusterHash:     req.ClusterHash,
+		SessionsStopped: len(results),
+		Sessions:        results,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/session"
+)
+
+func TestClusterDeactivate(t *testing.T) {
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	handler := NewSessionCleanupHandler(sessionMgr)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.Deactivate(rec, httptest.NewRequest(http.MethodPost, "/cluster/deactivate", strings.NewReader(body)))
+		return rec
+	}
+
+	for _, body := range []string{`{}`, `{"clusterHash":"old","gracePeriodSeconds":-1}`, `{"clusterHash":"old","gracePeriodSeconds":61}`} {
+		if rec := post(body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", body, rec.Code)
+		}
+	}
+
+	proxy, _ := sessionMgr.CreateForCluster(session.TypeProxy, "old")
+	kept, _ := sessionMgr.CreateForCluster(session.TypeProxy, "new")
+
+	rec := post(`{"clusterHash":"old","gracePeriodSeconds":1}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var resp ClusterDeactivateResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.ClusterHash != "old" || resp.SessionsStopped != 1 || len(resp.Sessions) != 1 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if r := resp.Sessions[0]; r.SessionID != proxy.ID || r.Type != session.TypeProxy || r.Reason != session.StopReasonExited {
+		t.Errorf("unexpected result: %+v", r)
+	}
+	if _, ok := sessionMgr.Get(kept.ID); !ok {
+		t.Error("session for another cluster was stopped")
+	}
+
+	// Nothing left to stop is not an error
+	rec = post(`{"clusterHash":"old"}`)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"sessions":[]`) {
+		t.Errorf("second deactivation: status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+}
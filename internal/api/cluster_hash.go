@@ -0,0 +1,63 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/cluster"
+	"github.com/kubedeskpro/kubedesk-helper/internal/logging"
+)
+
+// ClusterHashHandler handles /cluster/hash endpoint
+type ClusterHashHandler struct{}
+
+// ClusterHashRequest represents a cluster hash request
+type ClusterHashRequest struct {
+	Kubeconfig     string `json:"kubeconfig,omitempty"`
+	KubeconfigPath string `json:"kubeconfigPath,omitempty"` // Absolute path to a kubeconfig on disk
+	Context        string `json:"context,omitempty"`
+	Register       bool   `json:"register,omitempty"` // Also record the hash so later requests can send only clusterHash
+}
+
+// ClusterHashResponse represents a cluster hash response
+type ClusterHashResponse struct {
+	ClusterHash string `json:"clusterHash"`
+	Registered  bool   `json:"registered"`
+}
+
+// Hash handles POST /cluster/hash
+// Computes the canonical cluster hash without starting any session
+func (h *ClusterHashHandler) Hash(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	var req ClusterHashRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if status, msg := loadKubeconfigPath(&req.Kubeconfig, req.KubeconfigPath); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	if req.Kubeconfig == "" && req.Context == "" {
+		http.Error(w, "kubeconfig, kubeconfigPath, or context is required", http.StatusBadRequest)
+		return
+	}
+
+	var hash string
+	if req.Register {
+		hash = cluster.ComputeAndRegister(req.Kubeconfig, req.Context)
+	} else {
+		hash = cluster.ComputeHash(req.Kubeconfig, req.Context)
+	}
+
+	logger.Debug("Computed cluster hash", "clusterHash", hash, "context", req.Context, "registered", req.Register)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ClusterHashResponse{
+		ClusterHash: hash,
+		Registered:  req.Register,
+	})
+}
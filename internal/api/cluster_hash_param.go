@@ -0,0 +1,33 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// clusterHashBody is the optional JSON body of session endpoints that take no other input
+type clusterHashBody struct {
+	ClusterHash string `json:"clusterHash"`
+}
+
+// clusterHashFromRequest returns the clusterHash a session request is checked against:
+// bodyHash (from the JSON body) if set, otherwise the clusterHash query parameter
+func clusterHashFromRequest(r *http.Request, bodyHash string) string {
+	if bodyHash != "" {
+		return bodyHash
+	}
+	return r.URL.Query().Get("clusterHash")
+}
+
+// readClusterHash reads the clusterHash of a session request that has no other body fields,
+// from an optional JSON body {"clusterHash": "..."} or else the query parameter
+// A malformed body is an error rather than ignored, so the hash check is never silently skipped
+func readClusterHash(r *http.Request) (string, error) {
+	var body clusterHashBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return clusterHashFromRequest(r, body.ClusterHash), nil
+}
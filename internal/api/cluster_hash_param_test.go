@@ -0,0 +1,112 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/config"
+	"github.com/kubedeskpro/kubedesk-helper/internal/session"
+)
+
+func TestSessionEndpoints_ClusterHashPlacement(t *testing.T) {
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	defer sessionMgr.StopAll()
+	router := NewRouter("test", sessionMgr, config.Default())
+
+	endpoints := []struct {
+		method  string
+		path    string
+		typ     session.SessionType
+		body    string // other body fields, if the endpoint takes any
+		okCodes []int  // codes once the hash matches; the session itself is a bare placeholder
+	}{
+		{http.MethodPost, "/exec/input/", session.TypeExec, `"input":"ls\n"`, []int{http.StatusBadRequest}},
+		{http.MethodGet, "/exec/output/", session.TypeExec, "", []int{http.StatusOK}},
+		{http.MethodGet, "/exec/attach/", session.TypeExec, "", []int{http.StatusBadRequest}}, // not a WebSocket handshake
+		{http.MethodDelete, "/exec/stop/", session.TypeExec, "", []int{http.StatusOK}},
+		{http.MethodGet, "/shell/output/", session.TypeShell, "", []int{http.StatusOK}},
+		{http.MethodDelete, "/shell/stop/", session.TypeShell, "", []int{http.StatusOK}},
+		{http.MethodPost, "/shell/signal/", session.TypeShell, `"signal":"SIGINT"`, []int{http.StatusConflict}},
+		{http.MethodDelete, "/port-forward/stop/", session.TypePortForward, "", []int{http.StatusOK}},
+		{http.MethodDelete, "/proxy/stop/", session.TypeProxy, "", []int{http.StatusOK}},
+	}
+	placements := []struct {
+		name            string
+		query, bodyHash string
+		mismatch        bool // the effective hash names another cluster
+	}{
+		{"query match", "hash-a", "", false},
+		{"query mismatch", "hash-b", "", true},
+		{"body match", "", "hash-a", false},
+		{"body mismatch", "", "hash-b", true},
+		{"body wins over query", "hash-b", "hash-a", false},
+	}
+
+	for _, ep := range endpoints {
+		for _, pl := range placements {
+			t.Run(ep.path+pl.name, func(t *testing.T) {
+				sess, err := sessionMgr.CreateForCluster(ep.typ, "hash-a")
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer sessionMgr.Stop(sess.ID)
+
+				target := ep.path + sess.ID
+				if pl.query != "" {
+					target += "?clusterHash=" + pl.query
+				}
+				var fields []string
+				if ep.body != "" {
+					fields = append(fields, ep.body)
+				}
+				if pl.bodyHash != "" {
+					fields = append(fields, `"clusterHash":"`+pl.bodyHash+`"`)
+				}
+				body := ""
+				if len(fields) > 0 {
+					body = "{" + strings.Join(fields, ",") + "}"
+				}
+
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, httptest.NewRequest(ep.method, target, strings.NewReader(body)))
+
+				if pl.mismatch {
+					if rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), "cluster mismatch") {
+						t.Errorf("expected 404 cluster mismatch, got %d: %s", rec.Code, rec.Body.String())
+					}
+					return
+				}
+				for _, code := range ep.okCodes {
+					if rec.Code == code {
+						return
+					}
+				}
+				t.Errorf("got %d, want one of %v: %s", rec.Code, ep.okCodes, rec.Body.String())
+			})
+		}
+	}
+}
+
+func TestSessionEndpoints_MalformedClusterHashBody(t *testing.T) {
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	router := NewRouter("test", sessionMgr, config.Default())
+
+	sess, err := sessionMgr.CreateForCluster(session.TypeExec, "hash-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sessionMgr.Stop(sess.ID)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/exec/stop/"+sess.ID, strings.NewReader(`{"clusterHash":`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if _, ok := sessionMgr.Get(sess.ID); !ok {
+		t.Error("session stopped despite an unreadable cluster hash")
+	}
+}
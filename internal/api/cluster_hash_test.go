@@ -0,0 +1,81 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/cluster"
+)
+
+func postClusterHash(t *testing.T, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	(&ClusterHashHandler{}).Hash(rec, httptest.NewRequest(http.MethodPost, "/cluster/hash", strings.NewReader(body)))
+	return rec
+}
+
+func TestClusterHash(t *testing.T) {
+	const kubeconfigContent = "apiVersion: v1\nkind: Config\n# cluster-hash-test"
+	want := cluster.ComputeHash(kubeconfigContent, "dev")
+
+	body, _ := json.Marshal(ClusterHashRequest{Kubeconfig: kubeconfigContent, Context: "dev"})
+	rec := postClusterHash(t, string(body))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var resp ClusterHashResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.ClusterHash != want || resp.Registered {
+		t.Errorf("unexpected response: %+v, want hash %s", resp, want)
+	}
+	// Without register the request has no side effects
+	if _, _, found := cluster.GetRegistry().Lookup(want); found {
+		t.Errorf("hash was registered without register=true")
+	}
+
+	// A path to the same content yields the same hash, and register records it
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte(kubeconfigContent), 0600); err != nil {
+		t.Fatal(err)
+	}
+	body, _ = json.Marshal(ClusterHashRequest{KubeconfigPath: path, Context: "dev", Register: true})
+	rec = postClusterHash(t, string(body))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	resp = ClusterHashResponse{}
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if resp.ClusterHash != want || !resp.Registered {
+		t.Errorf("unexpected response: %+v, want hash %s", resp, want)
+	}
+	if kc, ctx, found := cluster.GetRegistry().Lookup(want); !found || kc != kubeconfigContent || ctx != "dev" {
+		t.Errorf("expected hash to be registered, got found=%v context=%q", found, ctx)
+	}
+}
+
+func TestClusterHash_InvalidInput(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "Malformed body", body: `{`},
+		{name: "Nothing provided", body: `{}`},
+		{name: "Both provided", body: `{"kubeconfig":"a: b","kubeconfigPath":"/tmp/config"}`},
+		{name: "Relative path", body: `{"kubeconfigPath":"config"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := postClusterHash(t, tt.body); rec.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
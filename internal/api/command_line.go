@@ -0,0 +1,41 @@
+package api
+
+import (
+	"regexp"
+	"strings"
+)
+
+// redactedValue replaces secrets and kubeconfig paths in a session's command line
+const redactedValue = "<redacted>"
+
+// sensitiveFlags take a value that must never show up in session listings
+var sensitiveFlags = map[string]bool{
+	"--token":      true,
+	"--password":   true,
+	"--kubeconfig": true,
+	"--client-key": true,
+}
+
+// Secrets embedded in a single argument, e.g. "--token=abc" or a bash -c script
+var (
+	inlineSensitiveFlagRe = regexp.MustCompile(`(--(?:token|password|kubeconfig|client-key))([= ])\S+`)
+	inlineSecretRe        = regexp.MustCompile(`(?i)(bearer\s+|KUBECONFIG=)\S+`)
+)
+
+// redactCommandLine returns a copy of argv safe to show in session responses:
+// values of sensitive flags, bearer tokens and KUBECONFIG assignments are replaced
+func redactCommandLine(argv []string) []string {
+	out := make([]string, len(argv))
+	for i, arg := range argv {
+		if i > 0 && sensitiveFlags[argv[i-1]] {
+			out[i] = redactedValue
+			continue
+		}
+		if strings.HasPrefix(arg, "-") || strings.ContainsAny(arg, " =") {
+			arg = inlineSensitiveFlagRe.ReplaceAllString(arg, "${1}${2}"+redactedValue)
+			arg = inlineSecretRe.ReplaceAllString(arg, "${1}"+redactedValue)
+		}
+		out[i] = arg
+	}
+	return out
+}
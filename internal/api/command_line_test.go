@@ -0,0 +1,82 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/session"
+)
+
+func TestRedactCommandLine(t *testing.T) {
+	tests := []struct {
+		name string
+		argv []string
+		want []string
+	}{
+		{
+			name: "plain kubectl",
+			argv: []string{"/usr/bin/kubectl", "port-forward", "svc/web", "8080:80", "-n", "default", "--context", "prod"},
+			want: []string{"/usr/bin/kubectl", "port-forward", "svc/web", "8080:80", "-n", "default", "--context", "prod"},
+		},
+		{
+			name: "separate flag values",
+			argv: []string{"kubectl", "get", "pods", "--token", "s3cr3t", "--kubeconfig", "/tmp/kc.yaml"},
+			want: []string{"kubectl", "get", "pods", "--token", redactedValue, "--kubeconfig", redactedValue},
+		},
+		{
+			name: "inline flag values",
+			argv: []string{"kubectl", "get", "pods", "--password=hunter2", "--client-key=/keys/me.key"},
+			want: []string{"kubectl", "get", "pods", "--password=" + redactedValue, "--client-key=" + redactedValue},
+		},
+		{
+			name: "shell script",
+			argv: []string{"/bin/bash", "-c", `KUBECONFIG=/tmp/kc kubectl --token abc get pods && curl -H "Authorization: Bearer xyz" http://x`},
+			want: []string{"/bin/bash", "-c", `KUBECONFIG=` + redactedValue + ` kubectl --token ` + redactedValue + ` get pods && curl -H "Authorization: Bearer ` + redactedValue + ` http://x`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactCommandLine(tt.argv); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("redactCommandLine() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShellList_CommandLine(t *testing.T) {
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	handler := &ShellHandler{sessionMgr: sessionMgr}
+
+	body, _ := json.Marshal(ShellStartRequest{Command: "echo --token=s3cr3t"})
+	rec := httptest.NewRecorder()
+	handler.Start(rec, httptest.NewRequest(http.MethodPost, "/shell/start", strings.NewReader(string(body))))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var start ShellStartResponse
+	if err := json.NewDecoder(rec.Body).Decode(&start); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	waitShellStopped(t, handler, start.SessionID)
+
+	rec = httptest.NewRecorder()
+	handler.List(rec, httptest.NewRequest(http.MethodGet, "/shell/list", nil))
+	var list struct {
+		Sessions []struct {
+			CommandLine []string `json:"commandLine"`
+		} `json:"sessions"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+		t.Fatalf("Failed to decode list: %v", err)
+	}
+	want := []string{"/bin/bash", "-c", "echo --token=" + redactedValue}
+	if len(list.Sessions) != 1 || !reflect.DeepEqual(list.Sessions[0].CommandLine, want) {
+		t.Errorf("sessions = %+v, want commandLine %q", list.Sessions, want)
+	}
+}
@@ -0,0 +1,336 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/cluster"
+	"github.com/kubedeskpro/kubedesk-helper/internal/env"
+	"github.com/kubedeskpro/kubedesk-helper/internal/kubeconfig"
+	"github.com/kubedeskpro/kubedesk-helper/internal/kubectl"
+	"github.com/kubedeskpro/kubedesk-helper/internal/logging"
+)
+
+// ConfigHandler handles read-only kubeconfig inspection endpoints
+type ConfigHandler struct{}
+
+// maxConfigRequestBody bounds request bodies carrying an inline kubeconfig
+const maxConfigRequestBody = kubeconfig.MaxSize + 64<<10
+
+// ConfigContextsRequest represents a request to list the contexts in a kubeconfig
+type ConfigContextsRequest struct {
+	Kubeconfig     string `json:"kubeconfig,omitempty"`     // Inline kubeconfig content
+	KubeconfigPath string `json:"kubeconfigPath,omitempty"` // Absolute path to a kubeconfig file on disk
+}
+
+// ConfigContextInfo describes one context in a kubeconfig
+type ConfigContextInfo struct {
+	Name      string `json:"name"`
+	Cluster   string `json:"cluster"`
+	User      string `json:"user"`
+	Namespace string `json:"namespace,omitempty"`
+	Server    string `json:"server,omitempty"`
+	Current   bool   `json:"current"`
+}
+
+// ConfigContextsResponse represents the contexts in a kubeconfig
+type ConfigContextsResponse struct {
+	CurrentContext string              `json:"currentContext"`
+	Contexts       []ConfigContextInfo `json:"contexts"`
+}
+
+// Contexts handles POST /config/contexts
+// Parses the kubeconfig and returns its contexts without running kubectl or a shell
+func (h *ConfigHandler) Contexts(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxConfigRequestBody)
+
+	var req ConfigContextsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("Failed to decode config contexts request", "error", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	cfg, status, msg := loadRequestKubeconfig(req.Kubeconfig, req.KubeconfigPath)
+	if cfg == nil {
+		http.Error(w, msg, status)
+		return
+	}
+
+	contexts := make([]ConfigContextInfo, 0, len(cfg.Contexts))
+	for _, c := range cfg.Contexts {
+		info := ConfigContextInfo{
+			Name:      c.Name,
+			Cluster:   c.Context.Cluster,
+			User:      c.Context.User,
+			Namespace: c.Context.Namespace,
+			Current:   c.Name == cfg.CurrentContext,
+		}
+		if cl, ok := cfg.FindCluster(c.Context.Cluster); ok {
+			info.Server = cl.Cluster.Server
+		}
+		contexts = append(contexts, info)
+	}
+
+	logger.Debug("Listed kubeconfig contexts", "contexts", len(contexts), "fromPath", req.KubeconfigPath != "")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ConfigContextsResponse{
+		CurrentContext: cfg.CurrentContext,
+		Contexts:       contexts,
+	})
+}
+
+// checkKubeconfigSource verifies exactly one of inline content or an absolute path was provided
+// Returns an empty string when the input is acceptable
+func checkKubeconfigSource(content, path string) string {
+	switch {
+	case content != "" && path != "":
+		return "Provide either kubeconfig or kubeconfigPath, not both"
+	case content == "" && path == "":
+		return "kubeconfig or kubeconfigPath is required"
+	case path != "" && !filepath.IsAbs(path):
+		return "kubeconfigPath must be an absolute path"
+	}
+	return ""
+}
+
+// loadKubeconfigPath reads the kubeconfig file named by path into *content
+// The content is used for hashing and the registry, so a path and the same config sent
+// inline map to the same cluster hash; kubectl itself is pointed at the file in place
+// Returns a non-zero HTTP status and message if the path is unusable
+func loadKubeconfigPath(content *string, path string) (int, string) {
+	if path == "" {
+		return 0, ""
+	}
+	if msg := checkKubeconfigSource(*content, path); msg != "" {
+		return http.StatusBadRequest, msg
+	}
+
+	data, err := kubeconfig.ReadFile(path)
+	if err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	*content = string(data)
+	return 0, ""
+}
+
+// resolvedKubeconfig names the kubeconfig kubectl reads for a request, for responses and logs:
+// the request's kubeconfigPath, or the default kubeconfig if none was sent
+// Returns "" for inline content, which kubectl reads from a private temp copy
+func resolvedKubeconfig(content, path string) string {
+	switch {
+	case path != "":
+		return path
+	case content != "":
+		return ""
+	default:
+		return env.DefaultKubeconfig()
+	}
+}
+
+// loadRequestKubeconfig parses an inline kubeconfig or one referenced by path
+// Returns (nil, status, message) when the input is missing or invalid
+func loadRequestKubeconfig(content, path string) (*kubeconfig.Config, int, string) {
+	if msg := checkKubeconfigSource(content, path); msg != "" {
+		return nil, http.StatusBadRequest, msg
+	}
+
+	var cfg *kubeconfig.Config
+	var err error
+	if content != "" {
+		cfg, err = kubeconfig.Parse([]byte(content))
+	} else {
+		cfg, err = kubeconfig.LoadFile(path)
+	}
+	if err != nil {
+		return nil, http.StatusBadRequest, err.Error()
+	}
+	return cfg, http.StatusOK, ""
+}
+
+// clusterCheckTimeout bounds the reachability probe in /config/validate
+const clusterCheckTimeout = 10 * time.Second
+
+// Validation error kinds returned by /config/validate
+const (
+	validationErrorParse           = "parse"
+	validationErrorContextNotFound = "context_not_found"
+	validationErrorUnreachable     = "unreachable"
+	validationErrorAuth            = "auth"
+	validationErrorTimeout         = "timeout"
+	validationErrorUnknown         = "unknown"
+)
+
+// ConfigValidateRequest represents a kubeconfig validation request
+type ConfigValidateRequest struct {
+	Kubeconfig       string `json:"kubeconfig,omitempty"`       // Inline kubeconfig content
+	KubeconfigPath   string `json:"kubeconfigPath,omitempty"`   // Absolute path to a kubeconfig file on disk
+	Context          string `json:"context,omitempty"`          // Defaults to the kubeconfig's current-context
+	SkipReachability bool   `json:"skipReachability,omitempty"` // Only parse; don't contact the cluster
+}
+
+// ConfigValidationError describes why validation failed
+type ConfigValidationError struct {
+	Kind    string `json:"kind"` // parse, context_not_found, unreachable, auth, timeout, unknown
+	Message string `json:"message"`
+}
+
+// ConfigValidateResponse represents the result of validating a kubeconfig
+type ConfigValidateResponse struct {
+	Valid         bool                   `json:"valid"`  // Parsed, context exists, and (unless skipped) reachable
+	Parsed        bool                   `json:"parsed"` // Kubeconfig parsed successfully
+	Context       string                 `json:"context,omitempty"`
+	Server        string                 `json:"server,omitempty"`
+	Reachable     bool                   `json:"reachable"`
+	ServerVersion string                 `json:"serverVersion,omitempty"`
+	Error         *ConfigValidationError `json:"error,omitempty"`
+}
+
+// Validate handles POST /config/validate
+// Parses the kubeconfig, checks the context exists and optionally probes the API server
+func (h *ConfigHandler) Validate(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxConfigRequestBody)
+
+	var req ConfigValidateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("Failed to decode config validate request", "error", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Missing input is a client error; a kubeconfig that doesn't parse is a validation result
+	if msg := checkKubeconfigSource(req.Kubeconfig, req.KubeconfigPath); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	cfg, _, msg := loadRequestKubeconfig(req.Kubeconfig, req.KubeconfigPath)
+	if cfg == nil {
+		writeValidateResponse(w, ConfigValidateResponse{
+			Error: &ConfigValidationError{Kind: validationErrorParse, Message: msg},
+		})
+		return
+	}
+
+	resp := ConfigValidateResponse{Parsed: true, Context: req.Context}
+	if resp.Context == "" {
+		resp.Context = cfg.CurrentContext
+	}
+
+	ctxEntry, ok := cfg.FindContext(resp.Context)
+	if !ok {
+		message := "kubeconfig has no current-context and no context was provided"
+		if resp.Context != "" {
+			message = fmt.Sprintf("context %q not found in kubeconfig", resp.Context)
+		}
+		resp.Error = &ConfigValidationError{Kind: validationErrorContextNotFound, Message: message}
+		writeValidateResponse(w, resp)
+		return
+	}
+	if cl, ok := cfg.FindCluster(ctxEntry.Context.Cluster); ok {
+		resp.Server = cl.Cluster.Server
+	}
+
+	if req.SkipReachability {
+		resp.Valid = true
+		writeValidateResponse(w, resp)
+		return
+	}
+
+	// Probe the API server using the same executor plumbing as /kubectl
+	kubeconfigPath := req.KubeconfigPath
+	if req.Kubeconfig != "" {
+		tmpFile, release, err := kubeconfig.GetTempManager().Acquire(cluster.ComputeHash(req.Kubeconfig, resp.Context), req.Kubeconfig)
+		if err != nil {
+			logger.Error("Failed to write kubeconfig for validation", "error", err)
+			http.Error(w, "Failed to write kubeconfig", http.StatusInternalServerError)
+			return
+		}
+		defer release()
+		kubeconfigPath = tmpFile
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), clusterCheckTimeout)
+	defer cancel()
+
+	args := []string{"version", "-o", "json", "--request-timeout", "5s"}
+	result, err := kubectl.ExecuteWithKubeconfigFile(ctx, args, kubeconfigPath, resp.Context)
+	if err != nil {
+		logger.Error("Failed to run kubectl for validation", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if version := parseServerVersion(result.Stdout); version != "" {
+		resp.Reachable = true
+		resp.ServerVersion = version
+		resp.Valid = true
+	} else if ctx.Err() == context.DeadlineExceeded {
+		resp.Error = &ConfigValidationError{Kind: validationErrorTimeout, Message: "Timed out contacting the API server"}
+	} else {
+		resp.Error = &ConfigValidationError{
+			Kind:    classifyConnectionError(result.Stderr),
+			Message: strings.TrimSpace(result.Stderr),
+		}
+	}
+
+	logger.Info("Validated kubeconfig",
+		"context", resp.Context,
+		"reachable", resp.Reachable,
+		"serverVersion", resp.ServerVersion,
+	)
+	writeValidateResponse(w, resp)
+}
+
+// writeValidateResponse writes a validation result; validation failures are still 200 responses
+func writeValidateResponse(w http.ResponseWriter, resp ConfigValidateResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// parseServerVersion extracts serverVersion.gitVersion from `kubectl version -o json` output
+func parseServerVersion(stdout string) string {
+	var out struct {
+		ServerVersion *struct {
+			GitVersion string `json:"gitVersion"`
+		} `json:"serverVersion"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &out); err != nil || out.ServerVersion == nil {
+		return ""
+	}
+	return out.ServerVersion.GitVersion
+}
+
+// classifyConnectionError maps kubectl stderr from a failed API call to a validation error kind
+func classifyConnectionError(stderr string) string {
+	lower := strings.ToLower(stderr)
+	switch {
+	case strings.Contains(lower, "unauthorized"),
+		strings.Contains(lower, "you must be logged in"),
+		strings.Contains(lower, "forbidden"),
+		strings.Contains(lower, "getting credentials"),
+		strings.Contains(lower, "x509"):
+		return validationErrorAuth
+	case strings.Contains(lower, "timeout"),
+		strings.Contains(lower, "deadline exceeded"):
+		return validationErrorTimeout
+	case strings.Contains(lower, "unable to connect"),
+		strings.Contains(lower, "connection refused"),
+		strings.Contains(lower, "no such host"),
+		strings.Contains(lower, "no route to host"),
+		strings.Contains(lower, "eof"):
+		return validationErrorUnreachable
+	default:
+		return validationErrorUnknown
+	}
+}
@@ -0,0 +1,154 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testKubeconfigYAML = `apiVersion: v1
+kind: Config
+current-context: dev
+clusters:
+- name: dev-cluster
+  cluster:
+    server: https://dev.example.com
+contexts:
+- name: dev
+  context:
+    cluster: dev-cluster
+    user: dev-user
+    namespace: team-a
+- name: prod
+  context:
+    cluster: prod-cluster
+    user: prod-user
+`
+
+func TestConfigContexts(t *testing.T) {
+	handler := &ConfigHandler{}
+
+	body, _ := json.Marshal(ConfigContextsRequest{Kubeconfig: testKubeconfigYAML})
+	req := httptest.NewRequest(http.MethodPost, "/config/contexts", strings.NewReader(string(body)))
+	rec := httptest.NewRecorder()
+	handler.Contexts(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+
+	var resp ConfigContextsResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.CurrentContext != "dev" {
+		t.Errorf("CurrentContext = %q, want dev", resp.CurrentContext)
+	}
+	if len(resp.Contexts) != 2 {
+		t.Fatalf("got %d contexts, want 2", len(resp.Contexts))
+	}
+
+	dev := resp.Contexts[0]
+	if dev.Name != "dev" || !dev.Current || dev.Namespace != "team-a" || dev.Server != "https://dev.example.com" {
+		t.Errorf("unexpected dev context: %+v", dev)
+	}
+	prod := resp.Contexts[1]
+	if prod.Name != "prod" || prod.Current || prod.Server != "" {
+		t.Errorf("unexpected prod context: %+v", prod)
+	}
+}
+
+func TestConfigContexts_InvalidInput(t *testing.T) {
+	handler := &ConfigHandler{}
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "Nothing provided", body: `{}`},
+		{name: "Both provided", body: `{"kubeconfig":"a: b","kubeconfigPath":"/tmp/config"}`},
+		{name: "Relative path", body: `{"kubeconfigPath":"config"}`},
+		{name: "Missing file", body: `{"kubeconfigPath":"/nonexistent/kubeconfig"}`},
+		{name: "Malformed kubeconfig", body: `{"kubeconfig":"contexts: [unterminated"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/config/contexts", strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			handler.Contexts(rec, req)
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+func validateConfig(t *testing.T, req ConfigValidateRequest) ConfigValidateResponse {
+	t.Helper()
+
+	body, _ := json.Marshal(req)
+	rec := httptest.NewRecorder()
+	(&ConfigHandler{}).Validate(rec, httptest.NewRequest(http.MethodPost, "/config/validate", strings.NewReader(string(body))))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+
+	var resp ConfigValidateResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return resp
+}
+
+func TestConfigValidate(t *testing.T) {
+	t.Run("Parse error", func(t *testing.T) {
+		resp := validateConfig(t, ConfigValidateRequest{Kubeconfig: "contexts: [unterminated"})
+		if resp.Valid || resp.Parsed || resp.Error == nil || resp.Error.Kind != validationErrorParse {
+			t.Errorf("unexpected response: %+v", resp)
+		}
+	})
+
+	t.Run("Context not found", func(t *testing.T) {
+		resp := validateConfig(t, ConfigValidateRequest{Kubeconfig: testKubeconfigYAML, Context: "staging"})
+		if resp.Valid || !resp.Parsed || resp.Error == nil || resp.Error.Kind != validationErrorContextNotFound {
+			t.Errorf("unexpected response: %+v", resp)
+		}
+	})
+
+	t.Run("Parse only", func(t *testing.T) {
+		resp := validateConfig(t, ConfigValidateRequest{Kubeconfig: testKubeconfigYAML, SkipReachability: true})
+		if !resp.Valid || resp.Context != "dev" || resp.Server != "https://dev.example.com" || resp.Reachable {
+			t.Errorf("unexpected response: %+v", resp)
+		}
+	})
+
+	t.Run("Reachable", func(t *testing.T) {
+		installFakeKubectl(t, `echo '{"clientVersion":{"gitVersion":"v1.30.0"},"serverVersion":{"gitVersion":"v1.29.4"}}'`)
+		resp := validateConfig(t, ConfigValidateRequest{Kubeconfig: testKubeconfigYAML, Context: "prod"})
+		if !resp.Valid || !resp.Reachable || resp.ServerVersion != "v1.29.4" {
+			t.Errorf("unexpected response: %+v", resp)
+		}
+	})
+
+	t.Run("Auth failure", func(t *testing.T) {
+		installFakeKubectl(t, `echo '{"clientVersion":{"gitVersion":"v1.30.0"}}'
+echo 'error: You must be logged in to the server (Unauthorized)' >&2
+exit 1`)
+		resp := validateConfig(t, ConfigValidateRequest{Kubeconfig: testKubeconfigYAML})
+		if resp.Valid || resp.Reachable || resp.Error == nil || resp.Error.Kind != validationErrorAuth {
+			t.Errorf("unexpected response: %+v", resp)
+		}
+	})
+
+	t.Run("Unreachable", func(t *testing.T) {
+		installFakeKubectl(t, `echo 'Unable to connect to the server: dial tcp: lookup dev.example.com: no such host' >&2
+exit 1`)
+		resp := validateConfig(t, ConfigValidateRequest{Kubeconfig: testKubeconfigYAML})
+		if resp.Valid || resp.Error == nil || resp.Error.Kind != validationErrorUnreachable {
+			t.Errorf("unexpected response: %+v", resp)
+		}
+	})
+}
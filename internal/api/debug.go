@@ -0,0 +1,73 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/session"
+)
+
+// DebugHandler serves internal state dumps for support bundles
+// Every endpoint requires "Authorization: Bearer <HELPER_DEBUG_TOKEN>" and is hidden when no token is set
+type DebugHandler struct {
+	sessionMgr *session.Manager
+	token      string
+}
+
+// DebugSessionsResponse is the GET /debug/sessions dump
+type DebugSessionsResponse struct {
+	GeneratedAt time.Time            `json:"generatedAt"`
+	Manager     DebugManagerSettings `json:"manager"`
+	Sessions    []session.DebugInfo  `json:"sessions"`
+}
+
+// DebugManagerSettings are the session manager's limits; durations as Go duration strings (e.g. "30m0s")
+type DebugManagerSettings struct {
+	InactivityTimeout string `json:"inactivityTimeout"`
+	CompletedTimeout  string `json:"completedTimeout"`
+	CleanupInterval   string `json:"cleanupInterval"`
+	DrainTimeout      string `json:"drainTimeout"`
+	MaxSessions       int    `json:"maxSessions"` // 0 = unlimited
+}
+
+// authorized checks the bearer token; a 404 when debugging is disabled keeps the endpoint invisible
+func (h *DebugHandler) authorized(w http.ResponseWriter, r *http.Request) bool {
+	if h.token == "" {
+		http.NotFound(w, r)
+		return false
+	}
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(h.token)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// Sessions handles GET /debug/sessions
+// Kubeconfig content is never included, and command lines are the redacted copies kept on each session
+func (h *DebugHandler) Sessions(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(w, r) {
+		return
+	}
+
+	settings := h.sessionMgr.Settings()
+	sessions := h.sessionMgr.DebugSnapshot()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(DebugSessionsResponse{
+		GeneratedAt: time.Now(),
+		Manager: DebugManagerSettings{
+			InactivityTimeout: settings.InactivityTimeout.String(),
+			CompletedTimeout:  settings.CompletedTimeout.String(),
+			CleanupInterval:   settings.CleanupInterval.String(),
+			DrainTimeout:      settings.DrainTimeout.String(),
+			MaxSessions:       settings.MaxSessions,
+		},
+		Sessions: sessions,
+	})
+}
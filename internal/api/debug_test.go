@@ -0,0 +1,83 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/session"
+)
+
+func TestDebugSessions_Auth(t *testing.T) {
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+
+	tests := []struct {
+		name   string
+		token  string
+		header string
+		want   int
+	}{
+		{"disabled", "", "Bearer anything", http.StatusNotFound},
+		{"missing header", "s3cr3t", "", http.StatusUnauthorized},
+		{"wrong token", "s3cr3t", "Bearer nope", http.StatusUnauthorized},
+		{"not bearer", "s3cr3t", "Basic s3cr3t", http.StatusUnauthorized},
+		{"ok", "s3cr3t", "Bearer s3cr3t", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := &DebugHandler{sessionMgr: sessionMgr, token: tt.token}
+			req := httptest.NewRequest(http.MethodGet, "/debug/sessions", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.Sessions(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestDebugSessions_Dump(t *testing.T) {
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	sessionMgr.SetMaxSessions(7)
+
+	sess, err := sessionMgr.CreateForCluster(session.TypeProxy, "abc123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess.Context = "prod"
+	sess.Port = 8001
+	sess.SetKubeconfig("users: [{user: {token: very-secret}}]")
+	sess.CommandLine = redactCommandLine([]string{"kubectl", "proxy", "--token", "very-secret"})
+
+	handler := &DebugHandler{sessionMgr: sessionMgr, token: "s3cr3t"}
+	req := httptest.NewRequest(http.MethodGet, "/debug/sessions", nil)
+	req.Header.Set("Authorization", "Bearer s3cr3t")
+	rec := httptest.NewRecorder()
+	handler.Sessions(rec, req)
+
+	if strings.Contains(rec.Body.String(), "very-secret") {
+		t.Fatalf("dump leaks a secret: %s", rec.Body.String())
+	}
+	var resp DebugSessionsResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Manager.MaxSessions != 7 || resp.Manager.InactivityTimeout != "30m0s" {
+		t.Errorf("manager = %+v", resp.Manager)
+	}
+	if len(resp.Sessions) != 1 {
+		t.Fatalf("got %d sessions, want 1", len(resp.Sessions))
+	}
+	got := resp.Sessions[0]
+	if got.ID != sess.ID || got.Type != session.TypeProxy || got.Status != session.StatusRunning ||
+		got.ClusterHash != "abc123" || got.Context != "prod" || got.Port != 8001 || !got.HasKubeconfig {
+		t.Errorf("session = %+v", got)
+	}
+}
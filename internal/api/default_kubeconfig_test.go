@@ -0,0 +1,158 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/cluster"
+	"github.com/kubedeskpro/kubedesk-helper/internal/config"
+	"github.com/kubedeskpro/kubedesk-helper/internal/env"
+	"github.com/kubedeskpro/kubedesk-helper/internal/session"
+)
+
+// defaultKubeconfigEnv is the KUBECONFIG commands get when the request carries no kubeconfig
+func defaultKubeconfigEnv() string {
+	for _, e := range env.GetShellEnvironment() {
+		if v, ok := strings.CutPrefix(e, "KUBECONFIG="); ok {
+			return v
+		}
+	}
+	return ""
+}
+
+// TestContextOnly_UsesDefaultKubeconfig checks that requests naming only a context run against
+// the user's default kubeconfig with --context, write no temp kubeconfig, and get a hash of
+// their own that never matches a cluster sent with kubeconfig content
+func TestContextOnly_UsesDefaultKubeconfig(t *testing.T) {
+	calls := filepath.Join(t.TempDir(), "calls")
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	defer sessionMgr.StopAll()
+	router := NewRouter("test", sessionMgr, config.Default())
+
+	const kubeContext = "default-ctx"
+	wantHash := cluster.ComputeHash("", kubeContext)
+	if wantHash == cluster.ComputeHash(testKubeconfigYAML, kubeContext) {
+		t.Fatal("context-only hash collides with the kubeconfig hash for the same context")
+	}
+	wantEnv := "KUBECONFIG=" + defaultKubeconfigEnv() + " "
+
+	tests := []struct {
+		name    string
+		path    string
+		body    string
+		session bool // kubectl keeps running until the session is stopped
+	}{
+		{"exec", "/exec", `{"namespace":"default","podName":"web","container":"app","command":["ls"],"context":"` + kubeContext + `"}`, false},
+		{"exec start", "/exec/start", `{"namespace":"default","podName":"web","container":"app","command":["sh"],"context":"` + kubeContext + `"}`, true},
+		{"port-forward", "/port-forward/start", `{"namespace":"default","resourceType":"service","resourceName":"web","servicePort":"80","localPort":"18080","context":"` + kubeContext + `"}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script := `echo "KUBECONFIG=$KUBECONFIG ARGS=$*" >> '` + calls + `'
+[ "$1" = get ] && { echo '{}'; exit 0; }
+`
+			if tt.session {
+				script += "exec sleep 30\n"
+			}
+			installFakeKubectl(t, script)
+			os.Remove(calls)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body)))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+			}
+
+			// Session endpoints start kubectl in the background
+			var got string
+			for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+				if data, _ := os.ReadFile(calls); len(data) > 0 {
+					got = string(data)
+					break
+				}
+			}
+			if !strings.HasPrefix(got, wantEnv) {
+				t.Errorf("kubectl ran with %q, want the default %q", got, wantEnv)
+			}
+			if !strings.Contains(got, "--context "+kubeContext) {
+				t.Errorf("kubectl args missing --context: %q", got)
+			}
+
+			kc, ctx, found := cluster.GetRegistry().Lookup(wantHash)
+			if !found || kc != "" || ctx != kubeContext {
+				t.Errorf("registry entry = (%q, %q, %v), want context-only", kc, ctx, found)
+			}
+		})
+	}
+
+	t.Run("shell run", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		body := `{"command":"echo KUBECONFIG=$KUBECONFIG","context":"` + kubeContext + `"}`
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/shell/run", strings.NewReader(body)))
+		var resp ShellRunResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if resp.ClusterHash != wantHash {
+			t.Errorf("clusterHash = %q, want %q", resp.ClusterHash, wantHash)
+		}
+		if strings.TrimSpace(resp.Stdout) != strings.TrimSpace(wantEnv) {
+			t.Errorf("shell saw %q, want the default %q", resp.Stdout, wantEnv)
+		}
+	})
+}
+
+func TestResolvedKubeconfig(t *testing.T) {
+	if got := resolvedKubeconfig(testKubeconfigYAML, "/Users/me/.kube/prod.yaml"); got != "/Users/me/.kube/prod.yaml" {
+		t.Errorf("with path: got %q", got)
+	}
+	if got := resolvedKubeconfig(testKubeconfigYAML, ""); got != "" {
+		t.Errorf("inline: got %q, want empty", got)
+	}
+	want := env.DefaultKubeconfig()
+	if want == "" {
+		t.Fatal("DefaultKubeconfig is empty; expected KUBECONFIG or ~/.kube/config")
+	}
+	if got := resolvedKubeconfig("", ""); got != want {
+		t.Errorf("default: got %q, want %q", got, want)
+	}
+	if got := defaultKubeconfigEnv(); got != want {
+		t.Errorf("commands get KUBECONFIG=%q, want %q", got, want)
+	}
+}
+
+func TestExecute_ReportsKubeconfigPath(t *testing.T) {
+	installFakeKubectl(t, `echo ok`)
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	handler := &ExecHandler{sessionMgr: sessionMgr}
+
+	for _, tt := range []struct {
+		name string
+		req  ExecRequest
+		want string
+	}{
+		{"context only", ExecRequest{Context: "default-ctx"}, env.DefaultKubeconfig()},
+		{"inline", ExecRequest{Kubeconfig: testKubeconfigYAML, Context: "prod"}, ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.req.Namespace, tt.req.PodName, tt.req.Container, tt.req.Command = "default", "web", "app", []string{"ls"}
+			body, _ := json.Marshal(tt.req)
+			rec := httptest.NewRecorder()
+			handler.Execute(rec, httptest.NewRequest(http.MethodPost, "/exec", strings.NewReader(string(body))))
+			var resp ExecResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if resp.KubeconfigPath != tt.want {
+				t.Errorf("kubeconfigPath = %q, want %q", resp.KubeconfigPath, tt.want)
+			}
+		})
+	}
+}
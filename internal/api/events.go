@@ -0,0 +1,81 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/logging"
+	"github.com/kubedeskpro/kubedesk-helper/internal/session"
+)
+
+// eventsKeepaliveInterval keeps idle SSE connections from being dropped by intermediaries
+const eventsKeepaliveInterval = 15 * time.Second
+
+// EventsHandler streams session lifecycle events
+type EventsHandler struct {
+	sessionMgr *session.Manager
+}
+
+// Stream handles GET /events as a Server-Sent Events feed
+// Optional ?clusterHash= limits the feed to one cluster's sessions
+func (h *EventsHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	r, endStream := withStreamShutdown(r)
+	defer endStream()
+	logger := logging.FromContext(r.Context())
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// CRITICAL: The server's write timeout would otherwise cut the stream
+	clearWriteDeadline(logger, w)
+
+	clusterHash := r.URL.Query().Get("clusterHash")
+
+	events, cancel := h.sessionMgr.Subscribe()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	logger.Info("Event stream opened", "clusterHash", clusterHash)
+	defer logger.Info("Event stream closed", "clusterHash", clusterHash)
+
+	keepalive := time.NewTicker(eventsKeepaliveInterval)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if clusterHash != "" && event.ClusterHash != clusterHash {
+				continue
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				logger.Error("Failed to encode session event", "error", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Kind, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -1,23 +1,35 @@
 package api
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
-	"os"
 	"os/exec"
-	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/kubedeskpro/kubedesk-helper/internal/childproc"
 	"github.com/kubedeskpro/kubedesk-helper/internal/cluster"
 	"github.com/kubedeskpro/kubedesk-helper/internal/env"
+	"github.com/kubedeskpro/kubedesk-helper/internal/kubeconfig"
+	"github.com/kubedeskpro/kubedesk-helper/internal/kubectl"
+	"github.com/kubedeskpro/kubedesk-helper/internal/logging"
+	"github.com/kubedeskpro/kubedesk-helper/internal/metrics"
 	"github.com/kubedeskpro/kubedesk-helper/internal/session"
 )
 
+// execOutputWaitDelay bounds how long an exec session waits for output after kubectl exits
+// A var so tests can shorten it
+var execOutputWaitDelay = 2 * time.Second
+
 // ExecHandler handles exec session endpoints
 type ExecHandler struct {
 	sessionMgr *session.Manager
@@ -25,39 +37,68 @@ type ExecHandler struct {
 
 // ExecRequest represents a synchronous exec request
 type ExecRequest struct {
-	Namespace   string   `json:"namespace"`
-	PodName     string   `json:"podName"`
-	Container   string   `json:"container,omitempty"`
-	Command     []string `json:"command"`
-	Kubeconfig  string   `json:"kubeconfig,omitempty"`
-	Context     string   `json:"context,omitempty"`
-	ClusterHash string   `json:"clusterHash,omitempty"` // Optional: computed by helper if not provided
-	Timeout     int      `json:"timeout,omitempty"`     // Optional: max seconds to wait (default: 300)
+	Namespace      string   `json:"namespace"`
+	PodName        string   `json:"podName"`
+	Container      string   `json:"container,omitempty"`
+	Command        []string `json:"command"`
+	Kubeconfig     string   `json:"kubeconfig,omitempty"`
+	KubeconfigPath string   `json:"kubeconfigPath,omitempty"` // Absolute path to a kubeconfig on disk, used in place
+	Context        string   `json:"context,omitempty"`
+	ClusterHash    string   `json:"clusterHash,omitempty"` // Optional: computed by helper if not provided
+	Timeout        int      `json:"timeout,omitempty"`     // Optional: max seconds to wait (default: 300)
+	Retries        int      `json:"retries,omitempty"`     // Optional: retries on transient connection/auth failures (default: 0, max: 5)
+
+	kubectl.Impersonation // Optional: as, asGroup, asUid
+
+	GlobalFlags []string `json:"globalFlags,omitempty"` // Optional: allow-listed kubectl global flags, e.g. "--v=6"
+
+	// Optional: stream the output as it arrives (chunked), with the rest of the response as
+	// trailers; see execStream
+	Stream bool `json:"stream,omitempty"`
 }
 
 // ExecResponse represents a synchronous exec response
 type ExecResponse struct {
-	Output   string  `json:"output"`
-	ExitCode int32   `json:"exitCode"`
-	Duration float64 `json:"duration"` // Seconds
-	Error    string  `json:"error,omitempty"`
+	Output    string  `json:"output"`
+	ExitCode  int32   `json:"exitCode"`
+	Duration  float64 `json:"duration"` // Seconds
+	Error     string  `json:"error,omitempty"`
+	ErrorKind string  `json:"errorKind,omitempty"` // Why kubectl couldn't run the command, e.g. "podNotFound"; see classifyExecError
+	Attempts  int     `json:"attempts,omitempty"`  // Times kubectl exec was run (more than 1 if retried)
+	Truncated bool    `json:"truncated,omitempty"` // Output exceeded MAX_OUTPUT_BYTES; the command was killed
+	Encoding  string  `json:"encoding,omitempty"`  // "base64" if output wasn't valid UTF-8 and is base64-encoded
+
+	KubeconfigPath string `json:"kubeconfigPath,omitempty"` // Kubeconfig used: the request's path or the default; omitted for inline kubeconfigs
+
+	VersionSkew string `json:"versionSkew,omitempty"` // Set if kubectl is more than one minor version from the cluster (KUBECTL_VERSION_CHECK)
 }
 
 // ExecStartRequest represents an exec start request (legacy session-based API)
 type ExecStartRequest struct {
-	Namespace   string   `json:"namespace"`
-	PodName     string   `json:"podName"`
-	Container   string   `json:"container,omitempty"`
-	Command     []string `json:"command"`
-	Kubeconfig  string   `json:"kubeconfig,omitempty"`
-	Context     string   `json:"context,omitempty"`
-	ClusterHash string   `json:"clusterHash,omitempty"` // Optional: computed by helper if not provided
+	Namespace      string   `json:"namespace"`
+	PodName        string   `json:"podName"`
+	Container      string   `json:"container,omitempty"`
+	Command        []string `json:"command"`
+	Kubeconfig     string   `json:"kubeconfig,omitempty"`
+	KubeconfigPath string   `json:"kubeconfigPath,omitempty"` // Absolute path to a kubeconfig on disk, used in place
+	Context        string   `json:"context,omitempty"`
+	ClusterHash    string   `json:"clusterHash,omitempty"` // Optional: computed by helper if not provided
+	EchoInput      bool     `json:"echoInput,omitempty"`   // Also write input to the output buffer, for a transcript of what was typed
+
+	// Optional: seconds to wait for the first output; if kubectl has printed nothing and not exited
+	// by then (e.g. it hangs opening the stream), the session is failed and killed. 0 = no deadline
+	StartTimeout int `json:"startTimeout,omitempty"`
+
+	kubectl.Impersonation // Optional: as, asGroup, asUid
+
+	GlobalFlags []string `json:"globalFlags,omitempty"` // Optional: allow-listed kubectl global flags, e.g. "--v=6"
 }
 
 // ExecStartResponse represents an exec start response
 type ExecStartResponse struct {
-	SessionID string `json:"sessionId"`
-	Status    string `json:"status"`
+	SessionID      string `json:"sessionId"`
+	Status         string `json:"status"`
+	KubeconfigPath string `json:"kubeconfigPath,omitempty"` // Kubeconfig used: the request's path or the default; omitted for inline kubeconfigs
 }
 
 // ExecInputRequest represents an exec input request
@@ -72,22 +113,81 @@ type ExecOutputResponse struct {
 	Timestamp string `json:"timestamp"`
 	Status    string `json:"status"`
 	ExitCode  *int32 `json:"exitCode,omitempty"` // Exit code of the command (nil if still running)
+	Error     string `json:"error,omitempty"`    // Why the session failed, e.g. it missed its startTimeout
+	Offset    int    `json:"offset"`             // Bytes of output returned; pass back as ?offset= with ?wait= to long-poll
+	Encoding  string `json:"encoding,omitempty"` // "base64" if output wasn't valid UTF-8 and is base64-encoded
+
+	BytesProduced int64 `json:"bytesProduced"` // Total bytes of output so far, including any no longer buffered
+}
+
+// checkExecCommand rejects a command kubectl would fail on confusingly, such as [""] or ["  ", ""]
+// Arguments after the first may be empty ("sh", "-c", ""); the program to run may not
+func checkExecCommand(command []string) error {
+	blank := 0
+	for _, arg := range command {
+		if strings.TrimSpace(arg) == "" {
+			blank++
+		}
+	}
+	if blank == len(command) {
+		return fmt.Errorf("command has only empty or whitespace elements")
+	}
+	if strings.TrimSpace(command[0]) == "" {
+		return fmt.Errorf("command[0] is empty; it must name the program to run")
+	}
+	return nil
 }
 
 // Execute handles POST /exec - synchronous exec (recommended)
 func (h *ExecHandler) Execute(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
 	startTime := time.Now()
 
 	var req ExecRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		slog.Error("Failed to decode exec request", "error", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		logger.Error("Failed to decode exec request", "error", err)
+		writeExecError(w, http.StatusBadRequest, startTime, "Invalid request body")
+		return
+	}
+	h.execute(w, r, req, startTime)
+}
+
+// execute validates and runs a synchronous exec request; shared by POST /exec and GET /exec/simple
+func (h *ExecHandler) execute(w http.ResponseWriter, r *http.Request, req ExecRequest, startTime time.Time) {
+	logger := logging.FromContext(r.Context())
+
+	// A kubeconfigPath is read only for hashing; kubectl uses the file in place
+	if status, msg := loadKubeconfigPath(&req.Kubeconfig, req.KubeconfigPath); status != 0 {
+		writeExecError(w, status, startTime, msg)
 		return
 	}
 
 	// Validate request
 	if req.Namespace == "" || req.PodName == "" || len(req.Command) == 0 {
-		http.Error(w, "Missing required fields: namespace, podName, command", http.StatusBadRequest)
+		writeExecError(w, http.StatusBadRequest, startTime, "Missing required fields: namespace, podName, command")
+		return
+	}
+	if err := checkExecCommand(req.Command); err != nil {
+		writeExecError(w, http.StatusBadRequest, startTime, fmt.Sprintf("Invalid command: %v", err))
+		return
+	}
+
+	if req.Retries < 0 || req.Retries > kubectl.MaxRetries {
+		writeExecError(w, http.StatusBadRequest, startTime, fmt.Sprintf("retries must be between 0 and %d", kubectl.MaxRetries))
+		return
+	}
+	if req.Stream && req.Retries > 0 {
+		// A retry would follow output the client has already been sent
+		writeExecError(w, http.StatusBadRequest, startTime, "retries can't be combined with stream")
+		return
+	}
+	if err := req.Impersonation.Validate(); err != nil {
+		writeExecError(w, http.StatusBadRequest, startTime, fmt.Sprintf("Invalid impersonation: %v", err))
+		return
+	}
+	if err := kubectl.ValidateGlobalFlags(req.GlobalFlags); err != nil {
+		writeExecError(w, http.StatusBadRequest, startTime, fmt.Sprintf("Invalid globalFlags: %v", err))
 		return
 	}
 
@@ -96,10 +196,28 @@ func (h *ExecHandler) Execute(w http.ResponseWriter, r *http.Request) {
 		req.Timeout = 300 // 5 minutes default
 	}
 
+	// If kubeconfig/context not provided, try to look up from registry
+	if !resolveHashOnly(logger, &req.Kubeconfig, &req.Context, req.ClusterHash) {
+		// Same recoverable error as every other handler, plus the usual ExecResponse fields
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(struct {
+			RegistryMissError
+			Output   string  `json:"output"`
+			ExitCode int32   `json:"exitCode"`
+			Duration float64 `json:"duration"`
+		}{RegistryMissError: newRegistryMissError(req.ClusterHash), ExitCode: -1, Duration: time.Since(startTime).Seconds()})
+		return
+	}
+	if err := checkKubeconfigContext(req.Kubeconfig, req.Context); err != nil {
+		writeExecError(w, http.StatusBadRequest, startTime, err.Error())
+		return
+	}
+
 	// Validate or compute cluster hash
 	if req.ClusterHash == "" {
 		req.ClusterHash = cluster.ComputeAndRegister(req.Kubeconfig, req.Context)
-		slog.Debug("Computed cluster hash for exec",
+		logger.Debug("Computed cluster hash for exec",
 			"clusterHash", req.ClusterHash,
 			"context", req.Context,
 		)
@@ -107,43 +225,52 @@ func (h *ExecHandler) Execute(w http.ResponseWriter, r *http.Request) {
 		// If hash is provided, VALIDATE it first before registering
 		expectedHash := cluster.ComputeHash(req.Kubeconfig, req.Context)
 		if req.ClusterHash != expectedHash {
-			slog.Error("Cluster hash mismatch - app sent wrong hash!",
+			logger.Error("Cluster hash mismatch - app sent wrong hash!",
 				"providedHash", req.ClusterHash,
 				"expectedHash", expectedHash,
 				"context", req.Context,
 			)
-			http.Error(w, fmt.Sprintf("Cluster hash mismatch: expected %s, got %s", expectedHash, req.ClusterHash), http.StatusBadRequest)
+			writeExecError(w, http.StatusBadRequest, startTime, fmt.Sprintf("Cluster hash mismatch: expected %s, got %s", expectedHash, req.ClusterHash))
 			return
 		}
 
 		// Hash is valid - register it
 		cluster.GetRegistry().Register(req.ClusterHash, req.Kubeconfig, req.Context)
-		slog.Info("Validated and registered cluster hash",
+		logger.Info("Validated and registered cluster hash",
 			"clusterHash", req.ClusterHash,
 			"context", req.Context,
 		)
 	}
 
+	// The command runs under req.Timeout, which may well exceed the server's write timeout
+	clearWriteDeadline(logger, w)
+
 	// Find kubectl
 	kubectlPath, err := exec.LookPath("kubectl")
 	if err != nil {
-		slog.Error("kubectl not found in PATH", "error", err)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(ExecResponse{
-			Output:   "",
-			ExitCode: -1,
-			Duration: time.Since(startTime).Seconds(),
-			Error:    "kubectl not found in PATH",
-		})
+		logger.Error("kubectl not found in PATH", "error", err)
+		writeExecError(w, http.StatusInternalServerError, startTime, "kubectl not found in PATH")
 		return
 	}
 
-	// Build kubectl exec command
-	args := []string{"exec", "-i"}
+	// Honor the pod's default-container annotation explicitly so exec is deterministic
+	if req.Container == "" {
+		if container := podDefaultContainer(r.Context(), req.ClusterHash, req.Kubeconfig, req.KubeconfigPath, req.Context, req.Namespace, req.PodName); container != "" {
+			req.Container = container
+			logger.Info("Using pod default container for exec",
+				"pod", req.PodName,
+				"namespace", req.Namespace,
+				"container", container,
+			)
+		}
+	}
+
+	// Build kubectl exec command; global flags go right after kubectl
+	args := append(slices.Clone(req.GlobalFlags), "exec", "-i")
 	if req.Context != "" {
 		args = append(args, "--context", req.Context)
 	}
+	args = append(args, req.Impersonation.Args()...)
 	args = append(args, "-n", req.Namespace)
 	if req.Container != "" {
 		args = append(args, "-c", req.Container)
@@ -153,36 +280,22 @@ func (h *ExecHandler) Execute(w http.ResponseWriter, r *http.Request) {
 
 	cmd := exec.Command(kubectlPath, args...)
 	cmd.Env = env.GetShellEnvironment()
+	kubeconfigUsed := resolvedKubeconfig(req.Kubeconfig, req.KubeconfigPath)
 
-	// Create temp kubeconfig file if provided
-	var tmpFile string
+	// Use the shared temp kubeconfig for this cluster if provided
 	if req.Kubeconfig != "" {
-		tmpDir := os.TempDir()
-		tmpFile = filepath.Join(tmpDir, fmt.Sprintf("kubeconfig-exec-%d", time.Now().UnixNano()))
-		if err := os.WriteFile(tmpFile, []byte(req.Kubeconfig), 0600); err != nil {
-			slog.Error("Failed to write kubeconfig", "error", err)
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(ExecResponse{
-				Output:   "",
-				ExitCode: -1,
-				Duration: time.Since(startTime).Seconds(),
-				Error:    "Failed to write kubeconfig",
-			})
+		tmpFile, release, err := kubeconfig.GetTempManager().AcquireFile(req.ClusterHash, req.Kubeconfig, req.KubeconfigPath)
+		if err != nil {
+			logger.Error("Failed to write kubeconfig", "error", err)
+			writeExecError(w, http.StatusInternalServerError, startTime, "Failed to write kubeconfig")
 			return
 		}
-		// Ensure cleanup happens no matter what
-		defer func() {
-			if err := os.Remove(tmpFile); err != nil && !os.IsNotExist(err) {
-				slog.Warn("Failed to remove temp kubeconfig", "file", tmpFile, "error", err)
-			} else {
-				slog.Debug("Removed temp kubeconfig", "file", tmpFile)
-			}
-		}()
+		// Ensure release happens no matter what
+		defer release()
 
 		cmd.Env = append(cmd.Env, fmt.Sprintf("KUBECONFIG=%s", tmpFile))
 
-		slog.Debug("Executing kubectl exec with custom kubeconfig",
+		logger.Debug("Executing kubectl exec with custom kubeconfig",
 			"command", kubectlPath,
 			"args", args,
 			"kubeconfigFile", tmpFile,
@@ -192,9 +305,10 @@ func (h *ExecHandler) Execute(w http.ResponseWriter, r *http.Request) {
 			"timeout", req.Timeout,
 		)
 	} else {
-		slog.Debug("Executing kubectl exec with default kubeconfig",
+		logger.Debug("Executing kubectl exec with default kubeconfig",
 			"command", kubectlPath,
 			"args", args,
+			"kubeconfigPath", kubeconfigUsed,
 			"pod", req.PodName,
 			"namespace", req.Namespace,
 			"context", req.Context,
@@ -202,6 +316,26 @@ func (h *ExecHandler) Execute(w http.ResponseWriter, r *http.Request) {
 		)
 	}
 
+	// A cached result only; a cluster's first request starts the check in the background
+	skew := versionSkew.warning(req.ClusterHash, kubeconfigUsed, req.Context)
+	if skew != "" {
+		w.Header().Set(versionSkewHeader, skew)
+	}
+
+	// Setup is done, so a streamed response can start; errors from here on go in its trailers
+	var stream *execStream
+	if req.Stream {
+		stream = startExecStream(w, kubeconfigUsed)
+	}
+	respond := func(status int, resp ExecResponse) {
+		resp.VersionSkew = skew
+		if stream != nil {
+			stream.finish(resp)
+			return
+		}
+		writeExecResponse(w, status, resp)
+	}
+
 	// Run command with timeout
 	ctx, cancel := r.Context(), func() {}
 	if req.Timeout > 0 {
@@ -211,63 +345,108 @@ func (h *ExecHandler) Execute(w http.ResponseWriter, r *http.Request) {
 	}
 	defer cancel()
 
-	cmdWithTimeout := exec.CommandContext(ctx, kubectlPath, args...)
-	cmdWithTimeout.Env = cmd.Env
-
-	// Capture combined output (stdout + stderr)
-	output, err := cmdWithTimeout.CombinedOutput()
+	// Retry only when kubectl failed to reach the API server, so the command never ran in the pod
+	var output []byte
+	var truncated bool
+	attempts := 0
+	runPath, runArgs := limitedCommandArgs(kubectlPath, args) // SHELL_MAX_* limits, if set
+	for {
+		attempts++
+		runCtx, stop := context.WithCancel(ctx) // Cancelled early if output outgrows the cap
+		cmdWithTimeout := exec.CommandContext(runCtx, runPath, runArgs...)
+		cmdWithTimeout.Env = cmd.Env
+
+		// Capture combined output (stdout + stderr), up to the configured cap
+		var combined bytes.Buffer
+		dst := io.Writer(&combined)
+		if stream != nil {
+			dst = io.MultiWriter(&combined, stream)
+		}
+		limiter := kubectl.NewOutputLimiter(kubectl.MaxOutputBytes(), stop)
+		cmdWithTimeout.Stdout = limiter.Writer(dst)
+		cmdWithTimeout.Stderr = cmdWithTimeout.Stdout
+		err = childproc.Run(cmdWithTimeout)
+		stop()
+		output = combined.Bytes()
+		truncated = limiter.Truncated()
+
+		_, exited := err.(*exec.ExitError)
+		if !exited || truncated || attempts > req.Retries || !kubectl.IsTransient(string(output)) {
+			break
+		}
+		logger.Warn("Transient kubectl exec failure, retrying", "pod", req.PodName, "attempt", attempts, "retries", req.Retries)
+		if !kubectl.WaitRetry(ctx, attempts) {
+			break
+		}
+	}
 	duration := time.Since(startTime).Seconds()
 
+	// A command that ran in the pod and exited non-zero isn't a cluster error; a failed exec is
+	_, exited := err.(*exec.ExitError)
+	execFailed := err != nil && (!exited || classifyExecError(string(output)) != "")
+	metrics.GetRecorder().Observe(req.ClusterHash, req.Context, metrics.SourceExec, time.Since(startTime), execFailed)
+
 	// Determine exit code
 	var exitCode int32
-	if err != nil {
+	var errorKind string
+	if truncated {
+		exitCode = -1
+		logger.Warn("Exec output exceeded limit, command killed",
+			"pod", req.PodName,
+			"command", req.Command,
+			"limit", kubectl.MaxOutputBytes(),
+			"duration", duration,
+		)
+	} else if err != nil {
 		if exitErr, ok := err.(*exec.ExitError); ok {
 			exitCode = int32(exitErr.ExitCode())
-			slog.Info("Exec completed with error",
+			errorKind = classifyExecError(string(output))
+			logger.Info("Exec completed with error",
 				"pod", req.PodName,
 				"command", req.Command,
 				"exitCode", exitCode,
+				"errorKind", errorKind,
 				"duration", duration,
 				"outputLength", len(output),
 			)
 		} else if ctx.Err() == context.DeadlineExceeded {
 			exitCode = -1
-			slog.Error("Exec timed out",
+			logger.Error("Exec timed out",
 				"pod", req.PodName,
 				"command", req.Command,
 				"timeout", req.Timeout,
 				"duration", duration,
 			)
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusGatewayTimeout)
-			json.NewEncoder(w).Encode(ExecResponse{
-				Output:   string(output),
-				ExitCode: exitCode,
-				Duration: duration,
-				Error:    fmt.Sprintf("Command timed out after %d seconds", req.Timeout),
+			respond(http.StatusGatewayTimeout, ExecResponse{
+				Output:         string(output),
+				ExitCode:       exitCode,
+				Duration:       duration,
+				Attempts:       attempts,
+				Error:          fmt.Sprintf("Command timed out after %d seconds", req.Timeout),
+				KubeconfigPath: kubeconfigUsed,
 			})
 			return
 		} else {
 			exitCode = -1
-			slog.Error("Exec failed",
+			logger.Error("Exec failed",
 				"pod", req.PodName,
 				"command", req.Command,
 				"error", err,
 				"duration", duration,
 			)
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(ExecResponse{
-				Output:   string(output),
-				ExitCode: exitCode,
-				Duration: duration,
-				Error:    err.Error(),
+			respond(http.StatusInternalServerError, ExecResponse{
+				Output:         string(output),
+				ExitCode:       exitCode,
+				Duration:       duration,
+				Attempts:       attempts,
+				Error:          err.Error(),
+				KubeconfigPath: kubeconfigUsed,
 			})
 			return
 		}
 	} else {
 		exitCode = 0
-		slog.Info("Exec completed successfully",
+		logger.Info("Exec completed successfully",
 			"pod", req.PodName,
 			"command", req.Command,
 			"duration", duration,
@@ -276,47 +455,87 @@ func (h *ExecHandler) Execute(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Return response
+	respond(http.StatusOK, ExecResponse{
+		Output:         string(output),
+		ExitCode:       exitCode,
+		Duration:       duration,
+		ErrorKind:      errorKind,
+		Attempts:       attempts,
+		Truncated:      truncated,
+		KubeconfigPath: kubeconfigUsed,
+	})
+}
+
+// execExitCodeHeader carries the exit code on every JSON /exec response
+// Streamed responses send it as the execTrailerExitCode trailer instead
+const execExitCodeHeader = "X-Exit-Code"
+
+// writeExecResponse writes an ExecResponse; every /exec response, including errors, is JSON
+// The exit code is also sent as a header, so clients can check it without parsing the body
+func writeExecResponse(w http.ResponseWriter, status int, resp ExecResponse) {
+	resp.Encoding = encodeOutputs(&resp.Output)
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(ExecResponse{
-		Output:   string(output),
-		ExitCode: exitCode,
-		Duration: duration,
+	w.Header().Set(execExitCodeHeader, strconv.Itoa(int(resp.ExitCode)))
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// writeExecError writes a request or setup failure as an ExecResponse with exit code -1
+func writeExecError(w http.ResponseWriter, status int, startTime time.Time, message string) {
+	writeExecResponse(w, status, ExecResponse{
+		ExitCode: -1,
+		Duration: time.Since(startTime).Seconds(),
+		Error:    message,
 	})
 }
 
 // Start handles POST /exec/start (legacy session-based API - deprecated)
 func (h *ExecHandler) Start(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
 	var req ExecStartRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		slog.Error("Failed to decode exec request", "error", err)
+		logger.Error("Failed to decode exec request", "error", err)
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
+	// A kubeconfigPath is read only for hashing; kubectl uses the file in place
+	if status, msg := loadKubeconfigPath(&req.Kubeconfig, req.KubeconfigPath); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
 	// Validate request
 	if req.Namespace == "" || req.PodName == "" || len(req.Command) == 0 {
 		http.Error(w, "Missing required fields", http.StatusBadRequest)
 		return
 	}
+	if err := checkExecCommand(req.Command); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid command: %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.StartTimeout < 0 {
+		http.Error(w, "startTimeout must be 0 (none) or a positive number of seconds", http.StatusBadRequest)
+		return
+	}
+	if err := req.Impersonation.Validate(); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid impersonation: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := kubectl.ValidateGlobalFlags(req.GlobalFlags); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid globalFlags: %v", err), http.StatusBadRequest)
+		return
+	}
 
 	// If kubeconfig/context not provided, try to look up from registry
-	if req.Kubeconfig == "" && req.Context == "" && req.ClusterHash != "" {
-		regKubeconfig, regContext, foundInRegistry := cluster.GetRegistry().Lookup(req.ClusterHash)
-		if !foundInRegistry {
-			slog.Error("Cluster hash not found in registry and kubeconfig/context not provided",
-				"providedHash", req.ClusterHash,
-				"pod", req.PodName,
-				"hint", "This usually happens after helper restart. App should send kubeconfig and context.",
-			)
-			http.Error(w, "Cluster hash not found in registry. Please provide kubeconfig and context in the request.", http.StatusBadRequest)
-			return
-		}
-		req.Kubeconfig = regKubeconfig
-		req.Context = regContext
-		slog.Info("Looked up cluster info from registry",
-			"clusterHash", req.ClusterHash,
-			"context", req.Context,
-		)
+	if !resolveHashOnly(logger, &req.Kubeconfig, &req.Context, req.ClusterHash) {
+		writeRegistryMiss(w, req.ClusterHash)
+		return
+	}
+	if err := checkKubeconfigContext(req.Kubeconfig, req.Context); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
 	// Compute cluster hash if not provided
@@ -326,7 +545,7 @@ func (h *ExecHandler) Start(w http.ResponseWriter, r *http.Request) {
 		// If hash is provided, VALIDATE it first before registering
 		expectedHash := cluster.ComputeHash(req.Kubeconfig, req.Context)
 		if req.ClusterHash != expectedHash {
-			slog.Error("Cluster hash mismatch - app sent wrong hash!",
+			logger.Error("Cluster hash mismatch - app sent wrong hash!",
 				"providedHash", req.ClusterHash,
 				"expectedHash", expectedHash,
 				"context", req.Context,
@@ -338,21 +557,38 @@ func (h *ExecHandler) Start(w http.ResponseWriter, r *http.Request) {
 
 		// Hash is valid - register it
 		cluster.GetRegistry().Register(req.ClusterHash, req.Kubeconfig, req.Context)
-		slog.Info("Validated and registered cluster hash",
+		logger.Info("Validated and registered cluster hash",
 			"clusterHash", req.ClusterHash,
 			"context", req.Context,
 		)
 	}
 
+	// Honor the pod's default-container annotation explicitly so exec is deterministic
+	if req.Container == "" {
+		if container := podDefaultContainer(r.Context(), req.ClusterHash, req.Kubeconfig, req.KubeconfigPath, req.Context, req.Namespace, req.PodName); container != "" {
+			req.Container = container
+			logger.Info("Using pod default container for exec session",
+				"pod", req.PodName,
+				"namespace", req.Namespace,
+				"container", container,
+			)
+		}
+	}
+
 	// Create session
-	sess := h.sessionMgr.Create(session.TypeExec)
+	sess, err := h.sessionMgr.CreateForCluster(session.TypeExec, req.ClusterHash)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
 	sess.Namespace = req.Namespace
 	sess.PodName = req.PodName
 	sess.Container = req.Container
 	sess.Command = req.Command
 	sess.Context = req.Context
-	sess.Kubeconfig = req.Kubeconfig
-	sess.ClusterHash = req.ClusterHash
+	setSessionImpersonation(sess, req.Impersonation)
+	sess.GlobalFlags = req.GlobalFlags
+	sess.SetKubeconfig(req.Kubeconfig)
 
 	// Find kubectl
 	kubectlPath, err := exec.LookPath("kubectl")
@@ -362,11 +598,12 @@ func (h *ExecHandler) Start(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Build kubectl exec command
-	args := []string{"exec", "-i"}
+	// Build kubectl exec command; global flags go right after kubectl
+	args := append(slices.Clone(req.GlobalFlags), "exec", "-i")
 	if req.Context != "" {
 		args = append(args, "--context", req.Context)
 	}
+	args = append(args, req.Impersonation.Args()...)
 	args = append(args, "-n", req.Namespace)
 	if req.Container != "" {
 		args = append(args, "-c", req.Container)
@@ -374,24 +611,24 @@ func (h *ExecHandler) Start(w http.ResponseWriter, r *http.Request) {
 	args = append(args, req.PodName, "--")
 	args = append(args, req.Command...)
 
-	cmd := exec.Command(kubectlPath, args...)
+	runPath, runArgs := limitedCommandArgs(kubectlPath, args) // SHELL_MAX_* limits, if set
+	cmd := exec.Command(runPath, runArgs...)
 	cmd.Env = env.GetShellEnvironment()
+	sess.KubeconfigPath = resolvedKubeconfig(req.Kubeconfig, req.KubeconfigPath)
 
 	// Set kubeconfig if provided
 	if req.Kubeconfig != "" {
-		tmpDir := os.TempDir()
-		tmpFile := filepath.Join(tmpDir, fmt.Sprintf("kubeconfig-%s", sess.ID))
-		if err := os.WriteFile(tmpFile, []byte(req.Kubeconfig), 0600); err != nil {
+		// Shared with other commands for the same cluster; released when the session ends
+		tmpFile, release, err := kubeconfig.GetTempManager().AcquireFile(req.ClusterHash, req.Kubeconfig, req.KubeconfigPath)
+		if err != nil {
 			h.sessionMgr.Stop(sess.ID)
 			http.Error(w, "Failed to write kubeconfig", http.StatusInternalServerError)
 			return
 		}
+		sess.AddRelease(release)
 		cmd.Env = append(cmd.Env, fmt.Sprintf("KUBECONFIG=%s", tmpFile))
 
-		// Register temp file for cleanup when session ends
-		sess.TempFiles = append(sess.TempFiles, tmpFile)
-
-		slog.Debug("Executing kubectl exec with custom kubeconfig",
+		logger.Debug("Executing kubectl exec with custom kubeconfig",
 			"sessionId", sess.ID,
 			"command", kubectlPath,
 			"args", args,
@@ -401,7 +638,7 @@ func (h *ExecHandler) Start(w http.ResponseWriter, r *http.Request) {
 			"context", req.Context,
 		)
 	} else {
-		slog.Debug("Executing kubectl exec with default kubeconfig",
+		logger.Debug("Executing kubectl exec with default kubeconfig",
 			"sessionId", sess.ID,
 			"command", kubectlPath,
 			"args", args,
@@ -418,65 +655,49 @@ func (h *ExecHandler) Start(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to create stdin pipe", http.StatusInternalServerError)
 		return
 	}
+	echo := sess.GetOutputBuffer()
 	sess.WriteInput = func(input string) error {
+		// Echoed before it reaches the process, so the transcript shows input ahead of its output
+		if req.EchoInput {
+			echo.Write([]byte(input))
+		}
 		_, err := stdin.Write([]byte(input))
 		return err
 	}
+	// Close stdin as soon as the session is stopped rather than waiting for the process to be reaped
+	sess.AddRelease(func() { stdin.Close() })
 
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		h.sessionMgr.Stop(sess.ID)
-		http.Error(w, "Failed to create stdout pipe", http.StatusInternalServerError)
-		return
-	}
-
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		h.sessionMgr.Stop(sess.ID)
-		http.Error(w, "Failed to create stderr pipe", http.StatusInternalServerError)
-		return
-	}
+	// Let exec copy output into the session buffer so Wait owns the copy goroutine.
+	// A child of kubectl can keep the pipe open after kubectl is killed; WaitDelay
+	// bounds how long Wait waits for it before closing the pipe, so nothing leaks.
+	// Stdout and stderr stay one writer so exec copies them through a single pipe
+	output := &processOutput{Writer: sess.GetOutputBuffer(), started: make(chan struct{})}
+	cmd.Stdout = output
+	cmd.Stderr = output
+	cmd.WaitDelay = execOutputWaitDelay
 
 	sess.Cmd = cmd
+	sess.CommandLine = redactCommandLine(append([]string{kubectlPath}, args...)) // Not the limits wrapper
 
 	// Start exec in background
-	if err := cmd.Start(); err != nil {
+	if err := childproc.Start(cmd); err != nil {
 		h.sessionMgr.Stop(sess.ID)
-		slog.Error("Failed to start exec", "error", err)
+		logger.Error("Failed to start exec", "error", err)
 		http.Error(w, fmt.Sprintf("Failed to start exec: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	// Capture output in background
-	go func() {
-		io.Copy(sess.GetOutputBuffer(), stdout)
-	}()
-	go func() {
-		io.Copy(sess.GetOutputBuffer(), stderr)
-	}()
-
 	// Monitor process in background and capture exit code
+	exited := make(chan struct{})
 	go func() {
-		// CRITICAL: Clean up temp files AFTER kubectl finishes
+		// CRITICAL: Release temp kubeconfig AFTER kubectl finishes
 		// This ensures kubectl can read the kubeconfig file for the entire duration
-		defer func() {
-			for _, tmpFile := range sess.TempFiles {
-				if err := os.Remove(tmpFile); err != nil && !os.IsNotExist(err) {
-					slog.Warn("Failed to remove temp file", "file", tmpFile, "error", err)
-				} else {
-					slog.Debug("Removed temp file after exec completed", "file", tmpFile)
-				}
-			}
-			// Clear the list so session cleanup doesn't try to delete them again
-			sess.TempFiles = nil
-		}()
-
-		err := cmd.Wait()
-		sess.Status = session.StatusStopped
+		defer sess.Release()
 
-		// Give stderr/stdout goroutines time to finish copying
-		// This ensures all output is captured before we mark as stopped
-		time.Sleep(100 * time.Millisecond)
+		// Returns once output is fully copied (or WaitDelay expires), so nothing is lost
+		err := childproc.Wait(cmd)
+		close(exited)
+		h.sessionMgr.SetStatus(sess, session.StatusStopped)
 
 		// Capture exit code
 		if err != nil {
@@ -484,7 +705,7 @@ func (h *ExecHandler) Start(w http.ResponseWriter, r *http.Request) {
 				exitCode := int32(exitErr.ExitCode())
 				sess.ExitCode = &exitCode
 				output := sess.ReadOutput()
-				slog.Info("Exec session ended with error",
+				logger.Info("Exec session ended with error",
 					"id", sess.ID,
 					"exitCode", exitCode,
 					"output", output,
@@ -496,7 +717,7 @@ func (h *ExecHandler) Start(w http.ResponseWriter, r *http.Request) {
 				exitCode := int32(-1)
 				sess.ExitCode = &exitCode
 				output := sess.ReadOutput()
-				slog.Error("Exec session ended with non-exit error",
+				logger.Error("Exec session ended with non-exit error",
 					"id", sess.ID,
 					"error", err,
 					"errorType", fmt.Sprintf("%T", err),
@@ -509,23 +730,61 @@ func (h *ExecHandler) Start(w http.ResponseWriter, r *http.Request) {
 			// Success
 			exitCode := int32(0)
 			sess.ExitCode = &exitCode
-			slog.Info("Exec session ended successfully", "id", sess.ID)
+			logger.Info("Exec session ended successfully", "id", sess.ID)
 		}
+		metrics.GetRecorder().AddOutput(sess.ClusterHash, sess.Context, metrics.SourceExec, sess.BytesProduced())
+		sess.CloseOutput()
 	}()
 
-	slog.Info("Exec started", "id", sess.ID, "pod", req.PodName, "command", req.Command)
+	if req.StartTimeout > 0 {
+		go h.enforceStartTimeout(logger, sess, output.started, exited, time.Duration(req.StartTimeout)*time.Second)
+	}
+
+	logger.Info("Exec started", "id", sess.ID, "pod", req.PodName, "command", req.Command)
 
 	response := ExecStartResponse{
-		SessionID: sess.ID,
-		Status:    string(sess.Status),
+		SessionID:      sess.ID,
+		Status:         string(h.sessionMgr.StatusOf(sess)),
+		KubeconfigPath: sess.KubeconfigPath,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
+// enforceStartTimeout fails and kills an exec session that has neither printed anything nor
+// exited within timeout, e.g. because kubectl is stuck establishing the exec stream
+// Only kubectl's own output counts (started); input echoed into the buffer by echoInput doesn't
+func (h *ExecHandler) enforceStartTimeout(logger *slog.Logger, sess *session.Session, started, exited <-chan struct{}, timeout time.Duration) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-started:
+		return
+	case <-exited:
+		return
+	case <-timer.C:
+	}
+	// Fails only a session still running: one that exited or was stopped is left alone
+	reason := fmt.Sprintf("no output from kubectl exec within startTimeout (%s); the session was killed", timeout)
+	if !h.sessionMgr.Fail(sess, reason) {
+		return
+	}
+	logger.Warn("Exec session produced no output before its start timeout, killing it",
+		"id", sess.ID,
+		"pod", sess.PodName,
+		"command", sess.Command,
+		"startTimeout", timeout,
+	)
+	if err := sess.Cmd.Process.Kill(); err != nil {
+		logger.Warn("Failed to kill stuck exec session", "id", sess.ID, "error", err)
+	}
+}
+
 // Input handles POST /exec/input/{sessionId}
 func (h *ExecHandler) Input(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
 	vars := mux.Vars(r)
 	sessionID := vars["sessionId"]
 
@@ -535,15 +794,16 @@ func (h *ExecHandler) Input(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get session with cluster validation if hash provided
+	// Get session with cluster validation if hash provided (the body's wins over the query's)
+	clusterHash := clusterHashFromRequest(r, req.ClusterHash)
 	var sess *session.Session
 	var ok bool
-	if req.ClusterHash != "" {
-		sess, ok = h.sessionMgr.GetWithClusterValidation(sessionID, req.ClusterHash)
+	if clusterHash != "" {
+		sess, ok = h.sessionMgr.GetWithClusterValidation(sessionID, clusterHash)
 		if !ok {
-			slog.Warn("Session not found or cluster hash mismatch",
+			logger.Warn("Session not found or cluster hash mismatch",
 				"sessionId", sessionID,
-				"providedHash", req.ClusterHash,
+				"providedHash", clusterHash,
 			)
 			http.Error(w, "Session not found or cluster mismatch", http.StatusNotFound)
 			return
@@ -572,19 +832,31 @@ func (h *ExecHandler) Input(w http.ResponseWriter, r *http.Request) {
 
 // Output handles GET /exec/output/{sessionId}
 func (h *ExecHandler) Output(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
 	vars := mux.Vars(r)
 	sessionID := vars["sessionId"]
 
-	// Get cluster hash from query parameter (optional)
-	clusterHash := r.URL.Query().Get("clusterHash")
+	// Optional cluster hash, from the JSON body or the query
+	clusterHash, err := readClusterHash(r)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
 
 	// Get session with cluster validation if hash provided
+	offset, wait, err := parseOutputPoll(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	var sess *session.Session
 	var ok bool
 	if clusterHash != "" {
 		sess, ok = h.sessionMgr.GetWithClusterValidation(sessionID, clusterHash)
 		if !ok {
-			slog.Warn("Session not found or cluster hash mismatch",
+			logger.Warn("Session not found or cluster hash mismatch",
 				"sessionId", sessionID,
 				"providedHash", clusterHash,
 			)
@@ -599,14 +871,25 @@ func (h *ExecHandler) Output(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Long-poll: block until there is output past the client's offset, or the wait elapses
+	// The wait is capped below the default write timeout, but HTTP_WRITE_TIMEOUT may be set lower
+	if wait > 0 {
+		clearWriteDeadline(logger, w)
+	}
+	sess.WaitOutput(r.Context(), offset, wait)
 	output := sess.ReadOutput()
 
 	response := ExecOutputResponse{
 		Output:    output,
+		Offset:    len(output),
 		Timestamp: sess.StartedAt.Format("2006-01-02T15:04:05Z07:00"),
-		Status:    string(sess.Status),
+		Status:    string(h.sessionMgr.StatusOf(sess)),
 		ExitCode:  sess.ExitCode, // Include exit code (nil if still running)
+		Error:     sess.FailReason(),
+
+		BytesProduced: sess.BytesProduced(),
 	}
+	response.Encoding = encodeOutputs(&response.Output)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
@@ -614,17 +897,23 @@ func (h *ExecHandler) Output(w http.ResponseWriter, r *http.Request) {
 
 // Stop handles DELETE /exec/stop/{sessionId}
 func (h *ExecHandler) Stop(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
 	vars := mux.Vars(r)
 	sessionID := vars["sessionId"]
 
-	// Get cluster hash from query parameter (optional)
-	clusterHash := r.URL.Query().Get("clusterHash")
+	// Optional cluster hash, from the JSON body or the query
+	clusterHash, err := readClusterHash(r)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
 
 	// Validate cluster hash if provided
 	if clusterHash != "" {
 		sess, ok := h.sessionMgr.GetWithClusterValidation(sessionID, clusterHash)
 		if !ok {
-			slog.Warn("Session not found or cluster hash mismatch",
+			logger.Warn("Session not found or cluster hash mismatch",
 				"sessionId", sessionID,
 				"providedHash", clusterHash,
 			)
@@ -643,3 +932,16 @@ func (h *ExecHandler) Stop(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"status": "stopped"})
 }
 
+// processOutput is kubectl's stdout and stderr; started is closed on the first byte either writes
+type processOutput struct {
+	io.Writer
+	once    sync.Once
+	started chan struct{}
+}
+
+func (p *processOutput) Write(b []byte) (int, error) {
+	if len(b) > 0 {
+		p.once.Do(func() { close(p.started) })
+	}
+	return p.Writer.Write(b)
+}
@@ -0,0 +1,193 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/kubedeskpro/kubedesk-helper/internal/logging"
+	"github.com/kubedeskpro/kubedesk-helper/internal/session"
+)
+
+// Timing for GET /exec/attach
+const (
+	attachPollInterval = 30 * time.Second // Longest wait for output before re-checking the session
+	attachCloseTimeout = 5 * time.Second  // How long to wait for the client to answer our close frame
+	attachWriteTimeout = 10 * time.Second // Per-frame write deadline, so a stuck client can't pin the session
+	maxAttachFrameSize = 1 << 20          // Largest frame accepted from the client
+	maxTerminalSize    = 10000            // Upper bound for resize cols/rows
+)
+
+// attachUpgrader keeps the default same-origin check, so web pages can't attach to local sessions
+var attachUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 32 << 10,
+}
+
+// AttachControl is a control message sent as a WebSocket text frame, in either direction
+type AttachControl struct {
+	Type     string `json:"type"`               // Client: "resize". Server: "exit" or "error"
+	Cols     int    `json:"cols,omitempty"`     // resize
+	Rows     int    `json:"rows,omitempty"`     // resize
+	ExitCode *int32 `json:"exitCode,omitempty"` // exit
+	Error    string `json:"error,omitempty"`    // error
+}
+
+// Attach handles GET /exec/attach/{sessionId}?clusterHash=&offset=
+// Upgrades to a WebSocket: binary frames from the client go to the session's stdin, session
+// output goes back as binary frames starting at offset (default 0, i.e. replayed from the start).
+// When the process exits the server sends an "exit" control message and closes; a close frame
+// from the client stops the session
+func (h *ExecHandler) Attach(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	sessionID := mux.Vars(r)["sessionId"]
+	clusterHash, err := readClusterHash(r)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	offset := 0
+	if raw := r.URL.Query().Get("offset"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			http.Error(w, "offset must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		offset = n
+	}
+
+	var sess *session.Session
+	var ok bool
+	if clusterHash != "" {
+		sess, ok = h.sessionMgr.GetWithClusterValidation(sessionID, clusterHash)
+		if !ok {
+			logger.Warn("Session not found or cluster hash mismatch",
+				"sessionId", sessionID,
+				"providedHash", clusterHash,
+			)
+			http.Error(w, "Session not found or cluster mismatch", http.StatusNotFound)
+			return
+		}
+	} else {
+		sess, ok = h.sessionMgr.Get(sessionID)
+		if !ok {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+	}
+	if sess.Type != session.TypeExec || sess.WriteInput == nil {
+		http.Error(w, "Session does not support input", http.StatusBadRequest)
+		return
+	}
+
+	// Upgrade writes its own error response
+	conn, err := attachUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logger.Warn("Failed to upgrade exec attach", "sessionId", sessionID, "error", err)
+		return
+	}
+	defer conn.Close()
+	conn.SetReadLimit(maxAttachFrameSize)
+
+	logger.Info("Exec session attached", "sessionId", sessionID, "offset", offset)
+	defer logger.Info("Exec session detached", "sessionId", sessionID)
+
+	// gorilla/websocket allows one concurrent writer; the output pump and the reader both write
+	var writeMu sync.Mutex
+	send := func(messageType int, data []byte) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		conn.SetWriteDeadline(time.Now().Add(attachWriteTimeout))
+		return conn.WriteMessage(messageType, data)
+	}
+	sendControl := func(msg AttachControl) error {
+		data, _ := json.Marshal(msg)
+		return send(websocket.TextMessage, data)
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	exited := false // Set by the pump once the process has exited; read after pump.Wait
+	var pump sync.WaitGroup
+	pump.Add(1)
+	go func() {
+		defer pump.Done()
+		for {
+			sess.WaitOutput(ctx, offset, attachPollInterval)
+			if ctx.Err() != nil {
+				return
+			}
+			output, done := sess.ReadOutputFrom(offset)
+			if len(output) > 0 {
+				if err := send(websocket.BinaryMessage, output); err != nil {
+					cancel()
+					return
+				}
+				offset += len(output)
+			}
+			if done {
+				exited = true
+				sendControl(AttachControl{Type: "exit", ExitCode: sess.ExitCode})
+				conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "process exited"), time.Now().Add(attachWriteTimeout))
+				// Give the client a moment to answer the close before the reader gives up
+				conn.SetReadDeadline(time.Now().Add(attachCloseTimeout))
+				return
+			}
+		}
+	}()
+
+	clientClosed := false
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			var closeErr *websocket.CloseError
+			clientClosed = errors.As(err, &closeErr)
+			break
+		}
+		sess.MarkActive()
+
+		switch messageType {
+		case websocket.BinaryMessage:
+			if err := sess.WriteInput(string(data)); err != nil {
+				logger.Warn("Failed to write attached input", "sessionId", sessionID, "error", err)
+				sendControl(AttachControl{Type: "error", Error: "Failed to write input: " + err.Error()})
+			}
+		case websocket.TextMessage:
+			var msg AttachControl
+			if err := json.Unmarshal(data, &msg); err != nil {
+				sendControl(AttachControl{Type: "error", Error: "Invalid control message"})
+				continue
+			}
+			switch msg.Type {
+			case "resize":
+				if msg.Cols < 1 || msg.Rows < 1 || msg.Cols > maxTerminalSize || msg.Rows > maxTerminalSize {
+					sendControl(AttachControl{Type: "error", Error: "resize needs cols and rows between 1 and 10000"})
+					continue
+				}
+				// Exec sessions run without a terminal, so there is nothing to resize yet
+				logger.Debug("Ignoring resize for exec session without a terminal", "sessionId", sessionID, "cols", msg.Cols, "rows", msg.Rows)
+			default:
+				sendControl(AttachControl{Type: "error", Error: "Unknown control message type " + strconv.Quote(msg.Type)})
+			}
+		}
+	}
+
+	cancel()
+	pump.Wait()
+
+	// A close frame means the user closed the terminal; a dropped connection leaves the session for a re-attach
+	if clientClosed && !exited {
+		if err := h.sessionMgr.Stop(sessionID); err != nil {
+			logger.Warn("Failed to stop exec session after close", "sessionId", sessionID, "error", err)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/kubedeskpro/kubedesk-helper/internal/config"
+	"github.com/kubedeskpro/kubedesk-helper/internal/session"
+)
+
+// startAttachedExec starts an exec session through the router and attaches a WebSocket to it
+func startAttachedExec(t *testing.T, sessionMgr *session.Manager) (*websocket.Conn, string) {
+	t.Helper()
+	server := httptest.NewServer(NewRouter("test", sessionMgr, config.Default()))
+	t.Cleanup(server.Close)
+
+	body := `{"namespace":"default","podName":"web","container":"app","command":["sh"]}`
+	resp, err := http.Post(server.URL+"/exec/start", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("exec start: %v", err)
+	}
+	defer resp.Body.Close()
+	var start ExecStartResponse
+	if err := json.NewDecoder(resp.Body).Decode(&start); err != nil {
+		t.Fatalf("Failed to decode exec start response: %v", err)
+	}
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/exec/attach/" + start.SessionID
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("attach: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn, start.SessionID
+}
+
+func TestExecAttach_StreamsInputAndOutput(t *testing.T) {
+	installFakeKubectl(t, `echo ready
+while read line; do
+  echo "got:$line"
+  [ "$line" = quit ] && exit 3
+done
+`)
+
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	conn, _ := startAttachedExec(t, sessionMgr)
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"resize","cols":120,"rows":40}`)); err != nil {
+		t.Fatalf("resize: %v", err)
+	}
+	for _, line := range []string{"hello\n", "quit\n"} {
+		if err := conn.WriteMessage(websocket.BinaryMessage, []byte(line)); err != nil {
+			t.Fatalf("write %q: %v", line, err)
+		}
+	}
+
+	var output strings.Builder
+	var exit AttachControl
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				t.Fatalf("read: %v (output so far %q)", err, output.String())
+			}
+			break
+		}
+		switch messageType {
+		case websocket.BinaryMessage:
+			output.Write(data)
+		case websocket.TextMessage:
+			if err := json.Unmarshal(data, &exit); err != nil {
+				t.Fatalf("bad control message %q: %v", data, err)
+			}
+		}
+	}
+
+	if want := "ready\ngot:hello\ngot:quit\n"; output.String() != want {
+		t.Errorf("output = %q, want %q", output.String(), want)
+	}
+	if exit.Type != "exit" || exit.ExitCode == nil || *exit.ExitCode != 3 {
+		t.Errorf("last control message = %+v, want exit with code 3", exit)
+	}
+}
+
+func TestExecAttach_CloseStopsSession(t *testing.T) {
+	installFakeKubectl(t, "exec sleep 30\n")
+
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	conn, sessionID := startAttachedExec(t, sessionMgr)
+
+	// An unknown control message is answered, not fatal
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"bogus"}`))
+	var reply AttachControl
+	if err := conn.ReadJSON(&reply); err != nil || reply.Type != "error" {
+		t.Fatalf("reply = %+v, %v; want an error control message", reply, err)
+	}
+
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, ok := sessionMgr.Get(sessionID); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("session still running after the client closed the WebSocket")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestExecAttach_UnknownSession(t *testing.T) {
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	server := httptest.NewServer(NewRouter("test", sessionMgr, config.Default()))
+	defer server.Close()
+
+	_, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/exec/attach/missing", nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("attach to missing session: err = %v, resp = %v; want 404", err, resp)
+	}
+}
@@ -3,16 +3,37 @@ package api
 import (
 	"context"
 	"encoding/json"
-	"log/slog"
+	"fmt"
 	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/kubedeskpro/kubedesk-helper/internal/config"
 	"github.com/kubedeskpro/kubedesk-helper/internal/kubectl"
+	"github.com/kubedeskpro/kubedesk-helper/internal/logging"
 )
 
 // ExecAuthHandler handles /exec-auth endpoint
 type ExecAuthHandler struct{}
 
+// execAuthEnvAllow holds the patterns from EXEC_AUTH_ENV_ALLOW, on top of config.DefaultExecAuthEnvAllow
+var execAuthEnvAllow atomic.Pointer[[]string]
+
+// SetExecAuthEnvAllow sets the extra env patterns /exec-auth passes to credential plugins (EXEC_AUTH_ENV_ALLOW)
+func SetExecAuthEnvAllow(patterns []string) {
+	execAuthEnvAllow.Store(&patterns)
+}
+
+// extraAllowedEnv returns the patterns set by SetExecAuthEnvAllow
+func extraAllowedEnv() []string {
+	if patterns := execAuthEnvAllow.Load(); patterns != nil {
+		return *patterns
+	}
+	return nil
+}
+
 // ExecAuthRequest represents an exec-auth command request
 type ExecAuthRequest struct {
 	Command string            `json:"command"`
@@ -22,16 +43,19 @@ type ExecAuthRequest struct {
 
 // ExecAuthResponse represents an exec-auth command response
 type ExecAuthResponse struct {
-	Stdout   string `json:"stdout"`
-	Stderr   string `json:"stderr"`
-	ExitCode int32  `json:"exitCode"`
+	Stdout    string `json:"stdout"`
+	Stderr    string `json:"stderr"`
+	ExitCode  int32  `json:"exitCode"`
+	Truncated bool   `json:"truncated,omitempty"` // Output exceeded MAX_OUTPUT_BYTES; the command was killed
 }
 
 // Handle processes exec-auth command requests
 func (h *ExecAuthHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
 	var req ExecAuthRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		slog.Error("Failed to decode exec-auth request", "error", err)
+		logger.Error("Failed to decode exec-auth request", "error", err)
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
@@ -41,24 +65,45 @@ func (h *ExecAuthHandler) Handle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// CRITICAL: Only pass env vars credential plugins need; keys like LD_PRELOAD or PATH
+	// would let a caller hijack what the plugin executes
+	if rejected := h.rejectedEnvKeys(req.Env); len(rejected) > 0 {
+		logger.Warn("Rejected exec-auth env vars", "keys", rejected, "command", req.Command)
+		http.Error(w, fmt.Sprintf("Environment variables not allowed for exec-auth: %s", strings.Join(rejected, ", ")), http.StatusBadRequest)
+		return
+	}
+
 	// Execute command with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
 	result, err := kubectl.ExecuteCommand(ctx, req.Command, req.Args, req.Env)
 	if err != nil {
-		slog.Error("Failed to execute exec-auth command", "error", err, "command", req.Command)
+		logger.Error("Failed to execute exec-auth command", "error", err, "command", req.Command)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	response := ExecAuthResponse{
-		Stdout:   result.Stdout,
-		Stderr:   result.Stderr,
-		ExitCode: result.ExitCode,
+		Stdout:    result.Stdout,
+		Stderr:    result.Stderr,
+		ExitCode:  result.ExitCode,
+		Truncated: result.Truncated,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
+// rejectedEnvKeys returns the sorted env keys that are denied or not on the allow-list
+func (h *ExecAuthHandler) rejectedEnvKeys(env map[string]string) []string {
+	var rejected []string
+	for key := range env {
+		if config.IsDeniedExecAuthEnv(key) ||
+			(!config.MatchesEnvPattern(key, config.DefaultExecAuthEnvAllow) && !config.MatchesEnvPattern(key, extraAllowedEnv())) {
+			rejected = append(rejected, key)
+		}
+	}
+	sort.Strings(rejected)
+	return rejected
+}
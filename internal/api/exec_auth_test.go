@@ -0,0 +1,132 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func postExecAuth(t *testing.T, handler *ExecAuthHandler, req ExecAuthRequest) *httptest.ResponseRecorder {
+	t.Helper()
+	body, _ := json.Marshal(req)
+	rec := httptest.NewRecorder()
+	handler.Handle(rec, httptest.NewRequest(http.MethodPost, "/exec-auth", strings.NewReader(string(body))))
+	return rec
+}
+
+// setExecAuthEnvAllow sets EXEC_AUTH_ENV_ALLOW patterns for the duration of a test
+func setExecAuthEnvAllow(t *testing.T, patterns []string) {
+	t.Helper()
+	orig := extraAllowedEnv()
+	SetExecAuthEnvAllow(patterns)
+	t.Cleanup(func() { SetExecAuthEnvAllow(orig) })
+}
+
+func TestExecAuth_AllowedEnvPassed(t *testing.T) {
+	rec := postExecAuth(t, &ExecAuthHandler{}, ExecAuthRequest{
+		Command: "sh",
+		Args:    []string{"-c", `echo "$AWS_PROFILE $KUBERNETES_EXEC_INFO"`},
+		Env:     map[string]string{"AWS_PROFILE": "dev", "KUBERNETES_EXEC_INFO": "{}"},
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var resp ExecAuthResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if got := strings.TrimSpace(resp.Stdout); got != "dev {}" {
+		t.Errorf("stdout = %q, want %q", got, "dev {}")
+	}
+}
+
+func TestExecAuth_CredentialPluginReadsExecInfo(t *testing.T) {
+	// Like client-go's exec credential plugins: the cluster comes from KUBERNETES_EXEC_INFO
+	plugin := filepath.Join(t.TempDir(), "fake-credential-plugin")
+	script := `#!/bin/sh
+[ -n "$KUBERNETES_EXEC_INFO" ] || { echo "KUBERNETES_EXEC_INFO not set" >&2; exit 1; }
+[ "$(env | grep -c '^KUBERNETES_EXEC_INFO=')" = 1 ] || { echo "KUBERNETES_EXEC_INFO set more than once" >&2; exit 1; }
+server=$(printf '%s' "$KUBERNETES_EXEC_INFO" | sed -n 's/.*"server":"\([^"]*\)".*/\1/p')
+printf '{"apiVersion":"client.authentication.k8s.io/v1","kind":"ExecCredential","status":{"token":"token-for-%s"}}' "$server"
+`
+	if err := os.WriteFile(plugin, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	execInfo := `{"apiVersion":"client.authentication.k8s.io/v1","kind":"ExecCredential","spec":{"cluster":{"server":"https://prod.example.com"},"interactive":false}}`
+	rec := postExecAuth(t, &ExecAuthHandler{}, ExecAuthRequest{
+		Command: plugin,
+		Env:     map[string]string{"KUBERNETES_EXEC_INFO": execInfo},
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var resp ExecAuthResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.ExitCode != 0 {
+		t.Fatalf("plugin failed: exit %d, stderr %q", resp.ExitCode, resp.Stderr)
+	}
+	var cred struct {
+		Status struct {
+			Token string `json:"token"`
+		} `json:"status"`
+	}
+	if err := json.Unmarshal([]byte(resp.Stdout), &cred); err != nil || cred.Status.Token != "token-for-https://prod.example.com" {
+		t.Errorf("credential = %q (%v)", resp.Stdout, err)
+	}
+}
+
+func TestExecAuth_RejectsDisallowedEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler *ExecAuthHandler
+		env     map[string]string
+	}{
+		{"LD_PRELOAD", &ExecAuthHandler{}, map[string]string{"AWS_PROFILE": "dev", "LD_PRELOAD": "/tmp/evil.so"}},
+		{"DYLD prefix", &ExecAuthHandler{}, map[string]string{"DYLD_INSERT_LIBRARIES": "/tmp/evil.dylib"}},
+		{"PATH", &ExecAuthHandler{}, map[string]string{"PATH": "/tmp/evil"}},
+		{"Not on allow-list", &ExecAuthHandler{}, map[string]string{"VAULT_ADDR": "https://vault"}},
+		{"Denied even if configured", &ExecAuthHandler{}, map[string]string{"LD_LIBRARY_PATH": "/tmp"}},
+	}
+
+	setExecAuthEnvAllow(t, []string{"L*"})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := postExecAuth(t, tt.handler, ExecAuthRequest{Command: "true", Env: tt.env})
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+func TestExecAuth_ConfiguredEnvAllowed(t *testing.T) {
+	setExecAuthEnvAllow(t, []string{"VAULT_*"})
+	handler := &ExecAuthHandler{}
+	rec := postExecAuth(t, handler, ExecAuthRequest{Command: "true", Env: map[string]string{"VAULT_ADDR": "https://vault"}})
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestExecAuth_TruncatesOversizedOutput(t *testing.T) {
+	setMaxOutputBytes(t, 4096)
+
+	rec := postExecAuth(t, &ExecAuthHandler{}, ExecAuthRequest{Command: "yes"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var resp ExecAuthResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if !resp.Truncated || resp.ExitCode != -1 || len(resp.Stdout) != 4096 {
+		t.Errorf("truncated %v, exit %d, %d bytes; want true, -1, 4096", resp.Truncated, resp.ExitCode, len(resp.Stdout))
+	}
+}
@@ -0,0 +1,65 @@
+package api
+
+import "strings"
+
+// Stable errorKind values for /exec failures that happened before the command ran in the container
+const (
+	execErrPodNotFound       = "podNotFound"       // No such pod
+	execErrContainerNotFound = "containerNotFound" // No such container in the pod
+	execErrContainerNotReady = "containerNotReady" // Pod not scheduled yet, or container not started
+	execErrCrashLoopBackOff  = "crashLoopBackOff"  // Container keeps crashing
+	execErrPodCompleted      = "podCompleted"      // Pod has finished (Succeeded or Failed)
+	execErrForbidden         = "forbidden"         // RBAC denies pods/exec
+	execErrUnauthorized      = "unauthorized"      // Credentials rejected or expired
+	execErrConnectionRefused = "connectionRefused" // API server unreachable
+)
+
+// execErrorPatterns maps substrings of kubectl's own error lines to an errorKind; first match wins,
+// so the more specific container states come before the generic not-found cases
+var execErrorPatterns = []struct {
+	substr string
+	kind   string
+}{
+	{"CrashLoopBackOff", execErrCrashLoopBackOff},
+	{"back-off restarting failed container", execErrCrashLoopBackOff},
+	{"cannot exec into a container in a completed pod", execErrPodCompleted},
+	{"does not have a host assigned", execErrContainerNotReady},
+	{"container is not created or running", execErrContainerNotReady},
+	{"ContainerCreating", execErrContainerNotReady},
+	{"PodInitializing", execErrContainerNotReady},
+	{"is not valid for pod", execErrContainerNotFound},
+	{"container not found", execErrContainerNotFound},
+	{"(NotFound)", execErrPodNotFound},
+	{"pod does not exist", execErrPodNotFound},
+	{"(Forbidden)", execErrForbidden},
+	{"(Unauthorized)", execErrUnauthorized},
+	{"connection refused", execErrConnectionRefused},
+	{"was refused - did you specify the right host or port", execErrConnectionRefused},
+}
+
+// classifyExecError returns the errorKind of a failed kubectl exec, or "" if the command ran in
+// the container (and failed on its own) or the failure isn't recognized. Only kubectl's own
+// error lines are considered, so the command's output can't be mistaken for one
+func classifyExecError(output string) string {
+	var kubectlErrors []string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		// kubectl reports the remote command's exit status this way; the exec itself worked
+		if strings.HasPrefix(line, "command terminated with exit code") {
+			return ""
+		}
+		if strings.HasPrefix(line, "error:") || strings.HasPrefix(line, "Error from server") ||
+			strings.HasPrefix(line, "Unable to connect to the server") || strings.HasPrefix(line, "The connection to the server") {
+			kubectlErrors = append(kubectlErrors, line)
+		}
+	}
+
+	for _, p := range execErrorPatterns {
+		for _, line := range kubectlErrors {
+			if strings.Contains(line, p.substr) {
+				return p.kind
+			}
+		}
+	}
+	return ""
+}
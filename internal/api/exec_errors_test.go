@@ -0,0 +1,68 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/session"
+)
+
+func TestClassifyExecError(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   string
+	}{
+		{"pod not found", `Error from server (NotFound): pods "web-1" not found`, execErrPodNotFound},
+		{"container not valid", `Error from server (BadRequest): container sidecar is not valid for pod web-1`, execErrContainerNotFound},
+		{"container not found on upgrade", `error: unable to upgrade connection: container not found ("app")`, execErrContainerNotFound},
+		{"pod pending", `Error from server (BadRequest): pod web-1 does not have a host assigned`, execErrContainerNotReady},
+		{"container creating", `error: unable to upgrade connection: container "app" in pod "web-1" is waiting to start: ContainerCreating`, execErrContainerNotReady},
+		{"container not running", `error: Internal error occurred: error executing command in container: container is not created or running`, execErrContainerNotReady},
+		{"crash loop", `error: unable to upgrade connection: container "app" in pod "web-1" is waiting to start: CrashLoopBackOff`, execErrCrashLoopBackOff},
+		{"completed pod", `error: cannot exec into a container in a completed pod; current phase is Succeeded`, execErrPodCompleted},
+		{"forbidden", `Error from server (Forbidden): pods "web-1" is forbidden: User "dev" cannot create resource "pods/exec" in API group "" in the namespace "default"`, execErrForbidden},
+		{"unauthorized", `error: You must be logged in to the server (Unauthorized)`, execErrUnauthorized},
+		{"connection refused", `The connection to the server 10.0.0.1:6443 was refused - did you specify the right host or port?`, execErrConnectionRefused},
+		{"dial refused", `Unable to connect to the server: dial tcp 10.0.0.1:6443: connect: connection refused`, execErrConnectionRefused},
+		{"command failed in container", "cat: /missing: No such file or directory\ncommand terminated with exit code 1", ""},
+		{"command printing a kubectl-like error", "Error from server (NotFound): pods \"x\" not found\ncommand terminated with exit code 2", ""},
+		{"not a kubectl line", `grep: pods "web" not found (NotFound)`, ""},
+		{"unknown", `error: something new went wrong`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyExecError(tt.output); got != tt.want {
+				t.Errorf("classifyExecError(%q) = %q, want %q", tt.output, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecute_ReportsErrorKind(t *testing.T) {
+	installFakeKubectl(t, `echo 'Error from server (NotFound): pods "web" not found' >&2
+exit 1
+`)
+
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	handler := &ExecHandler{sessionMgr: sessionMgr}
+
+	rec := httptest.NewRecorder()
+	body := `{"namespace":"default","podName":"web","container":"app","command":["ls"]}`
+	handler.Execute(rec, httptest.NewRequest(http.MethodPost, "/exec", strings.NewReader(body)))
+
+	var resp ExecResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.ExitCode != 1 || resp.ErrorKind != execErrPodNotFound {
+		t.Errorf("exitCode = %d, errorKind = %q; want 1, %q", resp.ExitCode, resp.ErrorKind, execErrPodNotFound)
+	}
+	if !strings.Contains(resp.Output, `pods "web" not found`) {
+		t.Errorf("raw output not kept: %q", resp.Output)
+	}
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExecSimple handles GET /exec/simple - a synchronous exec with its parameters in the query,
+// for quick one-shot commands such as "cat /etc/hostname"; POST /exec remains the full interface
+// Query: namespace, pod, cmd (required), container, context, clusterHash, kubeconfigPath, timeout
+func (h *ExecHandler) ExecSimple(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+
+	// Any web page can make a browser send a GET, so only direct clients may run commands this way
+	if fromWebPage(r) {
+		writeExecError(w, http.StatusForbidden, startTime, "/exec/simple can't be called from a web page")
+		return
+	}
+
+	q := r.URL.Query()
+	req := ExecRequest{
+		Namespace:      q.Get("namespace"),
+		PodName:        q.Get("pod"),
+		Container:      q.Get("container"),
+		Command:        simpleExecCommand(q["cmd"]),
+		KubeconfigPath: q.Get("kubeconfigPath"),
+		Context:        q.Get("context"),
+		ClusterHash:    q.Get("clusterHash"),
+	}
+	if req.Namespace == "" || req.PodName == "" || len(req.Command) == 0 {
+		writeExecError(w, http.StatusBadRequest, startTime, "Missing required query parameters: namespace, pod, cmd")
+		return
+	}
+	if raw := q.Get("timeout"); raw != "" {
+		timeout, err := strconv.Atoi(raw)
+		if err != nil || timeout < 0 {
+			writeExecError(w, http.StatusBadRequest, startTime, "timeout must be a number of seconds")
+			return
+		}
+		req.Timeout = timeout
+	}
+
+	h.execute(w, r, req, startTime)
+}
+
+// simpleExecCommand builds the command from the cmd query values: several values are the
+// arguments as given, a single one is split on whitespace. No shell is involved, so quotes,
+// pipes and $ reach the command as plain text
+func simpleExecCommand(values []string) []string {
+	if len(values) == 1 {
+		return strings.Fields(values[0])
+	}
+	return values
+}
+
+// fromWebPage reports whether a browser sent r on behalf of a web page rather than a user
+// typing the URL; native clients send neither header
+func fromWebPage(r *http.Request) bool {
+	if r.Header.Get("Origin") != "" {
+		return true
+	}
+	site := r.Header.Get("Sec-Fetch-Site")
+	return site != "" && site != "none"
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/session"
+)
+
+func TestExecSimple(t *testing.T) {
+	// Print each argument after "--" on its own line, so argument boundaries are visible
+	installFakeKubectl(t, "while [ \"$1\" != -- ]; do shift; done; shift; printf '[%s]\\n' \"$@\"\n")
+
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	handler := &ExecHandler{sessionMgr: sessionMgr}
+
+	tests := []struct {
+		name       string
+		query      url.Values
+		header     http.Header
+		wantStatus int
+		wantOutput string
+		wantError  string
+	}{
+		{
+			name:       "single cmd is split on whitespace",
+			query:      url.Values{"namespace": {"default"}, "pod": {"web"}, "cmd": {"cat  /etc/hostname"}},
+			wantStatus: http.StatusOK,
+			wantOutput: "[cat]\n[/etc/hostname]\n",
+		},
+		{
+			name:       "repeated cmd is the argv as given",
+			query:      url.Values{"namespace": {"default"}, "pod": {"web"}, "container": {"app"}, "cmd": {"ls", "-l", "/my dir"}},
+			wantStatus: http.StatusOK,
+			wantOutput: "[ls]\n[-l]\n[/my dir]\n",
+		},
+		{
+			name:       "shell syntax is plain text",
+			query:      url.Values{"namespace": {"default"}, "pod": {"web"}, "cmd": {"echo $(id); rm -rf /"}},
+			wantStatus: http.StatusOK,
+			wantOutput: "[echo]\n[$(id);]\n[rm]\n[-rf]\n[/]\n",
+		},
+		{
+			name:       "missing cmd",
+			query:      url.Values{"namespace": {"default"}, "pod": {"web"}},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "Missing required query parameters: namespace, pod, cmd",
+		},
+		{
+			name:       "blank cmd",
+			query:      url.Values{"namespace": {"default"}, "pod": {"web"}, "cmd": {"   "}},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "Missing required query parameters: namespace, pod, cmd",
+		},
+		{
+			name:       "invalid timeout",
+			query:      url.Values{"namespace": {"default"}, "pod": {"web"}, "cmd": {"ls"}, "timeout": {"5s"}},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "timeout must be a number of seconds",
+		},
+		{
+			name:       "cross-origin request",
+			query:      url.Values{"namespace": {"default"}, "pod": {"web"}, "cmd": {"ls"}},
+			header:     http.Header{"Origin": {"https://example.com"}},
+			wantStatus: http.StatusForbidden,
+			wantError:  "/exec/simple can't be called from a web page",
+		},
+		{
+			name:       "request made by a page",
+			query:      url.Values{"namespace": {"default"}, "pod": {"web"}, "cmd": {"ls"}},
+			header:     http.Header{"Sec-Fetch-Site": {"cross-site"}},
+			wantStatus: http.StatusForbidden,
+			wantError:  "/exec/simple can't be called from a web page",
+		},
+		{
+			name:       "URL typed into the browser",
+			query:      url.Values{"namespace": {"default"}, "pod": {"web"}, "cmd": {"ls"}},
+			header:     http.Header{"Sec-Fetch-Site": {"none"}},
+			wantStatus: http.StatusOK,
+			wantOutput: "[ls]\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/exec/simple?"+tt.query.Encode(), nil)
+			for key, values := range tt.header {
+				req.Header[key] = values
+			}
+			rec := httptest.NewRecorder()
+			handler.ExecSimple(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			var resp ExecResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if resp.Output != tt.wantOutput {
+				t.Errorf("output = %q, want %q", resp.Output, tt.wantOutput)
+			}
+			if resp.Error != tt.wantError {
+				t.Errorf("error = %q, want %q", resp.Error, tt.wantError)
+			}
+		})
+	}
+}
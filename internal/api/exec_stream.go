@@ -0,0 +1,62 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Trailers ending a streamed /exec response, carrying what ExecResponse would hold besides the output
+// Other /exec responses send the exit code as an X-Exit-Code header; see writeExecResponse
+const (
+	execTrailerExitCode  = "X-Exec-Exit-Code"
+	execTrailerDuration  = "X-Exec-Duration"
+	execTrailerAttempts  = "X-Exec-Attempts"
+	execTrailerError     = "X-Exec-Error"
+	execTrailerErrorKind = "X-Exec-Error-Kind"
+	execTrailerTruncated = "X-Exec-Truncated"
+)
+
+// execStream is a /exec response for stream: true. kubectl's combined output is flushed to the
+// client as it arrives, and the exit code, duration and errors follow as HTTP trailers
+type execStream struct {
+	flushWriter
+	w http.ResponseWriter
+}
+
+// startExecStream sends the headers of a streamed /exec response
+// Nothing can be reported through the status code after this, so call it once setup has succeeded
+func startExecStream(w http.ResponseWriter, kubeconfigPath string) *execStream {
+	h := w.Header()
+	h.Set("Content-Type", "application/octet-stream") // Raw output, not necessarily UTF-8
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Trailer", strings.Join([]string{
+		execTrailerExitCode, execTrailerDuration, execTrailerAttempts,
+		execTrailerError, execTrailerErrorKind, execTrailerTruncated,
+	}, ", "))
+	if kubeconfigPath != "" {
+		h.Set("X-Exec-Kubeconfig-Path", kubeconfigPath)
+	}
+	w.WriteHeader(http.StatusOK)
+
+	s := &execStream{flushWriter: flushWriter{w: w, rc: http.NewResponseController(w)}, w: w}
+	s.rc.Flush() // The client sees the command has started before it prints anything
+	return s
+}
+
+// finish writes resp as trailers; its output has already been streamed
+func (s *execStream) finish(resp ExecResponse) {
+	h := s.w.Header()
+	h.Set(execTrailerExitCode, strconv.Itoa(int(resp.ExitCode)))
+	h.Set(execTrailerDuration, strconv.FormatFloat(resp.Duration, 'f', -1, 64))
+	h.Set(execTrailerAttempts, strconv.Itoa(resp.Attempts))
+	if resp.Error != "" {
+		h.Set(execTrailerError, resp.Error)
+	}
+	if resp.ErrorKind != "" {
+		h.Set(execTrailerErrorKind, resp.ErrorKind)
+	}
+	if resp.Truncated {
+		h.Set(execTrailerTruncated, "true")
+	}
+}
@@ -0,0 +1,574 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/kubedeskpro/kubedesk-helper/internal/cluster"
+	"github.com/kubedeskpro/kubedesk-helper/internal/session"
+)
+
+func TestExecute_RetriesTransientFailure(t *testing.T) {
+	installFlakyKubectl(t, 1, "error: You must be logged in to the server (Unauthorized)")
+
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	handler := &ExecHandler{sessionMgr: sessionMgr}
+
+	body, _ := json.Marshal(ExecRequest{Namespace: "default", PodName: "web", Container: "app", Command: []string{"ls"}, Retries: 1})
+	rec := httptest.NewRecorder()
+	handler.Execute(rec, httptest.NewRequest(http.MethodPost, "/exec", strings.NewReader(string(body))))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+
+	var resp ExecResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.ExitCode != 0 || resp.Attempts != 2 || strings.TrimSpace(resp.Output) != "ok" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+}
+
+func TestExecStart_StopDoesNotLeakGoroutines(t *testing.T) {
+	// kubectl leaves a child holding stdout/stderr open after it is killed
+	installFakeKubectl(t, `[ "$1" = get ] && { echo '{}'; exit 0; }
+sleep 5 &
+exec sleep 30
+`)
+
+	orig := execOutputWaitDelay
+	execOutputWaitDelay = 100 * time.Millisecond
+	defer func() { execOutputWaitDelay = orig }()
+
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	handler := &ExecHandler{sessionMgr: sessionMgr}
+
+	baseline := runtime.NumGoroutine()
+
+	for i := 0; i < 10; i++ {
+		body, _ := json.Marshal(ExecStartRequest{Namespace: "default", PodName: "web", Command: []string{"sh"}})
+		rec := httptest.NewRecorder()
+		handler.Start(rec, httptest.NewRequest(http.MethodPost, "/exec/start", strings.NewReader(string(body))))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+		}
+		var resp ExecStartResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if err := sessionMgr.Stop(resp.SessionID); err != nil {
+			t.Fatalf("Stop: %v", err)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > baseline {
+		if time.Now().After(deadline) {
+			t.Fatalf("goroutines did not return to baseline: %d > %d", runtime.NumGoroutine(), baseline)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestExecStart_CapturesAllOutput(t *testing.T) {
+	installFakeKubectl(t, `echo out
+echo err >&2
+`)
+
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	handler := &ExecHandler{sessionMgr: sessionMgr}
+
+	body, _ := json.Marshal(ExecStartRequest{Namespace: "default", PodName: "web", Command: []string{"true"}})
+	rec := httptest.NewRecorder()
+	handler.Start(rec, httptest.NewRequest(http.MethodPost, "/exec/start", strings.NewReader(string(body))))
+	var resp ExecStartResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	sess, _ := sessionMgr.Get(resp.SessionID)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		// The session is marked stopped only after Wait has copied all output
+		if sessionMgr.Counts()[session.TypeExec][session.StatusStopped] == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("exec session did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if output := sess.ReadOutput(); !strings.Contains(output, "out") || !strings.Contains(output, "err") {
+		t.Errorf("output = %q, want both stdout and stderr", output)
+	}
+}
+
+func TestExecStart_StartTimeout(t *testing.T) {
+	// "stuck" blocks before printing anything, like kubectl failing to open the exec stream
+	installFakeKubectl(t, `[ "$1" = get ] && { echo '{}'; exit 0; }
+case "$*" in *stuck*) exec sleep 30 ;; esac
+echo ready
+exec sleep 30
+`)
+
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	defer sessionMgr.StopAll()
+	handler := &ExecHandler{sessionMgr: sessionMgr}
+	events, cancel := sessionMgr.Subscribe()
+	defer cancel()
+
+	start := func(command string) string {
+		t.Helper()
+		body, _ := json.Marshal(ExecStartRequest{Namespace: "default", PodName: "web", Command: []string{command}, StartTimeout: 1})
+		rec := httptest.NewRecorder()
+		handler.Start(rec, httptest.NewRequest(http.MethodPost, "/exec/start", strings.NewReader(string(body))))
+		var resp ExecStartResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp.SessionID
+	}
+	stuck := start("stuck")
+	ready := start("ready")
+
+	var failed session.Event
+	for timeout := time.After(5 * time.Second); failed.SessionID == ""; {
+		select {
+		case e := <-events:
+			if e.Kind == session.EventStatusChanged && e.Status == session.StatusFailed {
+				failed = e
+			}
+		case <-timeout:
+			t.Fatal("stuck session was not failed")
+		}
+	}
+	if failed.SessionID != stuck || !strings.Contains(failed.Reason, "startTimeout") {
+		t.Fatalf("failed event = %+v, want the stuck session with a startTimeout reason", failed)
+	}
+
+	// Killed, and the reason stays readable
+	sess, _ := sessionMgr.Get(stuck)
+	sess.WaitOutput(context.Background(), 0, 5*time.Second)
+	rec := httptest.NewRecorder()
+	req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/exec/output/"+stuck, nil), map[string]string{"sessionId": stuck})
+	handler.Output(rec, req)
+	var output ExecOutputResponse
+	if err := json.NewDecoder(rec.Body).Decode(&output); err != nil {
+		t.Fatalf("decode output: %v", err)
+	}
+	if output.Status != string(session.StatusFailed) || output.Error != failed.Reason || output.ExitCode == nil || *output.ExitCode != -1 {
+		t.Errorf("output = %+v, want failed with the reason and exit code -1", output)
+	}
+
+	// The session that printed right away is left running
+	counts := sessionMgr.Counts()[session.TypeExec]
+	if counts[session.StatusRunning] != 1 || counts[session.StatusFailed] != 1 {
+		t.Errorf("exec sessions by status = %v, want %s still running", counts, ready)
+	}
+}
+
+func TestExecStart_StartTimeoutIgnoresEchoedInput(t *testing.T) {
+	// Stuck before printing anything; typing into it must not count as kubectl having started
+	installFakeKubectl(t, `[ "$1" = get ] && { echo '{}'; exit 0; }
+exec sleep 30
+`)
+
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	defer sessionMgr.StopAll()
+	handler := &ExecHandler{sessionMgr: sessionMgr}
+
+	body, _ := json.Marshal(ExecStartRequest{Namespace: "default", PodName: "web", Command: []string{"sh"}, StartTimeout: 1, EchoInput: true})
+	rec := httptest.NewRecorder()
+	handler.Start(rec, httptest.NewRequest(http.MethodPost, "/exec/start", strings.NewReader(string(body))))
+	var resp ExecStartResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	input, _ := json.Marshal(ExecInputRequest{Input: "ls\n"})
+	rec = httptest.NewRecorder()
+	req := mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/exec/input/"+resp.SessionID, strings.NewReader(string(input))), map[string]string{"sessionId": resp.SessionID})
+	handler.Input(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("input: status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	sess, _ := sessionMgr.Get(resp.SessionID)
+	if !strings.Contains(sess.ReadOutput(), "ls") {
+		t.Fatalf("output = %q, want the echoed input", sess.ReadOutput())
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for sessionMgr.StatusOf(sess) != session.StatusFailed && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if status := sessionMgr.StatusOf(sess); status != session.StatusFailed || !strings.Contains(sess.FailReason(), "startTimeout") {
+		t.Errorf("status = %s (%q), want failed by startTimeout despite echoed input", status, sess.FailReason())
+	}
+}
+
+func TestExecStart_NoTruncationOnBurstBeforeExit(t *testing.T) {
+	// 1 MiB written in one go right before exiting, on both streams
+	installFakeKubectl(t, `head -c 524288 /dev/zero | tr '\0' o
+head -c 524288 /dev/zero | tr '\0' e >&2
+`)
+
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	handler := &ExecHandler{sessionMgr: sessionMgr}
+
+	body, _ := json.Marshal(ExecStartRequest{Namespace: "default", PodName: "web", Container: "app", Command: []string{"true"}})
+	rec := httptest.NewRecorder()
+	handler.Start(rec, httptest.NewRequest(http.MethodPost, "/exec/start", strings.NewReader(string(body))))
+	var resp ExecStartResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	sess, _ := sessionMgr.Get(resp.SessionID)
+	deadline := time.Now().Add(5 * time.Second)
+	for sessionMgr.Counts()[session.TypeExec][session.StatusStopped] != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("exec session did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Stopped is only set once Wait has drained both pipes, so everything must be there already
+	output := sess.ReadOutput()
+	if len(output) != 1<<20 {
+		t.Fatalf("output is %d bytes, want %d", len(output), 1<<20)
+	}
+	if o, e := strings.Count(output, "o"), strings.Count(output, "e"); o != 1<<19 || e != 1<<19 {
+		t.Errorf("got %d stdout and %d stderr bytes, want %d each", o, e, 1<<19)
+	}
+}
+
+func TestExecInput_Echo(t *testing.T) {
+	installFakeKubectl(t, `read line
+echo "got:$line"
+exec sleep 30
+`)
+
+	for _, echo := range []bool{false, true} {
+		sessionMgr := session.NewManager()
+		defer sessionMgr.Shutdown()
+		handler := &ExecHandler{sessionMgr: sessionMgr}
+
+		body, _ := json.Marshal(ExecStartRequest{Namespace: "default", PodName: "web", Container: "app", Command: []string{"sh"}, EchoInput: echo})
+		rec := httptest.NewRecorder()
+		handler.Start(rec, httptest.NewRequest(http.MethodPost, "/exec/start", strings.NewReader(string(body))))
+		var resp ExecStartResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("echo=%v: Failed to decode response: %v", echo, err)
+		}
+
+		sess, _ := sessionMgr.Get(resp.SessionID)
+		if err := sess.WriteInput("ls\n"); err != nil {
+			t.Fatalf("echo=%v: WriteInput: %v", echo, err)
+		}
+
+		deadline := time.Now().Add(5 * time.Second)
+		for !strings.Contains(sess.ReadOutput(), "got:ls") {
+			if time.Now().After(deadline) {
+				t.Fatalf("echo=%v: no output from the process: %q", echo, sess.ReadOutput())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		want := "got:ls\n"
+		if echo {
+			want = "ls\ngot:ls\n"
+		}
+		if output := sess.ReadOutput(); output != want {
+			t.Errorf("echo=%v: output = %q, want %q", echo, output, want)
+		}
+	}
+}
+
+func TestExecute_ErrorsAreJSON(t *testing.T) {
+	installFakeKubectl(t, "echo ok\n")
+
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	handler := &ExecHandler{sessionMgr: sessionMgr}
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantError  string
+	}{
+		{"Malformed body", `{"namespace":`, http.StatusBadRequest, "Invalid request body"},
+		{"Missing fields", `{"namespace":"default"}`, http.StatusBadRequest, "Missing required fields"},
+		{"Blank command", `{"namespace":"default","podName":"web","command":["",""]}`, http.StatusBadRequest, "only empty or whitespace"},
+		{"Whitespace command", `{"namespace":"default","podName":"web","command":["  "]}`, http.StatusBadRequest, "only empty or whitespace"},
+		{"Blank program", `{"namespace":"default","podName":"web","command":["","ls"]}`, http.StatusBadRequest, "command[0] is empty"},
+		{"Retries out of range", `{"namespace":"default","podName":"web","command":["ls"],"retries":9}`, http.StatusBadRequest, "retries must be"},
+		{"Hash mismatch", `{"namespace":"default","podName":"web","command":["ls"],"context":"dev","clusterHash":"0000000000000000"}`, http.StatusBadRequest, "Cluster hash mismatch"},
+		{"Relative kubeconfigPath", `{"namespace":"default","podName":"web","command":["ls"],"kubeconfigPath":"config"}`, http.StatusBadRequest, "absolute"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.Execute(rec, httptest.NewRequest(http.MethodPost, "/exec", strings.NewReader(tt.body)))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", ct)
+			}
+			var resp ExecResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("error body is not JSON: %v", err)
+			}
+			if resp.ExitCode != -1 || !strings.Contains(resp.Error, tt.wantError) {
+				t.Errorf("response = %+v, want exitCode -1 and error containing %q", resp, tt.wantError)
+			}
+			if got := rec.Header().Get("X-Exit-Code"); got != "-1" {
+				t.Errorf("X-Exit-Code = %q, want -1", got)
+			}
+		})
+	}
+}
+
+func TestExecute_ExitCodeHeader(t *testing.T) {
+	// The fake pod runs "exit N" like a shell would
+	installFakeKubectl(t, "while [ \"$1\" != -- ]; do shift; done; shift; echo done; exit \"$2\"\n")
+
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	handler := &ExecHandler{sessionMgr: sessionMgr}
+
+	for _, code := range []int{0, 1, 42} {
+		t.Run(strconv.Itoa(code), func(t *testing.T) {
+			body, _ := json.Marshal(ExecRequest{Namespace: "default", PodName: "web", Command: []string{"exit", strconv.Itoa(code)}})
+			rec := httptest.NewRecorder()
+			handler.Execute(rec, httptest.NewRequest(http.MethodPost, "/exec", strings.NewReader(string(body))))
+
+			// The HTTP call succeeded whatever the command's exit code
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+			}
+			if got := rec.Header().Get("X-Exit-Code"); got != strconv.Itoa(code) {
+				t.Errorf("X-Exit-Code = %q, want %d", got, code)
+			}
+			var resp ExecResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if resp.ExitCode != int32(code) || strings.TrimSpace(resp.Output) != "done" {
+				t.Errorf("unexpected response: %+v", resp)
+			}
+		})
+	}
+}
+
+func TestCheckExecCommand(t *testing.T) {
+	tests := []struct {
+		command []string
+		wantErr bool
+	}{
+		{[]string{"ls"}, false},
+		{[]string{"sh", "-c", ""}, false},
+		{[]string{"echo", " "}, false},
+		{[]string{""}, true},
+		{[]string{"", ""}, true},
+		{[]string{" \t", "\n"}, true},
+		{[]string{" ", "ls"}, true},
+	}
+	for _, tt := range tests {
+		if err := checkExecCommand(tt.command); (err != nil) != tt.wantErr {
+			t.Errorf("checkExecCommand(%q) = %v, wantErr %v", tt.command, err, tt.wantErr)
+		}
+	}
+
+	// /exec/start rejects them too, before looking for kubectl
+	handler := &ExecHandler{}
+	rec := httptest.NewRecorder()
+	handler.Start(rec, httptest.NewRequest(http.MethodPost, "/exec/start", strings.NewReader(`{"namespace":"default","podName":"web","command":["  ",""]}`)))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "only empty or whitespace") {
+		t.Errorf("exec start: status %d, body %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestExecute_HashOnlyUsesRegistry(t *testing.T) {
+	installFakeKubectl(t, `echo "$@"
+cat "$KUBECONFIG"
+`)
+
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	handler := &ExecHandler{sessionMgr: sessionMgr}
+
+	// An earlier request (e.g. /proxy/start) registered the cluster
+	hash := cluster.ComputeAndRegister(testKubeconfigYAML, "prod")
+
+	body, _ := json.Marshal(ExecRequest{Namespace: "default", PodName: "web", Command: []string{"ls"}, ClusterHash: hash})
+	rec := httptest.NewRecorder()
+	handler.Execute(rec, httptest.NewRequest(http.MethodPost, "/exec", strings.NewReader(string(body))))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var resp ExecResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if !strings.Contains(resp.Output, "--context prod") || !strings.Contains(resp.Output, "current-context") {
+		t.Errorf("expected registered context and kubeconfig to be used, output = %q", resp.Output)
+	}
+
+	// Unknown hashes are rejected with a JSON error
+	body, _ = json.Marshal(ExecRequest{Namespace: "default", PodName: "web", Command: []string{"ls"}, ClusterHash: "ffffffffffffffff"})
+	rec = httptest.NewRecorder()
+	handler.Execute(rec, httptest.NewRequest(http.MethodPost, "/exec", strings.NewReader(string(body))))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "not found in registry") {
+		t.Errorf("unknown hash: status %d, body %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestExecute_UsesDefaultContainerAnnotation(t *testing.T) {
+	installFakeKubectl(t, `case "$*" in
+  *"get pod multi -n default -o json"*) echo '{"metadata":{"annotations":{"kubectl.kubernetes.io/default-container":"app"}},"spec":{"containers":[{"name":"istio-proxy"},{"name":"app"}]}}' ;;
+  *"get pod plain -n default -o json"*) echo '{"metadata":{},"spec":{"containers":[{"name":"main"}]}}' ;;
+  *) echo "$@" ;;
+esac
+`)
+
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	handler := &ExecHandler{sessionMgr: sessionMgr}
+
+	tests := []struct {
+		name      string
+		pod       string
+		container string
+		want      string
+		notWant   string
+	}{
+		{"Annotation honored", "multi", "", "-c app multi", ""},
+		{"Explicit container wins", "multi", "istio-proxy", "-c istio-proxy multi", "-c app"},
+		{"No annotation leaves it to kubectl", "plain", "", "-n default plain", "-c "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(ExecRequest{Namespace: "default", PodName: tt.pod, Container: tt.container, Command: []string{"ls"}})
+			rec := httptest.NewRecorder()
+			handler.Execute(rec, httptest.NewRequest(http.MethodPost, "/exec", strings.NewReader(string(body))))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+			}
+			var resp ExecResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if !strings.Contains(resp.Output, tt.want) {
+				t.Errorf("output = %q, want %q", resp.Output, tt.want)
+			}
+			if tt.notWant != "" && strings.Contains(resp.Output, tt.notWant) {
+				t.Errorf("output = %q, should not contain %q", resp.Output, tt.notWant)
+			}
+		})
+	}
+}
+
+func TestExecute_TruncatesOversizedOutput(t *testing.T) {
+	installFakeKubectl(t, `[ "$1" = get ] && { echo '{}'; exit 0; }
+exec yes
+`)
+	setMaxOutputBytes(t, 4096)
+
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	handler := &ExecHandler{sessionMgr: sessionMgr}
+
+	body, _ := json.Marshal(ExecRequest{Namespace: "default", PodName: "web", Command: []string{"cat", "/var/log/huge.log"}})
+	rec := httptest.NewRecorder()
+	handler.Execute(rec, httptest.NewRequest(http.MethodPost, "/exec", strings.NewReader(string(body))))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var resp ExecResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if !resp.Truncated || resp.ExitCode != -1 || len(resp.Output) != 4096 {
+		t.Errorf("truncated %v, exit %d, %d bytes; want true, -1, 4096", resp.Truncated, resp.ExitCode, len(resp.Output))
+	}
+}
+
+func TestExecute_StreamFlushesProgressively(t *testing.T) {
+	// Prints a line, then waits for the test to have read it before finishing
+	marker := filepath.Join(t.TempDir(), "seen")
+	installFakeKubectl(t, `echo first
+while [ ! -f '`+marker+`' ]; do sleep 0.02; done
+echo second
+exit 3
+`)
+
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	server := httptest.NewServer(http.HandlerFunc((&ExecHandler{sessionMgr: sessionMgr}).Execute))
+	defer server.Close()
+
+	body, _ := json.Marshal(ExecRequest{Namespace: "default", PodName: "web", Container: "app", Command: []string{"migrate"}, Stream: true, Timeout: 10})
+	resp, err := http.Post(server.URL, "application/json", strings.NewReader(string(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || len(resp.TransferEncoding) == 0 || resp.TransferEncoding[0] != "chunked" {
+		t.Fatalf("status %d, transfer encoding %v; want 200 chunked", resp.StatusCode, resp.TransferEncoding)
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	if err != nil || line != "first\n" {
+		t.Fatalf("first line = %q, %v; want it before the command finishes", line, err)
+	}
+	if err := os.WriteFile(marker, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	rest, err := io.ReadAll(reader)
+	if err != nil || string(rest) != "second\n" {
+		t.Fatalf("rest = %q, %v", rest, err)
+	}
+
+	if got := resp.Trailer.Get("X-Exec-Exit-Code"); got != "3" {
+		t.Errorf("exit code trailer = %q, want 3", got)
+	}
+	if d, err := strconv.ParseFloat(resp.Trailer.Get("X-Exec-Duration"), 64); err != nil || d <= 0 {
+		t.Errorf("duration trailer = %q", resp.Trailer.Get("X-Exec-Duration"))
+	}
+	if got := resp.Trailer.Get("X-Exec-Attempts"); got != "1" {
+		t.Errorf("attempts trailer = %q, want 1", got)
+	}
+
+	// Retries would repeat output that was already sent
+	body, _ = json.Marshal(ExecRequest{Namespace: "default", PodName: "web", Container: "app", Command: []string{"ls"}, Stream: true, Retries: 1})
+	rec := httptest.NewRecorder()
+	(&ExecHandler{sessionMgr: sessionMgr}).Execute(rec, httptest.NewRequest(http.MethodPost, "/exec", strings.NewReader(string(body))))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("stream with retries: status = %d, want 400", rec.Code)
+	}
+}
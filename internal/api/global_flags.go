@@ -0,0 +1,37 @@
+package api
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/kubectl"
+)
+
+// checkGlobalFlags validates a request's globalFlags
+// Strict mode also applies its own flag denylist, which includes --insecure-skip-tls-verify
+func checkGlobalFlags(flags []string, strict bool) error {
+	if err := kubectl.ValidateGlobalFlags(flags); err != nil {
+		return err
+	}
+	if strict {
+		return kubectl.ValidateArgs(flags, true)
+	}
+	return nil
+}
+
+// leadingKubectlArgs returns the args that go right after kubectl, before a command's own:
+// the request's global flags, then its impersonation flags. The args may end in "--"
+// followed by a command's own arguments, so nothing can be appended after them
+func leadingKubectlArgs(globalFlags []string, imp kubectl.Impersonation) []string {
+	return append(slices.Clone(globalFlags), imp.Args()...)
+}
+
+// injectKubectlGlobalFlags adds the request's global flags to each kubectl invocation in the
+// command, the same way injectKubectlContext adds --context. The allow-list admits no values
+// with shell metacharacters
+func injectKubectlGlobalFlags(command string, flags []string) string {
+	if len(flags) == 0 {
+		return command
+	}
+	return injectKubectlFlags(command, strings.Join(flags, " "))
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/kubectl"
+	"github.com/kubedeskpro/kubedesk-helper/internal/session"
+)
+
+func TestKubectl_GlobalFlags(t *testing.T) {
+	installFakeKubectl(t, `echo "$@"
+`)
+
+	post := func(handler *KubectlHandler, req KubectlRequest) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(req)
+		rec := httptest.NewRecorder()
+		handler.Handle(rec, httptest.NewRequest(http.MethodPost, "/kubectl", strings.NewReader(string(body))))
+		return rec
+	}
+
+	rec := post(&KubectlHandler{}, KubectlRequest{
+		Args:          []string{"get", "pods"},
+		GlobalFlags:   []string{"--v=6", "--request-timeout=30s"},
+		Impersonation: kubectl.Impersonation{As: "jane"},
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var resp KubectlResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if want := "--v=6 --request-timeout=30s --as=jane get pods"; strings.TrimSpace(resp.Stdout) != want {
+		t.Errorf("kubectl args = %q, want %q", strings.TrimSpace(resp.Stdout), want)
+	}
+
+	rec = post(&KubectlHandler{}, KubectlRequest{Args: []string{"get", "pods"}, GlobalFlags: []string{"--kubeconfig=/tmp/other"}})
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "Invalid globalFlags") {
+		t.Errorf("disallowed flag: status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+
+	rec = post(&KubectlHandler{strictArgs: true}, KubectlRequest{Args: []string{"get", "pods"}, GlobalFlags: []string{"--insecure-skip-tls-verify"}})
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "strict mode") {
+		t.Errorf("strict mode: status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	rec = post(&KubectlHandler{strictArgs: true}, KubectlRequest{Args: []string{"get", "pods"}, GlobalFlags: []string{"--v=4"}})
+	if rec.Code != http.StatusOK {
+		t.Errorf("strict mode, allowed flag: status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestExecStart_RecordsGlobalFlags(t *testing.T) {
+	installFakeKubectl(t, `echo ok
+`)
+
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	handler := &ExecHandler{sessionMgr: sessionMgr}
+
+	body, _ := json.Marshal(ExecStartRequest{Namespace: "default", PodName: "web", Command: []string{"true"}, GlobalFlags: []string{"--v=8"}})
+	rec := httptest.NewRecorder()
+	handler.Start(rec, httptest.NewRequest(http.MethodPost, "/exec/start", strings.NewReader(string(body))))
+	var resp ExecStartResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v (body %s)", err, rec.Body.String())
+	}
+
+	sess, ok := sessionMgr.Get(resp.SessionID)
+	if !ok {
+		t.Fatal("session not found")
+	}
+	if !slices.Equal(sess.GlobalFlags, []string{"--v=8"}) {
+		t.Errorf("session global flags = %q", sess.GlobalFlags)
+	}
+	if len(sess.CommandLine) < 3 || !slices.Equal(sess.CommandLine[1:3], []string{"--v=8", "exec"}) {
+		t.Errorf("command line = %q, want the global flags right after kubectl", sess.CommandLine)
+	}
+
+	body, _ = json.Marshal(ExecStartRequest{Namespace: "default", PodName: "web", Command: []string{"true"}, GlobalFlags: []string{"--server=https://other"}})
+	rec = httptest.NewRecorder()
+	handler.Start(rec, httptest.NewRequest(http.MethodPost, "/exec/start", strings.NewReader(string(body))))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("disallowed flag: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestInjectKubectlGlobalFlags(t *testing.T) {
+	flags := []string{"--v=6", "--request-timeout=10s"}
+	tests := []struct {
+		command  string
+		flags    []string
+		expected string
+	}{
+		{"kubectl get pods", flags, "kubectl --v=6 --request-timeout=10s get pods"},
+		{"kubectl get pods && kubectl get svc", flags, "kubectl --v=6 --request-timeout=10s get pods && kubectl --v=6 --request-timeout=10s get svc"},
+		{"kubectl get pods", nil, "kubectl get pods"},
+		{"echo hello", flags, "echo hello"},
+	}
+
+	for _, tt := range tests {
+		if got := injectKubectlGlobalFlags(tt.command, tt.flags); got != tt.expected {
+			t.Errorf("injectKubectlGlobalFlags(%q) = %q, want %q", tt.command, got, tt.expected)
+		}
+	}
+
+	// Applied last, the global flags come right after kubectl
+	command := injectKubectlImpersonation(injectKubectlContext("kubectl get pods", "prod"), kubectl.Impersonation{As: "jane"})
+	if got, want := injectKubectlGlobalFlags(command, []string{"--v=6"}), "kubectl --v=6 --as=jane --context=prod get pods"; got != want {
+		t.Errorf("with context and impersonation = %q, want %q", got, want)
+	}
+}
@@ -3,17 +3,40 @@ package api
 import (
 	"encoding/json"
 	"net/http"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/config"
+	"github.com/kubedeskpro/kubedesk-helper/internal/kubeconfig"
 )
 
 // HealthHandler handles /health endpoint
 type HealthHandler struct {
 	version string
+	cfg     *config.Config
+	temp    *kubeconfig.TempManager // Probed on each request; nil skips the check
 }
 
 // HealthResponse represents the health check response
 type HealthResponse struct {
-	Version string `json:"version"`
-	Status  string `json:"status"`
+	Version        string     `json:"version"`
+	Status         string     `json:"status"` // "ok", or "degraded" when a check failed
+	ProxyPortRange *PortRange `json:"proxyPortRange,omitempty"`
+
+	TempDir *TempDirHealth `json:"tempDir,omitempty"`
+}
+
+// TempDirHealth reports whether temp kubeconfigs can be written
+// Every request carrying kubeconfig content fails when they can't
+type TempDirHealth struct {
+	Dir       string `json:"dir"`
+	Writable  bool   `json:"writable"`
+	FreeBytes uint64 `json:"freeBytes"`
+	Error     string `json:"error,omitempty"`
+}
+
+// PortRange is an inclusive port range
+type PortRange struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
 }
 
 // Handle processes health check requests
@@ -22,8 +45,32 @@ func (h *HealthHandler) Handle(w http.ResponseWriter, r *http.Request) {
 		Version: h.version,
 		Status:  "ok",
 	}
+	if h.cfg != nil {
+		// Effective range helps debug proxy port conflicts
+		response.ProxyPortRange = &PortRange{Min: h.cfg.ProxyPortMin, Max: h.cfg.ProxyPortMax}
+	}
+	if h.temp != nil {
+		response.TempDir = checkTempDir(h.temp)
+		if !response.TempDir.Writable {
+			response.Status = "degraded"
+		}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
+// checkTempDir probes the temp kubeconfig dir
+func checkTempDir(temp *kubeconfig.TempManager) *TempDirHealth {
+	health := &TempDirHealth{Dir: temp.Dir(), Writable: true}
+	if err := temp.Probe(); err != nil {
+		health.Writable = false
+		health.Error = err.Error()
+	}
+	if free, err := temp.FreeSpace(); err == nil {
+		health.FreeBytes = free
+	} else if health.Error == "" {
+		health.Error = err.Error()
+	}
+	return health
+}
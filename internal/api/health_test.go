@@ -0,0 +1,38 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/kubeconfig"
+)
+
+func TestHealth_TempDir(t *testing.T) {
+	get := func(handler *HealthHandler) HealthResponse {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.Handle(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200 even when degraded", rec.Code)
+		}
+		var resp HealthResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return resp
+	}
+
+	dir := t.TempDir()
+	resp := get(&HealthHandler{temp: kubeconfig.NewTempManager(dir)})
+	if resp.Status != "ok" || resp.TempDir == nil || !resp.TempDir.Writable || resp.TempDir.Dir != dir || resp.TempDir.FreeBytes == 0 {
+		t.Errorf("writable temp dir: %+v %+v", resp, resp.TempDir)
+	}
+
+	resp = get(&HealthHandler{temp: kubeconfig.NewTempManager(filepath.Join(dir, "missing"))})
+	if resp.Status != "degraded" || resp.TempDir == nil || resp.TempDir.Writable || resp.TempDir.Error == "" {
+		t.Errorf("unwritable temp dir: %+v %+v", resp, resp.TempDir)
+	}
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/session"
+)
+
+// Idempotency key limits; keys are remembered per handler and cluster
+const (
+	idempotencyTTL        = 10 * time.Minute
+	maxIdempotencyKeys    = 1024
+	maxIdempotencyKeySize = 128
+)
+
+// idempotentReplayHeader marks a response replayed for a repeated idempotencyKey
+const idempotentReplayHeader = "Idempotent-Replayed"
+
+// idempotentResult is the response a start request returned, kept for its retries
+type idempotentResult struct {
+	sessionID string
+	response  any
+	expires   time.Time
+}
+
+// idempotencyCache remembers which session a start request's idempotencyKey created,
+// so a retry returns that session instead of starting a duplicate
+// The zero value is ready to use
+type idempotencyCache struct {
+	locks   keyedMutex // Serializes concurrent retries of the same key
+	mu      sync.Mutex
+	entries map[string]idempotentResult
+	now     func() time.Time // Overridden in tests
+}
+
+// checkIdempotencyKey validates a request's optional idempotencyKey
+func checkIdempotencyKey(key string) error {
+	if len(key) > maxIdempotencyKeySize {
+		return fmt.Errorf("idempotencyKey must be at most %d bytes", maxIdempotencyKeySize)
+	}
+	return nil
+}
+
+// idempotencyCacheKey scopes a client key to a cluster, so reusing it elsewhere can't
+// return another cluster's session
+func idempotencyCacheKey(clusterHash, key string) string {
+	return clusterHash + "\x00" + key
+}
+
+// lock serializes requests for key; an empty key isn't idempotent and isn't locked
+func (c *idempotencyCache) lock(key string) func() {
+	if key == "" {
+		return func() {}
+	}
+	return c.locks.Lock(key)
+}
+
+// lookup returns the response stored for key while its session is still running;
+// once the session has stopped, a retry starts a new one
+func (c *idempotencyCache) lookup(key string, sessionMgr *session.Manager) (any, bool) {
+	if key == "" {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !c.clock().Before(entry.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	if sess, ok := sessionMgr.Get(entry.sessionID); !ok || sessionMgr.StatusOf(sess) != session.StatusRunning {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return entry.response, true
+}
+
+// store remembers the response a start request returned for key
+func (c *idempotencyCache) store(key, sessionID string, response any) {
+	if key == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[string]idempotentResult)
+	}
+	now := c.clock()
+	if len(c.entries) >= maxIdempotencyKeys {
+		for k, entry := range c.entries {
+			if !now.Before(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= maxIdempotencyKeys {
+			return // Full of live keys; a retry then falls back to the handler's own reuse
+		}
+	}
+	c.entries[key] = idempotentResult{sessionID: sessionID, response: response, expires: now.Add(idempotencyTTL)}
+}
+
+func (c *idempotencyCache) clock() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+// writeIdempotentReplay writes a stored start response again, flagged as a replay
+func writeIdempotentReplay(w http.ResponseWriter, response any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(idempotentReplayHeader, "true")
+	json.NewEncoder(w).Encode(response)
+}
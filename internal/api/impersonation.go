@@ -0,0 +1,24 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/kubectl"
+	"github.com/kubedeskpro/kubedesk-helper/internal/session"
+)
+
+// checkImpersonation validates a request's as/asGroup/asUid
+// Strict mode rejects impersonation outright, the same as it rejects the --as flags in args
+func checkImpersonation(imp kubectl.Impersonation, strict bool) error {
+	if strict && !imp.IsZero() {
+		return errors.New("impersonation is not allowed in strict mode")
+	}
+	return imp.Validate()
+}
+
+// setSessionImpersonation records the identity a session's kubectl runs as
+func setSessionImpersonation(sess *session.Session, imp kubectl.Impersonation) {
+	sess.ImpersonateUser = imp.As
+	sess.ImpersonateGroups = imp.AsGroup
+	sess.ImpersonateUID = imp.AsUID
+}
@@ -0,0 +1,178 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/kubectl"
+	"github.com/kubedeskpro/kubedesk-helper/internal/session"
+)
+
+func TestKubectl_Impersonation(t *testing.T) {
+	installFakeKubectl(t, `echo "$@"
+`)
+
+	post := func(handler *KubectlHandler, req KubectlRequest) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(req)
+		rec := httptest.NewRecorder()
+		handler.Handle(rec, httptest.NewRequest(http.MethodPost, "/kubectl", strings.NewReader(string(body))))
+		return rec
+	}
+	imp := kubectl.Impersonation{As: "jane@example.com", AsGroup: []string{"dev"}, AsUID: "42"}
+
+	rec := post(&KubectlHandler{}, KubectlRequest{Args: []string{"auth", "can-i", "delete", "pods"}, Impersonation: imp})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var resp KubectlResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if want := "--as=jane@example.com --as-group=dev --as-uid=42 auth can-i delete pods"; strings.TrimSpace(resp.Stdout) != want {
+		t.Errorf("kubectl args = %q, want %q", strings.TrimSpace(resp.Stdout), want)
+	}
+
+	rec = post(&KubectlHandler{}, KubectlRequest{Args: []string{"get", "pods"}, Impersonation: kubectl.Impersonation{As: "jane; id"}})
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "Invalid impersonation") {
+		t.Errorf("shell metacharacters: status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+
+	rec = post(&KubectlHandler{strictArgs: true}, KubectlRequest{Args: []string{"get", "pods"}, Impersonation: imp})
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "strict mode") {
+		t.Errorf("strict mode: status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestKubectl_ImpersonationIsPartOfCacheKey(t *testing.T) {
+	installFakeKubectl(t, `echo "$@"
+`)
+	handler := &KubectlHandler{cache: newResponseCache(time.Minute)}
+
+	for _, as := range []string{"", "jane", "jane", "bob"} {
+		body, _ := json.Marshal(KubectlRequest{Args: []string{"get", "pods"}, Impersonation: kubectl.Impersonation{As: as}})
+		rec := httptest.NewRecorder()
+		handler.Handle(rec, httptest.NewRequest(http.MethodPost, "/kubectl", strings.NewReader(string(body))))
+
+		var resp KubectlResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		want := "get pods"
+		if as != "" {
+			want = "--as=" + as + " get pods"
+		}
+		if got := strings.TrimSpace(resp.Stdout); got != want {
+			t.Errorf("as=%q: served %q, want %q", as, got, want)
+		}
+	}
+}
+
+func TestKubectlDelete_ConfirmCoversImpersonation(t *testing.T) {
+	installFakeKubectl(t, `echo "$@"
+`)
+
+	handler := &KubectlHandler{}
+	post := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.Delete(rec, httptest.NewRequest(http.MethodPost, "/kubectl/delete", strings.NewReader(body)))
+		return rec
+	}
+	const resources = `"resources":[{"type":"pods","name":"web-1","namespace":"default"}]`
+
+	rec := post(`{"dryRun":true,"as":"jane",` + resources + `}`)
+	var dry KubectlDeleteResponse
+	if err := json.NewDecoder(rec.Body).Decode(&dry); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if want := "delete pods web-1 --wait=false -n default --dry-run=server --as=jane"; dry.Results[0].Output != want {
+		t.Errorf("dry run args = %q, want %q", dry.Results[0].Output, want)
+	}
+
+	if rec := post(`{"confirm":"` + dry.Confirm + `",` + resources + `}`); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("token without impersonation: status = %d, want 412", rec.Code)
+	}
+	if rec := post(`{"confirm":"` + dry.Confirm + `","as":"jane",` + resources + `}`); rec.Code != http.StatusOK {
+		t.Errorf("token with the same impersonation: status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestExecStart_RecordsImpersonation(t *testing.T) {
+	installFakeKubectl(t, `echo ok
+`)
+
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	handler := &ExecHandler{sessionMgr: sessionMgr}
+
+	body, _ := json.Marshal(ExecStartRequest{
+		Namespace:     "default",
+		PodName:       "web",
+		Container:     "app",
+		Command:       []string{"true"},
+		Impersonation: kubectl.Impersonation{As: "system:serviceaccount:dev:builder", AsGroup: []string{"system:serviceaccounts"}},
+	})
+	rec := httptest.NewRecorder()
+	handler.Start(rec, httptest.NewRequest(http.MethodPost, "/exec/start", strings.NewReader(string(body))))
+	var resp ExecStartResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v (body %s)", err, rec.Body.String())
+	}
+
+	sess, ok := sessionMgr.Get(resp.SessionID)
+	if !ok {
+		t.Fatal("session not found")
+	}
+	if sess.ImpersonateUser != "system:serviceaccount:dev:builder" || !slices.Equal(sess.ImpersonateGroups, []string{"system:serviceaccounts"}) {
+		t.Errorf("session impersonation = %q %q", sess.ImpersonateUser, sess.ImpersonateGroups)
+	}
+	if !slices.Contains(sess.CommandLine, "--as=system:serviceaccount:dev:builder") || !slices.Contains(sess.CommandLine, "--as-group=system:serviceaccounts") {
+		t.Errorf("command line = %q, want the impersonation flags", sess.CommandLine)
+	}
+
+	body, _ = json.Marshal(ExecStartRequest{Namespace: "default", PodName: "web", Command: []string{"true"}, Impersonation: kubectl.Impersonation{AsGroup: []string{"dev"}}})
+	rec = httptest.NewRecorder()
+	handler.Start(rec, httptest.NewRequest(http.MethodPost, "/exec/start", strings.NewReader(string(body))))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("asGroup without as: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestInjectKubectlImpersonation(t *testing.T) {
+	orig := kubectlPluginExists
+	kubectlPluginExists = func(name string) bool { return name == "neat" }
+	t.Cleanup(func() { kubectlPluginExists = orig })
+
+	imp := kubectl.Impersonation{As: "jane", AsGroup: []string{"dev"}}
+	tests := []struct {
+		command  string
+		imp      kubectl.Impersonation
+		expected string
+	}{
+		{"kubectl get pods", imp, "kubectl --as=jane --as-group=dev get pods"},
+		{"kubectl get pods | grep web && kubectl get svc", imp, "kubectl --as=jane --as-group=dev get pods | grep web && kubectl --as=jane --as-group=dev get svc"},
+		{"kubectl neat get pod web", imp, "kubectl neat get pod web --as=jane --as-group=dev"},
+		{"kubectl --as=bob get pods", imp, "kubectl --as=bob get pods"},
+		{"kubectl get pods --as-uid 42", imp, "kubectl get pods --as-uid 42"},
+		{"echo --assume; kubectl get secrets", imp, "echo --assume; kubectl --as=jane --as-group=dev get secrets"},
+		{"kubectl get pods --assume-yes", imp, "kubectl --as=jane --as-group=dev get pods --assume-yes"},
+		{"kubectl --as=bob get pods && kubectl get svc", imp, "kubectl --as=bob get pods && kubectl --as=jane --as-group=dev get svc"},
+		{"kubectl get pods", kubectl.Impersonation{}, "kubectl get pods"},
+		{"echo hello", imp, "echo hello"},
+	}
+
+	for _, tt := range tests {
+		if got := injectKubectlImpersonation(tt.command, tt.imp); got != tt.expected {
+			t.Errorf("injectKubectlImpersonation(%q) = %q, want %q", tt.command, got, tt.expected)
+		}
+	}
+
+	// Applied after the context, both end up on each invocation
+	if got, want := injectKubectlImpersonation(injectKubectlContext("kubectl get pods", "prod"), imp), "kubectl --as=jane --as-group=dev --context=prod get pods"; got != want {
+		t.Errorf("with context = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestKeyedMutex_SerializesSameKey(t *testing.T) {
+	var km keyedMutex
+	var wg sync.WaitGroup
+	inside := 0
+	maxInside := 0
+	var mu sync.Mutex
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock := km.Lock("cluster-a")
+			defer unlock()
+
+			mu.Lock()
+			inside++
+			if inside > maxInside {
+				maxInside = inside
+			}
+			mu.Unlock()
+
+			mu.Lock()
+			inside--
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if maxInside != 1 {
+		t.Errorf("expected at most 1 holder at a time, saw %d", maxInside)
+	}
+	if len(km.locks) != 0 {
+		t.Errorf("expected unused keys to be dropped, %d remain", len(km.locks))
+	}
+}
+
+func TestKeyedMutex_IndependentKeys(t *testing.T) {
+	var km keyedMutex
+	unlockA := km.Lock("a")
+	defer unlockA()
+
+	// Must not block while "a" is held
+	done := make(chan struct{})
+	go func() {
+		unlockB := km.Lock("b")
+		unlockB()
+		close(done)
+	}()
+	<-done
+}
@@ -0,0 +1,24 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/kubeconfig"
+)
+
+// checkKubeconfigContext rejects a request whose context isn't defined in its kubeconfig,
+// before the pair is hashed or registered and before kubectl is spawned
+// Best-effort: an empty kubeconfig or context, or a kubeconfig that doesn't parse, is left to kubectl
+func checkKubeconfigContext(kubeconfigContent, kubeContext string) error {
+	if kubeconfigContent == "" || kubeContext == "" {
+		return nil
+	}
+	cfg, err := kubeconfig.Parse([]byte(kubeconfigContent))
+	if err != nil {
+		return nil
+	}
+	if _, ok := cfg.FindContext(kubeContext); !ok {
+		return fmt.Errorf("context '%s' not found in provided kubeconfig", kubeContext)
+	}
+	return nil
+}
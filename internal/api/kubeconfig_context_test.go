@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/cluster"
+)
+
+func TestCheckKubeconfigContext(t *testing.T) {
+	tests := []struct {
+		name       string
+		kubeconfig string
+		context    string
+		wantErr    bool
+	}{
+		{"Context defined", testKubeconfigYAML, "prod", false},
+		{"Context missing", testKubeconfigYAML, "staging", true},
+		{"No context", testKubeconfigYAML, "", false},
+		{"No kubeconfig", "", "staging", false},
+		{"Unparseable kubeconfig", "{not yaml", "staging", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkKubeconfigContext(tt.kubeconfig, tt.context)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && err.Error() != "context 'staging' not found in provided kubeconfig" {
+				t.Errorf("error = %q", err)
+			}
+		})
+	}
+}
+
+func TestKubectl_RejectsContextMissingFromKubeconfig(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "ran")
+	installFakeKubectl(t, `touch `+marker+`
+`)
+
+	body, _ := json.Marshal(KubectlRequest{Args: []string{"get", "pods"}, Kubeconfig: testKubeconfigYAML, Context: "staging"})
+	rec := httptest.NewRecorder()
+	(&KubectlHandler{}).Handle(rec, httptest.NewRequest(http.MethodPost, "/kubectl", strings.NewReader(string(body))))
+
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "context 'staging' not found in provided kubeconfig") {
+		t.Errorf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("kubectl was spawned for a context the kubeconfig doesn't define")
+	}
+	if _, _, found := cluster.GetRegistry().Lookup(cluster.ComputeHash(testKubeconfigYAML, "staging")); found {
+		t.Error("the mismatched kubeconfig/context pair was registered")
+	}
+}
@@ -1,47 +1,146 @@
 package api
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
-	"log/slog"
+	"fmt"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/kubedeskpro/kubedesk-helper/internal/cluster"
+	"github.com/kubedeskpro/kubedesk-helper/internal/kubeconfig"
 	"github.com/kubedeskpro/kubedesk-helper/internal/kubectl"
+	"github.com/kubedeskpro/kubedesk-helper/internal/logging"
+	"github.com/kubedeskpro/kubedesk-helper/internal/metrics"
 )
 
 // KubectlHandler handles /kubectl endpoint
-type KubectlHandler struct{}
+type KubectlHandler struct {
+	cache      *responseCache // Optional cache for read-only commands (nil = disabled)
+	strictArgs bool           // Also reject credential/server override flags (KUBECTL_STRICT_ARGS)
+}
 
 // KubectlRequest represents a kubectl command request
 type KubectlRequest struct {
-	Args        []string `json:"args"`
-	Kubeconfig  string   `json:"kubeconfig,omitempty"`
-	Context     string   `json:"context,omitempty"`
-	ClusterHash string   `json:"clusterHash,omitempty"` // Optional: computed by helper if not provided
+	Args           []string `json:"args"`
+	Kubeconfig     string   `json:"kubeconfig,omitempty"`
+	KubeconfigPath string   `json:"kubeconfigPath,omitempty"` // Absolute path to a kubeconfig on disk, used in place
+	Context        string   `json:"context,omitempty"`
+	ClusterHash    string   `json:"clusterHash,omitempty"` // Optional: computed by helper if not provided
+	Retries        int      `json:"retries,omitempty"`     // Optional: retries on transient connection/auth failures (default: 0, max: 5)
+
+	kubectl.Impersonation // Optional: as, asGroup, asUid
+
+	GlobalFlags []string `json:"globalFlags,omitempty"` // Optional: allow-listed kubectl global flags, e.g. "--v=6"
 }
 
 // KubectlResponse represents a kubectl command response
 type KubectlResponse struct {
-	Stdout   string `json:"stdout"`
-	Stderr   string `json:"stderr"`
-	ExitCode int32  `json:"exitCode"`
+	Stdout    string `json:"stdout"`
+	Stderr    string `json:"stderr"`
+	ExitCode  int32  `json:"exitCode"`
+	Attempts  int    `json:"attempts"`            // Times kubectl was run (more than 1 if retried)
+	Truncated bool   `json:"truncated,omitempty"` // Output exceeded MAX_OUTPUT_BYTES; kubectl was killed
+	Encoding  string `json:"encoding,omitempty"`  // "base64" if stdout/stderr weren't valid UTF-8 and are base64-encoded
+}
+
+// Batch limits for POST /kubectl/batch
+const (
+	maxBatchCommands     = 50
+	maxBatchConcurrency  = 8
+	defaultBatchParallel = 4
+	batchTimeout         = 60 * time.Second
+	batchCommandTimeout  = 30 * time.Second
+)
+
+// KubectlBatchCommand represents a single command within a batch
+type KubectlBatchCommand struct {
+	Args []string `json:"args"`
+}
+
+// KubectlBatchRequest represents a batch of kubectl commands against one cluster
+type KubectlBatchRequest struct {
+	Commands       []KubectlBatchCommand `json:"commands"`
+	Kubeconfig     string                `json:"kubeconfig,omitempty"`
+	KubeconfigPath string                `json:"kubeconfigPath,omitempty"` // Absolute path to a kubeconfig on disk, used in place
+	Context        string                `json:"context,omitempty"`
+	ClusterHash    string                `json:"clusterHash,omitempty"` // Optional: computed by helper if not provided
+	Parallel       bool                  `json:"parallel,omitempty"`    // Run commands concurrently (default: sequential)
+	Concurrency    int                   `json:"concurrency,omitempty"` // Max concurrent commands when parallel (default: 4, max: 8)
+
+	kubectl.Impersonation // Optional: as, asGroup, asUid; applies to every command
+
+	GlobalFlags []string `json:"globalFlags,omitempty"` // Optional: allow-listed kubectl global flags for every command
+}
+
+// KubectlBatchResult represents the result of one command in a batch
+type KubectlBatchResult struct {
+	Stdout    string `json:"stdout"`
+	Stderr    string `json:"stderr"`
+	ExitCode  int32  `json:"exitCode"`
+	Error     string `json:"error,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"` // Output exceeded MAX_OUTPUT_BYTES; kubectl was killed
+	Encoding  string `json:"encoding,omitempty"`  // "base64" if stdout/stderr weren't valid UTF-8 and are base64-encoded
+}
+
+// KubectlBatchResponse represents a batch response; results are in request order
+type KubectlBatchResponse struct {
+	Results     []KubectlBatchResult `json:"results"`
+	ClusterHash string               `json:"clusterHash"`
 }
 
 // Handle processes kubectl command requests
 func (h *KubectlHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
 	var req KubectlRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		slog.Error("Failed to decode kubectl request", "error", err)
+		logger.Error("Failed to decode kubectl request", "error", err)
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
+	// A kubeconfigPath is read only for hashing; kubectl uses the file in place
+	if status, msg := loadKubeconfigPath(&req.Kubeconfig, req.KubeconfigPath); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
 	if len(req.Args) == 0 {
 		http.Error(w, "No kubectl arguments provided", http.StatusBadRequest)
 		return
 	}
+	if err := kubectl.ValidateArgs(req.Args, h.strictArgs); err != nil {
+		logger.Warn("Rejected kubectl arguments", "error", err, "argCount", len(req.Args))
+		http.Error(w, fmt.Sprintf("Invalid kubectl arguments: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := checkImpersonation(req.Impersonation, h.strictArgs); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid impersonation: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := checkGlobalFlags(req.GlobalFlags, h.strictArgs); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid globalFlags: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if req.Retries < 0 || req.Retries > kubectl.MaxRetries {
+		http.Error(w, fmt.Sprintf("retries must be between 0 and %d", kubectl.MaxRetries), http.StatusBadRequest)
+		return
+	}
+
+	// If kubeconfig/context not provided, try to look up from registry
+	if !resolveHashOnly(logger, &req.Kubeconfig, &req.Context, req.ClusterHash) {
+		writeRegistryMiss(w, req.ClusterHash)
+		return
+	}
+	if err := checkKubeconfigContext(req.Kubeconfig, req.Context); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	// Compute cluster hash if not provided
 	if req.ClusterHash == "" {
@@ -50,7 +149,7 @@ func (h *KubectlHandler) Handle(w http.ResponseWriter, r *http.Request) {
 
 	// Validate cluster hash
 	if !cluster.ValidateHash(req.ClusterHash, req.Kubeconfig, req.Context) {
-		slog.Error("Cluster hash validation failed",
+		logger.Error("Cluster hash validation failed",
 			"providedHash", req.ClusterHash,
 			"args", req.Args,
 		)
@@ -58,26 +157,211 @@ func (h *KubectlHandler) Handle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	slog.Debug("kubectl request", "args", req.Args, "clusterHash", req.ClusterHash)
+	logger.Debug("kubectl request", "args", req.Args, "clusterHash", req.ClusterHash, "as", req.As)
+
+	// Global and impersonation flags go first: the args may end in "--" followed by a command's own arguments
+	args := append(leadingKubectlArgs(req.GlobalFlags, req.Impersonation), req.Args...)
 
-	// Execute kubectl command with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	// Read-only commands may be answered from the response cache; ?noCache=true forces a fresh run
+	// The key includes the impersonation, since what a user may see depends on who they are, and the global flags
+	var cacheKey string
+	if h.cache != nil && isCacheableKubectl(req.Args) {
+		cacheKey = responseCacheKey(req.ClusterHash, "kubectl", strings.Join(args, "\x00"), nil)
+		if entry, ok := h.cache.get(cacheKey); ok && r.URL.Query().Get("noCache") != "true" {
+			entry.write(w)
+			return
+		}
+		w.Header().Set(cacheHeader, "MISS")
+	}
+
+	// Execute kubectl command with timeout; a client disconnect cancels (kills) it too
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
 	defer cancel()
 
-	result, err := kubectl.Execute(ctx, req.Args, req.Kubeconfig, req.Context)
+	// Reuse the cluster's shared temp kubeconfig (e.g. one a running proxy already holds)
+	// instead of writing a fresh copy for every command
+	var kubeconfigPath string
+	if req.Kubeconfig != "" {
+		tmpFile, release, err := kubeconfig.GetTempManager().AcquireFile(req.ClusterHash, req.Kubeconfig, req.KubeconfigPath)
+		if err != nil {
+			logger.Error("Failed to write kubeconfig", "error", err)
+			http.Error(w, "Failed to write kubeconfig", http.StatusInternalServerError)
+			return
+		}
+		defer release()
+		kubeconfigPath = tmpFile
+	}
+
+	start := time.Now()
+	result, attempts, err := kubectl.Retry(ctx, req.Retries, func() (*kubectl.Result, error) {
+		return kubectl.ExecuteWithKubeconfigFile(ctx, args, kubeconfigPath, req.Context)
+	})
+	metrics.GetRecorder().Observe(req.ClusterHash, req.Context, metrics.SourceKubectl, time.Since(start), err != nil || result.ExitCode != 0)
 	if err != nil {
-		slog.Error("Failed to execute kubectl", "error", err, "args", req.Args)
+		logger.Error("Failed to execute kubectl", "error", err, "args", req.Args)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	response := KubectlResponse{
-		Stdout:   result.Stdout,
-		Stderr:   result.Stderr,
-		ExitCode: result.ExitCode,
+		Stdout:    result.Stdout,
+		Stderr:    result.Stderr,
+		ExitCode:  result.ExitCode,
+		Attempts:  attempts,
+		Truncated: result.Truncated,
 	}
+	response.Encoding = encodeOutputs(&response.Stdout, &response.Stderr)
+
+	var body bytes.Buffer
+	json.NewEncoder(&body).Encode(response)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	if cacheKey != "" && result.ExitCode == 0 {
+		h.cache.set(cacheKey, http.StatusOK, http.Header{"Content-Type": {"application/json"}}, body.Bytes())
+	}
+	w.Write(body.Bytes())
 }
 
+// Batch handles POST /kubectl/batch
+// Runs several kubectl commands against the same cluster, sharing one temp kubeconfig
+func (h *KubectlHandler) Batch(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	var req KubectlBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("Failed to decode kubectl batch request", "error", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// A kubeconfigPath is read only for hashing; kubectl uses the file in place
+	if status, msg := loadKubeconfigPath(&req.Kubeconfig, req.KubeconfigPath); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	if len(req.Commands) == 0 {
+		http.Error(w, "No commands provided", http.StatusBadRequest)
+		return
+	}
+	if len(req.Commands) > maxBatchCommands {
+		http.Error(w, fmt.Sprintf("Too many commands: %d (max %d)", len(req.Commands), maxBatchCommands), http.StatusBadRequest)
+		return
+	}
+	for i, c := range req.Commands {
+		if len(c.Args) == 0 {
+			http.Error(w, fmt.Sprintf("Command %d has no kubectl arguments", i), http.StatusBadRequest)
+			return
+		}
+		if err := kubectl.ValidateArgs(c.Args, h.strictArgs); err != nil {
+			http.Error(w, fmt.Sprintf("Command %d has invalid kubectl arguments: %v", i, err), http.StatusBadRequest)
+			return
+		}
+	}
+	if err := checkImpersonation(req.Impersonation, h.strictArgs); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid impersonation: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := checkGlobalFlags(req.GlobalFlags, h.strictArgs); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid globalFlags: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	// If kubeconfig/context not provided, try to look up from registry
+	if !resolveHashOnly(logger, &req.Kubeconfig, &req.Context, req.ClusterHash) {
+		writeRegistryMiss(w, req.ClusterHash)
+		return
+	}
+	if err := checkKubeconfigContext(req.Kubeconfig, req.Context); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Compute cluster hash if not provided
+	if req.ClusterHash == "" {
+		req.ClusterHash = cluster.ComputeHash(req.Kubeconfig, req.Context)
+	}
+
+	// Validate cluster hash
+	if !cluster.ValidateHash(req.ClusterHash, req.Kubeconfig, req.Context) {
+		logger.Error("Cluster hash validation failed",
+			"providedHash", req.ClusterHash,
+			"commands", len(req.Commands),
+		)
+		http.Error(w, "Cluster hash validation failed", http.StatusBadRequest)
+		return
+	}
+
+	// Write the kubeconfig once and share it across every command in the batch
+	var kubeconfigPath string
+	if req.Kubeconfig != "" {
+		tmpFile, release, err := kubeconfig.GetTempManager().AcquireFile(req.ClusterHash, req.Kubeconfig, req.KubeconfigPath)
+		if err != nil {
+			logger.Error("Failed to write kubeconfig for batch", "error", err)
+			http.Error(w, "Failed to write kubeconfig", http.StatusInternalServerError)
+			return
+		}
+		defer release()
+		kubeconfigPath = tmpFile
+	}
+
+	concurrency := 1
+	if req.Parallel {
+		concurrency = req.Concurrency
+		if concurrency <= 0 {
+			concurrency = defaultBatchParallel
+		}
+		if concurrency > maxBatchConcurrency {
+			concurrency = maxBatchConcurrency
+		}
+	}
+
+	logger.Debug("kubectl batch request",
+		"commands", len(req.Commands),
+		"concurrency", concurrency,
+		"clusterHash", req.ClusterHash,
+	)
+
+	ctx, cancel := context.WithTimeout(r.Context(), batchTimeout)
+	defer cancel()
+
+	results := make([]KubectlBatchResult, len(req.Commands))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i, c := range req.Commands {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, args []string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			cmdCtx, cmdCancel := context.WithTimeout(ctx, batchCommandTimeout)
+			defer cmdCancel()
+
+			start := time.Now()
+			result, err := kubectl.ExecuteWithKubeconfigFile(cmdCtx, append(leadingKubectlArgs(req.GlobalFlags, req.Impersonation), args...), kubeconfigPath, req.Context)
+			metrics.GetRecorder().Observe(req.ClusterHash, req.Context, metrics.SourceKubectl, time.Since(start), err != nil || result.ExitCode != 0)
+			if err != nil {
+				results[i] = KubectlBatchResult{ExitCode: -1, Error: err.Error()}
+				return
+			}
+			results[i] = KubectlBatchResult{
+				Stdout:    result.Stdout,
+				Stderr:    result.Stderr,
+				ExitCode:  result.ExitCode,
+				Truncated: result.Truncated,
+			}
+			results[i].Encoding = encodeOutputs(&results[i].Stdout, &results[i].Stderr)
+		}(i, c.Args)
+	}
+	wg.Wait()
+
+	logger.Info("kubectl batch completed", "commands", len(req.Commands), "clusterHash", req.ClusterHash)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(KubectlBatchResponse{
+		Results:     results,
+		ClusterHash: req.ClusterHash,
+	})
+}
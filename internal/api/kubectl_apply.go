@@ -0,0 +1,228 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/cluster"
+	"github.com/kubedeskpro/kubedesk-helper/internal/kubeconfig"
+	"github.com/kubedeskpro/kubedesk-helper/internal/kubectl"
+	"github.com/kubedeskpro/kubedesk-helper/internal/logging"
+)
+
+// Limits for POST /kubectl/apply
+const (
+	maxApplyManifestBytes = 4 << 20
+	maxApplyRequestBody   = 2*maxApplyManifestBytes + kubeconfig.MaxSize // JSON escaping can double a manifest
+	applyTimeout          = 60 * time.Second
+)
+
+// fieldManagerRe matches the field manager names accepted for apply; the API server caps them at 128 characters
+var fieldManagerRe = regexp.MustCompile(`^[A-Za-z0-9][-A-Za-z0-9_.:/]{0,127}$`)
+
+// Server-side apply conflicts as kubectl reports them:
+//
+//	error: Apply failed with 1 conflict: conflict with "helm" using apps/v1: .spec.replicas
+//	error: Apply failed with 2 conflicts: conflicts with "helm" using apps/v1:
+//	- .spec.replicas
+//	- .spec.template.spec.containers[name="app"].image
+var (
+	applyConflictRe      = regexp.MustCompile(`conflicts? with "([^"]+)"(?: using ([^\s:]+))?:(.*)$`)
+	applyConflictFieldRe = regexp.MustCompile(`^- (\S.*)$`)
+)
+
+// KubectlApplyRequest applies a manifest (YAML or JSON, may hold several objects) to one cluster
+type KubectlApplyRequest struct {
+	Manifest        string `json:"manifest"`
+	Namespace       string `json:"namespace,omitempty"` // For objects without one; kubectl's default otherwise
+	Kubeconfig      string `json:"kubeconfig,omitempty"`
+	KubeconfigPath  string `json:"kubeconfigPath,omitempty"` // Absolute path to a kubeconfig on disk, used in place
+	Context         string `json:"context,omitempty"`
+	ClusterHash     string `json:"clusterHash,omitempty"`     // Optional: computed by helper if not provided
+	ServerSideApply bool   `json:"serverSideApply,omitempty"` // kubectl apply --server-side
+	FieldManager    string `json:"fieldManager,omitempty"`    // kubectl --field-manager; kubectl's default if empty
+	Force           bool   `json:"force,omitempty"`           // --force-conflicts: take over conflicting fields (server-side only)
+	DryRun          bool   `json:"dryRun,omitempty"`          // Server-side dry run
+
+	kubectl.Impersonation // Optional: as, asGroup, asUid
+}
+
+// ApplyConflict is one field another field manager owns, from a failed server-side apply
+type ApplyConflict struct {
+	Manager    string `json:"manager"`              // Field manager that owns the field
+	APIVersion string `json:"apiVersion,omitempty"` // Version the manager applied it with
+	Field      string `json:"field"`                // Field path, e.g. ".spec.replicas"
+}
+
+// KubectlApplyResponse is the response of POST /kubectl/apply
+type KubectlApplyResponse struct {
+	Stdout      string          `json:"stdout"`
+	Stderr      string          `json:"stderr"`
+	ExitCode    int32           `json:"exitCode"`
+	Truncated   bool            `json:"truncated,omitempty"` // Output exceeded MAX_OUTPUT_BYTES; kubectl was killed
+	Conflicts   []ApplyConflict `json:"conflicts,omitempty"` // Server-side apply conflicts; retry with force to take the fields over
+	ClusterHash string          `json:"clusterHash"`
+}
+
+// Apply handles POST /kubectl/apply
+// The manifest is passed to "kubectl apply -f -" on stdin. A server-side apply that fails on
+// field conflicts returns 409 with the conflicting fields; other kubectl failures return 200
+// with kubectl's exit code, like /kubectl
+func (h *KubectlHandler) Apply(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxApplyRequestBody)
+
+	var req KubectlApplyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("Failed to decode kubectl apply request", "error", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if status, msg := loadKubeconfigPath(&req.Kubeconfig, req.KubeconfigPath); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	if strings.TrimSpace(req.Manifest) == "" {
+		http.Error(w, "No manifest provided", http.StatusBadRequest)
+		return
+	}
+	if len(req.Manifest) > maxApplyManifestBytes {
+		http.Error(w, fmt.Sprintf("Manifest too large: %d bytes (max %d)", len(req.Manifest), maxApplyManifestBytes), http.StatusBadRequest)
+		return
+	}
+	if req.Namespace != "" && !watchNamespaceRe.MatchString(req.Namespace) {
+		http.Error(w, fmt.Sprintf("Invalid namespace %q", req.Namespace), http.StatusBadRequest)
+		return
+	}
+	if req.FieldManager != "" && !fieldManagerRe.MatchString(req.FieldManager) {
+		http.Error(w, fmt.Sprintf("Invalid fieldManager %q: up to 128 letters, digits, '-', '_', '.', ':' or '/'", req.FieldManager), http.StatusBadRequest)
+		return
+	}
+	// Client-side apply's --force deletes and recreates objects; only offer the server-side meaning
+	if req.Force && !req.ServerSideApply {
+		http.Error(w, "force requires serverSideApply", http.StatusBadRequest)
+		return
+	}
+	if err := checkImpersonation(req.Impersonation, h.strictArgs); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid impersonation: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if !resolveHashOnly(logger, &req.Kubeconfig, &req.Context, req.ClusterHash) {
+		writeRegistryMiss(w, req.ClusterHash)
+		return
+	}
+	if err := checkKubeconfigContext(req.Kubeconfig, req.Context); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.ClusterHash == "" {
+		req.ClusterHash = cluster.ComputeHash(req.Kubeconfig, req.Context)
+	}
+	if !cluster.ValidateHash(req.ClusterHash, req.Kubeconfig, req.Context) {
+		logger.Error("Cluster hash validation failed", "providedHash", req.ClusterHash)
+		http.Error(w, "Cluster hash validation failed", http.StatusBadRequest)
+		return
+	}
+
+	var kubeconfigPath string
+	if req.Kubeconfig != "" {
+		tmpFile, release, err := kubeconfig.GetTempManager().AcquireFile(req.ClusterHash, req.Kubeconfig, req.KubeconfigPath)
+		if err != nil {
+			logger.Error("Failed to write kubeconfig for apply", "error", err)
+			http.Error(w, "Failed to write kubeconfig", http.StatusInternalServerError)
+			return
+		}
+		defer release()
+		kubeconfigPath = tmpFile
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), applyTimeout)
+	defer cancel()
+
+	result, err := kubectl.ExecuteWithInput(ctx, applyArgs(&req), strings.NewReader(req.Manifest), kubeconfigPath, req.Context)
+	if err != nil {
+		logger.Error("Failed to run kubectl apply", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := KubectlApplyResponse{
+		Stdout:      result.Stdout,
+		Stderr:      result.Stderr,
+		ExitCode:    result.ExitCode,
+		Truncated:   result.Truncated,
+		ClusterHash: req.ClusterHash,
+	}
+	if result.ExitCode != 0 && req.ServerSideApply {
+		response.Conflicts = parseApplyConflicts(result.Stderr)
+	}
+
+	logger.Info("kubectl apply completed",
+		"exitCode", result.ExitCode,
+		"serverSide", req.ServerSideApply,
+		"fieldManager", req.FieldManager,
+		"force", req.Force,
+		"dryRun", req.DryRun,
+		"conflicts", len(response.Conflicts),
+		"clusterHash", req.ClusterHash,
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	if len(response.Conflicts) > 0 {
+		w.WriteHeader(http.StatusConflict)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// applyArgs builds the kubectl arguments for an apply of the manifest on stdin
+func applyArgs(req *KubectlApplyRequest) []string {
+	args := []string{"apply", "-f", "-"}
+	if req.Namespace != "" {
+		args = append(args, "-n", req.Namespace)
+	}
+	if req.ServerSideApply {
+		args = append(args, "--server-side")
+	}
+	if req.FieldManager != "" {
+		args = append(args, "--field-manager="+req.FieldManager)
+	}
+	if req.Force {
+		args = append(args, "--force-conflicts")
+	}
+	if req.DryRun {
+		args = append(args, "--dry-run=server")
+	}
+	return append(args, req.Impersonation.Args()...)
+}
+
+// parseApplyConflicts extracts the conflicting fields from kubectl's server-side apply error output
+func parseApplyConflicts(stderr string) []ApplyConflict {
+	var conflicts []ApplyConflict
+	var manager, apiVersion string // Owner of the "- <field>" lines that follow a multi-field header
+	for _, line := range strings.Split(stderr, "\n") {
+		line = strings.TrimSpace(line)
+		if m := applyConflictRe.FindStringSubmatch(line); m != nil {
+			manager, apiVersion = m[1], m[2]
+			if field := strings.TrimSpace(m[3]); field != "" {
+				conflicts = append(conflicts, ApplyConflict{Manager: manager, APIVersion: apiVersion, Field: field})
+				manager = ""
+			}
+			continue
+		}
+		if m := applyConflictFieldRe.FindStringSubmatch(line); m != nil && manager != "" {
+			conflicts = append(conflicts, ApplyConflict{Manager: manager, APIVersion: apiVersion, Field: m[1]})
+			continue
+		}
+		manager = ""
+	}
+	return conflicts
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestKubectlApply_ServerSide(t *testing.T) {
+	installFakeKubectl(t, `case "$(cat)" in
+  *conflicting*)
+    echo 'error: Apply failed with 2 conflicts: conflicts with "helm" using apps/v1:' >&2
+    echo '- .spec.replicas' >&2
+    echo '- .spec.template.spec.containers[name="app"].image' >&2
+    echo 'Please review the fields above--they currently have other managers.' >&2
+    exit 1 ;;
+esac
+echo "$@"
+`)
+
+	handler := &KubectlHandler{}
+	post := func(body string) (*httptest.ResponseRecorder, KubectlApplyResponse) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.Apply(rec, httptest.NewRequest(http.MethodPost, "/kubectl/apply", strings.NewReader(body)))
+		var resp KubectlApplyResponse
+		if rec.Code == http.StatusOK || rec.Code == http.StatusConflict {
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+		}
+		return rec, resp
+	}
+
+	rec, resp := post(`{"manifest":"kind: ConfigMap","namespace":"apps","serverSideApply":true,"fieldManager":"kubedesk","force":true}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("apply: status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	if want := "apply -f - -n apps --server-side --field-manager=kubedesk --force-conflicts"; strings.TrimSpace(resp.Stdout) != want {
+		t.Errorf("args = %q, want %q", resp.Stdout, want)
+	}
+
+	rec, resp = post(`{"manifest":"kind: ConfigMap # conflicting","serverSideApply":true,"fieldManager":"kubedesk"}`)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("conflict: status = %d, want 409", rec.Code)
+	}
+	want := []ApplyConflict{
+		{Manager: "helm", APIVersion: "apps/v1", Field: ".spec.replicas"},
+		{Manager: "helm", APIVersion: "apps/v1", Field: `.spec.template.spec.containers[name="app"].image`},
+	}
+	if len(resp.Conflicts) != len(want) || resp.Conflicts[0] != want[0] || resp.Conflicts[1] != want[1] {
+		t.Errorf("conflicts = %+v, want %+v", resp.Conflicts, want)
+	}
+	if resp.ExitCode != 1 {
+		t.Errorf("exitCode = %d, want 1", resp.ExitCode)
+	}
+}
+
+func TestKubectlApply_Validation(t *testing.T) {
+	handler := &KubectlHandler{}
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"no manifest", `{"manifest":"  "}`},
+		{"bad namespace", `{"manifest":"kind: ConfigMap","namespace":"-A"}`},
+		{"bad field manager", `{"manifest":"kind: ConfigMap","serverSideApply":true,"fieldManager":"--force"}`},
+		{"field manager too long", `{"manifest":"kind: ConfigMap","serverSideApply":true,"fieldManager":"` + strings.Repeat("m", 129) + `"}`},
+		{"force without server-side", `{"manifest":"kind: ConfigMap","force":true}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.Apply(rec, httptest.NewRequest(http.MethodPost, "/kubectl/apply", strings.NewReader(tt.body)))
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400: %s", rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestParseApplyConflicts(t *testing.T) {
+	tests := []struct {
+		name   string
+		stderr string
+		want   []ApplyConflict
+	}{
+		{
+			name:   "single conflict",
+			stderr: `error: Apply failed with 1 conflict: conflict with "kubectl-client-side-apply" using apps/v1: .spec.replicas` + "\nPlease review the fields above",
+			want:   []ApplyConflict{{Manager: "kubectl-client-side-apply", APIVersion: "apps/v1", Field: ".spec.replicas"}},
+		},
+		{
+			name: "several managers",
+			stderr: `error: Apply failed with 3 conflicts: conflicts with "helm" using v1:
+- .data.a
+- .data.b
+conflict with "argocd": .metadata.labels.app`,
+			want: []ApplyConflict{
+				{Manager: "helm", APIVersion: "v1", Field: ".data.a"},
+				{Manager: "helm", APIVersion: "v1", Field: ".data.b"},
+				{Manager: "argocd", Field: ".metadata.labels.app"},
+			},
+		},
+		{
+			name:   "other error",
+			stderr: `Error from server (Forbidden): configmaps "x" is forbidden` + "\n- not a field",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseApplyConflicts(tt.stderr)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("conflict %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
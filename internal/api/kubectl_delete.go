@@ -0,0 +1,267 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/cluster"
+	"github.com/kubedeskpro/kubedesk-helper/internal/kubeconfig"
+	"github.com/kubedeskpro/kubedesk-helper/internal/kubectl"
+	"github.com/kubedeskpro/kubedesk-helper/internal/logging"
+)
+
+// Limits for POST /kubectl/delete
+const (
+	maxDeleteResources = maxBatchCommands
+	deleteConfirmTTL   = 5 * time.Minute // How long a dry run's confirm token stays valid
+	deleteTimeout      = 60 * time.Second
+)
+
+// deleteConfirmKey signs confirm tokens; a restart invalidates every outstanding token
+var deleteConfirmKey = func() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(fmt.Sprintf("failed to generate delete confirm key: %v", err))
+	}
+	return key
+}()
+
+// KubectlDeleteTarget is one object to delete
+type KubectlDeleteTarget struct {
+	Type      string `json:"type"` // e.g. "pods", "deployment.apps"
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"` // Omit for cluster-scoped objects
+}
+
+// KubectlDeleteRequest deletes several objects in one cluster. A dry run returns a confirm
+// token; the real delete must send it back for exactly the same resources and flags
+type KubectlDeleteRequest struct {
+	Resources      []KubectlDeleteTarget `json:"resources"`
+	Kubeconfig     string                `json:"kubeconfig,omitempty"`
+	KubeconfigPath string                `json:"kubeconfigPath,omitempty"` // Absolute path to a kubeconfig on disk, used in place
+	Context        string                `json:"context,omitempty"`
+	ClusterHash    string                `json:"clusterHash,omitempty"` // Optional: computed by helper if not provided
+	DryRun         bool                  `json:"dryRun,omitempty"`      // Server-side dry run; returns the confirm token
+	Confirm        string                `json:"confirm,omitempty"`     // Token from the dry run; required unless dryRun
+	GracePeriod    *int                  `json:"gracePeriod,omitempty"` // kubectl --grace-period (seconds, >= 0)
+	Force          bool                  `json:"force,omitempty"`       // kubectl --force
+
+	kubectl.Impersonation // Optional: as, asGroup, asUid; part of what the confirm token covers
+}
+
+// KubectlDeleteResult is the outcome for one object, in request order
+type KubectlDeleteResult struct {
+	KubectlDeleteTarget
+	Deleted  bool   `json:"deleted"`            // Deleted, or for a dry run: would be deleted
+	NotFound bool   `json:"notFound,omitempty"` // The object doesn't exist
+	Output   string `json:"output,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// KubectlDeleteResponse is the response of POST /kubectl/delete
+type KubectlDeleteResponse struct {
+	Results     []KubectlDeleteResult `json:"results"`
+	DryRun      bool                  `json:"dryRun"`
+	Confirm     string                `json:"confirm,omitempty"`   // Dry run only: pass back to delete for real
+	ExpiresAt   *time.Time            `json:"expiresAt,omitempty"` // Dry run only: when Confirm stops being accepted
+	ClusterHash string                `json:"clusterHash"`
+}
+
+// Delete handles POST /kubectl/delete
+// Objects are deleted one kubectl call each, without waiting for finalizers
+func (h *KubectlHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	var req KubectlDeleteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("Failed to decode kubectl delete request", "error", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if status, msg := loadKubeconfigPath(&req.Kubeconfig, req.KubeconfigPath); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	if len(req.Resources) == 0 {
+		http.Error(w, "No resources provided", http.StatusBadRequest)
+		return
+	}
+	if len(req.Resources) > maxDeleteResources {
+		http.Error(w, fmt.Sprintf("Too many resources: %d (max %d)", len(req.Resources), maxDeleteResources), http.StatusBadRequest)
+		return
+	}
+	for i, res := range req.Resources {
+		if err := validateDeleteTarget(res); err != nil {
+			http.Error(w, fmt.Sprintf("Resource %d: %v", i, err), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.GracePeriod != nil && *req.GracePeriod < 0 {
+		http.Error(w, "gracePeriod must not be negative", http.StatusBadRequest)
+		return
+	}
+	if err := checkImpersonation(req.Impersonation, h.strictArgs); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid impersonation: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if !resolveHashOnly(logger, &req.Kubeconfig, &req.Context, req.ClusterHash) {
+		writeRegistryMiss(w, req.ClusterHash)
+		return
+	}
+	if err := checkKubeconfigContext(req.Kubeconfig, req.Context); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.ClusterHash == "" {
+		req.ClusterHash = cluster.ComputeHash(req.Kubeconfig, req.Context)
+	}
+	if !cluster.ValidateHash(req.ClusterHash, req.Kubeconfig, req.Context) {
+		logger.Error("Cluster hash validation failed", "providedHash", req.ClusterHash, "resources", len(req.Resources))
+		http.Error(w, "Cluster hash validation failed", http.StatusBadRequest)
+		return
+	}
+
+	if !req.DryRun && !verifyDeleteConfirm(req.Confirm, &req, time.Now()) {
+		logger.Warn("Rejected delete without a valid confirm token", "clusterHash", req.ClusterHash, "resources", len(req.Resources))
+		http.Error(w, "Missing, expired or mismatched confirm token: run a dry run for these resources first", http.StatusPreconditionFailed)
+		return
+	}
+
+	var kubeconfigPath string
+	if req.Kubeconfig != "" {
+		tmpFile, release, err := kubeconfig.GetTempManager().AcquireFile(req.ClusterHash, req.Kubeconfig, req.KubeconfigPath)
+		if err != nil {
+			logger.Error("Failed to write kubeconfig for delete", "error", err)
+			http.Error(w, "Failed to write kubeconfig", http.StatusInternalServerError)
+			return
+		}
+		defer release()
+		kubeconfigPath = tmpFile
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), deleteTimeout)
+	defer cancel()
+
+	results := make([]KubectlDeleteResult, len(req.Resources))
+	sem := make(chan struct{}, defaultBatchParallel)
+	var wg sync.WaitGroup
+	for i, res := range req.Resources {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, res KubectlDeleteTarget) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			results[i] = KubectlDeleteResult{KubectlDeleteTarget: res}
+			cmdCtx, cmdCancel := context.WithTimeout(ctx, batchCommandTimeout)
+			defer cmdCancel()
+
+			result, err := kubectl.ExecuteWithKubeconfigFile(cmdCtx, deleteArgs(res, &req), kubeconfigPath, req.Context)
+			switch {
+			case err != nil:
+				results[i].Error = err.Error()
+			case result.ExitCode != 0:
+				results[i].NotFound = isNotFoundError(result.Stderr)
+				results[i].Error = strings.TrimSpace(result.Stderr)
+			default:
+				results[i].Deleted = true
+				results[i].Output = strings.TrimSpace(result.Stdout)
+			}
+		}(i, res)
+	}
+	wg.Wait()
+
+	response := KubectlDeleteResponse{Results: results, DryRun: req.DryRun, ClusterHash: req.ClusterHash}
+	if req.DryRun {
+		expiresAt := time.Now().Add(deleteConfirmTTL).Truncate(time.Second)
+		response.Confirm = deleteConfirmToken(&req, expiresAt)
+		response.ExpiresAt = &expiresAt
+	}
+
+	logger.Info("kubectl delete completed",
+		"resources", len(req.Resources),
+		"dryRun", req.DryRun,
+		"force", req.Force,
+		"clusterHash", req.ClusterHash,
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// validateDeleteTarget rejects anything kubectl could read as a flag or a second object
+func validateDeleteTarget(t KubectlDeleteTarget) error {
+	if !watchTypeRe.MatchString(t.Type) {
+		return fmt.Errorf("invalid type %q", t.Type)
+	}
+	if t.Name == "" || strings.HasPrefix(t.Name, "-") || strings.ContainsAny(t.Name, "/ \t\r\n") {
+		return fmt.Errorf("invalid name %q", t.Name)
+	}
+	if t.Namespace != "" && !watchNamespaceRe.MatchString(t.Namespace) {
+		return fmt.Errorf("invalid namespace %q", t.Namespace)
+	}
+	return nil
+}
+
+// deleteArgs builds the kubectl arguments for deleting one object
+func deleteArgs(t KubectlDeleteTarget, req *KubectlDeleteRequest) []string {
+	args := []string{"delete", t.Type, t.Name, "--wait=false"}
+	if t.Namespace != "" {
+		args = append(args, "-n", t.Namespace)
+	}
+	if req.GracePeriod != nil {
+		args = append(args, "--grace-period="+strconv.Itoa(*req.GracePeriod))
+	}
+	if req.Force {
+		args = append(args, "--force")
+	}
+	if req.DryRun {
+		args = append(args, "--dry-run=server")
+	}
+	return append(args, req.Impersonation.Args()...)
+}
+
+// deleteConfirmToken signs the cluster, identity, resources and flags of a delete until expiresAt
+// The token is "<unix expiry>.<hex HMAC>", so it can be checked without keeping state
+func deleteConfirmToken(req *KubectlDeleteRequest, expiresAt time.Time) string {
+	expiry := strconv.FormatInt(expiresAt.Unix(), 10)
+	mac := hmac.New(sha256.New, deleteConfirmKey)
+	fmt.Fprintf(mac, "%s\n%s\n%t\n%q\n", expiry, req.ClusterHash, req.Force, req.Impersonation.Args())
+	if req.GracePeriod != nil {
+		fmt.Fprintf(mac, "%d", *req.GracePeriod)
+	}
+	for _, t := range req.Resources {
+		fmt.Fprintf(mac, "\n%s\x00%s\x00%s", t.Namespace, t.Type, t.Name)
+	}
+	return expiry + "." + hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyDeleteConfirm reports whether token came from a dry run of the same delete and hasn't expired
+func verifyDeleteConfirm(token string, req *KubectlDeleteRequest, now time.Time) bool {
+	expiry, _, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	unix, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil {
+		return false
+	}
+	expiresAt := time.Unix(unix, 0)
+	if now.After(expiresAt) {
+		return false
+	}
+	return hmac.Equal([]byte(token), []byte(deleteConfirmToken(req, expiresAt)))
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKubectlDelete_DryRunThenConfirm(t *testing.T) {
+	installFakeKubectl(t, `case "$*" in
+  *"delete pods gone"*) echo 'Error from server (NotFound): pods "gone" not found' >&2; exit 1 ;;
+esac
+echo "$@"
+`)
+
+	handler := &KubectlHandler{}
+	post := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.Delete(rec, httptest.NewRequest(http.MethodPost, "/kubectl/delete", strings.NewReader(body)))
+		return rec
+	}
+	const resources = `"resources":[{"type":"pods","name":"web-1","namespace":"default"},{"type":"pods","name":"gone","namespace":"default"}],"gracePeriod":0,"force":true`
+
+	rec := post(`{"dryRun":true,` + resources + `}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("dry run: status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var dry KubectlDeleteResponse
+	if err := json.NewDecoder(rec.Body).Decode(&dry); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if !dry.DryRun || dry.Confirm == "" || dry.ExpiresAt == nil {
+		t.Fatalf("dry run response = %+v, want a confirm token", dry)
+	}
+	if want := "delete pods web-1 --wait=false -n default --grace-period=0 --force --dry-run=server"; dry.Results[0].Output != want {
+		t.Errorf("dry run args = %q, want %q", dry.Results[0].Output, want)
+	}
+	if r := dry.Results[1]; r.Deleted || !r.NotFound || r.Name != "gone" {
+		t.Errorf("missing pod result = %+v, want notFound", r)
+	}
+
+	if rec := post(`{` + resources + `}`); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("no token: status = %d, want 412", rec.Code)
+	}
+	other := `"resources":[{"type":"pods","name":"db-0","namespace":"default"}],"gracePeriod":0,"force":true`
+	if rec := post(`{"confirm":"` + dry.Confirm + `",` + other + `}`); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("token for other resources: status = %d, want 412", rec.Code)
+	}
+	if rec := post(`{"confirm":"` + dry.Confirm + `",` + strings.TrimSuffix(resources, `,"force":true`) + `}`); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("token without force: status = %d, want 412", rec.Code)
+	}
+
+	rec = post(`{"confirm":"` + dry.Confirm + `",` + resources + `}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("delete: status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var resp KubectlDeleteResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.DryRun || resp.Confirm != "" {
+		t.Errorf("delete response = %+v, want no new token", resp)
+	}
+	if want := "delete pods web-1 --wait=false -n default --grace-period=0 --force"; !resp.Results[0].Deleted || resp.Results[0].Output != want {
+		t.Errorf("result[0] = %+v, want deleted with args %q", resp.Results[0], want)
+	}
+}
+
+func TestKubectlDelete_Validation(t *testing.T) {
+	handler := &KubectlHandler{}
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"no resources", `{"dryRun":true}`},
+		{"flag as name", `{"dryRun":true,"resources":[{"type":"pods","name":"--all"}]}`},
+		{"flag as type", `{"dryRun":true,"resources":[{"type":"--all","name":"web"}]}`},
+		{"two names", `{"dryRun":true,"resources":[{"type":"pods","name":"web db"}]}`},
+		{"bad namespace", `{"dryRun":true,"resources":[{"type":"pods","name":"web","namespace":"-A"}]}`},
+		{"negative grace period", `{"dryRun":true,"resources":[{"type":"pods","name":"web"}],"gracePeriod":-1}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.Delete(rec, httptest.NewRequest(http.MethodPost, "/kubectl/delete", strings.NewReader(tt.body)))
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400: %s", rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestVerifyDeleteConfirm_Expired(t *testing.T) {
+	req := &KubectlDeleteRequest{ClusterHash: "abc123", Resources: []KubectlDeleteTarget{{Type: "pods", Name: "web"}}}
+	expiresAt := time.Now().Add(deleteConfirmTTL)
+	token := deleteConfirmToken(req, expiresAt)
+
+	if !verifyDeleteConfirm(token, req, time.Now()) {
+		t.Error("fresh token rejected")
+	}
+	if verifyDeleteConfirm(token, req, expiresAt.Add(time.Second)) {
+		t.Error("expired token accepted")
+	}
+	if verifyDeleteConfirm("9999999999."+strings.Repeat("0", 64), req, time.Now()) {
+		t.Error("forged token accepted")
+	}
+}
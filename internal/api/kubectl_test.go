@@ -0,0 +1,357 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/cluster"
+	"github.com/kubedeskpro/kubedesk-helper/internal/kubeconfig"
+	"github.com/kubedeskpro/kubedesk-helper/internal/kubectl"
+)
+
+// installFakeKubectl writes a shell script named kubectl into a temp dir and puts it first on PATH
+func installFakeKubectl(t *testing.T, script string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "kubectl")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatalf("Failed to write fake kubectl: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return path
+}
+
+// setMaxOutputBytes lowers the synchronous output cap for the rest of the test
+func setMaxOutputBytes(t *testing.T, n int) {
+	t.Helper()
+	orig := kubectl.MaxOutputBytes()
+	kubectl.SetMaxOutputBytes(n)
+	t.Cleanup(func() { kubectl.SetMaxOutputBytes(orig) })
+}
+
+func TestKubectlBatch_ResultsInOrder(t *testing.T) {
+	installFakeKubectl(t, `echo "$@"
+if [ "$1" = "fail" ]; then echo "boom" >&2; exit 3; fi
+`)
+
+	handler := &KubectlHandler{}
+
+	for _, parallel := range []bool{false, true} {
+		body := `{"parallel":` + strconv.FormatBool(parallel) + `,"commands":[
+			{"args":["get","deployment"]},
+			{"args":["fail"]},
+			{"args":["get","pods"]}
+		]}`
+		req := httptest.NewRequest(http.MethodPost, "/kubectl/batch", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		handler.Batch(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("parallel=%v: status = %d, body = %s", parallel, rec.Code, rec.Body.String())
+		}
+
+		var resp KubectlBatchResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if len(resp.Results) != 3 {
+			t.Fatalf("parallel=%v: got %d results, want 3", parallel, len(resp.Results))
+		}
+		if got := strings.TrimSpace(resp.Results[0].Stdout); got != "get deployment" {
+			t.Errorf("parallel=%v: result[0].Stdout = %q", parallel, got)
+		}
+		if resp.Results[1].ExitCode != 3 || strings.TrimSpace(resp.Results[1].Stderr) != "boom" {
+			t.Errorf("parallel=%v: result[1] = %+v, want exit 3 with stderr boom", parallel, resp.Results[1])
+		}
+		if got := strings.TrimSpace(resp.Results[2].Stdout); got != "get pods" {
+			t.Errorf("parallel=%v: result[2].Stdout = %q", parallel, got)
+		}
+	}
+}
+
+func TestKubectlBatch_Validation(t *testing.T) {
+	handler := &KubectlHandler{}
+
+	tooMany := make([]string, 0, maxBatchCommands+1)
+	for i := 0; i <= maxBatchCommands; i++ {
+		tooMany = append(tooMany, `{"args":["version"]}`)
+	}
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "Empty batch", body: `{"commands":[]}`},
+		{name: "Command without args", body: `{"commands":[{"args":["get","pods"]},{"args":[]}]}`},
+		{name: "Too many commands", body: `{"commands":[` + strings.Join(tooMany, ",") + `]}`},
+		{name: "Hash mismatch", body: `{"context":"prod","clusterHash":"wrong","commands":[{"args":["version"]}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/kubectl/batch", strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			handler.Batch(rec, req)
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+func TestKubectl_KubeconfigPath(t *testing.T) {
+	installFakeKubectl(t, `echo "$KUBECONFIG"
+`)
+
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte(testKubeconfigYAML), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The hash for a path matches the hash for the same content sent inline
+	hash := cluster.ComputeHash(testKubeconfigYAML, "dev")
+	body, _ := json.Marshal(KubectlRequest{Args: []string{"get", "pods"}, KubeconfigPath: path, Context: "dev", ClusterHash: hash})
+	rec := httptest.NewRecorder()
+	(&KubectlHandler{}).Handle(rec, httptest.NewRequest(http.MethodPost, "/kubectl", strings.NewReader(string(body))))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var resp KubectlResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	// kubectl is pointed at the file itself rather than a temp copy
+	if got := strings.TrimSpace(resp.Stdout); got != path {
+		t.Errorf("KUBECONFIG = %q, want %q", got, path)
+	}
+}
+
+func TestKubectl_KubeconfigPathValidation(t *testing.T) {
+	handler := &KubectlHandler{}
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "Both provided", body: `{"args":["version"],"kubeconfig":"a: b","kubeconfigPath":"/tmp/config"}`},
+		{name: "Relative path", body: `{"args":["version"],"kubeconfigPath":"config"}`},
+		{name: "Missing file", body: `{"args":["version"],"kubeconfigPath":"/nonexistent/kubeconfig"}`},
+		{name: "Directory", body: `{"args":["version"],"kubeconfigPath":"` + t.TempDir() + `"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.Handle(rec, httptest.NewRequest(http.MethodPost, "/kubectl", strings.NewReader(tt.body)))
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+// installFlakyKubectl installs a fake kubectl that fails with stderr for the first failures runs, then prints ok
+func installFlakyKubectl(t *testing.T, failures int, stderr string) {
+	t.Helper()
+	counter := filepath.Join(t.TempDir(), "attempts")
+	installFakeKubectl(t, `n=$(cat '`+counter+`' 2>/dev/null || echo 0)
+n=$((n+1))
+echo $n > '`+counter+`'
+if [ $n -le `+strconv.Itoa(failures)+` ]; then echo '`+stderr+`' >&2; exit 1; fi
+echo ok
+`)
+}
+
+func TestKubectl_Retries(t *testing.T) {
+	tests := []struct {
+		name         string
+		retries      int
+		stderr       string
+		wantExit     int32
+		wantAttempts int
+	}{
+		{"Transient failure retried", 2, "Unable to connect to the server: EOF", 0, 2},
+		{"Retries off by default", 0, "Unable to connect to the server: EOF", 1, 1},
+		{"Server error not retried", 3, `Error from server (NotFound): pods "web" not found`, 1, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			installFlakyKubectl(t, 1, tt.stderr)
+
+			body, _ := json.Marshal(KubectlRequest{Args: []string{"get", "pods"}, Retries: tt.retries})
+			rec := httptest.NewRecorder()
+			(&KubectlHandler{}).Handle(rec, httptest.NewRequest(http.MethodPost, "/kubectl", strings.NewReader(string(body))))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+			}
+
+			var resp KubectlResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if resp.ExitCode != tt.wantExit || resp.Attempts != tt.wantAttempts {
+				t.Errorf("got exit %d after %d attempts, want exit %d after %d", resp.ExitCode, resp.Attempts, tt.wantExit, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestKubectl_RetriesValidation(t *testing.T) {
+	for _, retries := range []string{"-1", "6"} {
+		rec := httptest.NewRecorder()
+		body := `{"args":["version"],"retries":` + retries + `}`
+		(&KubectlHandler{}).Handle(rec, httptest.NewRequest(http.MethodPost, "/kubectl", strings.NewReader(body)))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("retries=%s: status = %d, want %d", retries, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestKubectl_ReusesSharedTempKubeconfig(t *testing.T) {
+	installFakeKubectl(t, `echo "$KUBECONFIG"
+`)
+
+	// A running proxy for the cluster already holds the shared temp file
+	hash := cluster.ComputeHash(testKubeconfigYAML, "dev")
+	heldPath, release, err := kubeconfig.GetTempManager().Acquire(hash, testKubeconfigYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	for i := 0; i < 2; i++ {
+		body, _ := json.Marshal(KubectlRequest{Args: []string{"get", "pods"}, Kubeconfig: testKubeconfigYAML, Context: "dev"})
+		rec := httptest.NewRecorder()
+		(&KubectlHandler{}).Handle(rec, httptest.NewRequest(http.MethodPost, "/kubectl", strings.NewReader(string(body))))
+
+		var resp KubectlResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if got := strings.TrimSpace(resp.Stdout); got != heldPath {
+			t.Errorf("KUBECONFIG = %q, want shared file %q", got, heldPath)
+		}
+	}
+	if _, err := os.Stat(heldPath); err != nil {
+		t.Errorf("shared kubeconfig removed while still referenced: %v", err)
+	}
+}
+
+func TestKubectl_ArgValidation(t *testing.T) {
+	installFakeKubectl(t, "echo ok\n")
+
+	tests := []struct {
+		name       string
+		handler    *KubectlHandler
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{"Null byte", &KubectlHandler{}, "/kubectl", `{"args":["get","pods\u0000"]}`, http.StatusBadRequest},
+		{"Override allowed by default", &KubectlHandler{}, "/kubectl", `{"args":["get","pods","--server=https://other"]}`, http.StatusOK},
+		{"Override rejected in strict mode", &KubectlHandler{strictArgs: true}, "/kubectl", `{"args":["get","pods","--server=https://other"]}`, http.StatusBadRequest},
+		{"Batch command checked", &KubectlHandler{}, "/kubectl/batch", `{"commands":[{"args":["get","pods"]},{"args":["get","x\u0000"]}]}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			if tt.path == "/kubectl/batch" {
+				tt.handler.Batch(rec, req)
+			} else {
+				tt.handler.Handle(rec, req)
+			}
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestKubectl_HashOnlyUsesRegistry(t *testing.T) {
+	installFakeKubectl(t, `echo "$@"
+`)
+	hash := cluster.ComputeAndRegister(testKubeconfigYAML, "prod")
+
+	body, _ := json.Marshal(KubectlRequest{Args: []string{"get", "pods"}, ClusterHash: hash})
+	rec := httptest.NewRecorder()
+	(&KubectlHandler{}).Handle(rec, httptest.NewRequest(http.MethodPost, "/kubectl", strings.NewReader(string(body))))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var resp KubectlResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if !strings.Contains(resp.Stdout, "prod") {
+		t.Errorf("expected registered context in args, got %q", resp.Stdout)
+	}
+}
+
+func TestKubectl_TruncatesOversizedOutput(t *testing.T) {
+	installFakeKubectl(t, "exec yes\n")
+	setMaxOutputBytes(t, 4096)
+
+	rec := httptest.NewRecorder()
+	(&KubectlHandler{}).Handle(rec, httptest.NewRequest(http.MethodPost, "/kubectl", strings.NewReader(`{"args":["get","secrets","-A","-o","yaml"]}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var resp KubectlResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if !resp.Truncated || resp.ExitCode != -1 || len(resp.Stdout) != 4096 {
+		t.Errorf("truncated %v, exit %d, %d bytes; want true, -1, 4096", resp.Truncated, resp.ExitCode, len(resp.Stdout))
+	}
+}
+
+func TestKubectl_ClientDisconnectKillsCommand(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	installFakeKubectl(t, `echo $$ > `+pidFile+`
+exec sleep 30
+`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodPost, "/kubectl", strings.NewReader(`{"args":["get","pods","--watch"]}`)).WithContext(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		(&KubectlHandler{}).Handle(httptest.NewRecorder(), req)
+	}()
+
+	var pid int
+	deadline := time.Now().Add(5 * time.Second)
+	for pid == 0 {
+		if data, err := os.ReadFile(pidFile); err == nil {
+			pid, _ = strconv.Atoi(strings.TrimSpace(string(data)))
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("kubectl did not start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel() // The app gave up on the request
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler kept waiting for kubectl after the client disconnected")
+	}
+	if err := syscall.Kill(pid, 0); err != syscall.ESRCH {
+		t.Errorf("kubectl (pid %d) still running after the client disconnected: %v", pid, err)
+	}
+}
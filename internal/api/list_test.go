@@ -0,0 +1,50 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/cluster"
+	"github.com/kubedeskpro/kubedesk-helper/internal/session"
+)
+
+// TestList_IncludesCluster checks that every list endpoint reports each session's context and cluster hash
+func TestList_IncludesCluster(t *testing.T) {
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+
+	hash := cluster.ComputeHash("", "prod")
+	for _, typ := range []session.SessionType{session.TypeShell, session.TypePortForward, session.TypeProxy} {
+		sess, err := sessionMgr.CreateForCluster(typ, hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sess.Context = "prod"
+	}
+
+	list := func(handler http.HandlerFunc) []map[string]any {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/list", nil))
+		var resp struct {
+			Sessions []map[string]any `json:"sessions"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode list: %v", err)
+		}
+		return resp.Sessions
+	}
+
+	for name, handler := range map[string]http.HandlerFunc{
+		"shell":        (&ShellHandler{sessionMgr: sessionMgr}).List,
+		"port-forward": (&PortForwardHandler{sessionMgr: sessionMgr}).List,
+		"proxy":        (&ProxyHandler{sessionMgr: sessionMgr}).List,
+	} {
+		sessions := list(handler)
+		if len(sessions) != 1 || sessions[0]["context"] != "prod" || sessions[0]["clusterHash"] != hash {
+			t.Errorf("%s list = %v, want context prod and clusterHash %s", name, sessions, hash)
+		}
+	}
+}
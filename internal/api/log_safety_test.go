@@ -0,0 +1,79 @@
+package api
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// slogFuncs are the slog functions and Logger methods whose arguments end up in the log stream
+var slogFuncs = map[string]bool{
+	"Debug": true, "Info": true, "Warn": true, "Error": true, "Log": true,
+	"DebugContext": true, "InfoContext": true, "WarnContext": true, "ErrorContext": true,
+}
+
+// rawKubeconfigName matches names that hold kubeconfig content (e.g. req.Kubeconfig, regKubeconfig)
+// Derived values like len(req.Kubeconfig) or kubeconfigPath are fine to log
+var rawKubeconfigName = regexp.MustCompile(`(?i)kubeconfig$`)
+
+// TestNoRawKubeconfigInLogs fails if any slog call in the module passes kubeconfig content as an argument
+func TestNoRawKubeconfigInLogs(t *testing.T) {
+	root := filepath.Join("..", "..")
+	fset := token.NewFileSet()
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if name := d.Name(); name == "vendor" || (strings.HasPrefix(name, ".") && path != root) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+
+		file, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			return err
+		}
+		ast.Inspect(file, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			sel, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok || !slogFuncs[sel.Sel.Name] {
+				return true
+			}
+			for _, arg := range call.Args {
+				if name := exprName(arg); name != "" && rawKubeconfigName.MatchString(name) {
+					t.Errorf("%s: %s logs raw kubeconfig content via %q", fset.Position(arg.Pos()), sel.Sel.Name, name)
+				}
+			}
+			return true
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to scan sources: %v", err)
+	}
+}
+
+// exprName returns the identifier or field name of a plain variable or field reference
+func exprName(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		return e.Name
+	case *ast.SelectorExpr:
+		return e.Sel.Name
+	}
+	return ""
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/logging"
+	"github.com/kubedeskpro/kubedesk-helper/internal/metrics"
+)
+
+// MetricsHandler handles /metrics endpoint
+type MetricsHandler struct {
+	recorder *metrics.Recorder
+}
+
+// MetricsResponse is the JSON form of /metrics
+type MetricsResponse struct {
+	Clusters []metrics.ClusterSnapshot `json:"clusters"`
+}
+
+// Handle processes GET /metrics
+// Per-cluster request counts, error counts and latency histograms in the Prometheus text format,
+// or as JSON with estimated p50/p95 latencies when ?format=json
+func (h *MetricsHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(MetricsResponse{Clusters: h.recorder.Snapshot()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := h.recorder.WritePrometheus(w); err != nil {
+		logging.FromContext(r.Context()).Debug("Failed to write metrics", "error", err)
+	}
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/cluster"
+	"github.com/kubedeskpro/kubedesk-helper/internal/config"
+	"github.com/kubedeskpro/kubedesk-helper/internal/metrics"
+	"github.com/kubedeskpro/kubedesk-helper/internal/session"
+)
+
+func TestMetrics_RecordsKubectlRequests(t *testing.T) {
+	installFakeKubectl(t, `case "$*" in *fail*) echo "boom" >&2; exit 1;; esac
+echo ok
+`)
+	metrics.GetRecorder().Reset()
+	defer metrics.GetRecorder().Reset()
+
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	router := NewRouter("test", sessionMgr, config.Default())
+
+	hash := cluster.ComputeHash(testKubeconfigYAML, "dev")
+	for _, args := range [][]string{{"get", "pods"}, {"get", "nodes"}, {"fail"}} {
+		body, _ := json.Marshal(KubectlRequest{Args: args, Kubeconfig: testKubeconfigYAML, Context: "dev"})
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/kubectl", strings.NewReader(string(body))))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics?format=json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var resp MetricsResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(resp.Clusters) != 1 || resp.Clusters[0].ClusterHash != hash || resp.Clusters[0].Context != "dev" {
+		t.Fatalf("Expected one cluster %s labeled dev, got %+v", hash, resp.Clusters)
+	}
+	if got := resp.Clusters[0].Sources[metrics.SourceKubectl]; got.Requests != 3 || got.Errors != 1 {
+		t.Errorf("Expected 3 kubectl requests with 1 error, got %+v", got)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Content-Type = %q, want text/plain", ct)
+	}
+	want := `kubedesk_cluster_requests_total{cluster="` + hash + `",context="dev",source="kubectl"} 3`
+	if !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("Expected %q in:\n%s", want, rec.Body.String())
+	}
+}
+
+func TestMetrics_RecordsProxyRequests(t *testing.T) {
+	metrics.GetRecorder().Reset()
+	defer metrics.GetRecorder().Reset()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+
+	_, portStr, _ := net.SplitHostPort(upstream.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	hash := "abc123"
+	sess, _ := sessionMgr.CreateForCluster(session.TypeProxy, hash)
+	sess.Port = port
+
+	router := NewRouter("test", sessionMgr, config.Default())
+	for _, path := range []string{"/api/v1/pods", "/api/v1/nodes", "/broken", "/api/v1/pods"} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/proxy/"+hash+path, nil))
+	}
+
+	snap := metrics.GetRecorder().Snapshot()
+	if len(snap) != 1 || snap[0].ClusterHash != hash {
+		t.Fatalf("Expected metrics for %s only, got %+v", hash, snap)
+	}
+	if got := snap[0].Sources[metrics.SourceProxy]; got.Requests != 4 || got.Errors != 1 {
+		t.Errorf("Expected 4 proxy requests with 1 error, got %+v", got)
+	}
+}
@@ -0,0 +1,30 @@
+package api
+
+import (
+	"encoding/base64"
+	"unicode/utf8"
+)
+
+// outputEncodingBase64 is reported in a response's "encoding" field when its output
+// fields are base64 because the raw bytes weren't valid UTF-8
+const outputEncodingBase64 = "base64"
+
+// encodeOutputs base64-encodes every field in place if any of them isn't valid UTF-8,
+// since JSON would otherwise replace the bad bytes with U+FFFD. All fields switch together
+// so the client decodes them uniformly. Returns the encoding to report ("" = plain text)
+func encodeOutputs(fields ...*string) string {
+	binary := false
+	for _, f := range fields {
+		if !utf8.ValidString(*f) {
+			binary = true
+			break
+		}
+	}
+	if !binary {
+		return ""
+	}
+	for _, f := range fields {
+		*f = base64.StdEncoding.EncodeToString([]byte(*f))
+	}
+	return outputEncodingBase64
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/session"
+)
+
+// nonUTF8Output is latin-1 text followed by raw binary, as printed by the fake commands below
+const nonUTF8Output = "caf\xe9 \xff\xfe\x00\x01"
+
+func TestEncodeOutputs(t *testing.T) {
+	stdout, stderr := "plain", "caf\xe9"
+	if enc := encodeOutputs(&stdout, &stderr); enc != outputEncodingBase64 {
+		t.Fatalf("encoding = %q, want base64", enc)
+	}
+	for name, got := range map[string]string{"plain": stdout, "caf\xe9": stderr} {
+		raw, err := base64.StdEncoding.DecodeString(got)
+		if err != nil || string(raw) != name {
+			t.Errorf("decoded %q (err %v), want %q", raw, err, name)
+		}
+	}
+
+	text := "héllo ✓"
+	if enc := encodeOutputs(&text); enc != "" || text != "héllo ✓" {
+		t.Errorf("valid UTF-8 changed: encoding %q, value %q", enc, text)
+	}
+}
+
+// decodeOutput returns the exact bytes of an output field given the response's encoding
+func decodeOutput(t *testing.T, encoding, value string) string {
+	t.Helper()
+	if encoding != outputEncodingBase64 {
+		t.Fatalf("encoding = %q, want base64", encoding)
+	}
+	raw, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		t.Fatalf("decode %q: %v", value, err)
+	}
+	return string(raw)
+}
+
+func TestNonUTF8Output_RoundTrips(t *testing.T) {
+	installFakeKubectl(t, `[ "$1" = get ] && [ "$2" = pod ] && { echo '{}'; exit 0; }
+printf 'caf\351 \377\376\000\001'
+`)
+
+	t.Run("kubectl", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		(&KubectlHandler{}).Handle(rec, httptest.NewRequest(http.MethodPost, "/kubectl", strings.NewReader(`{"args":["get","configmap","blob"]}`)))
+		var resp KubectlResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if got := decodeOutput(t, resp.Encoding, resp.Stdout); got != nonUTF8Output {
+			t.Errorf("stdout = %q, want %q", got, nonUTF8Output)
+		}
+	})
+
+	t.Run("exec", func(t *testing.T) {
+		sessionMgr := session.NewManager()
+		defer sessionMgr.Shutdown()
+		body, _ := json.Marshal(ExecRequest{Namespace: "default", PodName: "web", Command: []string{"cat", "/bin/true"}})
+		rec := httptest.NewRecorder()
+		(&ExecHandler{sessionMgr: sessionMgr}).Execute(rec, httptest.NewRequest(http.MethodPost, "/exec", strings.NewReader(string(body))))
+		var resp ExecResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if got := decodeOutput(t, resp.Encoding, resp.Output); got != nonUTF8Output {
+			t.Errorf("output = %q, want %q", got, nonUTF8Output)
+		}
+	})
+
+	t.Run("shell run", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		(&ShellHandler{}).Run(rec, httptest.NewRequest(http.MethodPost, "/shell/run", strings.NewReader(`{"command":"printf 'caf\\351 \\377\\376\\000\\001'; echo ok >&2"}`)))
+		var resp ShellRunResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if got := decodeOutput(t, resp.Encoding, resp.Stdout); got != nonUTF8Output {
+			t.Errorf("stdout = %q, want %q", got, nonUTF8Output)
+		}
+		// stderr is valid UTF-8 but switches with stdout so the client decodes uniformly
+		if got := decodeOutput(t, resp.Encoding, resp.Stderr); got != "ok\n" {
+			t.Errorf("stderr = %q, want %q", got, "ok\n")
+		}
+	})
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxOutputWait caps ?wait= on the output endpoints; long polls lift the server's write timeout
+const maxOutputWait = 10 * time.Second
+
+// parseOutputPoll reads the optional long-poll parameters of /exec/output and /shell/output
+// ?offset= is the output length the client has already seen and ?wait= how long to block for more
+func parseOutputPoll(r *http.Request) (offset int, wait time.Duration, err error) {
+	q := r.URL.Query()
+
+	if v := q.Get("offset"); v != "" {
+		offset, err = strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("invalid offset %q: must be a non-negative integer", v)
+		}
+	}
+
+	if v := q.Get("wait"); v != "" {
+		wait, err = time.ParseDuration(v)
+		if err != nil || wait < 0 {
+			return 0, 0, fmt.Errorf("invalid wait %q: must be a non-negative duration like \"5s\"", v)
+		}
+		if wait > maxOutputWait {
+			wait = maxOutputWait
+		}
+	}
+
+	return offset, wait, nil
+}
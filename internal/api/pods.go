@@ -0,0 +1,250 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/cluster"
+	"github.com/kubedeskpro/kubedesk-helper/internal/kubeconfig"
+	"github.com/kubedeskpro/kubedesk-helper/internal/kubectl"
+	"github.com/kubedeskpro/kubedesk-helper/internal/logging"
+)
+
+// podLookupTimeout bounds the "kubectl get pod" behind /pods/containers
+const podLookupTimeout = 10 * time.Second
+
+// defaultContainerAnnotation names the container kubectl exec/logs pick when none is given
+const defaultContainerAnnotation = "kubectl.kubernetes.io/default-container"
+
+// Container states reported by /pods/containers
+const (
+	containerStateRunning    = "running"
+	containerStateWaiting    = "waiting"
+	containerStateTerminated = "terminated"
+	containerStateUnknown    = "unknown" // No status yet (e.g. pod still being scheduled)
+)
+
+// PodsHandler handles pod inspection endpoints
+type PodsHandler struct{}
+
+// PodContainer describes one container of a pod
+type PodContainer struct {
+	Name   string `json:"name"`
+	Init   bool   `json:"init"`             // True for init containers
+	State  string `json:"state"`            // running, waiting, terminated or unknown
+	Reason string `json:"reason,omitempty"` // e.g. "CrashLoopBackOff", "Completed"
+	Ready  bool   `json:"ready"`
+}
+
+// PodContainersResponse lists a pod's containers, init containers first in run order
+type PodContainersResponse struct {
+	Namespace   string         `json:"namespace"`
+	Pod         string         `json:"pod"`
+	Containers  []PodContainer `json:"containers"`
+	ClusterHash string         `json:"clusterHash"`
+}
+
+// Containers handles GET /pods/containers?namespace=&pod=&context=&clusterHash=&kubeconfigPath=
+// Kubeconfig content can't travel in a query string, so it comes from kubeconfigPath or the cluster registry
+func (h *PodsHandler) Containers(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	q := r.URL.Query()
+	namespace := q.Get("namespace")
+	pod := q.Get("pod")
+	kubeContext := q.Get("context")
+	clusterHash := q.Get("clusterHash")
+	kubeconfigPath := q.Get("kubeconfigPath")
+
+	if namespace == "" || pod == "" {
+		http.Error(w, "Missing required query parameters: namespace, pod", http.StatusBadRequest)
+		return
+	}
+
+	var kubeconfigContent string
+	if status, msg := loadKubeconfigPath(&kubeconfigContent, kubeconfigPath); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	// Without a kubeconfigPath, fall back to what an earlier request registered for this cluster;
+	// an explicit context still wins over the registered one
+	if kubeconfigContent == "" {
+		var regContext string
+		if !resolveHashOnly(logger, &kubeconfigContent, &regContext, clusterHash) {
+			writeRegistryMiss(w, clusterHash)
+			return
+		}
+		if kubeContext == "" {
+			kubeContext = regContext
+		}
+	}
+
+	if err := checkKubeconfigContext(kubeconfigContent, kubeContext); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Compute cluster hash if not provided
+	if clusterHash == "" {
+		clusterHash = cluster.ComputeHash(kubeconfigContent, kubeContext)
+	}
+
+	// Validate cluster hash
+	if !cluster.ValidateHash(clusterHash, kubeconfigContent, kubeContext) {
+		logger.Error("Cluster hash validation failed", "providedHash", clusterHash, "pod", pod)
+		http.Error(w, "Cluster hash validation failed", http.StatusBadRequest)
+		return
+	}
+
+	var kubeconfigFile string
+	if kubeconfigContent != "" {
+		tmpFile, release, err := kubeconfig.GetTempManager().AcquireFile(clusterHash, kubeconfigContent, kubeconfigPath)
+		if err != nil {
+			logger.Error("Failed to write kubeconfig", "error", err)
+			http.Error(w, "Failed to write kubeconfig", http.StatusInternalServerError)
+			return
+		}
+		defer release()
+		kubeconfigFile = tmpFile
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), podLookupTimeout)
+	defer cancel()
+
+	result, err := kubectl.ExecuteWithKubeconfigFile(ctx, []string{"get", "pod", pod, "-n", namespace, "-o", "json"}, kubeconfigFile, kubeContext)
+	if err != nil {
+		logger.Error("Failed to run kubectl for pod containers", "error", err, "pod", pod)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result.ExitCode != 0 {
+		if isNotFoundError(result.Stderr) {
+			http.Error(w, fmt.Sprintf("pod/%s not found in namespace %s", pod, namespace), http.StatusNotFound)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Failed to get pod/%s in namespace %s: %s", pod, namespace, strings.TrimSpace(result.Stderr)), http.StatusBadGateway)
+		return
+	}
+
+	containers, err := parsePodContainers(result.Stdout)
+	if err != nil {
+		logger.Error("Failed to parse pod", "error", err, "pod", pod)
+		http.Error(w, "Failed to parse kubectl output", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(PodContainersResponse{
+		Namespace:   namespace,
+		Pod:         pod,
+		Containers:  containers,
+		ClusterHash: clusterHash,
+	})
+}
+
+// podDefaultContainer returns the pod's default-container annotation, or "" if it has none
+// or the pod can't be read; the caller then leaves the choice to kubectl
+func podDefaultContainer(ctx context.Context, clusterHash, kubeconfigContent, kubeconfigPath, kubeContext, namespace, pod string) string {
+	var kubeconfigFile string
+	if kubeconfigContent != "" {
+		tmpFile, release, err := kubeconfig.GetTempManager().AcquireFile(clusterHash, kubeconfigContent, kubeconfigPath)
+		if err != nil {
+			logging.FromContext(ctx).Warn("Failed to write kubeconfig for default container lookup", "error", err)
+			return ""
+		}
+		defer release()
+		kubeconfigFile = tmpFile
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, podLookupTimeout)
+	defer cancel()
+
+	result, err := kubectl.ExecuteWithKubeconfigFile(ctx, []string{"get", "pod", pod, "-n", namespace, "-o", "json"}, kubeconfigFile, kubeContext)
+	if err != nil || result.ExitCode != 0 {
+		logging.FromContext(ctx).Debug("Default container lookup failed, leaving it to kubectl", "pod", pod, "namespace", namespace)
+		return ""
+	}
+
+	var meta struct {
+		Metadata struct {
+			Annotations map[string]string `json:"annotations"`
+		} `json:"metadata"`
+	}
+	if err := json.Unmarshal([]byte(result.Stdout), &meta); err != nil {
+		return ""
+	}
+	return meta.Metadata.Annotations[defaultContainerAnnotation]
+}
+
+// kubectlContainerStatus is the subset of a pod's containerStatuses entry we report
+type kubectlContainerStatus struct {
+	Name  string `json:"name"`
+	Ready bool   `json:"ready"`
+	State struct {
+		Running *struct{} `json:"running"`
+		Waiting *struct {
+			Reason string `json:"reason"`
+		} `json:"waiting"`
+		Terminated *struct {
+			Reason string `json:"reason"`
+		} `json:"terminated"`
+	} `json:"state"`
+}
+
+// parsePodContainers extracts init and regular containers, with their state, from `kubectl get pod -o json`
+func parsePodContainers(stdout string) ([]PodContainer, error) {
+	var pod struct {
+		Spec struct {
+			InitContainers []struct {
+				Name string `json:"name"`
+			} `json:"initContainers"`
+			Containers []struct {
+				Name string `json:"name"`
+			} `json:"containers"`
+		} `json:"spec"`
+		Status struct {
+			InitContainerStatuses []kubectlContainerStatus `json:"initContainerStatuses"`
+			ContainerStatuses     []kubectlContainerStatus `json:"containerStatuses"`
+		} `json:"status"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &pod); err != nil {
+		return nil, err
+	}
+
+	containers := make([]PodContainer, 0, len(pod.Spec.InitContainers)+len(pod.Spec.Containers))
+	for _, c := range pod.Spec.InitContainers {
+		containers = append(containers, containerWithStatus(c.Name, true, pod.Status.InitContainerStatuses))
+	}
+	for _, c := range pod.Spec.Containers {
+		containers = append(containers, containerWithStatus(c.Name, false, pod.Status.ContainerStatuses))
+	}
+	return containers, nil
+}
+
+// containerWithStatus builds a PodContainer from the matching status entry, if there is one
+func containerWithStatus(name string, init bool, statuses []kubectlContainerStatus) PodContainer {
+	c := PodContainer{Name: name, Init: init, State: containerStateUnknown}
+	for _, s := range statuses {
+		if s.Name != name {
+			continue
+		}
+		c.Ready = s.Ready
+		switch {
+		case s.State.Running != nil:
+			c.State = containerStateRunning
+		case s.State.Waiting != nil:
+			c.State = containerStateWaiting
+			c.Reason = s.State.Waiting.Reason
+		case s.State.Terminated != nil:
+			c.State = containerStateTerminated
+			c.Reason = s.State.Terminated.Reason
+		}
+		break
+	}
+	return c
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/cluster"
+)
+
+const testPodJSON = `{
+  "spec": {
+    "initContainers": [{"name": "migrate"}, {"name": "wait-db"}],
+    "containers": [{"name": "app"}, {"name": "sidecar"}]
+  },
+  "status": {
+    "initContainerStatuses": [
+      {"name": "migrate", "ready": false, "state": {"terminated": {"reason": "Completed", "exitCode": 0}}},
+      {"name": "wait-db", "ready": false, "state": {"running": {"startedAt": "2024-01-15T10:30:00Z"}}}
+    ],
+    "containerStatuses": [
+      {"name": "app", "ready": false, "state": {"waiting": {"reason": "PodInitializing"}}}
+    ]
+  }
+}`
+
+func TestParsePodContainers(t *testing.T) {
+	got, err := parsePodContainers(testPodJSON)
+	if err != nil {
+		t.Fatalf("parsePodContainers: %v", err)
+	}
+	want := []PodContainer{
+		{Name: "migrate", Init: true, State: "terminated", Reason: "Completed"},
+		{Name: "wait-db", Init: true, State: "running"},
+		{Name: "app", State: "waiting", Reason: "PodInitializing"},
+		{Name: "sidecar", State: "unknown"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d containers, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("container %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestPodContainers(t *testing.T) {
+	podFile := filepath.Join(t.TempDir(), "pod.json")
+	if err := os.WriteFile(podFile, []byte(testPodJSON), 0600); err != nil {
+		t.Fatal(err)
+	}
+	installFakeKubectl(t, `case "$*" in
+  *"get pod web -n default -o json"*) cat `+podFile+` ;;
+  *) echo 'Error from server (NotFound): pods "missing" not found' >&2; exit 1 ;;
+esac
+`)
+
+	kubeconfigPath := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(kubeconfigPath, []byte(testKubeconfigYAML), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := &PodsHandler{}
+	get := func(params url.Values) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.Containers(rec, httptest.NewRequest(http.MethodGet, "/pods/containers?"+params.Encode(), nil))
+		return rec
+	}
+
+	rec := get(url.Values{"namespace": {"default"}, "pod": {"web"}, "context": {"dev"}, "kubeconfigPath": {kubeconfigPath}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var resp PodContainersResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(resp.Containers) != 4 || !resp.Containers[0].Init || resp.Containers[2].Name != "app" {
+		t.Errorf("unexpected containers: %+v", resp.Containers)
+	}
+	if want := cluster.ComputeHash(testKubeconfigYAML, "dev"); resp.ClusterHash != want {
+		t.Errorf("clusterHash = %q, want %q", resp.ClusterHash, want)
+	}
+
+	if rec := get(url.Values{"namespace": {"default"}, "pod": {"missing"}}); rec.Code != http.StatusNotFound {
+		t.Errorf("missing pod: status = %d, want 404", rec.Code)
+	}
+	if rec := get(url.Values{"namespace": {"default"}}); rec.Code != http.StatusBadRequest {
+		t.Errorf("no pod: status = %d, want 400", rec.Code)
+	}
+	if rec := get(url.Values{"namespace": {"default"}, "pod": {"web"}, "clusterHash": {"0000000000000000"}}); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown cluster hash: status = %d, want 400", rec.Code)
+	}
+}
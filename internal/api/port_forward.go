@@ -1,42 +1,65 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log/slog"
 	"net/http"
-	"os"
 	"os/exec"
-	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/kubedeskpro/kubedesk-helper/internal/childproc"
 	"github.com/kubedeskpro/kubedesk-helper/internal/cluster"
 	"github.com/kubedeskpro/kubedesk-helper/internal/env"
+	"github.com/kubedeskpro/kubedesk-helper/internal/kubeconfig"
+	"github.com/kubedeskpro/kubedesk-helper/internal/kubectl"
+	"github.com/kubedeskpro/kubedesk-helper/internal/logging"
 	"github.com/kubedeskpro/kubedesk-helper/internal/session"
 )
 
 // PortForwardHandler handles port-forward endpoints
 type PortForwardHandler struct {
-	sessionMgr *session.Manager
+	sessionMgr  *session.Manager
+	idempotency idempotencyCache // Sessions started per idempotencyKey
 }
 
 // PortForwardStartRequest represents a port-forward start request
 type PortForwardStartRequest struct {
-	Namespace    string `json:"namespace"`
-	ResourceType string `json:"resourceType"` // "service" or "pod"
-	ResourceName string `json:"resourceName"`
-	ServicePort  string `json:"servicePort"`
-	LocalPort    string `json:"localPort"`
-	Kubeconfig   string `json:"kubeconfig,omitempty"`
-	Context      string `json:"context,omitempty"`
-	ClusterHash  string `json:"clusterHash,omitempty"` // Optional: computed by helper if not provided
+	Namespace      string `json:"namespace"`
+	ResourceType   string `json:"resourceType"` // "service" or "pod"
+	ResourceName   string `json:"resourceName"`
+	ServicePort    string `json:"servicePort"`
+	LocalPort      string `json:"localPort"`
+	Kubeconfig     string `json:"kubeconfig,omitempty"`
+	KubeconfigPath string `json:"kubeconfigPath,omitempty"` // Absolute path to a kubeconfig on disk, used in place
+	Context        string `json:"context,omitempty"`
+	ClusterHash    string `json:"clusterHash,omitempty"` // Optional: computed by helper if not provided
+
+	// VerifyResource runs a quick "kubectl get" before forwarding so a missing
+	// resource returns a clean 404 instead of an opaque port-forward failure.
+	// Off by default to avoid the extra round-trip.
+	VerifyResource bool `json:"verifyResource,omitempty"`
+
+	// WaitReady holds the response until kubectl reports it is forwarding (up to 15s),
+	// so a failed start returns kubectl's stderr instead of a session that dies right away
+	// Implied by a localPort of "0", whose real port is only known once kubectl reports it
+	WaitReady bool `json:"waitReady,omitempty"`
+
+	// Optional: a retry with the same key (and cluster) returns the session the first request
+	// started, as long as it is still running, instead of starting a duplicate
+	IdempotencyKey string `json:"idempotencyKey,omitempty"`
 }
 
+// resourceCheckTimeout bounds the optional pre-flight "kubectl get" for port-forward
+const resourceCheckTimeout = 10 * time.Second
+
 // PortForwardStartResponse represents a port-forward start response
 type PortForwardStartResponse struct {
 	SessionID string `json:"sessionId"`
 	Status    string `json:"status"`
+	LocalPort string `json:"localPort,omitempty"` // Port kubectl reported forwarding from; set when the start waited for it
 }
 
 // PortForwardListResponse represents a port-forward list response
@@ -46,26 +69,37 @@ type PortForwardListResponse struct {
 
 // PortForwardSessionInfo represents port-forward session information
 type PortForwardSessionInfo struct {
-	SessionID    string `json:"sessionId"`
-	Namespace    string `json:"namespace"`
-	ResourceType string `json:"resourceType"`
-	ResourceName string `json:"resourceName"`
-	ServicePort  string `json:"servicePort"`
-	LocalPort    string `json:"localPort"`
-	Status       string `json:"status"`
-	StartedAt    string `json:"startedAt"`
+	SessionID    string   `json:"sessionId"`
+	Context      string   `json:"context"`
+	ClusterHash  string   `json:"clusterHash"`
+	Namespace    string   `json:"namespace"`
+	ResourceType string   `json:"resourceType"`
+	ResourceName string   `json:"resourceName"`
+	ServicePort  string   `json:"servicePort"`
+	LocalPort    string   `json:"localPort"`
+	Status       string   `json:"status"`
+	StartedAt    string   `json:"startedAt"`
+	CommandLine  []string `json:"commandLine,omitempty"` // kubectl argv, secrets redacted
 }
 
 // Start handles POST /port-forward/start
 func (h *PortForwardHandler) Start(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
 	var req PortForwardStartRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		slog.Error("Failed to decode port-forward request", "error", err)
+		logger.Error("Failed to decode port-forward request", "error", err)
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	slog.Info("Port-forward request received",
+	// A kubeconfigPath is read only for hashing; kubectl uses the file in place
+	if status, msg := loadKubeconfigPath(&req.Kubeconfig, req.KubeconfigPath); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	logger.Info("Port-forward request received",
 		"namespace", req.Namespace,
 		"resourceType", req.ResourceType,
 		"resourceName", req.ResourceName,
@@ -83,25 +117,19 @@ func (h *PortForwardHandler) Start(w http.ResponseWriter, r *http.Request) {
 	if req.ResourceType != "service" && req.ResourceType != "pod" {
 		req.ResourceType = "pod" // Default to pod
 	}
+	if err := checkIdempotencyKey(req.IdempotencyKey); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	// If kubeconfig/context not provided, try to look up from registry
-	if req.Kubeconfig == "" && req.Context == "" && req.ClusterHash != "" {
-		regKubeconfig, regContext, foundInRegistry := cluster.GetRegistry().Lookup(req.ClusterHash)
-		if !foundInRegistry {
-			slog.Error("Cluster hash not found in registry and kubeconfig/context not provided",
-				"providedHash", req.ClusterHash,
-				"resource", req.ResourceName,
-				"hint", "This usually happens after helper restart. App should send kubeconfig and context.",
-			)
-			http.Error(w, "Cluster hash not found in registry. Please provide kubeconfig and context in the request.", http.StatusBadRequest)
-			return
-		}
-		req.Kubeconfig = regKubeconfig
-		req.Context = regContext
-		slog.Info("Looked up cluster info from registry",
-			"clusterHash", req.ClusterHash,
-			"context", req.Context,
-		)
+	if !resolveHashOnly(logger, &req.Kubeconfig, &req.Context, req.ClusterHash) {
+		writeRegistryMiss(w, req.ClusterHash)
+		return
+	}
+	if err := checkKubeconfigContext(req.Kubeconfig, req.Context); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
 	// Compute cluster hash if not provided
@@ -111,7 +139,7 @@ func (h *PortForwardHandler) Start(w http.ResponseWriter, r *http.Request) {
 		// If hash is provided, VALIDATE it first before registering
 		expectedHash := cluster.ComputeHash(req.Kubeconfig, req.Context)
 		if req.ClusterHash != expectedHash {
-			slog.Error("Cluster hash mismatch - app sent wrong hash!",
+			logger.Error("Cluster hash mismatch - app sent wrong hash!",
 				"providedHash", req.ClusterHash,
 				"expectedHash", expectedHash,
 				"context", req.Context,
@@ -123,22 +151,56 @@ func (h *PortForwardHandler) Start(w http.ResponseWriter, r *http.Request) {
 
 		// Hash is valid - register it
 		cluster.GetRegistry().Register(req.ClusterHash, req.Kubeconfig, req.Context)
-		slog.Info("Validated and registered cluster hash",
+		logger.Info("Validated and registered cluster hash",
 			"clusterHash", req.ClusterHash,
 			"context", req.Context,
 		)
 	}
 
+	// A retry of a request that already started a port-forward gets that session back
+	var idempotencyKey string
+	if req.IdempotencyKey != "" {
+		idempotencyKey = idempotencyCacheKey(req.ClusterHash, req.IdempotencyKey)
+	}
+	unlock := h.idempotency.lock(idempotencyKey)
+	defer unlock()
+	if response, ok := h.idempotency.lookup(idempotencyKey, h.sessionMgr); ok {
+		logger.Info("Returning port-forward for repeated idempotency key", "clusterHash", req.ClusterHash)
+		writeIdempotentReplay(w, response)
+		return
+	}
+
+	resource := fmt.Sprintf("%s/%s", req.ResourceType, req.ResourceName)
+
+	// Optionally confirm the target exists before spawning a long-lived port-forward
+	if req.VerifyResource {
+		status, msg := h.checkResourceExists(r.Context(), resource, &req)
+		if status != http.StatusOK {
+			logger.Warn("Port-forward resource check failed",
+				"resource", resource,
+				"namespace", req.Namespace,
+				"clusterHash", req.ClusterHash,
+				"status", status,
+				"reason", msg,
+			)
+			http.Error(w, msg, status)
+			return
+		}
+	}
+
 	// Create session
-	sess := h.sessionMgr.Create(session.TypePortForward)
+	sess, err := h.sessionMgr.CreateForCluster(session.TypePortForward, req.ClusterHash)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
 	sess.Namespace = req.Namespace
 	sess.ResourceType = req.ResourceType
 	sess.ResourceName = req.ResourceName
 	sess.ServicePort = req.ServicePort
-	sess.LocalPort = req.LocalPort
+	h.sessionMgr.SetLocalPort(sess, req.LocalPort)
 	sess.Context = req.Context
-	sess.Kubeconfig = req.Kubeconfig
-	sess.ClusterHash = req.ClusterHash
+	sess.SetKubeconfig(req.Kubeconfig)
 
 	// Find kubectl
 	kubectlPath, err := exec.LookPath("kubectl")
@@ -154,8 +216,6 @@ func (h *PortForwardHandler) Start(w http.ResponseWriter, r *http.Request) {
 		args = append(args, "--context", req.Context)
 	}
 	args = append(args, "-n", req.Namespace)
-	
-	resource := fmt.Sprintf("%s/%s", req.ResourceType, req.ResourceName)
 	args = append(args, resource, fmt.Sprintf("%s:%s", req.LocalPort, req.ServicePort))
 
 	cmd := exec.Command(kubectlPath, args...)
@@ -163,74 +223,141 @@ func (h *PortForwardHandler) Start(w http.ResponseWriter, r *http.Request) {
 
 	// Set kubeconfig if provided
 	if req.Kubeconfig != "" {
-		tmpDir := os.TempDir()
-		tmpFile := filepath.Join(tmpDir, fmt.Sprintf("kubeconfig-%s", sess.ID))
-		if err := os.WriteFile(tmpFile, []byte(req.Kubeconfig), 0600); err != nil {
+		// Shared with other commands for the same cluster; released when the session ends
+		tmpFile, release, err := kubeconfig.GetTempManager().AcquireFile(req.ClusterHash, req.Kubeconfig, req.KubeconfigPath)
+		if err != nil {
 			h.sessionMgr.Stop(sess.ID)
 			http.Error(w, "Failed to write kubeconfig", http.StatusInternalServerError)
 			return
 		}
+		sess.AddRelease(release)
 		cmd.Env = append(cmd.Env, fmt.Sprintf("KUBECONFIG=%s", tmpFile))
-
-		// Register temp file for cleanup when session ends
-		sess.TempFiles = append(sess.TempFiles, tmpFile)
 	}
 
+	// Capture stderr so a failed start can report why (port in use, unknown named port, ...)
+	// and watch stdout for the line kubectl prints once it is forwarding
+	stderr := newTailBuffer(portForwardStderrMaxBytes)
+	cmd.Stderr = stderr
+	stdout := newForwardingWriter()
+	cmd.Stdout = stdout
+
 	sess.Cmd = cmd
+	sess.CommandLine = redactCommandLine(cmd.Args)
 
 	// Start port-forward in background
-	if err := cmd.Start(); err != nil {
+	if err := childproc.Start(cmd); err != nil {
 		h.sessionMgr.Stop(sess.ID)
-		slog.Error("Failed to start port-forward", "error", err)
+		logger.Error("Failed to start port-forward", "error", err)
 		http.Error(w, fmt.Sprintf("Failed to start port-forward: %v", err), http.StatusInternalServerError)
 		return
 	}
 
 	// Monitor process in background
+	exited := make(chan struct{})
 	go func() {
-		// CRITICAL: Clean up temp files AFTER kubectl finishes
+		// CRITICAL: Release temp kubeconfig AFTER kubectl finishes
 		// This ensures kubectl can read the kubeconfig file for the entire duration
-		defer func() {
-			for _, tmpFile := range sess.TempFiles {
-				if err := os.Remove(tmpFile); err != nil && !os.IsNotExist(err) {
-					slog.Warn("Failed to remove temp file", "file", tmpFile, "error", err)
-				} else {
-					slog.Debug("Removed temp file after port-forward completed", "file", tmpFile)
-				}
-			}
-			// Clear the list so session cleanup doesn't try to delete them again
-			sess.TempFiles = nil
-		}()
-
-		cmd.Wait()
-		sess.Status = session.StatusStopped
-		slog.Info("Port-forward session ended", "id", sess.ID)
+		defer sess.Release()
+
+		err := childproc.Wait(cmd)
+		close(exited)
+		h.sessionMgr.SetStatus(sess, session.StatusStopped)
+		if err != nil {
+			logger.Info("Port-forward session ended", "id", sess.ID, "error", err, "stderr", stderr.LastLines(portForwardStderrTailLines))
+		} else {
+			logger.Info("Port-forward session ended", "id", sess.ID)
+		}
 	}()
 
-	slog.Info("Port-forward started", "id", sess.ID, "resource", resource, "ports", fmt.Sprintf("%s:%s", req.LocalPort, req.ServicePort))
+	// kubectl chooses the port for "0"; wait for it so the response can report it
+	var confirmedPort string
+	if req.WaitReady || req.LocalPort == "0" {
+		if failure := waitForPortForward(stdout.ready, exited, cmd, stderr, portForwardReadyTimeout); failure != nil {
+			h.sessionMgr.Stop(sess.ID)
+			logger.Error("Port-forward failed to start",
+				"resource", resource,
+				"error", failure.Error,
+				"stderr", failure.Stderr,
+			)
+			writePortForwardStartError(w, failure)
+			return
+		}
+		confirmedPort = stdout.LocalPort()
+		h.sessionMgr.SetLocalPort(sess, confirmedPort)
+	}
+
+	logger.Info("Port-forward started", "id", sess.ID, "resource", resource, "ports", fmt.Sprintf("%s:%s", h.sessionMgr.LocalPortOf(sess), req.ServicePort), "confirmed", confirmedPort != "")
 
 	response := PortForwardStartResponse{
 		SessionID: sess.ID,
-		Status:    string(sess.Status),
+		Status:    string(h.sessionMgr.StatusOf(sess)),
+		LocalPort: confirmedPort,
 	}
+	h.idempotency.store(idempotencyKey, sess.ID, response)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
+// checkResourceExists runs "kubectl get <type>/<name> -n <ns>" and maps the result to an HTTP status
+// Returns (http.StatusOK, "") when the resource exists
+func (h *PortForwardHandler) checkResourceExists(parent context.Context, resource string, req *PortForwardStartRequest) (int, string) {
+	ctx, cancel := context.WithTimeout(parent, resourceCheckTimeout)
+	defer cancel()
+
+	// Reuse the cluster's shared temp kubeconfig instead of writing a one-off copy
+	var kubeconfigPath string
+	if req.Kubeconfig != "" {
+		tmpFile, release, err := kubeconfig.GetTempManager().AcquireFile(req.ClusterHash, req.Kubeconfig, req.KubeconfigPath)
+		if err != nil {
+			return http.StatusInternalServerError, "Failed to write kubeconfig"
+		}
+		defer release()
+		kubeconfigPath = tmpFile
+	}
+
+	namespace := req.Namespace
+	result, err := kubectl.ExecuteWithKubeconfigFile(ctx, []string{"get", resource, "-n", namespace, "-o", "name"}, kubeconfigPath, req.Context)
+	if err != nil {
+		return http.StatusInternalServerError, err.Error()
+	}
+
+	if result.ExitCode == 0 {
+		return http.StatusOK, ""
+	}
+
+	if isNotFoundError(result.Stderr) {
+		return http.StatusNotFound, fmt.Sprintf("%s not found in namespace %s", resource, namespace)
+	}
+
+	return http.StatusBadGateway, fmt.Sprintf("Failed to verify %s in namespace %s: %s", resource, namespace, strings.TrimSpace(result.Stderr))
+}
+
+// isNotFoundError reports whether kubectl's stderr describes a missing resource
+// Only the API server's NotFound counts: local errors such as `context "x" not found` don't
+func isNotFoundError(stderr string) bool {
+	return strings.Contains(stderr, "Error from server (NotFound)")
+}
+
 // Stop handles DELETE /port-forward/stop/{sessionId}
 func (h *PortForwardHandler) Stop(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
 	vars := mux.Vars(r)
 	sessionID := vars["sessionId"]
 
-	// Get cluster hash from query parameter (optional)
-	clusterHash := r.URL.Query().Get("clusterHash")
+	// Optional cluster hash, from the JSON body or the query
+	clusterHash, err := readClusterHash(r)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
 
 	// Validate cluster hash if provided
 	if clusterHash != "" {
 		sess, ok := h.sessionMgr.GetWithClusterValidation(sessionID, clusterHash)
 		if !ok {
-			slog.Warn("Session not found or cluster hash mismatch",
+			logger.Warn("Session not found or cluster hash mismatch",
 				"sessionId", sessionID,
 				"providedHash", clusterHash,
 			)
@@ -257,13 +384,16 @@ func (h *PortForwardHandler) List(w http.ResponseWriter, r *http.Request) {
 	for _, sess := range sessions {
 		sessionInfos = append(sessionInfos, PortForwardSessionInfo{
 			SessionID:    sess.ID,
+			Context:      sess.Context,
+			ClusterHash:  sess.ClusterHash,
 			Namespace:    sess.Namespace,
 			ResourceType: sess.ResourceType,
 			ResourceName: sess.ResourceName,
 			ServicePort:  sess.ServicePort,
-			LocalPort:    sess.LocalPort,
-			Status:       string(sess.Status),
+			LocalPort:    h.sessionMgr.LocalPortOf(sess),
+			Status:       string(h.sessionMgr.StatusOf(sess)),
 			StartedAt:    sess.StartedAt.Format(time.RFC3339),
+			CommandLine:  sess.CommandLine,
 		})
 	}
 
@@ -271,4 +401,3 @@ func (h *PortForwardHandler) List(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
-
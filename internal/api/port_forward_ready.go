@@ -0,0 +1,137 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limits for waiting on, and reporting why, a port-forward failed to start
+const (
+	portForwardReadyTimeout    = 15 * time.Second
+	portForwardStderrMaxBytes  = 8 * 1024
+	portForwardStderrTailLines = 5
+)
+
+// forwardingLineRe matches the line kubectl port-forward prints on stdout for each listener,
+// e.g. "Forwarding from 127.0.0.1:8080 -> 80" or "Forwarding from [::1]:8080 -> 80"
+var forwardingLineRe = regexp.MustCompile(`^Forwarding from (\S+):([0-9]+) -> (\S+)$`)
+
+// Bounds the partial line a forwardingWriter keeps between writes
+const forwardingLineMaxBytes = 512
+
+// PortForwardStartError is the body of a /port-forward/start whose kubectl failed to start forwarding
+type PortForwardStartError struct {
+	Error    string `json:"error"`
+	Stderr   string `json:"stderr,omitempty"`   // Last lines kubectl wrote to stderr, e.g. "error: unable to listen on any of the requested ports"
+	ExitCode *int   `json:"exitCode,omitempty"` // Set if kubectl exited; absent if it was still not forwarding at the timeout
+}
+
+// forwardedPort is one listener kubectl reported
+type forwardedPort struct {
+	Address    string // Local address, e.g. "127.0.0.1" or "[::1]"
+	LocalPort  string
+	RemotePort string // Resolved by kubectl, so a number even for a named port
+}
+
+// parseForwardingLine parses one "Forwarding from" line of kubectl port-forward output
+func parseForwardingLine(line string) (forwardedPort, bool) {
+	m := forwardingLineRe.FindStringSubmatch(strings.TrimSpace(line))
+	if m == nil {
+		return forwardedPort{}, false
+	}
+	return forwardedPort{Address: m[1], LocalPort: m[2], RemotePort: m[3]}, true
+}
+
+// forwardingWriter parses kubectl's stdout and closes ready at the first "Forwarding from" line
+// Other output is discarded; kubectl keeps logging "Handling connection" lines
+type forwardingWriter struct {
+	ready chan struct{}
+
+	mu      sync.Mutex
+	ports   []forwardedPort
+	partial []byte // Unterminated last line, in case a line spans two writes
+}
+
+// newForwardingWriter returns an empty forwardingWriter
+func newForwardingWriter() *forwardingWriter {
+	return &forwardingWriter{ready: make(chan struct{})}
+}
+
+// Write implements io.Writer
+func (w *forwardingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	data := append(w.partial, p...)
+	for {
+		line, rest, found := bytes.Cut(data, []byte("\n"))
+		if !found {
+			break
+		}
+		data = rest
+		if port, ok := parseForwardingLine(string(line)); ok {
+			if len(w.ports) == 0 {
+				close(w.ready)
+			}
+			w.ports = append(w.ports, port)
+		}
+	}
+	if len(data) > forwardingLineMaxBytes {
+		data = data[len(data)-forwardingLineMaxBytes:]
+	}
+	w.partial = append([]byte(nil), data...)
+	return len(p), nil
+}
+
+// Ports returns the listeners kubectl has reported so far, in order
+func (w *forwardingWriter) Ports() []forwardedPort {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]forwardedPort(nil), w.ports...)
+}
+
+// LocalPort returns the local port of the first reported listener, or "" before there is one
+// kubectl picks one port for all of a mapping's listeners, including for a requested port of 0
+func (w *forwardingWriter) LocalPort() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.ports) == 0 {
+		return ""
+	}
+	return w.ports[0].LocalPort
+}
+
+// waitForPortForward waits until kubectl reports it is forwarding, it exits, or the timeout elapses
+// Returns nil once forwarding; otherwise the error to send, with kubectl's stderr attached
+func waitForPortForward(ready, exited <-chan struct{}, cmd *exec.Cmd, stderr *tailBuffer, timeout time.Duration) *PortForwardStartError {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	var failure PortForwardStartError
+	select {
+	case <-ready:
+		return nil
+	case <-exited:
+		// Wait has returned, so ProcessState is set
+		code := cmd.ProcessState.ExitCode()
+		failure.Error = "kubectl port-forward exited before forwarding"
+		failure.ExitCode = &code
+	case <-timer.C:
+		failure.Error = "kubectl port-forward was not forwarding after " + timeout.String()
+	}
+	failure.Stderr = stderr.LastLines(portForwardStderrTailLines)
+	return &failure
+}
+
+// writePortForwardStartError responds 500 with a PortForwardStartError
+func writePortForwardStartError(w http.ResponseWriter, failure *PortForwardStartError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusInternalServerError)
+	json.NewEncoder(w).Encode(failure)
+}
@@ -0,0 +1,276 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/session"
+)
+
+func TestIsNotFoundError(t *testing.T) {
+	tests := []struct {
+		name   string
+		stderr string
+		want   bool
+	}{
+		{
+			name:   "Service not found",
+			stderr: `Error from server (NotFound): services "foo" not found`,
+			want:   true,
+		},
+		{
+			name:   "Pod not found",
+			stderr: `Error from server (NotFound): pods "bar" not found`,
+			want:   true,
+		},
+		{
+			name:   "Forbidden",
+			stderr: `Error from server (Forbidden): pods "bar" is forbidden: User "dev" cannot get resource "pods"`,
+			want:   false,
+		},
+		{
+			name:   "Missing kubeconfig context",
+			stderr: `error: context "staging" not found`,
+			want:   false,
+		},
+		{
+			name:   "Connection refused",
+			stderr: "The connection to the server localhost:8080 was refused - did you specify the right host or port?",
+			want:   false,
+		},
+		{
+			name:   "Empty",
+			stderr: "",
+			want:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isNotFoundError(tt.stderr); got != tt.want {
+				t.Errorf("isNotFoundError(%q) = %v, want %v", tt.stderr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPortForwardStart_IdempotencyKey(t *testing.T) {
+	installFakeKubectl(t, "exec sleep 30\n")
+
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	defer sessionMgr.StopAll()
+	handler := &PortForwardHandler{sessionMgr: sessionMgr}
+
+	start := func(key string) (PortForwardStartResponse, *httptest.ResponseRecorder) {
+		t.Helper()
+		body := `{"namespace":"default","resourceName":"web","servicePort":"80","localPort":"8080","context":"dev","idempotencyKey":"` + key + `"}`
+		rec := httptest.NewRecorder()
+		handler.Start(rec, httptest.NewRequest(http.MethodPost, "/port-forward/start", strings.NewReader(body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+		}
+		var resp PortForwardStartResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp, rec
+	}
+
+	first, rec := start("retry-1")
+	if rec.Header().Get(idempotentReplayHeader) != "" {
+		t.Error("first request was marked as a replay")
+	}
+	second, rec := start("retry-1")
+	if second.SessionID != first.SessionID || rec.Header().Get(idempotentReplayHeader) != "true" {
+		t.Errorf("retry got session %s (replayed %q), want %s", second.SessionID, rec.Header().Get(idempotentReplayHeader), first.SessionID)
+	}
+	if n := len(sessionMgr.List(session.TypePortForward)); n != 1 {
+		t.Errorf("%d port-forward sessions after a retry, want 1", n)
+	}
+
+	if other, _ := start("retry-2"); other.SessionID == first.SessionID {
+		t.Error("a different key reused the first session")
+	}
+
+	// Once the session is gone, the key starts a new one
+	sessionMgr.Stop(first.SessionID)
+	if again, _ := start("retry-1"); again.SessionID == first.SessionID {
+		t.Error("key returned a stopped session")
+	}
+}
+
+func TestIdempotencyCache_Expiry(t *testing.T) {
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	sess, _ := sessionMgr.Create(session.TypeProxy)
+
+	now := time.Now()
+	cache := &idempotencyCache{now: func() time.Time { return now }}
+	key := idempotencyCacheKey("abc123", "k")
+	cache.store(key, sess.ID, "response")
+
+	if got, ok := cache.lookup(key, sessionMgr); !ok || got != "response" {
+		t.Fatalf("lookup = %v, %v", got, ok)
+	}
+	if _, ok := cache.lookup(idempotencyCacheKey("other", "k"), sessionMgr); ok {
+		t.Error("key matched on another cluster")
+	}
+	now = now.Add(idempotencyTTL)
+	if _, ok := cache.lookup(key, sessionMgr); ok {
+		t.Error("key outlived idempotencyTTL")
+	}
+}
+
+func TestPortForwardStart_WaitReady(t *testing.T) {
+	tests := []struct {
+		name       string
+		script     string
+		wantStatus int
+		wantStderr string
+	}{
+		{
+			name:       "Forwarding",
+			script:     "echo 'Forwarding from 127.0.0.1:8080 -> 80'\nexec sleep 30\n",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "Local port in use",
+			script: "echo 'Unable to listen on port 8080: Listeners failed to create with the following errors: [unable to create listener: Error listen tcp4 127.0.0.1:8080: bind: address already in use]' >&2\n" +
+				"echo 'error: unable to listen on any of the requested ports: [{8080 80}]' >&2\nexit 1\n",
+			wantStatus: http.StatusInternalServerError,
+			wantStderr: "error: unable to listen on any of the requested ports: [{8080 80}]",
+		},
+		{
+			name:       "Missing named port",
+			script:     "echo \"error: Pod 'web' does not have a named port 'http'\" >&2\nexit 1\n",
+			wantStatus: http.StatusInternalServerError,
+			wantStderr: "error: Pod 'web' does not have a named port 'http'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			installFakeKubectl(t, tt.script)
+
+			sessionMgr := session.NewManager()
+			defer sessionMgr.Shutdown()
+			defer sessionMgr.StopAll()
+			handler := &PortForwardHandler{sessionMgr: sessionMgr}
+
+			body := `{"namespace":"default","resourceType":"pod","resourceName":"web","servicePort":"http","localPort":"8080","context":"dev","waitReady":true}`
+			rec := httptest.NewRecorder()
+			handler.Start(rec, httptest.NewRequest(http.MethodPost, "/port-forward/start", strings.NewReader(body)))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body = %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus == http.StatusOK {
+				return
+			}
+
+			var failure PortForwardStartError
+			if err := json.NewDecoder(rec.Body).Decode(&failure); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if !strings.HasSuffix(failure.Stderr, tt.wantStderr) {
+				t.Errorf("stderr = %q, want it to end with %q", failure.Stderr, tt.wantStderr)
+			}
+			if failure.ExitCode == nil || *failure.ExitCode != 1 || failure.Error == "" {
+				t.Errorf("unexpected failure: %+v", failure)
+			}
+			if n := len(sessionMgr.List(session.TypePortForward)); n != 0 {
+				t.Errorf("%d port-forward sessions left after a failed start", n)
+			}
+		})
+	}
+}
+
+func TestPortForwardStart_AutoLocalPort(t *testing.T) {
+	// kubectl picks a free port for "0" and reports it on one line per listener
+	installFakeKubectl(t, "echo 'Forwarding from 127.0.0.1:54321 -> 8080'\necho 'Forwarding from [::1]:54321 -> 8080'\nexec sleep 30\n")
+
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	defer sessionMgr.StopAll()
+	handler := &PortForwardHandler{sessionMgr: sessionMgr}
+
+	// No waitReady: a port of 0 waits on its own
+	body := `{"namespace":"default","resourceType":"service","resourceName":"web","servicePort":"http","localPort":"0","context":"dev"}`
+	rec := httptest.NewRecorder()
+	handler.Start(rec, httptest.NewRequest(http.MethodPost, "/port-forward/start", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var resp PortForwardStartResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.LocalPort != "54321" {
+		t.Errorf("response localPort = %q, want 54321", resp.LocalPort)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.List(rec, httptest.NewRequest(http.MethodGet, "/port-forward/list", nil))
+	var list PortForwardListResponse
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+		t.Fatalf("decode list: %v", err)
+	}
+	if len(list.Sessions) != 1 || list.Sessions[0].LocalPort != "54321" {
+		t.Errorf("listed sessions = %+v, want localPort 54321", list.Sessions)
+	}
+}
+
+func TestParseForwardingLine(t *testing.T) {
+	// Representative kubectl port-forward output, stdout and stderr
+	output := `Forwarding from 127.0.0.1:8080 -> 80
+Forwarding from [::1]:8080 -> 80
+Handling connection for 8080
+Forwarding from 0.0.0.0:9090 -> 9090
+E0101 12:00:00.000000   123 portforward.go:409] an error occurred forwarding 8080 -> 80: connection refused
+Unable to listen on port 8080: Listeners failed to create with the following errors: [unable to create listener: Error listen tcp4 127.0.0.1:8080: bind: address already in use]
+`
+	want := []forwardedPort{
+		{Address: "127.0.0.1", LocalPort: "8080", RemotePort: "80"},
+		{Address: "[::1]", LocalPort: "8080", RemotePort: "80"},
+		{Address: "0.0.0.0", LocalPort: "9090", RemotePort: "9090"},
+	}
+
+	var got []forwardedPort
+	for _, line := range strings.Split(output, "\n") {
+		if port, ok := parseForwardingLine(line); ok {
+			got = append(got, port)
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parsed %+v, want %+v", got, want)
+	}
+}
+
+func TestForwardingWriter_LineSplitAcrossWrites(t *testing.T) {
+	w := newForwardingWriter()
+	w.Write([]byte("Forwarding f"))
+	select {
+	case <-w.ready:
+		t.Fatal("ready before the line was complete")
+	default:
+	}
+	w.Write([]byte("rom 127.0.0.1:8080 -> 80\nForwarding from [::1]:80"))
+	select {
+	case <-w.ready:
+	default:
+		t.Fatal("not ready after the line was split across writes")
+	}
+	w.Write([]byte("80 -> 80\nHandling connection for 8080\n"))
+
+	if got := w.LocalPort(); got != "8080" {
+		t.Errorf("LocalPort = %q, want 8080", got)
+	}
+	if ports := w.Ports(); len(ports) != 2 || ports[1].Address != "[::1]" {
+		t.Errorf("Ports = %+v, want the IPv4 and IPv6 listeners", ports)
+	}
+}
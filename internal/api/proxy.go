@@ -6,37 +6,104 @@ import (
 	"log/slog"
 	"net"
 	"net/http"
-	"os"
 	"os/exec"
-	"path/filepath"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/kubedeskpro/kubedesk-helper/internal/childproc"
 	"github.com/kubedeskpro/kubedesk-helper/internal/cluster"
+	"github.com/kubedeskpro/kubedesk-helper/internal/config"
 	"github.com/kubedeskpro/kubedesk-helper/internal/env"
+	"github.com/kubedeskpro/kubedesk-helper/internal/kubeconfig"
+	"github.com/kubedeskpro/kubedesk-helper/internal/logging"
 	"github.com/kubedeskpro/kubedesk-helper/internal/session"
 )
 
 // ProxyHandler handles proxy endpoints
 type ProxyHandler struct {
 	sessionMgr *session.Manager
+	portMin    int // Zero values fall back to config.DefaultProxyPort{Min,Max}
+	portMax    int
+
+	readyTimeout  time.Duration // Zero values fall back to config.DefaultProxyReady{Timeout,Interval}
+	readyInterval time.Duration
+
+	startLocks  keyedMutex       // Serializes Start per cluster hash
+	portMu      sync.Mutex       // Serializes proxy port selection across cluster hashes
+	reserved    map[int]string   // Ports picked for proxies still starting, by cluster hash; guarded by portMu
+	idempotency idempotencyCache // Proxies returned per /proxy/start idempotencyKey
+
+	pids *proxyPIDFile // Records running proxies for StopOrphanedProxies; nil = not recorded
+
+	stats proxyCounters // Reported by /proxy/stats
+
+	maxProxies int        // Running proxies before the least recently used is evicted; 0 = unlimited
+	evictLock  sync.Mutex // Serializes eviction so concurrent starts don't pick the same proxies
+}
+
+// Limits for reporting why kubectl proxy failed to start
+const (
+	proxyStderrMaxBytes  = 8 * 1024
+	proxyStderrTailLines = 5
+	proxyReadyMaxBackoff = time.Second
+)
+
+// proxyBindAddress is the loopback address kubectl proxy is pinned to
+// CRITICAL: Use the IPv4 literal, not "localhost" - on some systems localhost resolves
+// to ::1 first while kubectl proxy only listens on 127.0.0.1, causing spurious 502s
+const proxyBindAddress = "127.0.0.1"
+
+// proxyHostPort returns the host:port the helper uses to reach a kubectl proxy
+func proxyHostPort(port int) string {
+	return net.JoinHostPort(proxyBindAddress, strconv.Itoa(port))
 }
 
 // ProxyStartRequest represents a proxy start request
 type ProxyStartRequest struct {
-	Port        int    `json:"port"`
-	Kubeconfig  string `json:"kubeconfig,omitempty"`
-	Context     string `json:"context,omitempty"`
-	ClusterHash string `json:"clusterHash,omitempty"` // Optional: computed by helper if not provided
+	Port           int    `json:"port"`
+	Kubeconfig     string `json:"kubeconfig,omitempty"`
+	KubeconfigPath string `json:"kubeconfigPath,omitempty"` // Absolute path to a kubeconfig on disk, used in place
+	Context        string `json:"context,omitempty"`
+	ClusterHash    string `json:"clusterHash,omitempty"` // Optional: computed by helper if not provided
+
+	// Optional namespace scope, fixed when the proxy starts (a reused proxy keeps its own):
+	// cluster-wide lists of namespaced resources are rewritten to DefaultNamespace, and with
+	// NamespaceScoped requests into other namespaces are rejected
+	DefaultNamespace string `json:"defaultNamespace,omitempty"`
+	NamespaceScoped  bool   `json:"namespaceScoped,omitempty"` // Requires DefaultNamespace
+
+	// Optional, /proxy/start only: a retry with the same key (and cluster) returns the proxy the
+	// first request got, as long as it is still running. /proxy/ensure is idempotent anyway
+	IdempotencyKey string `json:"idempotencyKey,omitempty"`
 }
 
 // ProxyStartResponse represents a proxy start response
 type ProxyStartResponse struct {
+	SessionID      string `json:"sessionId"`
+	Port           int    `json:"port"`        // Deprecated: App should use /proxy/{clusterHash}/* instead
+	ClusterHash    string `json:"clusterHash"` // Use this to route requests via /proxy/{clusterHash}/*
+	Status         string `json:"status"`
+	KubeconfigPath string `json:"kubeconfigPath,omitempty"` // Kubeconfig the proxy uses: the request's path or the default; omitted for inline kubeconfigs
+
+	DefaultNamespace string `json:"defaultNamespace,omitempty"`
+	NamespaceScoped  bool   `json:"namespaceScoped,omitempty"`
+}
+
+// ProxyEnsureResponse represents a proxy ensure response
+type ProxyEnsureResponse struct {
 	SessionID   string `json:"sessionId"`
-	Port        int    `json:"port"`        // Deprecated: App should use /proxy/{clusterHash}/* instead
+	Port        int    `json:"port"`
 	ClusterHash string `json:"clusterHash"` // Use this to route requests via /proxy/{clusterHash}/*
 	Status      string `json:"status"`
+	Reused      bool   `json:"reused"` // True if an already-running proxy was returned
+	Ready       bool   `json:"ready"`  // True if the proxy accepted a connection
+
+	KubeconfigPath string `json:"kubeconfigPath,omitempty"` // Kubeconfig the proxy uses: the request's path or the default; omitted for inline kubeconfigs
+
+	DefaultNamespace string `json:"defaultNamespace,omitempty"`
+	NamespaceScoped  bool   `json:"namespaceScoped,omitempty"`
 }
 
 // ProxyListResponse represents a proxy list response
@@ -46,60 +113,197 @@ type ProxyListResponse struct {
 
 // ProxySessionInfo represents proxy session information
 type ProxySessionInfo struct {
-	SessionID string `json:"sessionId"`
-	Port      int    `json:"port"`
-	Context   string `json:"context"`
-	Status    string `json:"status"`
-	StartedAt string `json:"startedAt"`
+	SessionID    string   `json:"sessionId"`
+	Port         int      `json:"port"`
+	Context      string   `json:"context"`
+	ClusterHash  string   `json:"clusterHash"`
+	Status       string   `json:"status"`
+	StartedAt    string   `json:"startedAt"`
+	AuthFailures int      `json:"authFailures,omitempty"` // Consecutive 401/403 responses from the API server
+	NeedsReauth  bool     `json:"needsReauth,omitempty"`  // Credentials look expired; re-authenticate and restart the proxy
+	CommandLine  []string `json:"commandLine,omitempty"`  // kubectl argv, secrets redacted
+
+	DefaultNamespace string `json:"defaultNamespace,omitempty"`
+	NamespaceScoped  bool   `json:"namespaceScoped,omitempty"`
 }
 
 // Start handles POST /proxy/start
+// Prefer POST /proxy/ensure, which also reports whether the proxy was reused and ready
 func (h *ProxyHandler) Start(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	var req ProxyStartRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("Failed to decode proxy request", "error", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := checkIdempotencyKey(req.IdempotencyKey); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if status, msg := resolveProxyClusterHash(logger, &req); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	// A retry of a request that already got a proxy gets the same one back
+	var idempotencyKey string
+	if req.IdempotencyKey != "" {
+		idempotencyKey = idempotencyCacheKey(req.ClusterHash, req.IdempotencyKey)
+	}
+	unlock := h.idempotency.lock(idempotencyKey)
+	defer unlock()
+	if response, ok := h.idempotency.lookup(idempotencyKey, h.sessionMgr); ok {
+		logger.Info("Returning proxy for repeated idempotency key", "clusterHash", req.ClusterHash)
+		writeIdempotentReplay(w, response)
+		return
+	}
+
+	result, status, msg := h.ensureProxy(logger, &req, proxyEnsureOptions{})
+	if status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	response := ProxyStartResponse{
+		SessionID:   result.sess.ID,
+		Port:        result.sess.Port,
+		ClusterHash: req.ClusterHash,
+		Status:      string(h.sessionMgr.StatusOf(result.sess)),
+
+		KubeconfigPath: result.sess.KubeconfigPath,
+
+		DefaultNamespace: result.sess.Namespace,
+		NamespaceScoped:  result.sess.NamespaceScoped,
+	}
+	h.idempotency.store(idempotencyKey, result.sess.ID, response)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Ensure handles POST /proxy/ensure
+// Idempotent: returns the running proxy for the cluster, starting one only if needed
+func (h *ProxyHandler) Ensure(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
 	var req ProxyStartRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		slog.Error("Failed to decode proxy request", "error", err)
+		logger.Error("Failed to decode proxy ensure request", "error", err)
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
+	if status, msg := resolveProxyClusterHash(logger, &req); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	result, status, msg := h.ensureProxy(logger, &req, proxyEnsureOptions{replaceStale: true})
+	if status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	response := ProxyEnsureResponse{
+		SessionID:   result.sess.ID,
+		Port:        result.sess.Port,
+		ClusterHash: req.ClusterHash,
+		Status:      string(h.sessionMgr.StatusOf(result.sess)),
+		Reused:      result.reused,
+		Ready:       result.ready,
+
+		KubeconfigPath: result.sess.KubeconfigPath,
+
+		DefaultNamespace: result.sess.Namespace,
+		NamespaceScoped:  result.sess.NamespaceScoped,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// resolveProxyClusterHash computes or validates req.ClusterHash and registers it
+// Returns a non-zero HTTP status and message if the provided hash is wrong
+func resolveProxyClusterHash(logger *slog.Logger, req *ProxyStartRequest) (int, string) {
+	// A kubeconfigPath is read only for hashing; kubectl uses the file in place
+	if status, msg := loadKubeconfigPath(&req.Kubeconfig, req.KubeconfigPath); status != 0 {
+		return status, msg
+	}
+	if err := checkKubeconfigContext(req.Kubeconfig, req.Context); err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+
 	// Compute cluster hash if not provided and register it
 	if req.ClusterHash == "" {
 		req.ClusterHash = cluster.ComputeAndRegister(req.Kubeconfig, req.Context)
-		slog.Info("Computed and registered cluster hash",
+		logger.Info("Computed and registered cluster hash",
 			"clusterHash", req.ClusterHash,
 			"context", req.Context,
 		)
-	} else {
-		// If hash is provided, VALIDATE it first before registering
-		expectedHash := cluster.ComputeHash(req.Kubeconfig, req.Context)
-		if req.ClusterHash != expectedHash {
-			slog.Error("Cluster hash mismatch - app sent wrong hash!",
-				"providedHash", req.ClusterHash,
-				"expectedHash", expectedHash,
-				"context", req.Context,
-			)
-			http.Error(w, fmt.Sprintf("Cluster hash mismatch: expected %s, got %s", expectedHash, req.ClusterHash), http.StatusBadRequest)
-			return
-		}
+		return 0, ""
+	}
 
-		// Hash is valid - register it
-		cluster.GetRegistry().Register(req.ClusterHash, req.Kubeconfig, req.Context)
-		slog.Info("Validated and registered cluster hash",
-			"clusterHash", req.ClusterHash,
+	// If hash is provided, VALIDATE it first before registering
+	expectedHash := cluster.ComputeHash(req.Kubeconfig, req.Context)
+	if req.ClusterHash != expectedHash {
+		logger.Error("Cluster hash mismatch - app sent wrong hash!",
+			"providedHash", req.ClusterHash,
+			"expectedHash", expectedHash,
 			"context", req.Context,
 		)
+		return http.StatusBadRequest, fmt.Sprintf("Cluster hash mismatch: expected %s, got %s", expectedHash, req.ClusterHash)
 	}
 
+	// Hash is valid - register it
+	cluster.GetRegistry().Register(req.ClusterHash, req.Kubeconfig, req.Context)
+	logger.Info("Validated and registered cluster hash",
+		"clusterHash", req.ClusterHash,
+		"context", req.Context,
+	)
+	return 0, ""
+}
+
+// proxyEnsureOptions controls how ensureProxy treats existing proxies
+type proxyEnsureOptions struct {
+	replaceStale bool // Restart a reused proxy that no longer accepts connections
+}
+
+// proxyEnsureResult is the proxy session ensureProxy settled on
+type proxyEnsureResult struct {
+	sess   *session.Session
+	reused bool
+	ready  bool
+}
+
+// ensureProxy returns the running proxy for req.ClusterHash, starting one if needed
+// Returns a non-zero HTTP status and message on failure
+func (h *ProxyHandler) ensureProxy(logger *slog.Logger, req *ProxyStartRequest, opts proxyEnsureOptions) (*proxyEnsureResult, int, string) {
+	if req.DefaultNamespace != "" && !watchNamespaceRe.MatchString(req.DefaultNamespace) {
+		return nil, http.StatusBadRequest, fmt.Sprintf("Invalid defaultNamespace %q", req.DefaultNamespace)
+	}
+	if req.NamespaceScoped && req.DefaultNamespace == "" {
+		return nil, http.StatusBadRequest, "namespaceScoped requires defaultNamespace"
+	}
+
+	// CRITICAL: Serialize starts for the same cluster hash
+	// Concurrent starts (e.g. on reconnect) would otherwise both miss the reuse check below
+	// and spawn two kubectl proxies on the same deterministic port, one of which fails to bind
+	unlock := h.startLocks.Lock(req.ClusterHash)
+	defer unlock()
+
 	// CRITICAL: Check if there's already a proxy running for this cluster hash
 	// If yes, return the existing session (performance optimization)
 	// This is transparent to the app - it just gets a working proxy
 	existingProxies := h.sessionMgr.FindByClusterHash(req.ClusterHash)
 	for _, existing := range existingProxies {
-		if existing.Type == session.TypeProxy && existing.Status == session.StatusRunning {
+		if existing.Type == session.TypeProxy && h.sessionMgr.StatusOf(existing) == session.StatusRunning {
 			// CRITICAL: Verify the context matches before reusing!
 			// This prevents returning a proxy for the wrong cluster
 			if existing.Context != req.Context {
-				slog.Warn("Found proxy with same hash but different context - NOT reusing",
+				logger.Warn("Found proxy with same hash but different context - NOT reusing",
 					"sessionId", existing.ID,
 					"existingContext", existing.Context,
 					"requestedContext", req.Context,
@@ -108,32 +312,55 @@ func (h *ProxyHandler) Start(w http.ResponseWriter, r *http.Request) {
 				continue // Don't reuse - keep looking or create new one
 			}
 
+			ready := isProxyListening(existing.Port)
+			if !ready && opts.replaceStale {
+				logger.Warn("Existing proxy is not accepting connections - replacing it",
+					"sessionId", existing.ID,
+					"clusterHash", req.ClusterHash,
+					"port", existing.Port,
+				)
+				h.sessionMgr.Stop(existing.ID)
+				h.stats.staleReplaced.Add(1)
+				continue
+			}
+
+			if existing.Namespace != req.DefaultNamespace || existing.NamespaceScoped != req.NamespaceScoped {
+				logger.Warn("Reused proxy keeps its own namespace scope",
+					"sessionId", existing.ID,
+					"defaultNamespace", existing.Namespace,
+					"requestedNamespace", req.DefaultNamespace,
+				)
+			}
+
 			// Found an existing proxy for this cluster with matching context - reuse it!
-			slog.Info("Reusing existing proxy for cluster",
+			logger.Info("Reusing existing proxy for cluster",
 				"sessionId", existing.ID,
 				"clusterHash", req.ClusterHash,
 				"context", req.Context,
 				"port", existing.Port,
+				"ready", ready,
 			)
-			response := ProxyStartResponse{
-				SessionID:   existing.ID,
-				Port:        existing.Port,
-				ClusterHash: req.ClusterHash,
-				Status:      string(existing.Status),
-			}
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(response)
-			return
+			h.stats.reused.Add(1)
+			return &proxyEnsureResult{sess: existing, reused: true, ready: ready}, 0, ""
 		}
 	}
 
 	// No existing proxy for this cluster - need to start a new one
+	h.evictProxies(logger, req.ClusterHash)
+
 	// CRITICAL SAFETY: ALWAYS use deterministic port based on cluster hash
 	// NEVER trust the app's port choice - this prevents cross-cluster contamination
-	assignedPort := h.assignPortForCluster(req.ClusterHash)
+	assignedPort, releasePort := h.reserveProxyPort(logger, req.ClusterHash)
+	defer releasePort()
+	if assignedPort == 0 {
+		portMin, portMax := h.portRange()
+		logger.Error("No free proxy port in range", "clusterHash", req.ClusterHash, "min", portMin, "max", portMax)
+		h.stats.startFailures.Add(1)
+		return nil, http.StatusServiceUnavailable, fmt.Sprintf("No free proxy port in range %d-%d", portMin, portMax)
+	}
 
 	if req.Port != 0 && req.Port != assignedPort {
-		slog.Warn("App requested specific port but we're using deterministic port for safety",
+		logger.Warn("App requested specific port but we're using deterministic port for safety",
 			"requestedPort", req.Port,
 			"assignedPort", assignedPort,
 			"clusterHash", req.ClusterHash,
@@ -141,50 +368,54 @@ func (h *ProxyHandler) Start(w http.ResponseWriter, r *http.Request) {
 		)
 	}
 
-	slog.Info("Assigned deterministic port for cluster",
+	logger.Info("Assigned deterministic port for cluster",
 		"clusterHash", req.ClusterHash,
 		"port", assignedPort,
 		"context", req.Context,
 	)
 
-	// CRITICAL: Check if the assigned port is already in use by a DIFFERENT cluster
-	// If yes, we must kill that proxy first to prevent cross-cluster contamination
-	allProxies := h.sessionMgr.List(session.TypeProxy)
-	for _, existing := range allProxies {
-		if existing.Port == assignedPort && existing.ClusterHash != req.ClusterHash {
-			// Different cluster using our port - MUST kill it
-			slog.Warn("Killing proxy from different cluster on our assigned port",
-				"killingSessionId", existing.ID,
-				"killingClusterHash", existing.ClusterHash,
-				"killingContext", existing.Context,
-				"newClusterHash", req.ClusterHash,
-				"newContext", req.Context,
-				"port", assignedPort,
-			)
-			h.sessionMgr.Stop(existing.ID)
-		}
+	sess, status, msg := h.spawnProxy(logger, req, assignedPort)
+	if status != 0 {
+		h.stats.startFailures.Add(1)
+		return nil, status, msg
+	}
+	h.stats.started.Add(1)
+	if assignedPort != h.assignPortForCluster(req.ClusterHash) {
+		h.stats.alternatePorts.Add(1)
 	}
+	return &proxyEnsureResult{sess: sess, ready: true}, 0, ""
+}
 
+// spawnProxy starts kubectl proxy on port and waits until it accepts connections
+// Returns a non-zero HTTP status and message on failure
+func (h *ProxyHandler) spawnProxy(logger *slog.Logger, req *ProxyStartRequest, assignedPort int) (*session.Session, int, string) {
 	// Create session
-	sess := h.sessionMgr.Create(session.TypeProxy)
+	sess, err := h.sessionMgr.CreateForCluster(session.TypeProxy, req.ClusterHash)
+	if err != nil {
+		return nil, http.StatusTooManyRequests, err.Error()
+	}
+	h.portMu.Lock() // selectProxyPort reads the ports of listed sessions
 	sess.Port = assignedPort
+	h.portMu.Unlock()
 	sess.Context = req.Context
-	sess.Kubeconfig = req.Kubeconfig
-	sess.ClusterHash = req.ClusterHash
+	sess.Namespace = req.DefaultNamespace
+	sess.NamespaceScoped = req.NamespaceScoped
+	sess.SetKubeconfig(req.Kubeconfig)
 
-	slog.Info("Starting new proxy session",
+	logger.Info("Starting new proxy session",
 		"sessionId", sess.ID,
 		"clusterHash", req.ClusterHash,
 		"context", req.Context,
 		"port", assignedPort,
+		"defaultNamespace", req.DefaultNamespace,
+		"namespaceScoped", req.NamespaceScoped,
 	)
 
 	// Find kubectl
 	kubectlPath, err := exec.LookPath("kubectl")
 	if err != nil {
 		h.sessionMgr.Stop(sess.ID)
-		http.Error(w, "kubectl not found in PATH", http.StatusInternalServerError)
-		return
+		return nil, http.StatusInternalServerError, "kubectl not found in PATH"
 	}
 
 	// Build kubectl proxy command
@@ -192,133 +423,129 @@ func (h *ProxyHandler) Start(w http.ResponseWriter, r *http.Request) {
 	if req.Context != "" {
 		args = append(args, "--context", req.Context)
 	}
-	args = append(args, "--port", strconv.Itoa(assignedPort))
+	args = append(args, "--address", proxyBindAddress, "--port", strconv.Itoa(assignedPort))
 
 	cmd := exec.Command(kubectlPath, args...)
 	cmd.Env = env.GetShellEnvironment()
+	sess.KubeconfigPath = resolvedKubeconfig(req.Kubeconfig, req.KubeconfigPath)
 
 	// Log the exact command being executed
-	slog.Info("Executing kubectl proxy command",
+	logger.Info("Executing kubectl proxy command",
 		"command", kubectlPath,
 		"args", args,
 		"port", assignedPort,
 		"context", req.Context,
+		"kubeconfigPath", sess.KubeconfigPath,
 	)
 
 	// Set kubeconfig if provided
 	if req.Kubeconfig != "" {
-		tmpDir := os.TempDir()
-		tmpFile := filepath.Join(tmpDir, fmt.Sprintf("kubeconfig-%s", sess.ID))
-		if err := os.WriteFile(tmpFile, []byte(req.Kubeconfig), 0600); err != nil {
+		// Shared with other commands for the same cluster; released when the session ends
+		tmpFile, release, err := kubeconfig.GetTempManager().AcquireFile(req.ClusterHash, req.Kubeconfig, req.KubeconfigPath)
+		if err != nil {
 			h.sessionMgr.Stop(sess.ID)
-			http.Error(w, "Failed to write kubeconfig", http.StatusInternalServerError)
-			return
+			return nil, http.StatusInternalServerError, "Failed to write kubeconfig"
 		}
+		sess.AddRelease(release)
 		cmd.Env = append(cmd.Env, fmt.Sprintf("KUBECONFIG=%s", tmpFile))
 
-		// Register temp file for cleanup when session ends
-		sess.TempFiles = append(sess.TempFiles, tmpFile)
-
-		slog.Info("Using custom kubeconfig for proxy",
+		logger.Info("Using custom kubeconfig for proxy",
 			"sessionId", sess.ID,
 			"kubeconfigFile", tmpFile,
 			"context", req.Context,
 		)
 	} else {
-		slog.Info("Using default kubeconfig for proxy",
+		logger.Info("Using default kubeconfig for proxy",
 			"sessionId", sess.ID,
 			"context", req.Context,
 		)
 	}
 
+	// Capture stderr so a failed start can report why (x509, auth, port in use, ...)
+	stderr := newTailBuffer(proxyStderrMaxBytes)
+	cmd.Stderr = stderr
+
 	sess.Cmd = cmd
+	sess.CommandLine = redactCommandLine(cmd.Args)
 
 	// Start proxy in background
-	if err := cmd.Start(); err != nil {
+	if err := childproc.Start(cmd); err != nil {
 		h.sessionMgr.Stop(sess.ID)
-		slog.Error("Failed to start proxy", "error", err)
-		http.Error(w, fmt.Sprintf("Failed to start proxy: %v", err), http.StatusInternalServerError)
-		return
+		logger.Error("Failed to start proxy", "error", err)
+		return nil, http.StatusInternalServerError, fmt.Sprintf("Failed to start proxy: %v", err)
 	}
 
+	// Recorded so a helper restarted after a crash can stop it
+	pid := cmd.Process.Pid
+	h.pids.add(logger, proxyPIDRecord{PID: pid, Port: assignedPort, SessionID: sess.ID, ClusterHash: req.ClusterHash})
+
 	// Monitor process in background
+	exited := make(chan struct{})
 	go func() {
-		// CRITICAL: Clean up temp files AFTER kubectl finishes
+		// CRITICAL: Release temp kubeconfig AFTER kubectl finishes
 		// This ensures kubectl can read the kubeconfig file for the entire duration
-		defer func() {
-			for _, tmpFile := range sess.TempFiles {
-				if err := os.Remove(tmpFile); err != nil && !os.IsNotExist(err) {
-					slog.Warn("Failed to remove temp file", "file", tmpFile, "error", err)
-				} else {
-					slog.Debug("Removed temp file after proxy completed", "file", tmpFile)
-				}
-			}
-			// Clear the list so session cleanup doesn't try to delete them again
-			sess.TempFiles = nil
-		}()
+		defer sess.Release()
 
-		cmd.Wait()
-		sess.Status = session.StatusStopped
-		slog.Info("Proxy session ended", "id", sess.ID)
+		childproc.Wait(cmd)
+		h.pids.remove(logger, pid)
+		close(exited)
+		h.sessionMgr.SetStatus(sess, session.StatusStopped)
+		logger.Info("Proxy session ended", "id", sess.ID)
 	}()
 
 	// CRITICAL: Wait for kubectl proxy to actually start listening on the port
 	// kubectl proxy might start but fail immediately (auth errors, port in use, etc.)
-	maxRetries := 30 // 3 seconds total
-	proxyReady := false
-	for i := 0; i < maxRetries; i++ {
-		time.Sleep(100 * time.Millisecond)
+	if err := h.waitForProxyReady(assignedPort, exited); err != nil {
+		h.sessionMgr.Stop(sess.ID)
 
-		// Check if process is still running
-		if sess.Cmd.ProcessState != nil && sess.Cmd.ProcessState.Exited() {
-			h.sessionMgr.Stop(sess.ID)
-			slog.Error("kubectl proxy exited immediately", "port", assignedPort, "context", req.Context)
-			http.Error(w, "kubectl proxy failed to start (process exited)", http.StatusInternalServerError)
-			return
-		}
+		reason := stderr.LastLines(proxyStderrTailLines)
+		logger.Error("kubectl proxy failed to become ready",
+			"port", assignedPort,
+			"context", req.Context,
+			"error", err,
+			"stderr", reason,
+		)
 
-		// Try to connect to the proxy port
-		conn, err := net.DialTimeout("tcp", fmt.Sprintf("localhost:%d", assignedPort), 100*time.Millisecond)
-		if err == nil {
-			conn.Close()
-			proxyReady = true
-			break
+		msg := fmt.Sprintf("kubectl proxy failed to start (%v)", err)
+		if reason != "" {
+			msg += ": " + reason
 		}
+		return nil, http.StatusInternalServerError, msg
 	}
 
-	if !proxyReady {
-		h.sessionMgr.Stop(sess.ID)
-		slog.Error("kubectl proxy did not start listening", "port", assignedPort, "context", req.Context)
-		http.Error(w, "kubectl proxy failed to start listening on port", http.StatusInternalServerError)
-		return
-	}
-
-	slog.Info("Proxy started and verified", "id", sess.ID, "port", assignedPort, "context", req.Context)
+	logger.Info("Proxy started and verified", "id", sess.ID, "port", assignedPort, "context", req.Context)
+	return sess, 0, ""
+}
 
-	response := ProxyStartResponse{
-		SessionID:   sess.ID,
-		Port:        assignedPort,
-		ClusterHash: req.ClusterHash,
-		Status:      string(sess.Status),
+// isProxyListening reports whether something accepts connections on the proxy port
+func isProxyListening(port int) bool {
+	conn, err := net.DialTimeout("tcp", proxyHostPort(port), 100*time.Millisecond)
+	if err != nil {
+		return false
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	conn.Close()
+	return true
 }
 
 // Stop handles DELETE /proxy/stop/{sessionId}
 func (h *ProxyHandler) Stop(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
 	vars := mux.Vars(r)
 	sessionID := vars["sessionId"]
 
-	// Get cluster hash from query parameter (optional)
-	clusterHash := r.URL.Query().Get("clusterHash")
+	// Optional cluster hash, from the JSON body or the query
+	clusterHash, err := readClusterHash(r)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
 
 	// Validate cluster hash if provided
 	if clusterHash != "" {
 		sess, ok := h.sessionMgr.GetWithClusterValidation(sessionID, clusterHash)
 		if !ok {
-			slog.Warn("Session not found or cluster hash mismatch",
+			logger.Warn("Session not found or cluster hash mismatch",
 				"sessionId", sessionID,
 				"providedHash", clusterHash,
 			)
@@ -344,11 +571,18 @@ func (h *ProxyHandler) List(w http.ResponseWriter, r *http.Request) {
 	var sessionInfos []ProxySessionInfo
 	for _, sess := range sessions {
 		sessionInfos = append(sessionInfos, ProxySessionInfo{
-			SessionID: sess.ID,
-			Port:      sess.Port,
-			Context:   sess.Context,
-			Status:    string(sess.Status),
-			StartedAt: sess.StartedAt.Format(time.RFC3339),
+			SessionID:    sess.ID,
+			Port:         sess.Port,
+			Context:      sess.Context,
+			ClusterHash:  sess.ClusterHash,
+			Status:       string(h.sessionMgr.StatusOf(sess)),
+			StartedAt:    sess.StartedAt.Format(time.RFC3339),
+			AuthFailures: sess.AuthFailures(),
+			NeedsReauth:  sess.AuthFailures() >= proxyAuthFailureThreshold,
+			CommandLine:  sess.CommandLine,
+
+			DefaultNamespace: sess.Namespace,
+			NamespaceScoped:  sess.NamespaceScoped,
 		})
 	}
 
@@ -365,17 +599,7 @@ func (h *ProxyHandler) Verify(w http.ResponseWriter, r *http.Request) {
 	clusterHash := vars["clusterHash"]
 
 	// Find proxy session for this hash
-	proxies := h.sessionMgr.FindByClusterHash(clusterHash)
-	var proxySession *session.Session
-	for _, sess := range proxies {
-		if sess.Type == session.TypeProxy && sess.Status == session.StatusRunning {
-			if sess.ClusterHash == clusterHash {
-				proxySession = sess
-				break
-			}
-		}
-	}
-
+	proxySession := h.runningProxy(clusterHash)
 	if proxySession == nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusNotFound)
@@ -395,18 +619,163 @@ func (h *ProxyHandler) Verify(w http.ResponseWriter, r *http.Request) {
 		"context":     proxySession.Context,
 		"port":        proxySession.Port,
 		"sessionId":   proxySession.ID,
-		"status":      string(proxySession.Status),
+		"status":      string(h.sessionMgr.StatusOf(proxySession)),
 		"startedAt":   proxySession.StartedAt.Format(time.RFC3339),
+		"commandLine": proxySession.CommandLine,
 	})
 }
 
+// waitForProxyReady polls the proxy port with exponential backoff until it accepts connections
+// Returns an error if the process exits first or the ready timeout elapses
+func (h *ProxyHandler) waitForProxyReady(port int, exited <-chan struct{}) error {
+	timeout, interval := h.readyTimeout, h.readyInterval
+	if timeout <= 0 {
+		timeout = config.DefaultProxyReadyTimeout
+	}
+	if interval <= 0 {
+		interval = config.DefaultProxyReadyInterval
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return fmt.Errorf("not listening on port %d after %s", port, timeout)
+		}
+		if interval < wait {
+			wait = interval
+		}
+
+		select {
+		case <-exited:
+			return fmt.Errorf("process exited")
+		case <-time.After(wait):
+		}
+
+		// Try to connect to the proxy port
+		if isProxyListening(port) {
+			return nil
+		}
+
+		interval *= 2
+		if interval > proxyReadyMaxBackoff {
+			interval = proxyReadyMaxBackoff
+		}
+	}
+}
+
+// reserveProxyPort picks the port for a new proxy for clusterHash with selectProxyPort and holds
+// it until release is called. startLocks only serialize starts per cluster hash, so without this two
+// new clusters with the same preferred port could both find it free and spawn kubectl proxy on it
+// Returns 0 and a no-op release if no port is available
+func (h *ProxyHandler) reserveProxyPort(logger *slog.Logger, clusterHash string) (int, func()) {
+	h.portMu.Lock()
+	defer h.portMu.Unlock()
+
+	port := h.selectProxyPort(logger, clusterHash)
+	if port == 0 {
+		return 0, func() {}
+	}
+	if h.reserved == nil {
+		h.reserved = make(map[int]string)
+	}
+	h.reserved[port] = clusterHash
+
+	release := func() {
+		h.portMu.Lock()
+		defer h.portMu.Unlock()
+		delete(h.reserved, port)
+	}
+	return port, release
+}
+
+// selectProxyPort picks the port for a new proxy for clusterHash
+// Normally the deterministic assignPortForCluster port; if another cluster's proxy already
+// holds it, the next free port in the range is used instead so both proxies coexist
+// (previously the other cluster's proxy was killed, disconnecting it mid-use)
+// The same applies if a process outside the helper is bound to it, e.g. a kubectl proxy
+// left running by a helper that crashed: it would otherwise answer in place of the new proxy
+// Returns 0 if another cluster holds the preferred port and no other port in the range is available
+// Caller must hold h.portMu
+func (h *ProxyHandler) selectProxyPort(logger *slog.Logger, clusterHash string) int {
+	preferred := h.assignPortForCluster(clusterHash)
+
+	held := make(map[int]string)
+	for _, existing := range h.sessionMgr.List(session.TypeProxy) {
+		if existing.ClusterHash != clusterHash {
+			held[existing.Port] = existing.ClusterHash
+		}
+	}
+	for port, hash := range h.reserved {
+		if hash != clusterHash {
+			held[port] = hash
+		}
+	}
+
+	heldBy, ok := held[preferred]
+	if !ok {
+		if isPortFree(preferred) {
+			return preferred
+		}
+		heldBy = "another process"
+	}
+
+	portMin, portMax := h.portRange()
+	size := portMax - portMin + 1
+	offset := preferred - portMin
+	if offset < 0 || offset >= size {
+		offset = 0
+	}
+
+	for i := 1; i < size; i++ {
+		port := portMin + (offset+i)%size
+		if _, ok := held[port]; ok {
+			continue
+		}
+		// Alternate ports are not reserved for us, so make sure nothing else is bound there
+		if !isPortFree(port) {
+			continue
+		}
+		logger.Warn("Deterministic proxy port in use - using alternate port",
+			"clusterHash", clusterHash,
+			"preferredPort", preferred,
+			"heldBy", heldBy,
+			"port", port,
+		)
+		return port
+	}
+	if !ok {
+		// No alternate either; try the preferred port as before and let kubectl report the conflict
+		return preferred
+	}
+	return 0
+}
+
+// isPortFree reports whether the proxy port can currently be bound
+func isPortFree(port int) bool {
+	ln, err := net.Listen("tcp", proxyHostPort(port))
+	if err != nil {
+		return false
+	}
+	ln.Close()
+	return true
+}
+
+// portRange returns the configured proxy port range, or the default if unset
+func (h *ProxyHandler) portRange() (int, int) {
+	if h.portMin == 0 || h.portMax == 0 {
+		return config.DefaultProxyPortMin, config.DefaultProxyPortMax
+	}
+	return h.portMin, h.portMax
+}
+
 // assignPortForCluster assigns a unique port for a cluster hash
 // This ensures each cluster gets its own port, preventing cross-cluster contamination
 func (h *ProxyHandler) assignPortForCluster(clusterHash string) int {
 	// Strategy: Use a deterministic port based on cluster hash
 	// This ensures the same cluster always gets the same port (good for caching)
-	// Port range: 47824-57823 (10,000 ports available)
-	// We start at 47824 (helper is on 47823)
+	// Port range: PROXY_PORT_MIN-PROXY_PORT_MAX (default 47824-57823, 10,000 ports)
+	// The default starts at 47824 (helper is on 47823)
 
 	if clusterHash == "" {
 		// Fallback for empty hash (shouldn't happen, but be safe)
@@ -420,8 +789,9 @@ func (h *ProxyHandler) assignPortForCluster(clusterHash string) int {
 		hashNum = hashNum*16 + uint32(hexCharToInt(clusterHash[i]))
 	}
 
-	// Map to port range 47824-57823 (10,000 ports)
-	port := 47824 + int(hashNum%10000)
+	// Map to the configured port range
+	portMin, portMax := h.portRange()
+	port := portMin + int(hashNum%uint32(portMax-portMin+1))
 
 	return port
 }
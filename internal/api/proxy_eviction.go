@@ -0,0 +1,67 @@
+package api
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/session"
+)
+
+// proxyEvictedReason is the reason on the stopped event of a proxy evicted by MAX_PROXIES
+const proxyEvictedReason = "evicted: proxy limit reached"
+
+// proxyLastActivity returns when a request was last routed through a proxy, or when it started if none was
+func proxyLastActivity(sess *session.Session) time.Time {
+	if _, last := sess.ProxyRequests(); !last.IsZero() {
+		return last
+	}
+	return sess.StartedAt
+}
+
+// evictProxies stops the least recently used running proxies so that starting one for
+// clusterHash keeps the total within maxProxies
+// A proxy serving a request right now (e.g. a watch) counts as just used, so it goes last
+func (h *ProxyHandler) evictProxies(logger *slog.Logger, clusterHash string) {
+	if h.maxProxies <= 0 {
+		return
+	}
+	h.evictLock.Lock()
+	defer h.evictLock.Unlock()
+
+	var running []*session.Session
+	for _, sess := range h.sessionMgr.List(session.TypeProxy) {
+		if h.sessionMgr.StatusOf(sess) == session.StatusRunning {
+			running = append(running, sess)
+		}
+	}
+	excess := len(running) - h.maxProxies + 1
+	if excess <= 0 {
+		return
+	}
+
+	now := time.Now()
+	lastUsed := make(map[*session.Session]time.Time, len(running))
+	for _, sess := range running {
+		lastUsed[sess] = proxyLastActivity(sess)
+		if sess.InUse() {
+			lastUsed[sess] = now
+		}
+	}
+	sort.Slice(running, func(i, j int) bool { return lastUsed[running[i]].Before(lastUsed[running[j]]) })
+
+	for _, victim := range running[:excess] {
+		logger.Warn("Evicting least recently used proxy",
+			"sessionId", victim.ID,
+			"clusterHash", victim.ClusterHash,
+			"context", victim.Context,
+			"port", victim.Port,
+			"lastActivity", proxyLastActivity(victim),
+			"inUse", victim.InUse(),
+			"reason", fmt.Sprintf("MAX_PROXIES (%d) reached starting a proxy for cluster %s", h.maxProxies, clusterHash),
+		)
+		h.sessionMgr.StopWithReason(victim.ID, proxyEvictedReason)
+		h.stats.evicted.Add(1)
+	}
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/session"
+)
+
+func TestProxyEnsure_EvictsLeastRecentlyUsed(t *testing.T) {
+	base := freeProxyPort(t)
+	if base > 65535-20 {
+		t.Skip("no room for a port range above the free port")
+	}
+	installFakeKubectlProxy(t)
+
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	defer sessionMgr.StopAll()
+	handler := &ProxyHandler{sessionMgr: sessionMgr, portMin: base, portMax: base + 20, maxProxies: 2}
+
+	events, cancel := sessionMgr.Subscribe()
+	defer cancel()
+
+	ensure := func(ctx string) *session.Session {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.Ensure(rec, httptest.NewRequest(http.MethodPost, "/proxy/ensure", strings.NewReader(`{"context":"`+ctx+`"}`)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("ensure %s: expected 200, got %d: %s", ctx, rec.Code, rec.Body.String())
+		}
+		var resp ProxyEnsureResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		sess, ok := sessionMgr.Get(resp.SessionID)
+		if !ok {
+			t.Fatalf("ensure %s: session not found", ctx)
+		}
+		return sess
+	}
+	running := func() string {
+		var contexts []string
+		for _, sess := range sessionMgr.List(session.TypeProxy) {
+			contexts = append(contexts, sess.Context)
+		}
+		sort.Strings(contexts)
+		return strings.Join(contexts, ",")
+	}
+	expectEvicted := func(sess *session.Session) {
+		t.Helper()
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case e := <-events:
+				if e.Kind == session.EventStopped && e.SessionID == sess.ID {
+					if e.Reason != proxyEvictedReason {
+						t.Errorf("stopped event reason = %q, want %q", e.Reason, proxyEvictedReason)
+					}
+					return
+				}
+			case <-timeout:
+				t.Fatalf("no stopped event for %s", sess.Context)
+			}
+		}
+	}
+
+	a := ensure("ctx-a")
+	b := ensure("ctx-b")
+	a.RecordProxyRequest() // b is now the least recently used
+
+	c := ensure("ctx-c")
+	expectEvicted(b)
+	if got := running(); got != "ctx-a,ctx-c" {
+		t.Errorf("after third proxy: running %s, want ctx-a,ctx-c", got)
+	}
+
+	// a was used before c started, but a request still in flight (e.g. a watch) makes it current
+	if !a.BeginUse() {
+		t.Fatal("BeginUse failed")
+	}
+	ensure("ctx-d")
+	expectEvicted(c)
+	a.EndUse()
+	if got := running(); got != "ctx-a,ctx-d" {
+		t.Errorf("after fourth proxy: running %s, want ctx-a,ctx-d", got)
+	}
+
+	// Reusing a running proxy never evicts
+	ensure("ctx-d")
+	if got := running(); got != "ctx-a,ctx-d" {
+		t.Errorf("after reuse: running %s, want ctx-a,ctx-d", got)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.Stats(rec, httptest.NewRequest(http.MethodGet, "/proxy/stats", nil))
+	var stats ProxyStatsResponse
+	if err := json.NewDecoder(rec.Body).Decode(&stats); err != nil {
+		t.Fatalf("decode stats: %v", err)
+	}
+	if stats.MaxProxies != 2 || stats.Counters.Evicted != 2 || stats.Running != 2 {
+		t.Errorf("unexpected stats: maxProxies %d, evicted %d, running %d", stats.MaxProxies, stats.Counters.Evicted, stats.Running)
+	}
+}
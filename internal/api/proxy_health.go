@@ -0,0 +1,121 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/kubedeskpro/kubedesk-helper/internal/logging"
+	"github.com/kubedeskpro/kubedesk-helper/internal/session"
+)
+
+// proxyHealthTimeout bounds the API probe behind /proxy/health/{clusterHash}
+const proxyHealthTimeout = 5 * time.Second
+
+// proxyHealthPath is probed through the proxy; cheap, and it needs working credentials
+const proxyHealthPath = "/version"
+
+// ProxyHealthResponse reports whether a cluster answered through its proxy
+type ProxyHealthResponse struct {
+	ClusterHash   string `json:"clusterHash"`
+	SessionID     string `json:"sessionId"`
+	Port          int    `json:"port"`
+	Healthy       bool   `json:"healthy"`                 // The API server answered with a 2xx
+	StatusCode    int    `json:"statusCode,omitempty"`    // Status of the probe; 0 if nothing answered
+	LatencyMs     int64  `json:"latencyMs"`               // Round trip through the proxy
+	ServerVersion string `json:"serverVersion,omitempty"` // gitVersion from /version, when healthy
+	Error         string `json:"error,omitempty"`
+}
+
+// runningProxy returns the running proxy session for clusterHash, or nil
+func (h *ProxyHandler) runningProxy(clusterHash string) *session.Session {
+	for _, sess := range h.sessionMgr.FindByClusterHash(clusterHash) {
+		if sess.Type == session.TypeProxy && h.sessionMgr.StatusOf(sess) == session.StatusRunning && sess.ClusterHash == clusterHash {
+			return sess
+		}
+	}
+	return nil
+}
+
+// Health handles GET /proxy/health/{clusterHash}
+// Sends GET /version through the cluster's proxy, so the app can tell a proxy that exists
+// from one that actually reaches the cluster. 503 if no proxy is running
+func (h *ProxyHandler) Health(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	clusterHash := mux.Vars(r)["clusterHash"]
+
+	proxySession := h.runningProxy(clusterHash)
+	if proxySession == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"healthy":     false,
+			"clusterHash": clusterHash,
+			"error":       "No running proxy found for this cluster hash",
+		})
+		return
+	}
+
+	resp := ProxyHealthResponse{
+		ClusterHash: clusterHash,
+		SessionID:   proxySession.ID,
+		Port:        proxySession.Port,
+	}
+	probeProxy(r.Context(), proxySession.Port, proxyHealthTimeout, &resp)
+	if !resp.Healthy {
+		logger.Warn("Proxy health probe failed",
+			"clusterHash", clusterHash,
+			"port", proxySession.Port,
+			"statusCode", resp.StatusCode,
+			"error", resp.Error,
+		)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// probeProxy requests proxyHealthPath through the proxy on port and fills in the result
+func probeProxy(ctx context.Context, port int, timeout time.Duration, resp *ProxyHealthResponse) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+proxyHostPort(port)+proxyHealthPath, nil)
+	if err != nil {
+		resp.Error = err.Error()
+		return
+	}
+
+	start := time.Now()
+	probe, err := http.DefaultClient.Do(req)
+	resp.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		resp.Error = err.Error()
+		return
+	}
+	defer probe.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(probe.Body, 64*1024))
+
+	resp.StatusCode = probe.StatusCode
+	if probe.StatusCode < 200 || probe.StatusCode > 299 {
+		msg := strings.TrimSpace(string(body))
+		if len(msg) > 200 {
+			msg = msg[:200]
+		}
+		resp.Error = fmt.Sprintf("%s returned %d: %s", proxyHealthPath, probe.StatusCode, msg)
+		return
+	}
+	resp.Healthy = true
+
+	var version struct {
+		GitVersion string `json:"gitVersion"`
+	}
+	if json.Unmarshal(body, &version) == nil {
+		resp.ServerVersion = version.GitVersion
+	}
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/config"
+	"github.com/kubedeskpro/kubedesk-helper/internal/session"
+)
+
+func TestProxyHealth(t *testing.T) {
+	status := http.StatusOK
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/version" {
+			t.Errorf("probe path = %q, want /version", r.URL.Path)
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(`{"gitVersion":"v1.29.2"}`))
+	}))
+	defer upstream.Close()
+
+	_, portStr, _ := net.SplitHostPort(upstream.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	sess, _ := sessionMgr.CreateForCluster(session.TypeProxy, "abc123")
+	sess.Port = port
+	router := NewRouter("test", sessionMgr, config.Default())
+
+	get := func(hash string) (*httptest.ResponseRecorder, ProxyHealthResponse) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/proxy/health/"+hash, nil))
+		var resp ProxyHealthResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec, resp
+	}
+
+	rec, resp := get("abc123")
+	if rec.Code != http.StatusOK || !resp.Healthy || resp.StatusCode != http.StatusOK {
+		t.Fatalf("healthy cluster: status = %d, response = %+v", rec.Code, resp)
+	}
+	if resp.ServerVersion != "v1.29.2" || resp.SessionID != sess.ID || resp.Port != port {
+		t.Errorf("healthy cluster: response = %+v", resp)
+	}
+
+	status = http.StatusServiceUnavailable // e.g. the proxy can't reach the API server
+	rec, resp = get("abc123")
+	if rec.Code != http.StatusOK || resp.Healthy || resp.StatusCode != http.StatusServiceUnavailable || resp.Error == "" {
+		t.Errorf("unreachable cluster: status = %d, response = %+v", rec.Code, resp)
+	}
+
+	rec, resp = get("ffffffffffffffff")
+	if rec.Code != http.StatusServiceUnavailable || resp.Healthy {
+		t.Errorf("no proxy: status = %d, response = %+v, want 503", rec.Code, resp)
+	}
+}
@@ -95,6 +95,10 @@ func TestProxyRouting_KubernetesCommands(t *testing.T) {
 		testListPodsWithLimit(t, server.URL, clusterHash)
 	})
 
+	t.Run("CreateConfigMap", func(t *testing.T) {
+		testCreateConfigMap(t, server.URL, clusterHash)
+	})
+
 	// Cleanup
 	stopProxySession(t, server.URL, sessionID)
 }
@@ -339,6 +343,50 @@ func testListPodsWithLimit(t *testing.T, serverURL, clusterHash string) {
 	t.Logf("✓ Limit query worked, got %d pods (max 5)", len(result.Items))
 }
 
+func testCreateConfigMap(t *testing.T, serverURL, clusterHash string) {
+	name := fmt.Sprintf("kubedesk-helper-test-%d", time.Now().UnixNano())
+	base := fmt.Sprintf("%s/proxy/%s/api/v1/namespaces/default/configmaps", serverURL, clusterHash)
+
+	// POST with a known Content-Length
+	body := fmt.Sprintf(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"%s"},"data":{"key":"value"}}`, name)
+	resp, err := http.Post(base, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to create ConfigMap: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		respBody, _ := io.ReadAll(resp.Body)
+		t.Fatalf("POST configmaps failed: status=%d, body=%s", resp.StatusCode, string(respBody))
+	}
+
+	// Clean up through the proxy router as well
+	defer func() {
+		req, _ := http.NewRequest(http.MethodDelete, base+"/"+name, nil)
+		delResp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Logf("Warning: Failed to delete ConfigMap %s: %v", name, err)
+			return
+		}
+		delResp.Body.Close()
+	}()
+
+	getResp := makeProxyRequest(t, serverURL, clusterHash, "/api/v1/namespaces/default/configmaps/"+name)
+	defer getResp.Body.Close()
+
+	var cm struct {
+		Data map[string]string `json:"data"`
+	}
+	if err := json.NewDecoder(getResp.Body).Decode(&cm); err != nil {
+		t.Fatalf("Failed to decode ConfigMap: %v", err)
+	}
+	if cm.Data["key"] != "value" {
+		t.Errorf("Expected data.key=value, got %v", cm.Data)
+	}
+
+	t.Logf("✓ Created ConfigMap %s through proxy router", name)
+}
+
 // TestProxyRouting_RapidClusterSwitching tests that rapid cluster switching doesn't cause cross-cluster contamination
 func TestProxyRouting_RapidClusterSwitching(t *testing.T) {
 	// Skip if not in integration test mode
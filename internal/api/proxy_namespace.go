@@ -0,0 +1,62 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+)
+
+// namespacedListResources are built-in namespaced resources, keyed by API group ("" = core)
+// A cluster-wide list or watch of one of them is rewritten to a proxy's default namespace;
+// anything not listed (nodes, CRDs, ...) is forwarded unchanged since it may be cluster-scoped
+var namespacedListResources = map[string]map[string]bool{
+	"": {
+		"pods": true, "services": true, "endpoints": true, "configmaps": true, "secrets": true,
+		"events": true, "serviceaccounts": true, "persistentvolumeclaims": true,
+		"replicationcontrollers": true, "limitranges": true, "resourcequotas": true, "podtemplates": true,
+	},
+	"apps":                      {"deployments": true, "statefulsets": true, "daemonsets": true, "replicasets": true, "controllerrevisions": true},
+	"batch":                     {"jobs": true, "cronjobs": true},
+	"autoscaling":               {"horizontalpodautoscalers": true},
+	"policy":                    {"poddisruptionbudgets": true},
+	"networking.k8s.io":         {"ingresses": true, "networkpolicies": true},
+	"rbac.authorization.k8s.io": {"roles": true, "rolebindings": true},
+	"coordination.k8s.io":       {"leases": true},
+	"discovery.k8s.io":          {"endpointslices": true},
+	"events.k8s.io":             {"events": true},
+}
+
+// scopeProxyPath applies a proxy's default namespace to an API path
+// Cluster-wide lists of known namespaced resources (e.g. /api/v1/pods) are rewritten to the
+// namespace. With strict set, paths into any other namespace are rejected with an error
+func scopeProxyPath(path, namespace string, strict bool) (string, error) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	// Split off the group/version prefix: /api/v1/... or /apis/<group>/<version>/...
+	var group string
+	var prefix, rest []string
+	switch {
+	case len(segments) >= 2 && segments[0] == "api":
+		prefix, rest = segments[:2], segments[2:]
+	case len(segments) >= 3 && segments[0] == "apis":
+		group = segments[1]
+		prefix, rest = segments[:3], segments[3:]
+	default:
+		return path, nil // Discovery, /version, /openapi, ...
+	}
+	if len(rest) == 0 {
+		return path, nil
+	}
+
+	if rest[0] == "namespaces" {
+		if len(rest) >= 2 && strict && rest[1] != namespace {
+			return "", fmt.Errorf("namespace %q is outside this proxy's namespace %q", rest[1], namespace)
+		}
+		return path, nil
+	}
+
+	if len(rest) == 1 && namespacedListResources[group][rest[0]] {
+		scoped := append(append(append([]string{}, prefix...), "namespaces", namespace), rest...)
+		return "/" + strings.Join(scoped, "/"), nil
+	}
+	return path, nil
+}
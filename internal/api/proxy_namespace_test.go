@@ -0,0 +1,37 @@
+package api
+
+import "testing"
+
+func TestScopeProxyPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		strict  bool
+		want    string
+		wantErr bool
+	}{
+		{"core list", "/api/v1/pods", false, "/api/v1/namespaces/team-a/pods", false},
+		{"group list", "/apis/apps/v1/deployments", false, "/apis/apps/v1/namespaces/team-a/deployments", false},
+		{"cluster-scoped", "/api/v1/nodes", false, "/api/v1/nodes", false},
+		{"unknown group", "/apis/example.com/v1/widgets", false, "/apis/example.com/v1/widgets", false},
+		{"already namespaced", "/api/v1/namespaces/team-a/pods/web", true, "/api/v1/namespaces/team-a/pods/web", false},
+		{"namespace list", "/api/v1/namespaces", true, "/api/v1/namespaces", false},
+		{"discovery", "/apis/apps/v1", true, "/apis/apps/v1", false},
+		{"version", "/version", true, "/version", false},
+		{"other namespace", "/api/v1/namespaces/kube-system/pods", false, "/api/v1/namespaces/kube-system/pods", false},
+		{"other namespace strict", "/api/v1/namespaces/kube-system/pods", true, "", true},
+		{"other namespace object strict", "/api/v1/namespaces/kube-system", true, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := scopeProxyPath(tt.path, "team-a", tt.strict)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("scopeProxyPath(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
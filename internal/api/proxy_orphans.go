@@ -0,0 +1,195 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// orphanStopGrace is how long an orphaned kubectl proxy gets to exit after SIGTERM before SIGKILL
+const orphanStopGrace = 2 * time.Second
+
+// orphanPollInterval is how often a terminated orphan is checked for exit
+const orphanPollInterval = 50 * time.Millisecond
+
+// proxyPIDState is the content of the proxy PID file
+type proxyPIDState struct {
+	HelperPID int              `json:"helperPid"` // Helper that started the proxies
+	Proxies   []proxyPIDRecord `json:"proxies"`
+}
+
+// proxyPIDRecord is one running kubectl proxy
+type proxyPIDRecord struct {
+	PID         int    `json:"pid"`
+	Port        int    `json:"port"`
+	SessionID   string `json:"sessionId"`
+	ClusterHash string `json:"clusterHash"`
+}
+
+// proxyPIDFile records running kubectl proxies so the next helper can stop the ones a crash left behind
+// A backstop for when childproc couldn't kill it with the helper (e.g. the watchdog was killed too),
+// since a leftover proxy keeps holding its port. A nil *proxyPIDFile records nothing
+type proxyPIDFile struct {
+	path string
+
+	mu      sync.Mutex
+	proxies []proxyPIDRecord
+}
+
+// newProxyPIDFile returns a PID file at path, or nil if path is empty
+func newProxyPIDFile(path string) *proxyPIDFile {
+	if path == "" {
+		return nil
+	}
+	return &proxyPIDFile{path: path}
+}
+
+// add records a started proxy
+func (f *proxyPIDFile) add(logger *slog.Logger, record proxyPIDRecord) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.proxies = append(f.proxies, record)
+	f.writeLocked(logger)
+}
+
+// remove forgets a proxy once its process has exited
+func (f *proxyPIDFile) remove(logger *slog.Logger, pid int) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.proxies = slices.DeleteFunc(f.proxies, func(p proxyPIDRecord) bool { return p.PID == pid })
+	f.writeLocked(logger)
+}
+
+// writeLocked replaces the file with the current proxies; failures are logged, not returned,
+// since a missing record only matters if the helper later crashes
+func (f *proxyPIDFile) writeLocked(logger *slog.Logger) {
+	data, err := json.Marshal(proxyPIDState{HelperPID: os.Getpid(), Proxies: f.proxies})
+	if err != nil {
+		logger.Warn("Failed to encode proxy PID file", "error", err)
+		return
+	}
+
+	// Write then rename so a crash mid-write never leaves a truncated file
+	tmp := f.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		logger.Warn("Failed to write proxy PID file", "path", f.path, "error", err)
+		return
+	}
+	if err := os.Rename(tmp, f.path); err != nil {
+		os.Remove(tmp)
+		logger.Warn("Failed to write proxy PID file", "path", f.path, "error", err)
+	}
+}
+
+// StopOrphanedProxies terminates kubectl proxies a previous helper recorded in path but never stopped,
+// e.g. because it crashed, so they stop holding ports in the proxy range. The file is then removed
+// A process is only signalled if it is still alive and still looks like that kubectl proxy; PIDs
+// reused by unrelated processes are left alone. Returns the number of proxies stopped
+func StopOrphanedProxies(path string) (int, error) {
+	if path == "" {
+		return 0, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read proxy PID file: %w", err)
+	}
+
+	var state proxyPIDState
+	if err := json.Unmarshal(data, &state); err != nil {
+		os.Remove(path)
+		return 0, fmt.Errorf("failed to parse proxy PID file: %w", err)
+	}
+
+	// Another helper still running owns these proxies (and will fail to bind the helper port anyway)
+	if state.HelperPID != os.Getpid() && processAlive(state.HelperPID) {
+		return 0, fmt.Errorf("proxy PID file is owned by running helper (pid %d)", state.HelperPID)
+	}
+
+	stopped := 0
+	for _, p := range state.Proxies {
+		if !processAlive(p.PID) || !isKubectlProxyProcess(p.PID, p.Port) {
+			continue
+		}
+		slog.Warn("Stopping kubectl proxy orphaned by a previous helper",
+			"pid", p.PID,
+			"port", p.Port,
+			"sessionId", p.SessionID,
+			"clusterHash", p.ClusterHash,
+		)
+		if err := stopProcess(p.PID, orphanStopGrace); err != nil {
+			slog.Warn("Failed to stop orphaned kubectl proxy", "pid", p.PID, "error", err)
+			continue
+		}
+		stopped++
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return stopped, fmt.Errorf("failed to remove proxy PID file: %w", err)
+	}
+	return stopped, nil
+}
+
+// processAlive reports whether pid is a running process
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// isKubectlProxyProcess reports whether pid's command line is a kubectl proxy on port
+func isKubectlProxyProcess(pid, port int) bool {
+	out, err := exec.Command("ps", "-o", "command=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return false
+	}
+	args := strings.Fields(string(out))
+	if !slices.Contains(args, "proxy") {
+		return false
+	}
+	for i := 0; i < len(args)-1; i++ {
+		if args[i] == "--port" && args[i+1] == strconv.Itoa(port) {
+			return true
+		}
+	}
+	return false
+}
+
+// stopProcess sends SIGTERM to pid and SIGKILL if it is still running after grace
+func stopProcess(pid int, grace time.Duration) error {
+	if err := syscall.Kill(pid, syscall.SIGTERM); err != nil {
+		if errors.Is(err, syscall.ESRCH) {
+			return nil
+		}
+		return err
+	}
+	for deadline := time.Now().Add(grace); time.Now().Before(deadline); {
+		time.Sleep(orphanPollInterval)
+		if !processAlive(pid) {
+			return nil
+		}
+	}
+	if err := syscall.Kill(pid, syscall.SIGKILL); err != nil && !errors.Is(err, syscall.ESRCH) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,256 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/cluster"
+	"github.com/kubedeskpro/kubedesk-helper/internal/session"
+)
+
+// freeProxyPort returns a port on the proxy bind address that is free right now
+func freeProxyPort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp4", proxyBindAddress+":0")
+	if err != nil {
+		t.Skipf("IPv4 loopback unavailable: %v", err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+	return port
+}
+
+// writeProxyPIDState writes a PID file as a previous helper would have left it
+func writeProxyPIDState(t *testing.T, path string, state proxyPIDState) {
+	t.Helper()
+	data, err := json.Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// startProcess starts a process the test reaps, so it doesn't linger as a zombie once stopped
+func startProcess(t *testing.T, name string, args ...string) (*exec.Cmd, <-chan struct{}) {
+	t.Helper()
+	cmd := exec.Command(name, args...)
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start %s: %v", name, err)
+	}
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		<-exited
+	})
+	return cmd, exited
+}
+
+// deadPID returns the PID of a process that has already exited
+func deadPID(t *testing.T) int {
+	t.Helper()
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("run true: %v", err)
+	}
+	return cmd.Process.Pid
+}
+
+func TestProxyStart_PreferredPortInUse(t *testing.T) {
+	port := freeProxyPort(t)
+	if port >= 65535 || !isPortFree(port+1) {
+		t.Skip("could not find two free adjacent ports")
+	}
+
+	// Something outside the helper, e.g. a kubectl proxy left by a crashed helper, holds the
+	// cluster's deterministic port
+	orphan, err := net.Listen("tcp", proxyHostPort(port))
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer orphan.Close()
+
+	installFakeKubectlProxy(t)
+
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	defer sessionMgr.StopAll()
+	handler := &ProxyHandler{sessionMgr: sessionMgr, portMin: port, portMax: port + 1}
+
+	// Pick a context whose deterministic port is the occupied one
+	var ctx string
+	for i := 0; i < 100 && ctx == ""; i++ {
+		if c := fmt.Sprintf("orphan-ctx-%d", i); handler.assignPortForCluster(cluster.ComputeHash("", c)) == port {
+			ctx = c
+		}
+	}
+	if ctx == "" {
+		t.Fatal("no context maps to the occupied port")
+	}
+
+	rec := httptest.NewRecorder()
+	handler.Ensure(rec, httptest.NewRequest(http.MethodPost, "/proxy/ensure", strings.NewReader(`{"context":"`+ctx+`"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ensure: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp ProxyEnsureResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Port != port+1 || !resp.Ready {
+		t.Errorf("expected a ready proxy on alternate port %d, got %+v", port+1, resp)
+	}
+	if got := handler.stats.alternatePorts.Load(); got != 1 {
+		t.Errorf("alternatePorts = %d, want 1", got)
+	}
+}
+
+func TestProxyPIDFile_RecordsRunningProxies(t *testing.T) {
+	port := freeProxyPort(t)
+	installFakeKubectlProxy(t)
+
+	path := filepath.Join(t.TempDir(), "proxies.json")
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	defer sessionMgr.StopAll()
+	handler := &ProxyHandler{sessionMgr: sessionMgr, portMin: port, portMax: port, pids: newProxyPIDFile(path)}
+
+	read := func() proxyPIDState {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("read PID file: %v", err)
+		}
+		var state proxyPIDState
+		if err := json.Unmarshal(data, &state); err != nil {
+			t.Fatalf("parse PID file: %v", err)
+		}
+		return state
+	}
+
+	rec := httptest.NewRecorder()
+	handler.Ensure(rec, httptest.NewRequest(http.MethodPost, "/proxy/ensure", strings.NewReader(`{"context":"pid-context"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ensure: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp ProxyEnsureResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	sess, ok := sessionMgr.Get(resp.SessionID)
+	if !ok {
+		t.Fatal("session not found")
+	}
+
+	state := read()
+	if state.HelperPID != os.Getpid() || len(state.Proxies) != 1 {
+		t.Fatalf("unexpected PID file: %+v", state)
+	}
+	if p := state.Proxies[0]; p.PID != sess.Cmd.Process.Pid || p.Port != port || p.SessionID != sess.ID || p.ClusterHash != resp.ClusterHash {
+		t.Errorf("unexpected record: %+v", p)
+	}
+
+	// Forgotten once the proxy exits
+	sessionMgr.Stop(sess.ID)
+	deadline := time.Now().Add(5 * time.Second)
+	for len(read().Proxies) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("proxy still recorded after stop: %+v", read())
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestStopOrphanedProxies(t *testing.T) {
+	port := freeProxyPort(t)
+	installFakeKubectlProxy(t)
+	kubectlPath, err := exec.LookPath("kubectl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A kubectl proxy whose helper died, still listening on its port
+	orphan, orphanExited := startProcess(t, kubectlPath, "proxy", "--address", proxyBindAddress, "--port", strconv.Itoa(port))
+	for deadline := time.Now().Add(5 * time.Second); !isProxyListening(port); {
+		if time.Now().After(deadline) {
+			t.Fatal("orphaned proxy never started listening")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	// A recorded PID now used by an unrelated process
+	unrelated, unrelatedExited := startProcess(t, "sleep", "30")
+
+	path := filepath.Join(t.TempDir(), "proxies.json")
+	writeProxyPIDState(t, path, proxyPIDState{
+		HelperPID: deadPID(t),
+		Proxies: []proxyPIDRecord{
+			{PID: orphan.Process.Pid, Port: port, SessionID: "orphan"},
+			{PID: unrelated.Process.Pid, Port: port + 1, SessionID: "reused"},
+			{PID: deadPID(t), Port: port + 2, SessionID: "exited"},
+		},
+	})
+
+	stopped, err := StopOrphanedProxies(path)
+	if err != nil || stopped != 1 {
+		t.Fatalf("StopOrphanedProxies = %d, %v; want 1, nil", stopped, err)
+	}
+	select {
+	case <-orphanExited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("orphaned proxy still running")
+	}
+	if !isPortFree(port) {
+		t.Error("orphaned proxy's port is still held")
+	}
+	select {
+	case <-unrelatedExited:
+		t.Error("unrelated process with a recorded PID was stopped")
+	default:
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("PID file not removed: %v", err)
+	}
+
+	// No file, nothing to do
+	if stopped, err := StopOrphanedProxies(path); err != nil || stopped != 0 {
+		t.Errorf("missing file: got %d, %v", stopped, err)
+	}
+}
+
+func TestStopOrphanedProxies_HelperStillRunning(t *testing.T) {
+	helper, _ := startProcess(t, "sleep", "30")
+	proxy, proxyExited := startProcess(t, "sleep", "30")
+
+	path := filepath.Join(t.TempDir(), "proxies.json")
+	writeProxyPIDState(t, path, proxyPIDState{
+		HelperPID: helper.Process.Pid,
+		Proxies:   []proxyPIDRecord{{PID: proxy.Process.Pid, Port: 47900}},
+	})
+
+	if _, err := StopOrphanedProxies(path); err == nil || !strings.Contains(err.Error(), "running helper") {
+		t.Errorf("expected an error about the running helper, got %v", err)
+	}
+	select {
+	case <-proxyExited:
+		t.Error("proxy of a running helper was stopped")
+	default:
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("PID file of a running helper should be kept: %v", err)
+	}
+}
@@ -1,20 +1,110 @@
 package api
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/kubedeskpro/kubedesk-helper/internal/logging"
+	"github.com/kubedeskpro/kubedesk-helper/internal/metrics"
 	"github.com/kubedeskpro/kubedesk-helper/internal/session"
 )
 
+// hopByHopHeaders apply to a single connection and must not be forwarded (RFC 7230 section 6.1)
+var hopByHopHeaders = []string{
+	"Connection",
+	"Proxy-Connection", // Non-standard, but sent by some clients
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// copyEndToEndHeaders copies src into dst, dropping hop-by-hop headers
+// including any extra ones the sender listed in its Connection header
+func copyEndToEndHeaders(dst, src http.Header) {
+	skip := make(map[string]bool, len(hopByHopHeaders))
+	for _, h := range hopByHopHeaders {
+		skip[h] = true
+	}
+	for _, value := range src.Values("Connection") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				skip[http.CanonicalHeaderKey(name)] = true
+			}
+		}
+	}
+
+	for key, values := range src {
+		if skip[http.CanonicalHeaderKey(key)] {
+			continue
+		}
+		for _, value := range values {
+			dst.Add(key, value)
+		}
+	}
+}
+
+// proxyAuthFailureThreshold is how many consecutive 401/403 responses through a proxy
+// mark its credentials as likely expired (a single 403 is usually just RBAC)
+const proxyAuthFailureThreshold = 3
+
+// authHintHeader carries proxyAuthHint on 401/403 responses that look like expired credentials
+const authHintHeader = "X-Auth-Hint"
+
+// proxyAuthHint tells the app what to do when a proxy's credentials stop working
+const proxyAuthHint = "Credentials may be expired; re-authenticate and restart the proxy"
+
+// maxWrappedErrorBody caps how much of an upstream error body is read for ?wrap=true
+const maxWrappedErrorBody = 1 << 20
+
+// ProxyErrorEnvelope wraps a Kubernetes Status error with the cluster it came from (?wrap=true)
+type ProxyErrorEnvelope struct {
+	ClusterHash string          `json:"clusterHash"`
+	Context     string          `json:"context"`
+	StatusCode  int             `json:"statusCode"`
+	Reason      string          `json:"reason,omitempty"`
+	Message     string          `json:"message,omitempty"`
+	Status      json.RawMessage `json:"status"`         // Original Status object, unchanged
+	Hint        string          `json:"hint,omitempty"` // Set when the error looks like expired credentials
+}
+
+// kubeStatus is the subset of a Kubernetes metav1.Status needed to recognize and summarize it
+type kubeStatus struct {
+	Kind    string `json:"kind"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
 // ProxyRouterHandler handles routing requests to the correct kubectl proxy
 type ProxyRouterHandler struct {
 	sessionMgr *session.Manager
+	cache      *responseCache // Optional GET response cache (nil = disabled)
+	userAgent  string         // Prepended to forwarded User-Agent headers, e.g. "kubedesk-helper/1.2.3"; "" = pass through
+
+	// Set when token auth is on: Authorization then carries the helper's own token, which
+	// must not reach the API server (kubectl proxy keeps an existing Authorization header)
+	dropAuthorization bool
+}
+
+// forwardedUserAgent puts the helper's identity first so API server audit logs attribute
+// proxied calls to the helper, keeping the app's own User-Agent after it
+func forwardedUserAgent(helper, original string) string {
+	if original == "" {
+		return helper
+	}
+	return helper + " " + original
 }
 
 // NewProxyRouterHandler creates a new proxy router handler
@@ -27,6 +117,8 @@ func NewProxyRouterHandler(sessionMgr *session.Manager) *ProxyRouterHandler {
 // Route handles all requests to /proxy/{clusterHash}/*
 // It routes the request to the correct kubectl proxy based on the cluster hash
 func (h *ProxyRouterHandler) Route(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
 	vars := mux.Vars(r)
 	clusterHash := vars["clusterHash"]
 
@@ -38,7 +130,7 @@ func (h *ProxyRouterHandler) Route(w http.ResponseWriter, r *http.Request) {
 		targetPath = "/"
 	}
 
-	slog.Debug("Routing proxy request",
+	logger.Debug("Routing proxy request",
 		"clusterHash", clusterHash,
 		"path", targetPath,
 		"method", r.Method,
@@ -48,10 +140,10 @@ func (h *ProxyRouterHandler) Route(w http.ResponseWriter, r *http.Request) {
 	proxies := h.sessionMgr.FindByClusterHash(clusterHash)
 	var proxySession *session.Session
 	for _, sess := range proxies {
-		if sess.Type == session.TypeProxy && sess.Status == session.StatusRunning {
+		if sess.Type == session.TypeProxy && h.sessionMgr.StatusOf(sess) == session.StatusRunning {
 			// CRITICAL SAFETY CHECK: Verify cluster hash matches
 			if sess.ClusterHash != clusterHash {
-				slog.Error("CRITICAL: Found proxy with mismatched cluster hash!",
+				logger.Error("CRITICAL: Found proxy with mismatched cluster hash!",
 					"requestedHash", clusterHash,
 					"sessionHash", sess.ClusterHash,
 					"sessionId", sess.ID,
@@ -61,13 +153,18 @@ func (h *ProxyRouterHandler) Route(w http.ResponseWriter, r *http.Request) {
 				// DO NOT use this proxy - it's for a different cluster!
 				continue
 			}
+			// Hold the session so cluster cleanup waits for this forward to finish
+			if !sess.BeginUse() {
+				continue
+			}
+			sess.RecordProxyRequest()
 			proxySession = sess
 			break
 		}
 	}
 
 	if proxySession == nil {
-		slog.Error("No running proxy found for cluster hash - helper may have restarted",
+		logger.Error("No running proxy found for cluster hash - helper may have restarted",
 			"clusterHash", clusterHash,
 			"path", targetPath,
 			"method", r.Method,
@@ -85,10 +182,11 @@ func (h *ProxyRouterHandler) Route(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(errorResponse)
 		return
 	}
+	defer proxySession.EndUse()
 
 	// CRITICAL SAFETY: Double-check cluster hash before forwarding
 	if proxySession.ClusterHash != clusterHash {
-		slog.Error("CRITICAL SAFETY VIOLATION: Cluster hash mismatch before forwarding!",
+		logger.Error("CRITICAL SAFETY VIOLATION: Cluster hash mismatch before forwarding!",
 			"requestedHash", clusterHash,
 			"sessionHash", proxySession.ClusterHash,
 			"sessionId", proxySession.ID,
@@ -108,13 +206,75 @@ func (h *ProxyRouterHandler) Route(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Apply the proxy's namespace scope, if it was started with one
+	if proxySession.Namespace != "" {
+		scoped, err := scopeProxyPath(targetPath, proxySession.Namespace, proxySession.NamespaceScoped)
+		if err != nil {
+			logger.Warn("Rejected proxy request outside its namespace scope",
+				"clusterHash", clusterHash,
+				"namespace", proxySession.Namespace,
+				"path", targetPath,
+			)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":       err.Error(),
+				"clusterHash": clusterHash,
+				"namespace":   proxySession.Namespace,
+				"path":        targetPath,
+			})
+			return
+		}
+		if scoped != targetPath {
+			logger.Debug("Scoped proxy request to default namespace", "path", targetPath, "scopedPath", scoped)
+			targetPath = scoped
+		}
+	}
+
 	// Build the target URL for the kubectl proxy
-	targetURL := fmt.Sprintf("http://localhost:%d%s", proxySession.Port, targetPath)
-	if r.URL.RawQuery != "" {
-		targetURL += "?" + r.URL.RawQuery
+	// Same address kubectl proxy was pinned to with --address (see proxyBindAddress)
+	targetURL := fmt.Sprintf("http://%s%s", proxyHostPort(proxySession.Port), targetPath)
+
+	// ?wrap=true and ?noCache=true are for the helper, not the API server
+	rawQuery := r.URL.RawQuery
+	wrapErrors := false
+	noCache := false
+	if query := r.URL.Query(); query.Has("wrap") || query.Has("noCache") {
+		wrapErrors = query.Get("wrap") == "true"
+		noCache = query.Get("noCache") == "true"
+		query.Del("wrap")
+		query.Del("noCache")
+		rawQuery = query.Encode()
+	}
+	if rawQuery != "" {
+		targetURL += "?" + rawQuery
+	}
+
+	// Watches and log follows last until the client disconnects: lift the server's write
+	// timeout and flush every chunk as it arrives rather than when the buffer fills
+	forwardQuery, _ := url.ParseQuery(rawQuery)
+	streaming := isStreamingQuery(forwardQuery)
+	if streaming {
+		clearWriteDeadline(logger, w)
+		var endStream context.CancelFunc
+		r, endStream = withStreamShutdown(r)
+		defer endStream()
 	}
 
-	slog.Info("Forwarding request to kubectl proxy",
+	// Serve repeated read-only GETs from the cache when enabled
+	// Accept is part of the key since it selects the representation (e.g. Table vs JSON)
+	var cacheKey string
+	if h.cache != nil && r.Method == http.MethodGet && !streaming {
+		cacheKey = responseCacheKey(clusterHash, r.Method, targetPath, forwardQuery) + "\x00" + r.Header.Get("Accept")
+		if entry, ok := h.cache.get(cacheKey); ok && !noCache {
+			logger.Debug("Serving proxy request from cache", "clusterHash", clusterHash, "path", targetPath)
+			entry.write(w)
+			return
+		}
+		w.Header().Set(cacheHeader, "MISS")
+	}
+
+	logger.Info("Forwarding request to kubectl proxy",
 		"clusterHash", clusterHash,
 		"context", proxySession.Context,
 		"port", proxySession.Port,
@@ -124,25 +284,44 @@ func (h *ProxyRouterHandler) Route(w http.ResponseWriter, r *http.Request) {
 	)
 
 	// Create a new request to the kubectl proxy
-	proxyReq, err := http.NewRequest(r.Method, targetURL, r.Body)
+	// Tied to the client's context so an abandoned request doesn't keep the upstream call running
+	proxyReq, err := http.NewRequestWithContext(r.Context(), r.Method, targetURL, r.Body)
 	if err != nil {
-		slog.Error("Failed to create proxy request", "error", err)
+		logger.Error("Failed to create proxy request", "error", err)
 		http.Error(w, "Failed to create proxy request", http.StatusInternalServerError)
 		return
 	}
 
-	// Copy headers from original request
-	for key, values := range r.Header {
-		for _, value := range values {
-			proxyReq.Header.Add(key, value)
-		}
+	// CRITICAL: Preserve body framing - the body is streamed to the upstream, never buffered
+	// NewRequest can't know the length of r.Body, so without this every POST/PUT would
+	// be sent chunked (and bodyless requests would carry an empty chunked body)
+	// Known length -> Content-Length; unknown (-1, client sent chunked) -> chunked
+	proxyReq.ContentLength = r.ContentLength
+	if r.ContentLength == 0 {
+		proxyReq.Body = http.NoBody
+	}
+
+	// Copy end-to-end headers from original request
+	copyEndToEndHeaders(proxyReq.Header, r.Header)
+	if h.dropAuthorization {
+		proxyReq.Header.Del("Authorization")
+	}
+
+	// Host must name the upstream kubectl proxy, not the helper the app addressed
+	proxyReq.Host = proxyHostPort(proxySession.Port)
+
+	if h.userAgent != "" {
+		proxyReq.Header.Set("User-Agent", forwardedUserAgent(h.userAgent, r.Header.Get("User-Agent")))
 	}
 
 	// Forward the request to kubectl proxy
 	client := &http.Client{}
+	start := time.Now()
 	resp, err := client.Do(proxyReq)
+	// Latency is time to response headers; watches and log follows would otherwise skew it
+	metrics.GetRecorder().Observe(clusterHash, proxySession.Context, metrics.SourceProxy, time.Since(start), err != nil || resp.StatusCode >= 500)
 	if err != nil {
-		slog.Error("Failed to forward request to kubectl proxy",
+		logger.Error("Failed to forward request to kubectl proxy",
 			"error", err,
 			"clusterHash", clusterHash,
 			"port", proxySession.Port,
@@ -152,21 +331,108 @@ func (h *ProxyRouterHandler) Route(w http.ResponseWriter, r *http.Request) {
 	}
 	defer resp.Body.Close()
 
-	// Copy response headers
-	for key, values := range resp.Header {
-		for _, value := range values {
-			w.Header().Add(key, value)
+	// kubectl proxy keeps listening when its credentials expire, so every call then fails with
+	// 401 (or 403). Flag that to the app instead of passing the bare status through
+	var hint string
+	if failures := proxySession.RecordUpstreamStatus(resp.StatusCode); resp.StatusCode == http.StatusUnauthorized || failures >= proxyAuthFailureThreshold {
+		hint = proxyAuthHint
+		w.Header().Set(authHintHeader, hint)
+		if failures == 1 || failures == proxyAuthFailureThreshold {
+			logger.Warn("kubectl proxy is getting auth errors; credentials may be expired",
+				"clusterHash", clusterHash,
+				"context", proxySession.Context,
+				"sessionId", proxySession.ID,
+				"status", resp.StatusCode,
+				"consecutiveFailures", failures,
+			)
 		}
 	}
 
+	if skew := versionSkew.warning(clusterHash, proxySession.KubeconfigPath, proxySession.Context); skew != "" {
+		w.Header().Set(versionSkewHeader, skew)
+	}
+
+	// Optionally wrap Kubernetes Status errors with which cluster they came from
+	if wrapErrors && (resp.StatusCode < 200 || resp.StatusCode > 299) {
+		if writeWrappedStatusError(logger, w, resp, proxySession, hint) {
+			return
+		}
+	}
+
+	// Copy end-to-end response headers; net/http sets its own framing for our connection
+	copyEndToEndHeaders(w.Header(), resp.Header)
+
+	// Keep small successful bodies for the cache; larger ones stream through uncached
+	if cacheKey != "" && resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxCachedResponseBody+1))
+		if err == nil {
+			// Cache what came from upstream only; w.Header() also holds this request's ID and warnings
+			upstream := make(http.Header)
+			copyEndToEndHeaders(upstream, resp.Header)
+			h.cache.set(cacheKey, resp.StatusCode, upstream, body)
+		}
+		resp.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), resp.Body))
+	}
+
 	// Copy status code
 	w.WriteHeader(resp.StatusCode)
 
 	// Copy response body
-	_, err = io.Copy(w, resp.Body)
+	dst := io.Writer(w)
+	if streaming {
+		dst = flushWriter{w: w, rc: http.NewResponseController(w)}
+	}
+	_, err = io.Copy(dst, resp.Body)
 	if err != nil {
-		slog.Error("Failed to copy response body", "error", err)
+		logger.Error("Failed to copy response body", "error", err)
 		return
 	}
 }
 
+// flushWriter flushes after every write so streamed events reach the client without delay
+type flushWriter struct {
+	w  io.Writer
+	rc *http.ResponseController
+}
+
+func (f flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if err == nil {
+		err = f.rc.Flush()
+	}
+	return n, err
+}
+
+// writeWrappedStatusError writes resp's Kubernetes Status body inside a ProxyErrorEnvelope
+// Returns false without writing if the body isn't a Status object; resp.Body is then
+// replaced so the caller can still pass the original bytes through unchanged
+func writeWrappedStatusError(logger *slog.Logger, w http.ResponseWriter, resp *http.Response, sess *session.Session, hint string) bool {
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxWrappedErrorBody+1))
+	if err != nil {
+		logger.Error("Failed to read upstream error body", "error", err)
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		return false
+	}
+
+	var status kubeStatus
+	if len(body) > maxWrappedErrorBody || json.Unmarshal(body, &status) != nil || status.Kind != "Status" {
+		// Too large or not a Status: let the caller stream the original body (plus any unread rest)
+		resp.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), resp.Body))
+		return false
+	}
+
+	envelope := ProxyErrorEnvelope{
+		ClusterHash: sess.ClusterHash,
+		Context:     sess.Context,
+		StatusCode:  resp.StatusCode,
+		Reason:      status.Reason,
+		Message:     status.Message,
+		Status:      json.RawMessage(body),
+		Hint:        hint,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(resp.StatusCode)
+	json.NewEncoder(w).Encode(envelope)
+	return true
+}
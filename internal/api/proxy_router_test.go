@@ -0,0 +1,503 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/kubedeskpro/kubedesk-helper/internal/session"
+)
+
+func TestCopyEndToEndHeaders(t *testing.T) {
+	src := http.Header{}
+	src.Set("Accept", "application/json")
+	src.Set("Authorization", "Bearer token")
+	src.Set("Connection", "keep-alive, X-Custom-Hop")
+	src.Set("Keep-Alive", "timeout=5")
+	src.Set("Transfer-Encoding", "chunked")
+	src.Set("Upgrade", "websocket")
+	src.Set("Proxy-Authorization", "Basic abc")
+	src.Set("Te", "trailers")
+	src.Set("X-Custom-Hop", "drop me")
+
+	dst := http.Header{}
+	copyEndToEndHeaders(dst, src)
+
+	for _, h := range []string{"Connection", "Keep-Alive", "Transfer-Encoding", "Upgrade", "Proxy-Authorization", "Te", "X-Custom-Hop"} {
+		if v := dst.Get(h); v != "" {
+			t.Errorf("hop-by-hop header %s was copied: %q", h, v)
+		}
+	}
+	if dst.Get("Accept") != "application/json" || dst.Get("Authorization") != "Bearer token" {
+		t.Errorf("end-to-end headers not copied: %v", dst)
+	}
+}
+
+func TestProxyRoute_StripsHopByHopHeaders(t *testing.T) {
+	var upstreamReq *http.Request
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamReq = r.Clone(r.Context())
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Keep-Alive", "timeout=99")
+		w.Header().Set("Connection", "X-Upstream-Hop")
+		w.Header().Set("X-Upstream-Hop", "drop me")
+		w.Header().Set("X-Upstream-Kept", "keep me")
+		w.Write([]byte(`{"kind":"PodList"}`))
+	}))
+	defer upstream.Close()
+
+	_, portStr, _ := net.SplitHostPort(upstream.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	sess, _ := sessionMgr.CreateForCluster(session.TypeProxy, "abc123")
+	sess.Port = port
+
+	router := mux.NewRouter()
+	router.PathPrefix("/proxy/{clusterHash}/").HandlerFunc(NewProxyRouterHandler(sessionMgr).Route)
+
+	req := httptest.NewRequest(http.MethodGet, "/proxy/abc123/api/v1/pods?limit=1", nil)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Keep-Alive", "timeout=5")
+	req.Header.Set("Proxy-Authorization", "Basic abc")
+	req.Header.Set("Connection", "X-Client-Hop")
+	req.Header.Set("X-Client-Hop", "drop me")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if upstreamReq == nil {
+		t.Fatal("request did not reach upstream")
+	}
+
+	// Request direction
+	if upstreamReq.URL.Path != "/api/v1/pods" || upstreamReq.URL.RawQuery != "limit=1" {
+		t.Errorf("unexpected upstream URL: %s", upstreamReq.URL)
+	}
+	if upstreamReq.Host != proxyHostPort(port) {
+		t.Errorf("upstream Host = %q, want %q", upstreamReq.Host, proxyHostPort(port))
+	}
+	for _, h := range []string{"Keep-Alive", "Proxy-Authorization", "X-Client-Hop"} {
+		if v := upstreamReq.Header.Get(h); v != "" {
+			t.Errorf("hop-by-hop header %s forwarded upstream: %q", h, v)
+		}
+	}
+	if upstreamReq.Header.Get("Accept") != "application/json" {
+		t.Errorf("Accept header not forwarded")
+	}
+
+	// Response direction
+	for _, h := range []string{"Keep-Alive", "Connection", "X-Upstream-Hop"} {
+		if v := rec.Header().Get(h); v != "" {
+			t.Errorf("hop-by-hop header %s returned to client: %q", h, v)
+		}
+	}
+	if rec.Header().Get("X-Upstream-Kept") != "keep me" {
+		t.Errorf("end-to-end response header not returned")
+	}
+	if rec.Body.String() != `{"kind":"PodList"}` {
+		t.Errorf("unexpected body: %q", rec.Body.String())
+	}
+}
+
+func TestProxyRoute_ForwardsRequestBodyFraming(t *testing.T) {
+	type seen struct {
+		contentLength    int64
+		transferEncoding []string
+		contentType      string
+		body             string
+	}
+	got := make(chan seen, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got <- seen{r.ContentLength, r.TransferEncoding, r.Header.Get("Content-Type"), string(body)}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer upstream.Close()
+
+	_, portStr, _ := net.SplitHostPort(upstream.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	sess, _ := sessionMgr.CreateForCluster(session.TypeProxy, "abc123")
+	sess.Port = port
+
+	router := mux.NewRouter()
+	router.PathPrefix("/proxy/{clusterHash}/").HandlerFunc(NewProxyRouterHandler(sessionMgr).Route)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	url := server.URL + "/proxy/abc123/api/v1/namespaces/default/configmaps"
+	payload := `{"kind":"ConfigMap","metadata":{"name":"demo"}}`
+
+	t.Run("ContentLength", func(t *testing.T) {
+		resp, err := http.Post(url, "application/json", strings.NewReader(payload))
+		if err != nil {
+			t.Fatalf("POST: %v", err)
+		}
+		resp.Body.Close()
+
+		s := <-got
+		if s.contentLength != int64(len(payload)) || len(s.transferEncoding) != 0 {
+			t.Errorf("expected Content-Length %d without chunking, got %d %v", len(payload), s.contentLength, s.transferEncoding)
+		}
+		if s.contentType != "application/json" || s.body != payload {
+			t.Errorf("unexpected content type %q or body %q", s.contentType, s.body)
+		}
+	})
+
+	t.Run("Chunked", func(t *testing.T) {
+		// An io.Reader of unknown size makes the client send chunked
+		pr, pw := io.Pipe()
+		go func() {
+			pw.Write([]byte(payload[:10]))
+			pw.Write([]byte(payload[10:]))
+			pw.Close()
+		}()
+		resp, err := http.Post(url, "application/json", pr)
+		if err != nil {
+			t.Fatalf("POST: %v", err)
+		}
+		resp.Body.Close()
+
+		s := <-got
+		if s.contentLength != -1 || len(s.transferEncoding) == 0 || s.transferEncoding[0] != "chunked" {
+			t.Errorf("expected chunked upstream request, got length %d encoding %v", s.contentLength, s.transferEncoding)
+		}
+		if s.body != payload {
+			t.Errorf("unexpected body %q", s.body)
+		}
+	})
+
+	t.Run("NoBody", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodDelete, url+"/demo", nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("DELETE: %v", err)
+		}
+		resp.Body.Close()
+
+		s := <-got
+		if s.contentLength != 0 || len(s.transferEncoding) != 0 || s.body != "" {
+			t.Errorf("expected bodyless upstream request, got length %d encoding %v body %q", s.contentLength, s.transferEncoding, s.body)
+		}
+	})
+}
+
+func TestProxyRoute_WrapStatusErrors(t *testing.T) {
+	const forbidden = `{"kind":"Status","apiVersion":"v1","status":"Failure","message":"pods is forbidden: User \"dev\" cannot list resource \"pods\"","reason":"Forbidden","code":403}`
+
+	var upstreamQuery string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamQuery = r.URL.RawQuery
+		switch r.URL.Path {
+		case "/api/v1/pods":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(forbidden))
+		default:
+			http.Error(w, "plain upstream failure", http.StatusBadGateway)
+		}
+	}))
+	defer upstream.Close()
+
+	_, portStr, _ := net.SplitHostPort(upstream.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	sess, _ := sessionMgr.CreateForCluster(session.TypeProxy, "abc123")
+	sess.Port = port
+	sess.Context = "prod-cluster"
+
+	router := mux.NewRouter()
+	router.PathPrefix("/proxy/{clusterHash}/").HandlerFunc(NewProxyRouterHandler(sessionMgr).Route)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	t.Run("DefaultPassthrough", func(t *testing.T) {
+		rec := get("/proxy/abc123/api/v1/pods")
+		if rec.Code != http.StatusForbidden || rec.Body.String() != forbidden {
+			t.Errorf("expected verbatim 403 body, got %d %q", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("Wrapped", func(t *testing.T) {
+		rec := get("/proxy/abc123/api/v1/pods?limit=5&wrap=true")
+		if rec.Code != http.StatusForbidden {
+			t.Fatalf("expected 403, got %d", rec.Code)
+		}
+		if upstreamQuery != "limit=5" {
+			t.Errorf("wrap param leaked upstream: %q", upstreamQuery)
+		}
+
+		var env ProxyErrorEnvelope
+		if err := json.NewDecoder(rec.Body).Decode(&env); err != nil {
+			t.Fatalf("decode envelope: %v", err)
+		}
+		if env.ClusterHash != "abc123" || env.Context != "prod-cluster" || env.StatusCode != 403 || env.Reason != "Forbidden" {
+			t.Errorf("unexpected envelope: %+v", env)
+		}
+		if !strings.Contains(env.Message, "cannot list resource") {
+			t.Errorf("expected original message, got %q", env.Message)
+		}
+		var original map[string]interface{}
+		if err := json.Unmarshal(env.Status, &original); err != nil || original["kind"] != "Status" {
+			t.Errorf("expected original Status object preserved, got %s", env.Status)
+		}
+	})
+
+	t.Run("WrappedNonStatusPassesThrough", func(t *testing.T) {
+		rec := get("/proxy/abc123/other?wrap=true")
+		if rec.Code != http.StatusBadGateway || !strings.Contains(rec.Body.String(), "plain upstream failure") {
+			t.Errorf("expected original 502 body, got %d %q", rec.Code, rec.Body.String())
+		}
+	})
+}
+
+func TestProxyRoute_AuthFailureHint(t *testing.T) {
+	const unauthorized = `{"kind":"Status","apiVersion":"v1","status":"Failure","message":"Unauthorized","reason":"Unauthorized","code":401}`
+
+	var status atomic.Int32
+	status.Store(http.StatusUnauthorized)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code := int(status.Load())
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		if code == http.StatusUnauthorized {
+			w.Write([]byte(unauthorized))
+			return
+		}
+		w.Write([]byte(`{"kind":"Status","reason":"Forbidden","code":403}`))
+	}))
+	defer upstream.Close()
+
+	_, portStr, _ := net.SplitHostPort(upstream.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	sess, _ := sessionMgr.CreateForCluster(session.TypeProxy, "abc123")
+	sess.Port = port
+
+	router := mux.NewRouter()
+	router.PathPrefix("/proxy/{clusterHash}/").HandlerFunc(NewProxyRouterHandler(sessionMgr).Route)
+	router.HandleFunc("/proxy/list", (&ProxyHandler{sessionMgr: sessionMgr}).List)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	// Every 401 carries the hint; the body passes through unchanged
+	for i := 0; i < proxyAuthFailureThreshold; i++ {
+		rec := get("/proxy/abc123/api/v1/pods")
+		if rec.Code != http.StatusUnauthorized || rec.Body.String() != unauthorized {
+			t.Fatalf("expected verbatim 401, got %d %q", rec.Code, rec.Body.String())
+		}
+		if rec.Header().Get(authHintHeader) != proxyAuthHint {
+			t.Errorf("request %d: %s = %q, want hint", i+1, authHintHeader, rec.Header().Get(authHintHeader))
+		}
+	}
+
+	// The wrapped envelope carries it too
+	rec := get("/proxy/abc123/api/v1/pods?wrap=true")
+	var env ProxyErrorEnvelope
+	if err := json.NewDecoder(rec.Body).Decode(&env); err != nil || env.Hint != proxyAuthHint {
+		t.Errorf("wrapped envelope = %+v (err %v), want hint", env, err)
+	}
+
+	// The proxy list flags the session
+	rec = get("/proxy/list")
+	var list ProxyListResponse
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil || len(list.Sessions) != 1 || !list.Sessions[0].NeedsReauth {
+		t.Errorf("proxy list = %+v (err %v), want session needing reauth", list, err)
+	}
+
+	// A success resets the streak; an isolated 403 (e.g. RBAC) gets no hint
+	status.Store(http.StatusOK)
+	get("/proxy/abc123/api/v1/pods")
+	status.Store(http.StatusForbidden)
+	if rec := get("/proxy/abc123/api/v1/secrets"); rec.Header().Get(authHintHeader) != "" {
+		t.Errorf("isolated 403 got hint %q", rec.Header().Get(authHintHeader))
+	}
+	if sess.AuthFailures() != 1 {
+		t.Errorf("AuthFailures = %d, want 1", sess.AuthFailures())
+	}
+}
+
+func TestProxyRoute_CleanupWaitsForInFlightForward(t *testing.T) {
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-unblock
+		w.Write([]byte(`{"kind":"PodList"}`))
+	}))
+	defer upstream.Close()
+
+	_, portStr, _ := net.SplitHostPort(upstream.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	sess, _ := sessionMgr.CreateForCluster(session.TypeProxy, "abc123")
+	sess.Port = port
+
+	kubeconfigFile := filepath.Join(t.TempDir(), "kubeconfig-test")
+	if err := os.WriteFile(kubeconfigFile, []byte("apiVersion: v1"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	sess.AddTempFile(kubeconfigFile)
+
+	router := mux.NewRouter()
+	router.PathPrefix("/proxy/{clusterHash}/").HandlerFunc(NewProxyRouterHandler(sessionMgr).Route)
+
+	forwarded := make(chan *httptest.ResponseRecorder)
+	go func() {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/proxy/abc123/api/v1/pods", nil))
+		forwarded <- rec
+	}()
+	<-started
+
+	cleaned := make(chan int)
+	go func() { cleaned <- sessionMgr.CleanupByClusterHash("abc123") }()
+
+	select {
+	case <-cleaned:
+		t.Fatal("cleanup returned while a forward was in flight")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if _, err := os.Stat(kubeconfigFile); err != nil {
+		t.Fatalf("kubeconfig removed while a forward was in flight: %v", err)
+	}
+
+	// New requests no longer see the draining session
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/proxy/abc123/api/v1/pods", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 for a new request during cleanup, got %d", rec.Code)
+	}
+
+	close(unblock)
+	if rec := <-forwarded; rec.Code != http.StatusOK || rec.Body.String() != `{"kind":"PodList"}` {
+		t.Errorf("in-flight forward did not complete: %d %q", rec.Code, rec.Body.String())
+	}
+	if n := <-cleaned; n != 1 {
+		t.Errorf("expected 1 session cleaned up, got %d", n)
+	}
+	if _, err := os.Stat(kubeconfigFile); !os.IsNotExist(err) {
+		t.Errorf("expected kubeconfig to be removed after cleanup, got %v", err)
+	}
+}
+
+func TestProxyRoute_UserAgent(t *testing.T) {
+	var gotUA string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUA = r.Header.Get("User-Agent")
+		w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+
+	_, portStr, _ := net.SplitHostPort(upstream.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	sess, _ := sessionMgr.CreateForCluster(session.TypeProxy, "abc123")
+	sess.Port = port
+
+	tests := []struct {
+		name      string
+		userAgent string
+		appUA     string
+		want      string
+	}{
+		{"prepended", "kubedesk-helper/1.2.3", "KubeDesk/4.0 (Macintosh)", "kubedesk-helper/1.2.3 KubeDesk/4.0 (Macintosh)"},
+		{"no app user agent", "kubedesk-helper/1.2.3", "", "kubedesk-helper/1.2.3"},
+		{"disabled", "", "KubeDesk/4.0 (Macintosh)", "KubeDesk/4.0 (Macintosh)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewProxyRouterHandler(sessionMgr)
+			handler.userAgent = tt.userAgent
+			router := mux.NewRouter()
+			router.PathPrefix("/proxy/{clusterHash}/").HandlerFunc(handler.Route)
+
+			req := httptest.NewRequest(http.MethodGet, "/proxy/abc123/api/v1/pods", nil)
+			if tt.appUA != "" {
+				req.Header.Set("User-Agent", tt.appUA)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+			}
+			if gotUA != tt.want {
+				t.Errorf("upstream User-Agent = %q, want %q", gotUA, tt.want)
+			}
+		})
+	}
+}
+
+func TestProxyRoute_NamespaceScope(t *testing.T) {
+	var gotPath string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+
+	_, portStr, _ := net.SplitHostPort(upstream.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	sess, _ := sessionMgr.CreateForCluster(session.TypeProxy, "abc123")
+	sess.Port = port
+	sess.Namespace = "team-a"
+	sess.NamespaceScoped = true
+
+	router := mux.NewRouter()
+	router.PathPrefix("/proxy/{clusterHash}/").HandlerFunc(NewProxyRouterHandler(sessionMgr).Route)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/proxy/abc123/api/v1/pods", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+	if gotPath != "/api/v1/namespaces/team-a/pods" {
+		t.Errorf("upstream path = %q, want /api/v1/namespaces/team-a/pods", gotPath)
+	}
+
+	gotPath = ""
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/proxy/abc123/api/v1/namespaces/kube-system/pods", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403: %s", rec.Code, rec.Body.String())
+	}
+	if gotPath != "" {
+		t.Errorf("request outside the scope reached the proxy: %q", gotPath)
+	}
+}
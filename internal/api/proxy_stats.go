@@ -0,0 +1,97 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/session"
+)
+
+// proxyCounters count proxy start outcomes since the helper started
+type proxyCounters struct {
+	started        atomic.Int64
+	startFailures  atomic.Int64
+	reused         atomic.Int64
+	staleReplaced  atomic.Int64
+	alternatePorts atomic.Int64
+	evicted        atomic.Int64
+}
+
+// ProxyStatsResponse is the response of GET /proxy/stats
+type ProxyStatsResponse struct {
+	Running   int                `json:"running"`
+	PortRange PortRange          `json:"portRange"`
+	Counters  ProxyStatsCounters `json:"counters"`
+	Proxies   []ProxyStats       `json:"proxies"` // Sorted by port
+
+	MaxProxies int `json:"maxProxies,omitempty"` // MAX_PROXIES; omitted if unlimited
+}
+
+// ProxyStatsCounters are totals since the helper started
+type ProxyStatsCounters struct {
+	Started        int64 `json:"started"`        // kubectl proxies spawned
+	StartFailures  int64 `json:"startFailures"`  // Starts that failed, including no free port
+	Reused         int64 `json:"reused"`         // Start/ensure calls answered with an already-running proxy
+	StaleReplaced  int64 `json:"staleReplaced"`  // Running proxies /proxy/ensure restarted because they stopped accepting connections
+	AlternatePorts int64 `json:"alternatePorts"` // Proxies started off their deterministic port because another cluster or process held it
+	Evicted        int64 `json:"evicted"`        // Least recently used proxies stopped to stay within MAX_PROXIES
+}
+
+// ProxyStats describes one proxy session
+type ProxyStats struct {
+	SessionID     string    `json:"sessionId"`
+	ClusterHash   string    `json:"clusterHash"`
+	Context       string    `json:"context"`
+	Status        string    `json:"status"`
+	Port          int       `json:"port"`
+	PreferredPort int       `json:"preferredPort"` // The cluster's deterministic port; differs from port if another cluster or process held it
+	StartedAt     time.Time `json:"startedAt"`
+	LastActivity  time.Time `json:"lastActivity"` // Last request routed through the proxy, or startedAt if none
+	Requests      int64     `json:"requests"`     // Requests routed through /proxy/{clusterHash}/
+	AuthFailures  int       `json:"authFailures,omitempty"`
+}
+
+// Stats handles GET /proxy/stats
+// Reports every proxy session with its port assignment and traffic, plus start and reuse totals
+func (h *ProxyHandler) Stats(w http.ResponseWriter, r *http.Request) {
+	portMin, portMax := h.portRange()
+	response := ProxyStatsResponse{
+		PortRange: PortRange{Min: portMin, Max: portMax},
+		Counters: ProxyStatsCounters{
+			Started:        h.stats.started.Load(),
+			StartFailures:  h.stats.startFailures.Load(),
+			Reused:         h.stats.reused.Load(),
+			StaleReplaced:  h.stats.staleReplaced.Load(),
+			AlternatePorts: h.stats.alternatePorts.Load(),
+			Evicted:        h.stats.evicted.Load(),
+		},
+		Proxies:    []ProxyStats{},
+		MaxProxies: h.maxProxies,
+	}
+
+	for _, sess := range h.sessionMgr.List(session.TypeProxy) {
+		if h.sessionMgr.StatusOf(sess) == session.StatusRunning {
+			response.Running++
+		}
+		requests, _ := sess.ProxyRequests()
+		response.Proxies = append(response.Proxies, ProxyStats{
+			SessionID:     sess.ID,
+			ClusterHash:   sess.ClusterHash,
+			Context:       sess.Context,
+			Status:        string(h.sessionMgr.StatusOf(sess)),
+			Port:          sess.Port,
+			PreferredPort: h.assignPortForCluster(sess.ClusterHash),
+			StartedAt:     sess.StartedAt,
+			LastActivity:  proxyLastActivity(sess),
+			Requests:      requests,
+			AuthFailures:  sess.AuthFailures(),
+		})
+	}
+	sort.Slice(response.Proxies, func(i, j int) bool { return response.Proxies[i].Port < response.Proxies[j].Port })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/kubedeskpro/kubedesk-helper/internal/session"
+)
+
+func TestProxyStats_ReflectsStartedProxies(t *testing.T) {
+	ln, err := net.Listen("tcp4", proxyBindAddress+":0")
+	if err != nil {
+		t.Skipf("IPv4 loopback unavailable: %v", err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	installFakeKubectlProxy(t)
+
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	defer sessionMgr.StopAll()
+	handler := &ProxyHandler{sessionMgr: sessionMgr, portMin: port, portMax: port}
+
+	stats := func() ProxyStatsResponse {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.Stats(rec, httptest.NewRequest(http.MethodGet, "/proxy/stats", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var resp ProxyStatsResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp
+	}
+
+	if empty := stats(); empty.Running != 0 || len(empty.Proxies) != 0 || empty.PortRange.Min != port {
+		t.Errorf("expected no proxies before any start, got %+v", empty)
+	}
+
+	var ensured ProxyEnsureResponse
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		handler.Ensure(rec, httptest.NewRequest(http.MethodPost, "/proxy/ensure", strings.NewReader(`{"context":"stats-context"}`)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("ensure: expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&ensured); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+	}
+
+	resp := stats()
+	if resp.Running != 1 || len(resp.Proxies) != 1 {
+		t.Fatalf("expected 1 running proxy, got %+v", resp)
+	}
+	if resp.Counters.Started != 1 || resp.Counters.Reused != 1 || resp.Counters.AlternatePorts != 0 || resp.Counters.StartFailures != 0 {
+		t.Errorf("unexpected counters: %+v", resp.Counters)
+	}
+	p := resp.Proxies[0]
+	if p.SessionID != ensured.SessionID || p.ClusterHash != ensured.ClusterHash || p.Context != "stats-context" ||
+		p.Port != port || p.PreferredPort != port || p.Status != string(session.StatusRunning) {
+		t.Errorf("unexpected proxy stats: %+v", p)
+	}
+	if p.Requests != 0 || !p.LastActivity.Equal(p.StartedAt) {
+		t.Errorf("expected no requests and lastActivity = startedAt, got %+v", p)
+	}
+
+	// Requests routed through /proxy/{clusterHash}/ count, whatever the upstream answered
+	router := mux.NewRouter()
+	router.PathPrefix("/proxy/{clusterHash}/").HandlerFunc(NewProxyRouterHandler(sessionMgr).Route)
+	for i := 0; i < 3; i++ {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/proxy/"+ensured.ClusterHash+"/api/v1/pods", nil))
+	}
+
+	p = stats().Proxies[0]
+	if p.Requests != 3 || !p.LastActivity.After(p.StartedAt) {
+		t.Errorf("expected 3 requests and a later lastActivity, got %+v", p)
+	}
+}
@@ -1,7 +1,21 @@
 package api
 
 import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/cluster"
+	"github.com/kubedeskpro/kubedesk-helper/internal/session"
 )
 
 func TestAssignPortForCluster(t *testing.T) {
@@ -78,6 +92,23 @@ func TestAssignPortForCluster_Range(t *testing.T) {
 	}
 }
 
+func TestAssignPortForCluster_CustomRange(t *testing.T) {
+	handler := &ProxyHandler{portMin: 20000, portMax: 20009}
+
+	hashes := []string{"0000", "ffff", "e40f0908cbe45e0d", "03bbba57f539155e"}
+	for _, hash := range hashes {
+		port := handler.assignPortForCluster(hash)
+		if port < 20000 || port > 20009 {
+			t.Errorf("assignPortForCluster(%q) = %d, want port in range [20000, 20009]", hash, port)
+		}
+	}
+
+	// 0xffff % 10 == 5
+	if port := handler.assignPortForCluster("ffff"); port != 20005 {
+		t.Errorf("assignPortForCluster(\"ffff\") = %d, want 20005", port)
+	}
+}
+
 func TestAssignPortForCluster_DifferentHashesDifferentPorts(t *testing.T) {
 	handler := &ProxyHandler{}
 
@@ -119,3 +150,337 @@ func TestHexCharToInt(t *testing.T) {
 	}
 }
 
+func TestProxyHostPort(t *testing.T) {
+	if got := proxyHostPort(47824); got != "127.0.0.1:47824" {
+		t.Errorf("proxyHostPort(47824) = %q, want %q", got, "127.0.0.1:47824")
+	}
+}
+
+// A proxy bound only to IPv4 loopback must be reachable via proxyHostPort,
+// regardless of whether "localhost" resolves to ::1 first on this system
+func TestProxyHostPort_ReachesIPv4OnlyListener(t *testing.T) {
+	ln, err := net.Listen("tcp4", proxyBindAddress+":0")
+	if err != nil {
+		t.Skipf("IPv4 loopback unavailable: %v", err)
+	}
+	defer ln.Close()
+
+	port := ln.Addr().(*net.TCPAddr).Port
+	conn, err := net.Dial("tcp", proxyHostPort(port))
+	if err != nil {
+		t.Fatalf("dial %s: %v", proxyHostPort(port), err)
+	}
+	conn.Close()
+}
+
+func TestProxyStart_ReportsStderrOnAuthFailure(t *testing.T) {
+	installFakeKubectl(t, `echo "Starting proxy..." >&2
+echo "Unable to connect to the server: x509: certificate signed by unknown authority" >&2
+exit 1
+`)
+
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	handler := &ProxyHandler{sessionMgr: sessionMgr}
+
+	body := `{"context":"bad-auth-context"}`
+	req := httptest.NewRequest(http.MethodPost, "/proxy/start", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	handler.Start(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), "process exited") ||
+		!strings.Contains(rec.Body.String(), "x509: certificate signed by unknown authority") {
+		t.Errorf("expected exit reason and stderr in body, got %q", rec.Body.String())
+	}
+	if n := len(sessionMgr.List(session.TypeProxy)); n != 0 {
+		t.Errorf("expected failed proxy session to be removed, got %d", n)
+	}
+}
+
+func TestProxyStart_ReadyTimeout(t *testing.T) {
+	installFakeKubectl(t, `echo "still connecting" >&2
+exec sleep 5
+`)
+
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	handler := &ProxyHandler{
+		sessionMgr:    sessionMgr,
+		readyTimeout:  300 * time.Millisecond,
+		readyInterval: 50 * time.Millisecond,
+	}
+
+	start := time.Now()
+	req := httptest.NewRequest(http.MethodPost, "/proxy/start", strings.NewReader(`{"context":"slow-context"}`))
+	rec := httptest.NewRecorder()
+	handler.Start(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), "not listening") || !strings.Contains(rec.Body.String(), "still connecting") {
+		t.Errorf("expected timeout reason and stderr in body, got %q", rec.Body.String())
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("ready wait took %s, expected it to honor the 300ms timeout", elapsed)
+	}
+}
+
+func TestProxyStart_ConcurrentStartsSpawnOneProxy(t *testing.T) {
+	// Stand in for kubectl proxy's listener so readiness succeeds for whichever process starts
+	ln, err := net.Listen("tcp4", proxyBindAddress+":0")
+	if err != nil {
+		t.Skipf("IPv4 loopback unavailable: %v", err)
+	}
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	countFile := filepath.Join(t.TempDir(), "spawns")
+	installFakeKubectl(t, `echo spawned >> '`+countFile+`'
+exec sleep 5
+`)
+
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	defer sessionMgr.StopAll()
+	handler := &ProxyHandler{sessionMgr: sessionMgr, portMin: port, portMax: port}
+
+	const n = 16
+	var wg sync.WaitGroup
+	ready := make(chan struct{})
+	codes := make([]int, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-ready
+			req := httptest.NewRequest(http.MethodPost, "/proxy/start", strings.NewReader(`{"context":"reconnect-context"}`))
+			rec := httptest.NewRecorder()
+			handler.Start(rec, req)
+			codes[i] = rec.Code
+		}(i)
+	}
+	close(ready)
+	wg.Wait()
+
+	for i, code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("start %d: expected 200, got %d", i, code)
+		}
+	}
+
+	data, err := os.ReadFile(countFile)
+	if err != nil {
+		t.Fatalf("read spawn count: %v", err)
+	}
+	if spawns := strings.Count(string(data), "spawned"); spawns != 1 {
+		t.Errorf("expected exactly 1 kubectl proxy process, got %d", spawns)
+	}
+	if sessions := len(sessionMgr.List(session.TypeProxy)); sessions != 1 {
+		t.Errorf("expected exactly 1 proxy session, got %d", sessions)
+	}
+}
+
+func TestProxyEnsure_StartsThenReuses(t *testing.T) {
+	ln, err := net.Listen("tcp4", proxyBindAddress+":0")
+	if err != nil {
+		t.Skipf("IPv4 loopback unavailable: %v", err)
+	}
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	installFakeKubectl(t, "exec sleep 5\n")
+
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	defer sessionMgr.StopAll()
+	handler := &ProxyHandler{sessionMgr: sessionMgr, portMin: port, portMax: port}
+
+	ensure := func() ProxyEnsureResponse {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/proxy/ensure", strings.NewReader(`{"context":"ensure-context"}`))
+		rec := httptest.NewRecorder()
+		handler.Ensure(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var resp ProxyEnsureResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp
+	}
+
+	first := ensure()
+	if first.Reused || !first.Ready || first.Port != port {
+		t.Errorf("first ensure: expected new ready proxy on %d, got %+v", port, first)
+	}
+
+	second := ensure()
+	if !second.Reused || !second.Ready || second.SessionID != first.SessionID {
+		t.Errorf("second ensure: expected reuse of %s, got %+v", first.SessionID, second)
+	}
+}
+
+// TestHelperKubectlProxy is not a real test: it is exec'd by installFakeKubectlProxy
+// and behaves like kubectl proxy by listening on the --address/--port it is given
+func TestHelperKubectlProxy(t *testing.T) {
+	if os.Getenv("KUBEDESK_HELPER_FAKE_PROXY") != "1" {
+		return
+	}
+	address, port := "127.0.0.1", ""
+	args := os.Args
+	for i := 0; i < len(args)-1; i++ {
+		switch args[i] {
+		case "--address":
+			address = args[i+1]
+		case "--port":
+			port = args[i+1]
+		}
+	}
+	ln, err := net.Listen("tcp", net.JoinHostPort(address, port))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			os.Exit(0)
+		}
+		conn.Close()
+	}
+}
+
+// installFakeKubectlProxy installs a kubectl that really listens like kubectl proxy
+func installFakeKubectlProxy(t *testing.T) {
+	t.Helper()
+	installFakeKubectl(t, "KUBEDESK_HELPER_FAKE_PROXY=1 exec '"+os.Args[0]+"' -test.run='^TestHelperKubectlProxy$' -- \"$@\"\n")
+}
+
+func TestProxyStart_CollidingClustersCoexist(t *testing.T) {
+	// Reserve two adjacent-ish free ports by letting the OS pick, then use a 2-port range
+	ln, err := net.Listen("tcp4", proxyBindAddress+":0")
+	if err != nil {
+		t.Skipf("IPv4 loopback unavailable: %v", err)
+	}
+	base := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+	if base >= 65535 || !isPortFree(base+1) {
+		t.Skip("could not find two free adjacent ports")
+	}
+
+	installFakeKubectlProxy(t)
+
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	defer sessionMgr.StopAll()
+	handler := &ProxyHandler{sessionMgr: sessionMgr, portMin: base, portMax: base + 1}
+
+	// Find two contexts whose hashes map to the same deterministic port
+	var contexts []string
+	wantPort := 0
+	for i := 0; len(contexts) < 2 && i < 100; i++ {
+		ctx := fmt.Sprintf("ctx-%d", i)
+		port := handler.assignPortForCluster(cluster.ComputeHash("", ctx))
+		if wantPort == 0 {
+			wantPort = port
+		}
+		if port == wantPort {
+			contexts = append(contexts, ctx)
+		}
+	}
+	if len(contexts) < 2 {
+		t.Fatal("could not find two colliding contexts")
+	}
+
+	var sessions []ProxyStartResponse
+	for _, ctx := range contexts {
+		req := httptest.NewRequest(http.MethodPost, "/proxy/start", strings.NewReader(`{"context":"`+ctx+`"}`))
+		rec := httptest.NewRecorder()
+		handler.Start(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("start %s: expected 200, got %d: %s", ctx, rec.Code, rec.Body.String())
+		}
+		var resp ProxyStartResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		sessions = append(sessions, resp)
+	}
+
+	if sessions[0].Port != wantPort {
+		t.Errorf("first cluster should keep its deterministic port %d, got %d", wantPort, sessions[0].Port)
+	}
+	if sessions[1].Port == sessions[0].Port {
+		t.Errorf("second cluster should get an alternate port, both got %d", sessions[0].Port)
+	}
+	if n := handler.stats.alternatePorts.Load(); n != 1 {
+		t.Errorf("alternatePorts = %d, want 1", n)
+	}
+
+	for _, resp := range sessions {
+		sess, ok := sessionMgr.Get(resp.SessionID)
+		if !ok || sess.Status != session.StatusRunning {
+			t.Errorf("proxy %s for %s should still be running", resp.SessionID, resp.ClusterHash)
+		}
+		if !isProxyListening(resp.Port) {
+			t.Errorf("proxy for %s not listening on %d", resp.ClusterHash, resp.Port)
+		}
+	}
+}
+
+func TestReserveProxyPort_CollidingClustersStartingTogether(t *testing.T) {
+	ln, err := net.Listen("tcp4", proxyBindAddress+":0")
+	if err != nil {
+		t.Skipf("IPv4 loopback unavailable: %v", err)
+	}
+	base := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+	if base >= 65535 || !isPortFree(base+1) {
+		t.Skip("could not find two free adjacent ports")
+	}
+
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	handler := &ProxyHandler{sessionMgr: sessionMgr, portMin: base, portMax: base + 1}
+
+	var hashes []string
+	wantPort := 0
+	for i := 0; len(hashes) < 2 && i < 100; i++ {
+		hash := cluster.ComputeHash("", fmt.Sprintf("ctx-%d", i))
+		port := handler.assignPortForCluster(hash)
+		if wantPort == 0 {
+			wantPort = port
+		}
+		if port == wantPort {
+			hashes = append(hashes, hash)
+		}
+	}
+	if len(hashes) < 2 {
+		t.Fatal("could not find two colliding cluster hashes")
+	}
+
+	// The first proxy is still starting: nothing listens yet and no session holds the port
+	logger := slog.Default()
+	first, releaseFirst := handler.reserveProxyPort(logger, hashes[0])
+	second, releaseSecond := handler.reserveProxyPort(logger, hashes[1])
+	if first != wantPort {
+		t.Errorf("first cluster got %d, want its preferred port %d", first, wantPort)
+	}
+	if second == 0 || second == first {
+		t.Errorf("second cluster got %d while %d is reserved, want the alternate port", second, first)
+	}
+
+	// Once released, the preferred port is available again
+	releaseFirst()
+	releaseSecond()
+	if port, release := handler.reserveProxyPort(logger, hashes[1]); port != wantPort {
+		t.Errorf("after release got %d, want %d", port, wantPort)
+	} else {
+		release()
+	}
+}
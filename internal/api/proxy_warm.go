@@ -0,0 +1,82 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/kubedeskpro/kubedesk-helper/internal/logging"
+)
+
+// proxyWarmTimeout bounds the warm-up request; longer than the health probe since a credential
+// plugin may run, but within the default HTTP_WRITE_TIMEOUT
+const proxyWarmTimeout = 10 * time.Second
+
+// ProxyWarmResponse reports the result of warming a cluster's proxy
+type ProxyWarmResponse struct {
+	ClusterHash string `json:"clusterHash"`
+	SessionID   string `json:"sessionId"`
+	Port        int    `json:"port"`
+	Warmed      bool   `json:"warmed"`               // The API server answered with a 2xx
+	StatusCode  int    `json:"statusCode,omitempty"` // Status of the warm-up request; 0 if nothing answered
+	LatencyMs   int64  `json:"latencyMs"`            // What the warm-up request took, saved from the first real one
+	Hint        string `json:"hint,omitempty"`       // Set when the credentials look expired
+	Error       string `json:"error,omitempty"`
+}
+
+// Warm handles POST /proxy/warm/{clusterHash}
+// Sends GET /version through the cluster's proxy so the TLS handshake, credential plugin and
+// connections to the proxy are set up before the app's first real request. 503 if no proxy is running
+func (h *ProxyHandler) Warm(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	clusterHash := mux.Vars(r)["clusterHash"]
+
+	// Held like a routed request, so cluster cleanup waits for the warm-up to finish
+	proxySession := h.runningProxy(clusterHash)
+	if proxySession == nil || !proxySession.BeginUse() {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"warmed":      false,
+			"clusterHash": clusterHash,
+			"error":       "No running proxy found for this cluster hash",
+			"action":      "Call POST /proxy/ensure with kubeconfig and context to start a proxy",
+		})
+		return
+	}
+	defer proxySession.EndUse()
+
+	// Same transport as /proxy/{clusterHash}/..., so the connection it opens is reused
+	var probe ProxyHealthResponse
+	probeProxy(r.Context(), proxySession.Port, proxyWarmTimeout, &probe)
+
+	resp := ProxyWarmResponse{
+		ClusterHash: clusterHash,
+		SessionID:   proxySession.ID,
+		Port:        proxySession.Port,
+		Warmed:      probe.Healthy,
+		StatusCode:  probe.StatusCode,
+		LatencyMs:   probe.LatencyMs,
+		Error:       probe.Error,
+	}
+	if probe.StatusCode != 0 {
+		if failures := proxySession.RecordUpstreamStatus(probe.StatusCode); probe.StatusCode == http.StatusUnauthorized || failures >= proxyAuthFailureThreshold {
+			resp.Hint = proxyAuthHint
+		}
+	}
+
+	if resp.Warmed {
+		logger.Info("Warmed proxy", "clusterHash", clusterHash, "port", proxySession.Port, "latencyMs", resp.LatencyMs)
+	} else {
+		logger.Warn("Proxy warm-up failed",
+			"clusterHash", clusterHash,
+			"port", proxySession.Port,
+			"statusCode", resp.StatusCode,
+			"error", resp.Error,
+		)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
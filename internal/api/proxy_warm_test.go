@@ -0,0 +1,72 @@
+package api
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/config"
+	"github.com/kubedeskpro/kubedesk-helper/internal/session"
+)
+
+func TestProxyWarm(t *testing.T) {
+	status := http.StatusOK
+	var requests int
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Method != http.MethodGet || r.URL.Path != "/version" {
+			t.Errorf("warm request = %s %s, want GET /version", r.Method, r.URL.Path)
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(`{"gitVersion":"v1.29.2"}`))
+	}))
+	defer upstream.Close()
+
+	_, portStr, _ := net.SplitHostPort(upstream.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	sess, _ := sessionMgr.CreateForCluster(session.TypeProxy, "abc123")
+	sess.Port = port
+	router := NewRouter("test", sessionMgr, config.Default())
+
+	warm := func(hash string) (*httptest.ResponseRecorder, ProxyWarmResponse) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/proxy/warm/"+hash, nil))
+		var resp ProxyWarmResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec, resp
+	}
+
+	rec, resp := warm("abc123")
+	if rec.Code != http.StatusOK || !resp.Warmed || resp.StatusCode != http.StatusOK || resp.LatencyMs < 0 {
+		t.Fatalf("running proxy: status = %d, response = %+v", rec.Code, resp)
+	}
+	if resp.SessionID != sess.ID || resp.Port != port || resp.Hint != "" {
+		t.Errorf("running proxy: response = %+v", resp)
+	}
+	if requests != 1 {
+		t.Errorf("upstream got %d requests, want 1", requests)
+	}
+	if sess.InUse() {
+		t.Error("session still marked in use after warming")
+	}
+
+	status = http.StatusUnauthorized // Credentials expired
+	rec, resp = warm("abc123")
+	if rec.Code != http.StatusOK || resp.Warmed || resp.StatusCode != http.StatusUnauthorized || resp.Hint != proxyAuthHint {
+		t.Errorf("expired credentials: status = %d, response = %+v", rec.Code, resp)
+	}
+
+	rec, resp = warm("ffffffffffffffff")
+	if rec.Code != http.StatusServiceUnavailable || resp.Warmed {
+		t.Errorf("no proxy: status = %d, response = %+v, want 503", rec.Code, resp)
+	}
+	if requests != 2 {
+		t.Errorf("upstream got %d requests, want 2", requests)
+	}
+}
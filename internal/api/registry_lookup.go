@@ -0,0 +1,72 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/cluster"
+)
+
+// ErrCodeClusterNotRegistered is the stable error code for a hash-only request whose cluster
+// the helper doesn't know (usually after a restart); the app should resend kubeconfig and context
+const ErrCodeClusterNotRegistered = "CLUSTER_NOT_REGISTERED"
+
+// Registry miss message and recovery action, shared by every handler
+const (
+	registryMissMessage = "Cluster hash not found in registry. Please provide kubeconfig and context in the request."
+	registryMissAction  = "Resend the request with kubeconfig (or kubeconfigPath) and context"
+)
+
+// RegistryMissError is the JSON body returned when a hash-only request names an unknown cluster
+type RegistryMissError struct {
+	Error       string `json:"error"`
+	Code        string `json:"code"` // Always ErrCodeClusterNotRegistered
+	ClusterHash string `json:"clusterHash"`
+	Action      string `json:"action"`
+	Recoverable bool   `json:"recoverable"` // Retrying with full credentials will succeed
+}
+
+// resolveHashOnly fills in kubeconfig and context from the cluster registry when a request
+// sent only a clusterHash. Returns false if the hash isn't registered; the caller should
+// then respond with writeRegistryMiss
+func resolveHashOnly(logger *slog.Logger, kubeconfigContent, kubeContext *string, clusterHash string) bool {
+	if *kubeconfigContent != "" || *kubeContext != "" || clusterHash == "" {
+		return true
+	}
+
+	regKubeconfig, regContext, found := cluster.GetRegistry().Lookup(clusterHash)
+	if !found {
+		logger.Error("Cluster hash not found in registry and kubeconfig/context not provided",
+			"providedHash", clusterHash,
+			"hint", "This usually happens after helper restart. App should send kubeconfig and context.",
+		)
+		return false
+	}
+
+	*kubeconfigContent = regKubeconfig
+	*kubeContext = regContext
+	logger.Info("Looked up cluster info from registry",
+		"clusterHash", clusterHash,
+		"context", regContext,
+	)
+	return true
+}
+
+// newRegistryMissError builds the recoverable registry miss error for clusterHash
+func newRegistryMissError(clusterHash string) RegistryMissError {
+	return RegistryMissError{
+		Error:       registryMissMessage,
+		Code:        ErrCodeClusterNotRegistered,
+		ClusterHash: clusterHash,
+		Action:      registryMissAction,
+		Recoverable: true,
+	}
+}
+
+// writeRegistryMiss responds 400 with a RegistryMissError
+func writeRegistryMiss(w http.ResponseWriter, clusterHash string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(newRegistryMissError(clusterHash))
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/config"
+	"github.com/kubedeskpro/kubedesk-helper/internal/session"
+)
+
+// TestRegistryMiss_SameErrorEverywhere simulates a helper restart: a fresh manager and
+// an unregistered hash. Every hash-only endpoint must return the same recoverable error
+func TestRegistryMiss_SameErrorEverywhere(t *testing.T) {
+	const hash = "ffffffffffffffff" // Never registered
+	router := NewRouter("test", session.NewManager(), config.Default())
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+	}{
+		{"kubectl", http.MethodPost, "/kubectl", `{"args":["get","pods"],"clusterHash":"` + hash + `"}`},
+		{"kubectl batch", http.MethodPost, "/kubectl/batch", `{"commands":[{"args":["get","pods"]}],"clusterHash":"` + hash + `"}`},
+		{"kubectl delete", http.MethodPost, "/kubectl/delete", `{"dryRun":true,"resources":[{"type":"pods","name":"web"}],"clusterHash":"` + hash + `"}`},
+		{"kubectl apply", http.MethodPost, "/kubectl/apply", `{"manifest":"kind: ConfigMap","clusterHash":"` + hash + `"}`},
+		{"exec", http.MethodPost, "/exec", `{"namespace":"default","podName":"web","command":["ls"],"clusterHash":"` + hash + `"}`},
+		{"exec start", http.MethodPost, "/exec/start", `{"namespace":"default","podName":"web","command":["sh"],"clusterHash":"` + hash + `"}`},
+		{"shell start", http.MethodPost, "/shell/start", `{"command":"kubectl get pods","clusterHash":"` + hash + `"}`},
+		{"shell run", http.MethodPost, "/shell/run", `{"command":"kubectl get pods","clusterHash":"` + hash + `"}`},
+		{"port-forward", http.MethodPost, "/port-forward/start", `{"namespace":"default","resourceName":"web","servicePort":"80","localPort":"8080","clusterHash":"` + hash + `"}`},
+		{"pod containers", http.MethodGet, "/pods/containers?namespace=default&pod=web&clusterHash=" + hash, ""},
+		{"resource", http.MethodGet, "/resource?version=v1&kind=Pod&namespace=default&name=web&clusterHash=" + hash, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400: %s", rec.Code, rec.Body.String())
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", ct)
+			}
+
+			var resp RegistryMissError
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode: %v: %s", err, rec.Body.String())
+			}
+			if resp != newRegistryMissError(hash) {
+				t.Errorf("response = %+v, want %+v", resp, newRegistryMissError(hash))
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package api
+
+import (
+	"log/slog"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/cluster"
+	"github.com/kubedeskpro/kubedesk-helper/internal/config"
+	"github.com/kubedeskpro/kubedesk-helper/internal/kubectl"
+	"github.com/kubedeskpro/kubedesk-helper/internal/session"
+)
+
+// ApplyConfig applies the settings that can change while the helper runs, at startup and on
+// SIGHUP. Running sessions are kept: a lower MAX_SESSIONS only refuses new ones
+// The log level and shutdown timeout are owned by main
+func ApplyConfig(cfg *config.Config, sessionMgr *session.Manager) {
+	kubectl.SetMaxOutputBytes(cfg.MaxOutputBytes)
+	sessionMgr.SetMaxSessions(cfg.MaxSessions)
+	cluster.GetRegistry().SetLimits(cfg.RegistryMaxEntries, cfg.RegistryTTL)
+	SetExecAuthEnvAllow(cfg.ExecAuthEnvAllow)
+	SetVersionSkewCheck(cfg.KubectlVersionCheck)
+
+	limits := ShellLimits{MemoryMB: cfg.ShellMaxMemoryMB, CPUSeconds: cfg.ShellMaxCPUSeconds, OpenFiles: cfg.ShellMaxOpenFiles}
+	if limits != (ShellLimits{}) && !shellLimitsSupported {
+		slog.Warn("Shell resource limits are only applied on Linux; ignoring them", "limits", limits)
+	}
+	SetShellLimits(limits)
+}
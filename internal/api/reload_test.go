@@ -0,0 +1,77 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/cluster"
+	"github.com/kubedeskpro/kubedesk-helper/internal/config"
+	"github.com/kubedeskpro/kubedesk-helper/internal/kubectl"
+	"github.com/kubedeskpro/kubedesk-helper/internal/session"
+)
+
+func TestApplyConfig_Reload(t *testing.T) {
+	origMax, origAllow := kubectl.MaxOutputBytes(), extraAllowedEnv()
+	t.Cleanup(func() {
+		kubectl.SetMaxOutputBytes(origMax)
+		SetExecAuthEnvAllow(origAllow)
+		cluster.GetRegistry().SetLimits(0, 0)
+	})
+
+	path := filepath.Join(t.TempDir(), "helper.yaml")
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HELPER_CONFIG", path)
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	ApplyConfig(cfg, sessionMgr)
+	var running []*session.Session
+	for i := 0; i < 2; i++ {
+		sess, err := sessionMgr.Create(session.TypeExec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		running = append(running, sess)
+	}
+
+	settings := "maxSessions: 1\nmaxOutputBytes: 1024\nexecAuthEnvAllow: [VAULT_*]\nproxyPortMin: 30000\n"
+	if err := os.WriteFile(path, []byte(settings), 0600); err != nil {
+		t.Fatal(err)
+	}
+	next, _, err := config.Reload(cfg)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	ApplyConfig(next, sessionMgr)
+
+	if got := kubectl.MaxOutputBytes(); got != 1024 {
+		t.Errorf("MaxOutputBytes = %d, want 1024", got)
+	}
+	if next.ProxyPortMin != cfg.ProxyPortMin {
+		t.Errorf("ProxyPortMin changed to %d without a restart", next.ProxyPortMin)
+	}
+
+	// Sessions over the new limit keep running; new ones are refused
+	for _, sess := range running {
+		if got, ok := sessionMgr.Get(sess.ID); !ok || got.Status != session.StatusRunning {
+			t.Errorf("session %s dropped by reload", sess.ID)
+		}
+	}
+	if _, err := sessionMgr.Create(session.TypeExec); !errors.Is(err, session.ErrTooManySessions) {
+		t.Errorf("Create after lowering MAX_SESSIONS: got %v, want ErrTooManySessions", err)
+	}
+
+	rec := postExecAuth(t, &ExecAuthHandler{}, ExecAuthRequest{Command: "true", Env: map[string]string{"VAULT_ADDR": "https://vault"}})
+	if rec.Code != http.StatusOK {
+		t.Errorf("exec-auth with reloaded allow-list: status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"regexp"
+
+	"github.com/google/uuid"
+	"github.com/kubedeskpro/kubedesk-helper/internal/logging"
+)
+
+// requestIDHeader carries the request ID in both directions
+const requestIDHeader = "X-Request-ID"
+
+// requestIDRe limits client-supplied request IDs to something safe to echo and log
+var requestIDRe = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+
+// requestIDMiddleware tags each request with an ID, taken from X-Request-ID or generated,
+// and returns it in the response header. Handlers log through logging.FromContext, so every
+// line they write for the request carries it as requestId
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !requestIDRe.MatchString(id) {
+			id = uuid.NewString()
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		logger := slog.Default().With("requestId", id)
+		next.ServeHTTP(w, r.WithContext(logging.NewContext(r.Context(), logger)))
+	})
+}
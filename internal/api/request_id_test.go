@@ -0,0 +1,82 @@
+package api
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/logging"
+)
+
+// syncBuffer is a bytes.Buffer safe to share with goroutines of earlier tests that still log,
+// such as proxy monitors reaping a killed kubectl
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func (b *syncBuffer) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf.Reset()
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var logs syncBuffer
+	orig := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(orig) })
+
+	handler := requestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logging.FromContext(r.Context()).Info("handling")
+	}))
+
+	tests := []struct {
+		name   string
+		header string
+		keep   bool
+	}{
+		{"client id", "app-42.retry:1", true},
+		{"generated", "", false},
+		{"unsafe client id", "evil\" injected=1", false},
+		{"too long", strings.Repeat("a", 65), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs.Reset()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(requestIDHeader, tt.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			id := rec.Header().Get(requestIDHeader)
+			if tt.keep && id != tt.header {
+				t.Errorf("%s = %q, want the client's %q", requestIDHeader, id, tt.header)
+			}
+			if !tt.keep && (id == "" || id == tt.header) {
+				t.Errorf("%s = %q, want a generated ID", requestIDHeader, id)
+			}
+			if !strings.Contains(logs.String(), "requestId="+id) {
+				t.Errorf("log = %q, want requestId=%s", logs.String(), id)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/cluster"
+	"github.com/kubedeskpro/kubedesk-helper/internal/kubeconfig"
+	"github.com/kubedeskpro/kubedesk-helper/internal/kubectl"
+	"github.com/kubedeskpro/kubedesk-helper/internal/logging"
+)
+
+// resourceGetTimeout bounds the "kubectl get --raw" behind /resource
+const resourceGetTimeout = 10 * time.Second
+
+// Accepted /resource query values; they end up in an API path, so anything else is rejected
+var (
+	resourceGroupRe   = regexp.MustCompile(`^[a-z0-9]([-a-z0-9.]*[a-z0-9])?$`)
+	resourceVersionRe = regexp.MustCompile(`^v[0-9]+((alpha|beta)[0-9]+)?$`)
+	resourceKindRe    = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*$`)
+	resourcePluralRe  = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+)
+
+// irregularResources maps kinds whose resource name isn't the guessed plural
+var irregularResources = map[string]string{
+	"endpoints": "endpoints",
+}
+
+// ResourceHandler fetches single Kubernetes objects by group, version, kind and name
+type ResourceHandler struct{}
+
+// Get handles GET /resource?group=&version=&kind=&namespace=&name=&context=&clusterHash=&kubeconfigPath=
+// The object is returned as-is. kind is mapped to its resource name by the usual plural rules;
+// pass resource instead for custom resources whose plural isn't the guessed one. An unknown
+// resource type is a 404 as well, since the API server can't tell the two apart
+func (h *ResourceHandler) Get(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	q := r.URL.Query()
+	group := q.Get("group")
+	version := q.Get("version")
+	kind := q.Get("kind")
+	resource := q.Get("resource")
+	namespace := q.Get("namespace")
+	name := q.Get("name")
+	kubeContext := q.Get("context")
+	clusterHash := q.Get("clusterHash")
+	kubeconfigPath := q.Get("kubeconfigPath")
+
+	if version == "" || name == "" || (kind == "" && resource == "") {
+		http.Error(w, "Missing required query parameters: version, kind (or resource), name", http.StatusBadRequest)
+		return
+	}
+	if resource == "" {
+		if !resourceKindRe.MatchString(kind) {
+			http.Error(w, fmt.Sprintf("Invalid kind %q", kind), http.StatusBadRequest)
+			return
+		}
+		resource = kindToResource(kind)
+	}
+	apiPath, err := resourceAPIPath(group, version, resource, namespace, name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var kubeconfigContent string
+	if status, msg := loadKubeconfigPath(&kubeconfigContent, kubeconfigPath); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	// Kubeconfig content can't travel in a query string, so it comes from kubeconfigPath or the cluster registry
+	if kubeconfigContent == "" {
+		var regContext string
+		if !resolveHashOnly(logger, &kubeconfigContent, &regContext, clusterHash) {
+			writeRegistryMiss(w, clusterHash)
+			return
+		}
+		if kubeContext == "" {
+			kubeContext = regContext
+		}
+	}
+	if err := checkKubeconfigContext(kubeconfigContent, kubeContext); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if clusterHash == "" {
+		clusterHash = cluster.ComputeHash(kubeconfigContent, kubeContext)
+	}
+	if !cluster.ValidateHash(clusterHash, kubeconfigContent, kubeContext) {
+		logger.Error("Cluster hash validation failed", "providedHash", clusterHash, "path", apiPath)
+		http.Error(w, "Cluster hash validation failed", http.StatusBadRequest)
+		return
+	}
+
+	var kubeconfigFile string
+	if kubeconfigContent != "" {
+		tmpFile, release, err := kubeconfig.GetTempManager().AcquireFile(clusterHash, kubeconfigContent, kubeconfigPath)
+		if err != nil {
+			logger.Error("Failed to write kubeconfig", "error", err)
+			http.Error(w, "Failed to write kubeconfig", http.StatusInternalServerError)
+			return
+		}
+		defer release()
+		kubeconfigFile = tmpFile
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), resourceGetTimeout)
+	defer cancel()
+
+	result, err := kubectl.ExecuteWithKubeconfigFile(ctx, []string{"get", "--raw", apiPath}, kubeconfigFile, kubeContext)
+	if err != nil {
+		logger.Error("Failed to run kubectl for resource", "error", err, "path", apiPath)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result.ExitCode != 0 {
+		if isNotFoundError(result.Stderr) {
+			http.Error(w, fmt.Sprintf("%s %q not found%s", qualifiedResource(resource, group), name, inNamespace(namespace)), http.StatusNotFound)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Failed to get %s %q%s: %s", qualifiedResource(resource, group), name, inNamespace(namespace), strings.TrimSpace(result.Stderr)), http.StatusBadGateway)
+		return
+	}
+	if result.Truncated {
+		http.Error(w, fmt.Sprintf("%s %q exceeds the output limit", qualifiedResource(resource, group), name), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(result.Stdout))
+}
+
+// resourceAPIPath builds the API server path of one object: /api/v1/... for the core group,
+// /apis/<group>/<version>/... otherwise; an empty namespace addresses a cluster-scoped object
+func resourceAPIPath(group, version, resource, namespace, name string) (string, error) {
+	if group != "" && !resourceGroupRe.MatchString(group) {
+		return "", fmt.Errorf("invalid group %q", group)
+	}
+	if !resourceVersionRe.MatchString(version) {
+		return "", fmt.Errorf("invalid version %q", version)
+	}
+	if !resourcePluralRe.MatchString(resource) {
+		return "", fmt.Errorf("invalid resource %q", resource)
+	}
+	if namespace != "" && !watchNamespaceRe.MatchString(namespace) {
+		return "", fmt.Errorf("invalid namespace %q", namespace)
+	}
+	// Object names are path segments; RBAC names may contain ':' but never '/'
+	if name == "." || name == ".." || strings.ContainsAny(name, "/%?# \t\r\n") {
+		return "", fmt.Errorf("invalid name %q", name)
+	}
+
+	path := "/api/" + version
+	if group != "" {
+		path = "/apis/" + group + "/" + version
+	}
+	if namespace != "" {
+		path += "/namespaces/" + namespace
+	}
+	return path + "/" + resource + "/" + name, nil
+}
+
+// kindToResource guesses a kind's resource name the way Kubernetes client tooling does:
+// lowercase and pluralize (Ingress -> ingresses, NetworkPolicy -> networkpolicies)
+func kindToResource(kind string) string {
+	singular := strings.ToLower(kind)
+	if resource, ok := irregularResources[singular]; ok {
+		return resource
+	}
+	switch {
+	case strings.HasSuffix(singular, "s"):
+		return singular + "es"
+	case strings.HasSuffix(singular, "y"):
+		return strings.TrimSuffix(singular, "y") + "ies"
+	}
+	return singular + "s"
+}
+
+// qualifiedResource formats a resource kubectl-style, e.g. "deployments.apps"
+func qualifiedResource(resource, group string) string {
+	if group == "" {
+		return resource
+	}
+	return resource + "." + group
+}
+
+// inNamespace returns " in namespace <ns>" for error messages, or "" for cluster-scoped objects
+func inNamespace(namespace string) string {
+	if namespace == "" {
+		return ""
+	}
+	return " in namespace " + namespace
+}
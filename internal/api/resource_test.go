@@ -0,0 +1,108 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResourceAPIPath(t *testing.T) {
+	tests := []struct {
+		name                                   string
+		group, version, resource, namespace, n string
+		want                                   string
+		wantErr                                bool
+	}{
+		{"core namespaced", "", "v1", "pods", "default", "web", "/api/v1/namespaces/default/pods/web", false},
+		{"named group", "apps", "v1", "deployments", "team-a", "web", "/apis/apps/v1/namespaces/team-a/deployments/web", false},
+		{"cluster-scoped", "", "v1", "nodes", "", "node-1", "/api/v1/nodes/node-1", false},
+		{"rbac name", "rbac.authorization.k8s.io", "v1", "clusterroles", "", "system:controller:job-controller", "/apis/rbac.authorization.k8s.io/v1/clusterroles/system:controller:job-controller", false},
+		{"beta version", "example.com", "v1beta1", "widgets", "default", "w", "/apis/example.com/v1beta1/namespaces/default/widgets/w", false},
+		{"bad version", "apps", "1", "deployments", "default", "web", "", true},
+		{"bad group", "Apps", "v1", "deployments", "default", "web", "", true},
+		{"bad namespace", "", "v1", "pods", "../kube-system", "web", "", true},
+		{"name with slash", "", "v1", "pods", "default", "web/exec", "", true},
+		{"dot-dot name", "", "v1", "pods", "default", "..", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resourceAPIPath(tt.group, tt.version, tt.resource, tt.namespace, tt.n)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("path = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKindToResource(t *testing.T) {
+	for kind, want := range map[string]string{
+		"Pod":           "pods",
+		"Deployment":    "deployments",
+		"Ingress":       "ingresses",
+		"NetworkPolicy": "networkpolicies",
+		"Endpoints":     "endpoints",
+	} {
+		if got := kindToResource(kind); got != want {
+			t.Errorf("kindToResource(%q) = %q, want %q", kind, got, want)
+		}
+	}
+}
+
+func TestResourceGet(t *testing.T) {
+	installFakeKubectl(t, `case "$*" in
+  *"get --raw /apis/apps/v1/namespaces/default/deployments/web") echo '{"kind":"Deployment","metadata":{"name":"web"}}' ;;
+  *"get --raw /api/v1/namespaces/default/pods/flaky") echo 'Unable to connect to the server' >&2; exit 1 ;;
+  *) echo 'Error from server (NotFound): the server could not find the requested resource' >&2; exit 1 ;;
+esac
+`)
+
+	kubeconfigPath := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(kubeconfigPath, []byte(testKubeconfigYAML), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := &ResourceHandler{}
+	get := func(params url.Values) *httptest.ResponseRecorder {
+		params.Set("kubeconfigPath", kubeconfigPath)
+		rec := httptest.NewRecorder()
+		handler.Get(rec, httptest.NewRequest(http.MethodGet, "/resource?"+params.Encode(), nil))
+		return rec
+	}
+
+	rec := get(url.Values{"group": {"apps"}, "version": {"v1"}, "kind": {"Deployment"}, "namespace": {"default"}, "name": {"web"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	if !strings.Contains(rec.Body.String(), `"kind":"Deployment"`) {
+		t.Errorf("body = %s, want the object", rec.Body.String())
+	}
+
+	rec = get(url.Values{"group": {"apps"}, "version": {"v1"}, "resource": {"deployments"}, "namespace": {"default"}, "name": {"missing"}})
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("missing object: status = %d, want 404", rec.Code)
+	}
+	if want := `deployments.apps "missing" not found in namespace default`; !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("missing object: body = %q, want %q", rec.Body.String(), want)
+	}
+
+	if rec := get(url.Values{"version": {"v1"}, "kind": {"Pod"}, "namespace": {"default"}, "name": {"flaky"}}); rec.Code != http.StatusBadGateway {
+		t.Errorf("kubectl failure: status = %d, want 502", rec.Code)
+	}
+	if rec := get(url.Values{"version": {"v1"}, "kind": {"Pod"}}); rec.Code != http.StatusBadRequest {
+		t.Errorf("no name: status = %d, want 400", rec.Code)
+	}
+	if rec := get(url.Values{"version": {"v1"}, "kind": {"Pod"}, "namespace": {"default"}, "name": {"web/exec"}}); rec.Code != http.StatusBadRequest {
+		t.Errorf("name with slash: status = %d, want 400", rec.Code)
+	}
+}
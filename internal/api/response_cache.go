@@ -0,0 +1,144 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Response cache limits; large list responses are passed through rather than cached
+const (
+	maxCachedResponseBody = 1 << 20
+	maxCachedResponses    = 512
+)
+
+// cacheHeader tells the app whether a response was served from the cache ("HIT") or fetched ("MISS")
+const cacheHeader = "X-Cache"
+
+// perRequestHeaders describe one request rather than the response and are never cached or replayed
+var perRequestHeaders = []string{requestIDHeader, cacheHeader, authHintHeader, versionSkewHeader}
+
+// readOnlyKubectlVerbs are the /kubectl commands whose successful output may be cached
+var readOnlyKubectlVerbs = map[string]bool{
+	"get":           true,
+	"api-versions":  true,
+	"api-resources": true,
+	"version":       true,
+	"explain":       true,
+}
+
+// cachedResponse is a stored response body with the headers needed to replay it
+type cachedResponse struct {
+	statusCode int
+	header     http.Header
+	body       []byte
+	expires    time.Time
+}
+
+// responseCache is a small TTL cache for read-only responses, shared by the proxy router and /kubectl
+// A nil *responseCache is valid and caches nothing
+type responseCache struct {
+	ttl     time.Duration
+	now     func() time.Time // Overridden in tests
+	mu      sync.Mutex
+	entries map[string]*cachedResponse
+}
+
+// newResponseCache returns a cache with the given TTL, or nil (caching disabled) if ttl <= 0
+func newResponseCache(ttl time.Duration) *responseCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &responseCache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]*cachedResponse),
+	}
+}
+
+// responseCacheKey builds a key from the cluster and request; query parameters are sorted
+// so equivalent requests share an entry
+func responseCacheKey(clusterHash, method, path string, query url.Values) string {
+	return clusterHash + "\x00" + method + "\x00" + path + "\x00" + query.Encode()
+}
+
+// get returns a live entry for key
+func (c *responseCache) get(key string) (*cachedResponse, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !c.now().Before(entry.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return entry, true
+}
+
+// set stores a successful response; non-2xx and oversized bodies are ignored
+func (c *responseCache) set(key string, statusCode int, header http.Header, body []byte) {
+	if c == nil || statusCode < 200 || statusCode > 299 || len(body) > maxCachedResponseBody {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if len(c.entries) >= maxCachedResponses {
+		for k, entry := range c.entries {
+			if !now.Before(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= maxCachedResponses {
+			return // Full of live entries; they expire within one TTL
+		}
+	}
+
+	header = header.Clone()
+	for _, name := range perRequestHeaders {
+		header.Del(name)
+	}
+	c.entries[key] = &cachedResponse{
+		statusCode: statusCode,
+		header:     header,
+		body:       body,
+		expires:    now.Add(c.ttl),
+	}
+}
+
+// write replays a cached response
+func (e *cachedResponse) write(w http.ResponseWriter) {
+	for key, values := range e.header {
+		w.Header()[key] = append([]string(nil), values...)
+	}
+	w.Header().Set(cacheHeader, "HIT")
+	w.WriteHeader(e.statusCode)
+	w.Write(e.body)
+}
+
+// isStreamingQuery reports whether an API server request streams (watch, log follow) and must not be cached
+func isStreamingQuery(query url.Values) bool {
+	return query.Get("watch") == "true" || query.Get("watch") == "1" || query.Get("follow") == "true"
+}
+
+// isCacheableKubectl reports whether a /kubectl command is read-only and non-streaming
+func isCacheableKubectl(args []string) bool {
+	if len(args) == 0 || !readOnlyKubectlVerbs[args[0]] {
+		return false
+	}
+	for _, arg := range args[1:] {
+		if arg == "-w" || arg == "--watch" || arg == "--watch-only" || strings.HasPrefix(arg, "--watch=") {
+			return false
+		}
+	}
+	return true
+}
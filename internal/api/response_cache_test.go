@@ -0,0 +1,223 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/kubedeskpro/kubedesk-helper/internal/session"
+)
+
+func TestResponseCache_TTL(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	c := newResponseCache(10 * time.Second)
+	c.now = func() time.Time { return now }
+
+	key := responseCacheKey("abc123", http.MethodGet, "/api/v1/namespaces", url.Values{"limit": {"5"}})
+	if _, ok := c.get(key); ok {
+		t.Fatal("expected miss on empty cache")
+	}
+
+	c.set(key, http.StatusOK, http.Header{"Content-Type": {"application/json"}}, []byte(`{"kind":"NamespaceList"}`))
+	entry, ok := c.get(key)
+	if !ok || string(entry.body) != `{"kind":"NamespaceList"}` {
+		t.Fatalf("expected hit, got %v %+v", ok, entry)
+	}
+
+	now = now.Add(10 * time.Second)
+	if _, ok := c.get(key); ok {
+		t.Error("expected entry to expire after the TTL")
+	}
+
+	c.set(key, http.StatusNotFound, nil, []byte("not found"))
+	if _, ok := c.get(key); ok {
+		t.Error("non-2xx responses must not be cached")
+	}
+
+	// Query parameter order doesn't matter
+	a := responseCacheKey("abc123", http.MethodGet, "/api", url.Values{"a": {"1"}, "b": {"2"}})
+	b, _ := url.ParseQuery("b=2&a=1")
+	if a != responseCacheKey("abc123", http.MethodGet, "/api", b) {
+		t.Error("expected equivalent queries to share a key")
+	}
+
+	// Disabled cache is a nil no-op
+	disabled := newResponseCache(0)
+	disabled.set(key, http.StatusOK, nil, []byte("x"))
+	if _, ok := disabled.get(key); ok {
+		t.Error("disabled cache must not return entries")
+	}
+}
+
+func TestIsCacheableKubectl(t *testing.T) {
+	for args, want := range map[string]bool{
+		"get namespaces":        true,
+		"api-resources":         true,
+		"get pods -w":           false,
+		"get pods --watch=true": false,
+		"delete pod web":        false,
+		"logs web":              false,
+	} {
+		if got := isCacheableKubectl(strings.Fields(args)); got != want {
+			t.Errorf("isCacheableKubectl(%q) = %v, want %v", args, got, want)
+		}
+	}
+}
+
+func TestProxyRoute_ResponseCache(t *testing.T) {
+	var hits atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := hits.Add(1)
+		if r.URL.Path == "/api/v1/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"n":` + strconv.Itoa(int(n)) + `}`))
+	}))
+	defer upstream.Close()
+
+	_, portStr, _ := net.SplitHostPort(upstream.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	sess, _ := sessionMgr.CreateForCluster(session.TypeProxy, "abc123")
+	sess.Port = port
+
+	handler := NewProxyRouterHandler(sessionMgr)
+	handler.cache = newResponseCache(time.Minute)
+	router := mux.NewRouter()
+	router.PathPrefix("/proxy/{clusterHash}/").HandlerFunc(handler.Route)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	first := get("/proxy/abc123/api/v1/namespaces")
+	second := get("/proxy/abc123/api/v1/namespaces")
+	if first.Header().Get("X-Cache") != "MISS" || second.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("X-Cache = %q then %q, want MISS then HIT", first.Header().Get("X-Cache"), second.Header().Get("X-Cache"))
+	}
+	if second.Body.String() != `{"n":1}` || second.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("cached response = %q (%s), want the first body", second.Body.String(), second.Header().Get("Content-Type"))
+	}
+
+	// noCache bypasses and refreshes the entry
+	if rec := get("/proxy/abc123/api/v1/namespaces?noCache=true"); rec.Header().Get("X-Cache") != "MISS" || rec.Body.String() != `{"n":2}` {
+		t.Errorf("noCache: X-Cache %q body %q", rec.Header().Get("X-Cache"), rec.Body.String())
+	}
+	if rec := get("/proxy/abc123/api/v1/namespaces"); rec.Body.String() != `{"n":2}` {
+		t.Errorf("after noCache: body %q, want refreshed entry", rec.Body.String())
+	}
+
+	// Watches and errors are never served from the cache
+	get("/proxy/abc123/api/v1/pods?watch=true")
+	if rec := get("/proxy/abc123/api/v1/pods?watch=true"); rec.Header().Get("X-Cache") != "" {
+		t.Errorf("watch request got X-Cache %q", rec.Header().Get("X-Cache"))
+	}
+	get("/proxy/abc123/api/v1/missing")
+	if rec := get("/proxy/abc123/api/v1/missing"); rec.Code != http.StatusNotFound || rec.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("error response: status %d X-Cache %q", rec.Code, rec.Header().Get("X-Cache"))
+	}
+	if got := hits.Load(); got != 6 {
+		t.Errorf("upstream hits = %d, want 6", got)
+	}
+}
+
+func TestProxyRoute_ResponseCacheKeepsRequestID(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"kind":"NamespaceList"}`))
+	}))
+	defer upstream.Close()
+
+	_, portStr, _ := net.SplitHostPort(upstream.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	sess, _ := sessionMgr.CreateForCluster(session.TypeProxy, "abc123")
+	sess.Port = port
+
+	handler := NewProxyRouterHandler(sessionMgr)
+	handler.cache = newResponseCache(time.Minute)
+	router := mux.NewRouter()
+	router.Use(requestIDMiddleware)
+	router.PathPrefix("/proxy/{clusterHash}/").HandlerFunc(handler.Route)
+
+	get := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/proxy/abc123/api/v1/namespaces", nil)
+		req.Header.Set(requestIDHeader, id)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := get("first")
+	second := get("second")
+	if second.Header().Get(cacheHeader) != "HIT" {
+		t.Fatalf("second request X-Cache = %q, want HIT", second.Header().Get(cacheHeader))
+	}
+	if got := first.Header().Get(requestIDHeader); got != "first" {
+		t.Errorf("first request X-Request-ID = %q, want first", got)
+	}
+	if got := second.Header().Values(requestIDHeader); len(got) != 1 || got[0] != "second" {
+		t.Errorf("cache hit X-Request-ID = %q, want [second]", got)
+	}
+	if second.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("cache hit lost upstream Content-Type: %q", second.Header().Get("Content-Type"))
+	}
+
+	// Per-request headers are dropped even when a caller passes them to set
+	handler.cache.set("k", http.StatusOK, http.Header{requestIDHeader: {"x"}, versionSkewHeader: {"y"}, "Etag": {"z"}}, nil)
+	entry, _ := handler.cache.get("k")
+	if entry.header.Get(requestIDHeader) != "" || entry.header.Get(versionSkewHeader) != "" || entry.header.Get("Etag") != "z" {
+		t.Errorf("cached header = %v, want only Etag", entry.header)
+	}
+}
+
+func TestKubectl_ResponseCache(t *testing.T) {
+	counter := filepath.Join(t.TempDir(), "runs")
+	installFakeKubectl(t, `n=$(cat '`+counter+`' 2>/dev/null || echo 0)
+n=$((n+1))
+echo $n > '`+counter+`'
+echo "run $n"
+`)
+
+	handler := &KubectlHandler{cache: newResponseCache(time.Minute)}
+	run := func(args, query string) *httptest.ResponseRecorder {
+		body := `{"args":["` + strings.Join(strings.Fields(args), `","`) + `"],"context":"dev"}`
+		rec := httptest.NewRecorder()
+		handler.Handle(rec, httptest.NewRequest(http.MethodPost, "/kubectl"+query, strings.NewReader(body)))
+		return rec
+	}
+
+	run("get namespaces", "")
+	rec := run("get namespaces", "")
+	if rec.Header().Get("X-Cache") != "HIT" || !strings.Contains(rec.Body.String(), "run 1") {
+		t.Errorf("X-Cache %q body %s, want cached first run", rec.Header().Get("X-Cache"), rec.Body.String())
+	}
+	if rec := run("get namespaces", "?noCache=true"); rec.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("noCache: X-Cache = %q, want MISS", rec.Header().Get("X-Cache"))
+	}
+	if rec := run("delete pod web", ""); rec.Header().Get("X-Cache") != "" {
+		t.Errorf("mutating command got X-Cache %q", rec.Header().Get("X-Cache"))
+	}
+
+	runs, _ := os.ReadFile(counter)
+	if strings.TrimSpace(string(runs)) != "3" {
+		t.Errorf("kubectl ran %s times, want 3", strings.TrimSpace(string(runs)))
+	}
+}
@@ -1,33 +1,82 @@
 package api
 
 import (
+	"time"
+
 	"github.com/gorilla/mux"
+	"github.com/kubedeskpro/kubedesk-helper/internal/config"
+	"github.com/kubedeskpro/kubedesk-helper/internal/kubeconfig"
+	"github.com/kubedeskpro/kubedesk-helper/internal/metrics"
 	"github.com/kubedeskpro/kubedesk-helper/internal/session"
 )
 
 // NewRouter creates and configures the HTTP router
-func NewRouter(version string, sessionMgr *session.Manager) *mux.Router {
+func NewRouter(version string, sessionMgr *session.Manager, cfg *config.Config) *mux.Router {
 	r := mux.NewRouter()
 
 	// Create handlers
-	healthHandler := &HealthHandler{version: version}
-	kubectlHandler := &KubectlHandler{}
+	healthHandler := &HealthHandler{version: version, cfg: cfg, temp: kubeconfig.GetTempManager()}
+	statusHandler := &StatusHandler{version: version, startedAt: time.Now(), sessionMgr: sessionMgr}
+	metricsHandler := &MetricsHandler{recorder: metrics.GetRecorder()}
+	responseCache := newResponseCache(cfg.ResponseCacheTTL) // nil (disabled) unless RESPONSE_CACHE_TTL is set
+	kubectlHandler := &KubectlHandler{cache: responseCache, strictArgs: cfg.KubectlStrictArgs}
 	execAuthHandler := &ExecAuthHandler{}
+	configHandler := &ConfigHandler{}
+	clusterHashHandler := &ClusterHashHandler{}
+	podsHandler := &PodsHandler{}
+	resourceHandler := &ResourceHandler{}
 	shellHandler := &ShellHandler{sessionMgr: sessionMgr}
 	portForwardHandler := &PortForwardHandler{sessionMgr: sessionMgr}
 	execHandler := &ExecHandler{sessionMgr: sessionMgr}
-	proxyHandler := &ProxyHandler{sessionMgr: sessionMgr}
+	proxyHandler := &ProxyHandler{
+		sessionMgr: sessionMgr,
+		portMin:    cfg.ProxyPortMin,
+		portMax:    cfg.ProxyPortMax,
+
+		readyTimeout:  cfg.ProxyReadyTimeout,
+		readyInterval: cfg.ProxyReadyInterval,
+
+		maxProxies: cfg.MaxProxies,
+
+		pids: newProxyPIDFile(cfg.ProxyPIDFile),
+	}
 	sessionCleanupHandler := NewSessionCleanupHandler(sessionMgr)
+	eventsHandler := &EventsHandler{sessionMgr: sessionMgr}
+	watchHandler := &WatchHandler{sessionMgr: sessionMgr}
+	debugHandler := &DebugHandler{sessionMgr: sessionMgr, token: cfg.DebugToken}
+
+	// Every matched request gets an X-Request-ID and a logger tagged with it
+	r.Use(requestIDMiddleware)
 
 	// Existing API endpoints (backward compatibility)
 	r.HandleFunc("/health", healthHandler.Handle).Methods("GET")
+	r.HandleFunc("/status", statusHandler.Handle).Methods("GET") // Diagnostics; keep probes on /health
+	r.HandleFunc("/metrics", metricsHandler.Handle).Methods("GET")
 	r.HandleFunc("/kubectl", kubectlHandler.Handle).Methods("POST")
+	r.HandleFunc("/kubectl/batch", kubectlHandler.Batch).Methods("POST")
+	r.HandleFunc("/kubectl/delete", kubectlHandler.Delete).Methods("POST") // Dry run first, then confirm
+	r.HandleFunc("/kubectl/apply", kubectlHandler.Apply).Methods("POST")
 	r.HandleFunc("/exec-auth", execAuthHandler.Handle).Methods("POST")
 
+	// Kubeconfig inspection endpoints
+	r.HandleFunc("/config/contexts", configHandler.Contexts).Methods("POST")
+	r.HandleFunc("/config/validate", configHandler.Validate).Methods("POST")
+
+	// Cluster hash lookup (no sessions started)
+	r.HandleFunc("/cluster/hash", clusterHashHandler.Hash).Methods("POST")
+
+	// Pod inspection (e.g. container picker before exec)
+	r.HandleFunc("/pods/containers", podsHandler.Containers).Methods("GET")
+
+	// Single object lookup by group/version/kind, so the app doesn't build API paths itself
+	r.HandleFunc("/resource", resourceHandler.Get).Methods("GET")
+
 	// Shell endpoints
 	r.HandleFunc("/shell/start", shellHandler.Start).Methods("POST")
+	r.HandleFunc("/shell/run", shellHandler.Run).Methods("POST") // One-shot: runs to completion, no session
 	r.HandleFunc("/shell/output/{sessionId}", shellHandler.Output).Methods("GET")
 	r.HandleFunc("/shell/stop/{sessionId}", shellHandler.Stop).Methods("DELETE")
+	r.HandleFunc("/shell/signal/{sessionId}", shellHandler.Signal).Methods("POST")
 	r.HandleFunc("/shell/list", shellHandler.List).Methods("GET")
 
 	// Port-forward endpoints
@@ -36,29 +85,49 @@ func NewRouter(version string, sessionMgr *session.Manager) *mux.Router {
 	r.HandleFunc("/port-forward/list", portForwardHandler.List).Methods("GET")
 
 	// Exec endpoints
-	r.HandleFunc("/exec", execHandler.Execute).Methods("POST") // NEW: Synchronous exec (recommended)
+	r.HandleFunc("/exec", execHandler.Execute).Methods("POST")          // NEW: Synchronous exec (recommended)
+	r.HandleFunc("/exec/simple", execHandler.ExecSimple).Methods("GET") // Query-string variant for quick one-shot commands
 
 	// Exec session endpoints (legacy - deprecated)
 	r.HandleFunc("/exec/start", execHandler.Start).Methods("POST")
 	r.HandleFunc("/exec/input/{sessionId}", execHandler.Input).Methods("POST")
 	r.HandleFunc("/exec/output/{sessionId}", execHandler.Output).Methods("GET")
+	r.HandleFunc("/exec/attach/{sessionId}", execHandler.Attach).Methods("GET") // WebSocket: stdin in, output out
 	r.HandleFunc("/exec/stop/{sessionId}", execHandler.Stop).Methods("DELETE")
 
 	// Proxy endpoints
 	r.HandleFunc("/proxy/start", proxyHandler.Start).Methods("POST")
+	r.HandleFunc("/proxy/ensure", proxyHandler.Ensure).Methods("POST") // Preferred over /proxy/start
 	r.HandleFunc("/proxy/stop/{sessionId}", proxyHandler.Stop).Methods("DELETE")
 	r.HandleFunc("/proxy/list", proxyHandler.List).Methods("GET")
+	r.HandleFunc("/proxy/stats", proxyHandler.Stats).Methods("GET")
 	r.HandleFunc("/proxy/verify/{clusterHash}", proxyHandler.Verify).Methods("GET")
+	r.HandleFunc("/proxy/health/{clusterHash}", proxyHandler.Health).Methods("GET") // Probes the cluster through the proxy
+	r.HandleFunc("/proxy/warm/{clusterHash}", proxyHandler.Warm).Methods("POST")    // Sets up auth and connections before the first request
 
 	// Proxy router - routes requests to the correct kubectl proxy based on cluster hash
 	// This allows the app to make requests through the helper instead of directly to kubectl proxy
 	// Pattern: /proxy/{clusterHash}/api/v1/pods -> routes to kubectl proxy for that cluster
 	proxyRouterHandler := NewProxyRouterHandler(sessionMgr)
+	proxyRouterHandler.cache = responseCache
+	if cfg.ProxyUserAgent {
+		proxyRouterHandler.userAgent = "kubedesk-helper/" + version
+	}
+	proxyRouterHandler.dropAuthorization = cfg.AuthTokenFile != "" // main registers TokenAuth whenever this is set
 	r.PathPrefix("/proxy/{clusterHash}/").HandlerFunc(proxyRouterHandler.Route)
 
-	// Session cleanup endpoint
+	// Session cleanup endpoints
 	r.HandleFunc("/sessions/cleanup", sessionCleanupHandler.Cleanup).Methods("POST")
+	r.HandleFunc("/cluster/deactivate", sessionCleanupHandler.Deactivate).Methods("POST") // Graceful, with per-session results
+
+	// Session lifecycle event stream (SSE)
+	r.HandleFunc("/events", eventsHandler.Stream).Methods("GET")
+
+	// Multiplexed kubectl watches (SSE); one connection for several resources
+	r.HandleFunc("/watch", watchHandler.Stream).Methods("GET")
+
+	// Support-bundle dumps; 404 unless HELPER_DEBUG_TOKEN is set
+	r.HandleFunc("/debug/sessions", debugHandler.Sessions).Methods("GET")
 
 	return r
 }
-
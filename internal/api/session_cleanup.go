@@ -2,9 +2,9 @@ package api
 
 import (
 	"encoding/json"
-	"log/slog"
 	"net/http"
 
+	"github.com/kubedeskpro/kubedesk-helper/internal/logging"
 	"github.com/kubedeskpro/kubedesk-helper/internal/session"
 )
 
@@ -33,9 +33,11 @@ type SessionCleanupResponse struct {
 
 // Cleanup handles POST /sessions/cleanup
 func (h *SessionCleanupHandler) Cleanup(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
 	var req SessionCleanupRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		slog.Error("Failed to decode cleanup request", "error", err)
+		logger.Error("Failed to decode cleanup request", "error", err)
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
@@ -45,11 +47,11 @@ func (h *SessionCleanupHandler) Cleanup(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	slog.Info("Cleaning up sessions for cluster", "clusterHash", req.ClusterHash)
+	logger.Info("Cleaning up sessions for cluster", "clusterHash", req.ClusterHash)
 
 	count := h.sessionMgr.CleanupByClusterHash(req.ClusterHash)
 
-	slog.Info("Cleaned up sessions", "count", count, "clusterHash", req.ClusterHash)
+	logger.Info("Cleaned up sessions", "count", count, "clusterHash", req.ClusterHash)
 
 	response := SessionCleanupResponse{
 		SessionsRemoved: count,
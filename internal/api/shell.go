@@ -1,6 +1,8 @@
 package api
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"log/slog"
@@ -9,12 +11,19 @@ import (
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/kubedeskpro/kubedesk-helper/internal/childproc"
 	"github.com/kubedeskpro/kubedesk-helper/internal/cluster"
 	"github.com/kubedeskpro/kubedesk-helper/internal/env"
+	"github.com/kubedeskpro/kubedesk-helper/internal/kubeconfig"
+	"github.com/kubedeskpro/kubedesk-helper/internal/kubectl"
+	"github.com/kubedeskpro/kubedesk-helper/internal/logging"
+	"github.com/kubedeskpro/kubedesk-helper/internal/metrics"
 	"github.com/kubedeskpro/kubedesk-helper/internal/session"
 )
 
@@ -25,10 +34,16 @@ type ShellHandler struct {
 
 // ShellStartRequest represents a shell command start request
 type ShellStartRequest struct {
-	Command     string `json:"command"`              // Full shell command string
-	Kubeconfig  string `json:"kubeconfig,omitempty"` // Optional kubeconfig content
-	Context     string `json:"context,omitempty"`    // Optional kubectl context
-	ClusterHash string `json:"clusterHash,omitempty"` // Optional: computed by helper if not provided
+	Command        string `json:"command"`                  // Full shell command string
+	Kubeconfig     string `json:"kubeconfig,omitempty"`     // Optional kubeconfig content
+	KubeconfigPath string `json:"kubeconfigPath,omitempty"` // Optional absolute path to a kubeconfig on disk, used in place
+	Context        string `json:"context,omitempty"`        // Optional kubectl context
+	ClusterHash    string `json:"clusterHash,omitempty"`    // Optional: computed by helper if not provided
+	Structured     bool   `json:"structured,omitempty"`     // Optional: record timestamped stdout/stderr lines instead of raw output
+
+	kubectl.Impersonation // Optional: as, asGroup, asUid; added to each kubectl invocation in the command
+
+	GlobalFlags []string `json:"globalFlags,omitempty"` // Optional: allow-listed kubectl global flags, added to each kubectl invocation
 }
 
 // ShellStartResponse represents a shell start response
@@ -37,92 +52,148 @@ type ShellStartResponse struct {
 	Status    string `json:"status"`
 }
 
+// ShellRunRequest represents a one-shot shell command request (POST /shell/run)
+type ShellRunRequest struct {
+	Command        string `json:"command"`                  // Full shell command string
+	Kubeconfig     string `json:"kubeconfig,omitempty"`     // Optional kubeconfig content
+	KubeconfigPath string `json:"kubeconfigPath,omitempty"` // Optional absolute path to a kubeconfig on disk, used in place
+	Context        string `json:"context,omitempty"`        // Optional kubectl context
+	ClusterHash    string `json:"clusterHash,omitempty"`    // Optional: computed by helper if not provided
+	Timeout        int    `json:"timeout,omitempty"`        // Optional: max seconds to wait (default: 60)
+
+	kubectl.Impersonation // Optional: as, asGroup, asUid; added to each kubectl invocation in the command
+
+	GlobalFlags []string `json:"globalFlags,omitempty"` // Optional: allow-listed kubectl global flags, added to each kubectl invocation
+}
+
+// ShellRunResponse represents the result of a one-shot shell command
+type ShellRunResponse struct {
+	Stdout      string  `json:"stdout"`
+	Stderr      string  `json:"stderr"`
+	ExitCode    int32   `json:"exitCode"`
+	Duration    float64 `json:"duration"` // Seconds
+	ClusterHash string  `json:"clusterHash"`
+	Error       string  `json:"error,omitempty"`
+	Encoding    string  `json:"encoding,omitempty"` // "base64" if stdout/stderr weren't valid UTF-8 and are base64-encoded
+}
+
+// defaultShellRunTimeout applies to /shell/run when the request sets no timeout
+const defaultShellRunTimeout = 60
+
 // ShellOutputResponse represents a shell output response
 type ShellOutputResponse struct {
-	Output    string `json:"output"`
-	Timestamp string `json:"timestamp"`
-	Status    string `json:"status"`
-	ExitCode  *int32 `json:"exitCode,omitempty"` // Only set when process has exited
+	Output    string               `json:"output"`          // stdout and stderr interleaved, as before
+	Stdout    string               `json:"stdout"`          // stdout only
+	Stderr    string               `json:"stderr"`          // stderr only
+	Lines     []session.OutputLine `json:"lines,omitempty"` // Only set for structured sessions (output fields are then empty)
+	Timestamp string               `json:"timestamp"`
+	Status    string               `json:"status"`
+	ExitCode  *int32               `json:"exitCode,omitempty"` // Only set when process has exited
+	Offset    int                  `json:"offset"`             // Bytes of output (lines if structured) returned; pass back as ?offset= with ?wait=
+	Encoding  string               `json:"encoding,omitempty"` // "base64" if output/stdout/stderr weren't valid UTF-8 and are base64-encoded
+
+	BytesProduced int64 `json:"bytesProduced"` // Total bytes of output so far, including any no longer buffered
+}
+
+// ShellListResponse represents a shell list response
+type ShellListResponse struct {
+	Sessions []ShellSessionInfo `json:"sessions"`
+}
+
+// ShellSessionInfo represents shell session information
+type ShellSessionInfo struct {
+	SessionID   string   `json:"sessionId"`
+	Command     string   `json:"command"`
+	Context     string   `json:"context"`
+	ClusterHash string   `json:"clusterHash"`
+	Status      string   `json:"status"`
+	StartedAt   string   `json:"startedAt"`
+	ExitCode    *int32   `json:"exitCode,omitempty"`
+	StdoutBytes int      `json:"stdoutBytes"`
+	StderrBytes int      `json:"stderrBytes"`
+	CommandLine []string `json:"commandLine,omitempty"` // argv as run, secrets redacted
+
+	BytesProduced int64 `json:"bytesProduced"` // Total bytes of output so far, including any no longer buffered
+
+	// Identity kubectl impersonates, if any
+	As      string   `json:"as,omitempty"`
+	AsGroup []string `json:"asGroup,omitempty"`
+	AsUID   string   `json:"asUid,omitempty"`
+
+	GlobalFlags []string `json:"globalFlags,omitempty"` // Global flags added to each kubectl invocation
+}
+
+// ShellSignalRequest represents a request to signal a running shell session
+type ShellSignalRequest struct {
+	Signal      string `json:"signal"`                // Signal name, e.g. "SIGINT" or "INT"
+	ClusterHash string `json:"clusterHash,omitempty"` // Optional: for validation
+}
+
+// shellSignals maps the signal names accepted by /shell/signal to syscall signals
+var shellSignals = map[string]syscall.Signal{
+	"SIGINT":  syscall.SIGINT,
+	"SIGTERM": syscall.SIGTERM,
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGKILL": syscall.SIGKILL,
+	"SIGUSR1": syscall.SIGUSR1,
+	"SIGUSR2": syscall.SIGUSR2,
+	"SIGSTOP": syscall.SIGSTOP,
+	"SIGCONT": syscall.SIGCONT,
 }
 
 // Start handles POST /shell/start
 func (h *ShellHandler) Start(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
 	var req ShellStartRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		slog.Error("Failed to decode shell request", "error", err)
+		logger.Error("Failed to decode shell request", "error", err)
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	if req.Command == "" {
-		http.Error(w, "No command provided", http.StatusBadRequest)
+	// A kubeconfigPath is read only for hashing; kubectl uses the file in place
+	if status, msg := loadKubeconfigPath(&req.Kubeconfig, req.KubeconfigPath); status != 0 {
+		http.Error(w, msg, status)
 		return
 	}
 
-	// If kubeconfig/context not provided, try to look up from registry
-	if req.Kubeconfig == "" && req.Context == "" && req.ClusterHash != "" {
-		regKubeconfig, regContext, foundInRegistry := cluster.GetRegistry().Lookup(req.ClusterHash)
-		if !foundInRegistry {
-			slog.Error("Cluster hash not found in registry and kubeconfig/context not provided",
-				"providedHash", req.ClusterHash,
-				"command", req.Command,
-				"hint", "This usually happens after helper restart. App should send kubeconfig and context.",
-			)
-			http.Error(w, "Cluster hash not found in registry. Please provide kubeconfig and context in the request.", http.StatusBadRequest)
-			return
-		}
-		req.Kubeconfig = regKubeconfig
-		req.Context = regContext
-		slog.Info("Looked up cluster info from registry",
-			"clusterHash", req.ClusterHash,
-			"context", req.Context,
-		)
+	if strings.TrimSpace(req.Command) == "" {
+		http.Error(w, "No command provided (command is empty or only whitespace)", http.StatusBadRequest)
+		return
+	}
+	if err := req.Impersonation.Validate(); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid impersonation: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := kubectl.ValidateGlobalFlags(req.GlobalFlags); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid globalFlags: %v", err), http.StatusBadRequest)
+		return
 	}
 
-	// Compute cluster hash if not provided
-	if req.ClusterHash == "" {
-		req.ClusterHash = cluster.ComputeAndRegister(req.Kubeconfig, req.Context)
-	} else {
-		// If hash is provided, VALIDATE it first before registering
-		expectedHash := cluster.ComputeHash(req.Kubeconfig, req.Context)
-		if req.ClusterHash != expectedHash {
-			slog.Error("Cluster hash mismatch - app sent wrong hash!",
-				"providedHash", req.ClusterHash,
-				"expectedHash", expectedHash,
-				"context", req.Context,
-			)
-			http.Error(w, fmt.Sprintf("Cluster hash mismatch: expected %s, got %s", expectedHash, req.ClusterHash), http.StatusBadRequest)
-			return
-		}
-
-		// Hash is valid - register it
-		cluster.GetRegistry().Register(req.ClusterHash, req.Kubeconfig, req.Context)
-		slog.Info("Validated and registered cluster hash",
-			"clusterHash", req.ClusterHash,
-			"context", req.Context,
-		)
+	// If kubeconfig/context not provided, try to look up from registry
+	if !resolveHashOnly(logger, &req.Kubeconfig, &req.Context, req.ClusterHash) {
+		writeRegistryMiss(w, req.ClusterHash)
+		return
 	}
 
-	// Double-check validation (should always pass now)
-	if !cluster.ValidateHash(req.ClusterHash, req.Kubeconfig, req.Context) {
-		expectedHash := cluster.GetExpectedHash(req.Kubeconfig, req.Context)
-		slog.Error("Cluster hash validation failed",
-			"providedHash", req.ClusterHash,
-			"expectedHash", expectedHash,
-			"kubeconfig", req.Kubeconfig,
-			"context", req.Context,
-			"command", req.Command,
-		)
-		http.Error(w, "Cluster hash validation failed", http.StatusBadRequest)
+	if status, msg := resolveShellCluster(logger, &req.Kubeconfig, &req.Context, &req.ClusterHash, req.Command); status != 0 {
+		http.Error(w, msg, status)
 		return
 	}
 
 	// Create session
-	sess := h.sessionMgr.Create(session.TypeShell)
+	sess, err := h.sessionMgr.CreateForCluster(session.TypeShell, req.ClusterHash)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
 	sess.ShellCommand = req.Command
 	sess.Context = req.Context
-	sess.Kubeconfig = req.Kubeconfig
-	sess.ClusterHash = req.ClusterHash
+	setSessionImpersonation(sess, req.Impersonation)
+	sess.GlobalFlags = req.GlobalFlags
+	sess.SetKubeconfig(req.Kubeconfig)
 
 	// Inject --context flag into kubectl commands if context is provided
 	command := req.Command
@@ -130,62 +201,60 @@ func (h *ShellHandler) Start(w http.ResponseWriter, r *http.Request) {
 		// Replace kubectl commands with kubectl --context=<context>
 		// This handles various kubectl command patterns
 		command = injectKubectlContext(command, req.Context)
-		slog.Info("Injected context into command", "sessionId", sess.ID, "original", req.Command, "modified", command, "context", req.Context)
+		logger.Info("Injected context into command", "sessionId", sess.ID, "original", req.Command, "modified", command, "context", req.Context)
 	}
+	command = injectKubectlImpersonation(command, req.Impersonation)
+	command = injectKubectlGlobalFlags(command, req.GlobalFlags)
 
-	slog.Info("Starting shell session", "sessionId", sess.ID, "command", command, "clusterHash", req.ClusterHash)
+	logger.Info("Starting shell session", "sessionId", sess.ID, "command", command, "clusterHash", req.ClusterHash)
 
 	// Build bash command
-	cmd := exec.Command("/bin/bash", "-c", command)
+	cmd := exec.Command("/bin/bash", "-c", limitShellCommand(command))
 	cmd.Env = env.GetShellEnvironment()
 
+	// Run in its own process group so /shell/signal reaches bash and its children
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
 	// Set kubeconfig if provided
 	if req.Kubeconfig != "" {
-		tmpDir := os.TempDir()
-		tmpFile := filepath.Join(tmpDir, fmt.Sprintf("kubeconfig-%s", sess.ID))
-		if err := os.WriteFile(tmpFile, []byte(req.Kubeconfig), 0600); err != nil {
+		// Shared with other commands for the same cluster; released when the session ends
+		tmpFile, release, err := kubeconfig.GetTempManager().AcquireFile(req.ClusterHash, req.Kubeconfig, req.KubeconfigPath)
+		if err != nil {
 			h.sessionMgr.Stop(sess.ID)
-			slog.Error("Failed to write kubeconfig", "error", err)
+			logger.Error("Failed to write kubeconfig", "error", err)
 			http.Error(w, "Failed to write kubeconfig", http.StatusInternalServerError)
 			return
 		}
+		sess.AddRelease(release)
 		cmd.Env = append(cmd.Env, fmt.Sprintf("KUBECONFIG=%s", tmpFile))
-
-		// Register temp file for cleanup when session ends
-		sess.TempFiles = append(sess.TempFiles, tmpFile)
 	}
 
-	// Capture combined output (stdout + stderr)
-	cmd.Stdout = sess.GetOutputBuffer()
-	cmd.Stderr = sess.GetOutputBuffer()
+	// Capture stdout and stderr separately (plus combined), or as line records in structured mode
+	if req.Structured {
+		sess.EnableStructuredOutput()
+	}
+	cmd.Stdout = sess.StreamWriter(session.StreamStdout)
+	cmd.Stderr = sess.StreamWriter(session.StreamStderr)
 
 	sess.Cmd = cmd
+	sess.CommandLine = redactCommandLine(cmd.Args)
 
 	// Start the command
-	if err := cmd.Start(); err != nil {
+	if err := childproc.Start(cmd); err != nil {
 		h.sessionMgr.Stop(sess.ID)
-		slog.Error("Failed to start shell command", "error", err, "command", req.Command)
+		logger.Error("Failed to start shell command", "error", err, "command", req.Command)
 		http.Error(w, fmt.Sprintf("Failed to start command: %v", err), http.StatusInternalServerError)
 		return
 	}
 
 	// Monitor process completion in background
 	go func() {
-		// CRITICAL: Clean up temp files AFTER command finishes
+		// CRITICAL: Release temp kubeconfig AFTER command finishes
 		// This ensures kubectl can read the kubeconfig file for the entire duration
-		defer func() {
-			for _, tmpFile := range sess.TempFiles {
-				if err := os.Remove(tmpFile); err != nil && !os.IsNotExist(err) {
-					slog.Warn("Failed to remove temp file", "file", tmpFile, "error", err)
-				} else {
-					slog.Debug("Removed temp file after shell completed", "file", tmpFile)
-				}
-			}
-			// Clear the list so session cleanup doesn't try to delete them again
-			sess.TempFiles = nil
-		}()
+		defer sess.Release()
 
-		err := cmd.Wait()
+		err := childproc.Wait(cmd)
+		sess.FlushOutput()
 		var exitCode int32
 		if err != nil {
 			if exitErr, ok := err.(*exec.ExitError); ok {
@@ -200,10 +269,12 @@ func (h *ShellHandler) Start(w http.ResponseWriter, r *http.Request) {
 		// Store exit code in session
 		if s, ok := h.sessionMgr.Get(sess.ID); ok {
 			s.ExitCode = &exitCode
-			s.Status = session.StatusStopped
+			h.sessionMgr.SetStatus(s, session.StatusStopped)
 		}
 
-		slog.Info("Shell command completed", "sessionId", sess.ID, "exitCode", exitCode)
+		logger.Info("Shell command completed", "sessionId", sess.ID, "exitCode", exitCode, "bytesProduced", sess.BytesProduced())
+		metrics.GetRecorder().AddOutput(sess.ClusterHash, sess.Context, metrics.SourceShell, sess.BytesProduced())
+		sess.CloseOutput()
 	}()
 
 	response := ShellStartResponse{
@@ -215,21 +286,199 @@ func (h *ShellHandler) Start(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// Run handles POST /shell/run
+// Runs a shell command to completion and returns its full result, without creating a session
+func (h *ShellHandler) Run(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	startTime := time.Now()
+
+	var req ShellRunRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("Failed to decode shell run request", "error", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// A kubeconfigPath is read only for hashing; kubectl uses the file in place
+	if status, msg := loadKubeconfigPath(&req.Kubeconfig, req.KubeconfigPath); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	if strings.TrimSpace(req.Command) == "" {
+		http.Error(w, "No command provided (command is empty or only whitespace)", http.StatusBadRequest)
+		return
+	}
+	if err := req.Impersonation.Validate(); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid impersonation: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := kubectl.ValidateGlobalFlags(req.GlobalFlags); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid globalFlags: %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.Timeout < 0 {
+		http.Error(w, "timeout must not be negative", http.StatusBadRequest)
+		return
+	}
+	if req.Timeout == 0 {
+		req.Timeout = defaultShellRunTimeout
+	}
+
+	// If kubeconfig/context not provided, try to look up from registry
+	if !resolveHashOnly(logger, &req.Kubeconfig, &req.Context, req.ClusterHash) {
+		writeRegistryMiss(w, req.ClusterHash)
+		return
+	}
+
+	if status, msg := resolveShellCluster(logger, &req.Kubeconfig, &req.Context, &req.ClusterHash, req.Command); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	// Inject --context flag into kubectl commands if context is provided
+	command := req.Command
+	if req.Context != "" {
+		command = injectKubectlContext(command, req.Context)
+	}
+	command = injectKubectlImpersonation(command, req.Impersonation)
+	command = injectKubectlGlobalFlags(command, req.GlobalFlags)
+
+	// The command runs under req.Timeout, which may well exceed the server's write timeout
+	clearWriteDeadline(logger, w)
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(req.Timeout)*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "/bin/bash", "-c", limitShellCommand(command))
+	cmd.Env = env.GetShellEnvironment()
+
+	// Own process group so a timeout kills the whole pipeline, not just bash
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error { return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL) }
+	cmd.WaitDelay = execOutputWaitDelay
+
+	if req.Kubeconfig != "" {
+		tmpFile, release, err := kubeconfig.GetTempManager().AcquireFile(req.ClusterHash, req.Kubeconfig, req.KubeconfigPath)
+		if err != nil {
+			logger.Error("Failed to write kubeconfig", "error", err)
+			http.Error(w, "Failed to write kubeconfig", http.StatusInternalServerError)
+			return
+		}
+		defer release()
+		cmd.Env = append(cmd.Env, fmt.Sprintf("KUBECONFIG=%s", tmpFile))
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	logger.Info("Running shell command", "command", command, "clusterHash", req.ClusterHash, "timeout", req.Timeout)
+	err := childproc.Run(cmd)
+
+	response := ShellRunResponse{
+		Duration:    time.Since(startTime).Seconds(),
+		ClusterHash: req.ClusterHash,
+	}
+	status := http.StatusOK
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			response.ExitCode = -1
+			response.Error = fmt.Sprintf("Command timed out after %d seconds", req.Timeout)
+			status = http.StatusGatewayTimeout
+		} else if exitErr, ok := err.(*exec.ExitError); ok {
+			response.ExitCode = int32(exitErr.ExitCode())
+		} else {
+			response.ExitCode = -1
+			response.Error = err.Error()
+			status = http.StatusInternalServerError
+		}
+	}
+	// Read only after Run returns, once exec has finished copying output
+	response.Stdout = stdout.String()
+	response.Stderr = stderr.String()
+	response.Encoding = encodeOutputs(&response.Stdout, &response.Stderr)
+
+	logger.Info("Shell command finished", "exitCode", response.ExitCode, "duration", response.Duration, "clusterHash", req.ClusterHash)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// resolveShellCluster computes, or validates and registers, the cluster hash
+// Returns a non-zero HTTP status and message if the request must be rejected
+func resolveShellCluster(logger *slog.Logger, kubeconfigContent, kubeContext, clusterHash *string, command string) (int, string) {
+	if err := checkKubeconfigContext(*kubeconfigContent, *kubeContext); err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+
+	// Compute cluster hash if not provided
+	if *clusterHash == "" {
+		*clusterHash = cluster.ComputeAndRegister(*kubeconfigContent, *kubeContext)
+	} else {
+		// If hash is provided, VALIDATE it first before registering
+		expectedHash := cluster.ComputeHash(*kubeconfigContent, *kubeContext)
+		if *clusterHash != expectedHash {
+			logger.Error("Cluster hash mismatch - app sent wrong hash!",
+				"providedHash", *clusterHash,
+				"expectedHash", expectedHash,
+				"context", *kubeContext,
+			)
+			return http.StatusBadRequest, fmt.Sprintf("Cluster hash mismatch: expected %s, got %s", expectedHash, *clusterHash)
+		}
+
+		// Hash is valid - register it
+		cluster.GetRegistry().Register(*clusterHash, *kubeconfigContent, *kubeContext)
+		logger.Info("Validated and registered cluster hash",
+			"clusterHash", *clusterHash,
+			"context", *kubeContext,
+		)
+	}
+
+	// Double-check validation (should always pass now)
+	if !cluster.ValidateHash(*clusterHash, *kubeconfigContent, *kubeContext) {
+		expectedHash := cluster.GetExpectedHash(*kubeconfigContent, *kubeContext)
+		logger.Error("Cluster hash validation failed",
+			"providedHash", *clusterHash,
+			"expectedHash", expectedHash,
+			"kubeconfigLength", len(*kubeconfigContent), // Never log the content: it holds credentials
+			"context", *kubeContext,
+			"command", command,
+		)
+		return http.StatusBadRequest, "Cluster hash validation failed"
+	}
+
+	return 0, ""
+}
+
 // Output handles GET /shell/output/{sessionId}
 func (h *ShellHandler) Output(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
 	vars := mux.Vars(r)
 	sessionID := vars["sessionId"]
 
-	// Get cluster hash from query parameter (optional)
-	clusterHash := r.URL.Query().Get("clusterHash")
+	// Optional cluster hash, from the JSON body or the query
+	clusterHash, err := readClusterHash(r)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
 
 	// Get session with cluster validation if hash provided
+	offset, wait, err := parseOutputPoll(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	var sess *session.Session
 	var ok bool
 	if clusterHash != "" {
 		sess, ok = h.sessionMgr.GetWithClusterValidation(sessionID, clusterHash)
 		if !ok {
-			slog.Warn("Session not found or cluster hash mismatch",
+			logger.Warn("Session not found or cluster hash mismatch",
 				"sessionId", sessionID,
 				"providedHash", clusterHash,
 			)
@@ -244,14 +493,29 @@ func (h *ShellHandler) Output(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	output := sess.ReadOutput()
-	status := string(sess.Status)
+	// Long-poll: block until there is output past the client's offset, or the wait elapses
+	// The wait is capped below the default write timeout, but HTTP_WRITE_TIMEOUT may be set lower
+	if wait > 0 {
+		clearWriteDeadline(logger, w)
+	}
+	sess.WaitOutput(r.Context(), offset, wait)
+	status := string(h.sessionMgr.StatusOf(sess))
 
 	response := ShellOutputResponse{
-		Output:    output,
 		Timestamp: time.Now().Format(time.RFC3339),
 		Status:    status,
 		ExitCode:  sess.ExitCode,
+
+		BytesProduced: sess.BytesProduced(),
+	}
+	if sess.IsStructured() {
+		response.Lines = sess.ReadLines()
+		response.Offset = len(response.Lines)
+	} else {
+		response.Output = sess.ReadOutput()
+		response.Stdout, response.Stderr = sess.ReadStreams()
+		response.Offset = len(response.Output)
+		response.Encoding = encodeOutputs(&response.Output, &response.Stdout, &response.Stderr)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -260,17 +524,23 @@ func (h *ShellHandler) Output(w http.ResponseWriter, r *http.Request) {
 
 // Stop handles DELETE /shell/stop/{sessionId}
 func (h *ShellHandler) Stop(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
 	vars := mux.Vars(r)
 	sessionID := vars["sessionId"]
 
-	// Get cluster hash from query parameter (optional)
-	clusterHash := r.URL.Query().Get("clusterHash")
+	// Optional cluster hash, from the JSON body or the query
+	clusterHash, err := readClusterHash(r)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
 
 	// Validate cluster hash if provided
 	if clusterHash != "" {
 		sess, ok := h.sessionMgr.GetWithClusterValidation(sessionID, clusterHash)
 		if !ok {
-			slog.Warn("Session not found or cluster hash mismatch",
+			logger.Warn("Session not found or cluster hash mismatch",
 				"sessionId", sessionID,
 				"providedHash", clusterHash,
 			)
@@ -281,7 +551,7 @@ func (h *ShellHandler) Stop(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := h.sessionMgr.Stop(sessionID); err != nil {
-		slog.Error("Failed to stop shell session", "error", err, "sessionId", sessionID)
+		logger.Error("Failed to stop shell session", "error", err, "sessionId", sessionID)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -290,31 +560,115 @@ func (h *ShellHandler) Stop(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"message": "Session stopped"})
 }
 
+// Signal handles POST /shell/signal/{sessionId}
+// Sends a signal (e.g. SIGINT for Ctrl-C) to the session's process group without removing the session
+func (h *ShellHandler) Signal(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	vars := mux.Vars(r)
+	sessionID := vars["sessionId"]
+
+	var req ShellSignalRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	sig, ok := parseSignalName(req.Signal)
+	if !ok {
+		http.Error(w, fmt.Sprintf("Unsupported signal: %q", req.Signal), http.StatusBadRequest)
+		return
+	}
+
+	// Get session with cluster validation if hash provided (the body's wins over the query's)
+	clusterHash := clusterHashFromRequest(r, req.ClusterHash)
+	var sess *session.Session
+	if clusterHash != "" {
+		sess, ok = h.sessionMgr.GetWithClusterValidation(sessionID, clusterHash)
+		if !ok {
+			logger.Warn("Session not found or cluster hash mismatch",
+				"sessionId", sessionID,
+				"providedHash", clusterHash,
+			)
+			http.Error(w, "Session not found or cluster mismatch", http.StatusNotFound)
+			return
+		}
+	} else {
+		sess, ok = h.sessionMgr.Get(sessionID)
+		if !ok {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	if sess.Type != session.TypeShell {
+		http.Error(w, "Session is not a shell session", http.StatusBadRequest)
+		return
+	}
+
+	if h.sessionMgr.StatusOf(sess) != session.StatusRunning || sess.Cmd == nil || sess.Cmd.Process == nil {
+		http.Error(w, "Session is not running", http.StatusConflict)
+		return
+	}
+
+	// Negative PID targets the whole process group (bash was started with Setpgid)
+	if err := syscall.Kill(-sess.Cmd.Process.Pid, sig); err != nil {
+		logger.Error("Failed to signal shell session", "error", err, "sessionId", sessionID, "signal", req.Signal)
+		http.Error(w, fmt.Sprintf("Failed to send signal: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Signaled shell session", "sessionId", sessionID, "signal", sig.String())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "signaled"})
+}
+
+// parseSignalName converts a signal name like "SIGINT", "sigint" or "INT" to a syscall signal
+func parseSignalName(name string) (syscall.Signal, bool) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if name == "" {
+		return 0, false
+	}
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	sig, ok := shellSignals[name]
+	return sig, ok
+}
+
 // List handles GET /shell/list
 func (h *ShellHandler) List(w http.ResponseWriter, r *http.Request) {
 	sessions := h.sessionMgr.List(session.TypeShell)
 
-	type shellSessionInfo struct {
-		SessionID string `json:"sessionId"`
-		Command   string `json:"command"`
-		Status    string `json:"status"`
-		StartedAt string `json:"startedAt"`
-		ExitCode  *int32 `json:"exitCode,omitempty"`
-	}
-
-	var result []shellSessionInfo
+	var sessionInfos []ShellSessionInfo
 	for _, sess := range sessions {
-		result = append(result, shellSessionInfo{
-			SessionID: sess.ID,
-			Command:   sess.ShellCommand,
-			Status:    string(sess.Status),
-			StartedAt: sess.StartedAt.Format(time.RFC3339),
-			ExitCode:  sess.ExitCode,
+		stdoutBytes, stderrBytes := sess.StreamSizes()
+		sessionInfos = append(sessionInfos, ShellSessionInfo{
+			SessionID:   sess.ID,
+			Command:     sess.ShellCommand,
+			Context:     sess.Context,
+			ClusterHash: sess.ClusterHash,
+			Status:      string(h.sessionMgr.StatusOf(sess)),
+			StartedAt:   sess.StartedAt.Format(time.RFC3339),
+			ExitCode:    sess.ExitCode,
+			StdoutBytes: stdoutBytes,
+			StderrBytes: stderrBytes,
+			CommandLine: sess.CommandLine,
+
+			BytesProduced: sess.BytesProduced(),
+
+			As:      sess.ImpersonateUser,
+			AsGroup: sess.ImpersonateGroups,
+			AsUID:   sess.ImpersonateUID,
+
+			GlobalFlags: sess.GlobalFlags,
 		})
 	}
 
+	response := ShellListResponse{Sessions: sessionInfos}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{"sessions": result})
+	json.NewEncoder(w).Encode(response)
 }
 
 // injectKubectlContext scans the command string for kubectl invocations and injects --context flag
@@ -324,6 +678,7 @@ func (h *ShellHandler) List(w http.ResponseWriter, r *http.Request) {
 // - Mixed commands: "echo hello && kubectl get pods && ls -la"
 // - Pipes: "kubectl get pods | grep nginx"
 // - Already has context: "kubectl --context=foo get pods" (skips)
+// - Plugins: "kubectl neat get pod web" -> "kubectl neat get pod web --context=<context>"
 func injectKubectlContext(command, context string) string {
 	if context == "" {
 		return command
@@ -334,17 +689,111 @@ func injectKubectlContext(command, context string) string {
 		return command
 	}
 
-	contextFlag := fmt.Sprintf("--context=%s", context)
+	return injectKubectlFlags(command, fmt.Sprintf("--context=%s", context))
+}
 
-	// Use regex to find kubectl followed by whitespace
-	// Pattern: \bkubectl\b - word boundary + kubectl + word boundary (prevents matching "mykubectl")
-	// Followed by whitespace (\s+)
-	pattern := regexp.MustCompile(`\bkubectl\b(\s+)`)
+// injectKubectlImpersonation adds --as, --as-group and --as-uid to each kubectl invocation in the
+// command, the same way injectKubectlContext adds --context. An invocation that already passes one
+// of them is left alone. The values were validated to hold no shell metacharacters
+func injectKubectlImpersonation(command string, imp kubectl.Impersonation) string {
+	if imp.IsZero() {
+		return command
+	}
+	return injectKubectlFlagsUnless(command, strings.Join(imp.Args(), " "), func(words []string) bool {
+		return slices.ContainsFunc(words, isImpersonationFlag)
+	})
+}
+
+// isImpersonationFlag reports whether word is kubectl's --as, --as-group or --as-uid flag
+func isImpersonationFlag(word string) bool {
+	name, _, _ := strings.Cut(word, "=")
+	return name == "--as" || name == "--as-group" || name == "--as-uid"
+}
+
+// injectKubectlFlags inserts flags (already joined and shell-safe) into each kubectl invocation:
+// right after "kubectl", or after a plugin's leading words
+func injectKubectlFlags(command, flags string) string {
+	return injectKubectlFlagsUnless(command, flags, nil)
+}
+
+// injectKubectlFlagsUnless is injectKubectlFlags, skipping invocations whose words (up to the
+// next shell operator) skip reports true for; a nil skip injects into every invocation
+func injectKubectlFlagsUnless(command, flags string, skip func(words []string) bool) string {
+	// kubectlInvocationRe: \bkubectl\b - word boundary + kubectl + word boundary (prevents matching "mykubectl")
+	// Followed by whitespace (\s+), which is kept as-is after the injected flag
+	var result strings.Builder
+	last := 0
+	for _, m := range kubectlInvocationRe.FindAllStringSubmatchIndex(command, -1) {
+		if m[0] < last {
+			continue // Inside a plugin's arguments already copied
+		}
+		if skip != nil && skip(strings.Fields(kubectlArgsRe.FindString(command[m[1]:]))) {
+			continue // Copied unchanged along with the text before the next invocation
+		}
 
-	// Replace kubectl with kubectl --context=<context>
-	// $1 preserves the original whitespace
-	result := pattern.ReplaceAllString(command, "kubectl "+contextFlag+"$1")
+		// kubectl rejects flags before a plugin name, so a plugin gets the flags after its leading
+		// words instead; plugins built on kubectl's CLI libraries accept them there
+		if words := kubectlBareWordsRe.FindString(command[m[1]:]); words != "" && isKubectlPlugin(strings.Fields(words)) {
+			end := m[1] + len(words)
+			result.WriteString(command[last:end])
+			result.WriteString(" " + flags)
+			last = end
+			continue
+		}
 
-	return result
+		// Replace kubectl with kubectl <flags>
+		result.WriteString(command[last:m[0]])
+		result.WriteString("kubectl " + flags + command[m[2]:m[3]])
+		last = m[1]
+	}
+	result.WriteString(command[last:])
+
+	return result.String()
 }
 
+// Patterns used by injectKubectlFlags
+var (
+	kubectlInvocationRe = regexp.MustCompile(`\bkubectl\b(\s+)`)
+	kubectlArgsRe       = regexp.MustCompile("^[^;&|\n()`]*")
+	kubectlBareWordsRe  = regexp.MustCompile(`^[A-Za-z0-9][-A-Za-z0-9_./:]*(?:[ \t]+[A-Za-z0-9][-A-Za-z0-9_./:]*)*`)
+)
+
+// kubectlPluginExists reports whether a kubectl-<name> executable is on the commands' PATH
+// Replaced in tests
+var kubectlPluginExists = func(name string) bool {
+	for _, e := range env.GetShellEnvironment() {
+		if path, ok := strings.CutPrefix(e, "PATH="); ok {
+			return pluginOnPath(name, path)
+		}
+	}
+	return false
+}
+
+// isKubectlPlugin reports whether kubectl would run words as a plugin, trying the longest
+// name first like kubectl does: "foo bar" runs kubectl-foo-bar, else kubectl-foo
+func isKubectlPlugin(words []string) bool {
+	for i := len(words); i > 0; i-- {
+		parts := make([]string, i)
+		for j, w := range words[:i] {
+			parts[j] = strings.ReplaceAll(w, "-", "_") // kubectl view-secret -> kubectl-view_secret
+		}
+		if kubectlPluginExists(strings.Join(parts, "-")) {
+			return true
+		}
+	}
+	return false
+}
+
+// pluginOnPath reports whether an executable kubectl-<name> exists in one of path's directories
+func pluginOnPath(name, path string) bool {
+	for _, dir := range filepath.SplitList(path) {
+		if dir == "" {
+			continue
+		}
+		info, err := os.Stat(filepath.Join(dir, "kubectl-"+name))
+		if err == nil && info.Mode().IsRegular() && info.Mode()&0o111 != 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package api
+
+import "sync/atomic"
+
+// ShellLimits bounds the resources of each /shell command and the processes it starts, and of
+// the local kubectl process behind each /exec command
+// Zero fields are unlimited. Each is a per-process rlimit, so a pipeline gets one per process
+type ShellLimits struct {
+	MemoryMB   int // Virtual memory (RLIMIT_AS) in MiB; allocations beyond it fail
+	CPUSeconds int // CPU time (RLIMIT_CPU); the kernel kills the process with SIGXCPU, then SIGKILL
+	OpenFiles  int // Open file descriptors (RLIMIT_NOFILE)
+}
+
+// shellLimits holds the limits set by SetShellLimits
+var shellLimits atomic.Pointer[ShellLimits]
+
+// SetShellLimits sets the limits applied to /shell and /exec commands started from now on
+// (SHELL_MAX_MEMORY_MB, SHELL_MAX_CPU_SECONDS, SHELL_MAX_OPEN_FILES)
+func SetShellLimits(limits ShellLimits) {
+	shellLimits.Store(&limits)
+}
+
+// limitShellCommand returns the bash script for command with the configured limits applied first
+// bash's ulimit calls setrlimit in the shell itself, before the command runs, so there is no
+// window in which it runs unlimited. Best effort: a limit the OS refuses (e.g. above the hard
+// limit the helper inherited) is skipped and the command still runs
+func limitShellCommand(command string) string {
+	limits := shellLimits.Load()
+	if limits == nil {
+		return command
+	}
+	return shellLimitPrelude(*limits) + command
+}
+
+// limitedCommandArgs returns the program and arguments that run name with args under the
+// configured limits: bash applies them with the same prelude as /shell commands, then execs
+// name, which keeps bash's pid. Without limits, name and args are returned unchanged
+func limitedCommandArgs(name string, args []string) (string, []string) {
+	limits := shellLimits.Load()
+	if limits == nil {
+		return name, args
+	}
+	prelude := shellLimitPrelude(*limits)
+	if prelude == "" {
+		return name, args
+	}
+	return "/bin/bash", append([]string{"-c", prelude + `exec "$0" "$@"`, name}, args...)
+}
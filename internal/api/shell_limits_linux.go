@@ -0,0 +1,29 @@
+//go:build linux
+
+package api
+
+import (
+	"fmt"
+	"strings"
+)
+
+// shellLimitsSupported reports whether SetShellLimits has any effect on this platform
+const shellLimitsSupported = true
+
+// shellLimitPrelude returns the ulimit lines that apply limits, or "" if there are none
+func shellLimitPrelude(limits ShellLimits) string {
+	var b strings.Builder
+	for _, l := range []struct {
+		flag  string
+		value int
+	}{
+		{"-v", limits.MemoryMB * 1024}, // ulimit -v counts KiB
+		{"-t", limits.CPUSeconds},
+		{"-n", limits.OpenFiles},
+	} {
+		if l.value > 0 {
+			fmt.Fprintf(&b, "ulimit %s %d 2>/dev/null\n", l.flag, l.value)
+		}
+	}
+	return b.String()
+}
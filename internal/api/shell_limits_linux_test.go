@@ -0,0 +1,128 @@
+//go:build linux
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/session"
+)
+
+// setShellLimits sets the /shell limits for the duration of a test
+func setShellLimits(t *testing.T, limits ShellLimits) {
+	t.Helper()
+	orig := shellLimits.Load()
+	SetShellLimits(limits)
+	t.Cleanup(func() { shellLimits.Store(orig) })
+}
+
+func TestShellLimits(t *testing.T) {
+	handler := &ShellHandler{}
+	run := func(command string) ShellRunResponse {
+		t.Helper()
+		body, _ := json.Marshal(ShellRunRequest{Command: command, Timeout: 30})
+		rec := httptest.NewRecorder()
+		handler.Run(rec, httptest.NewRequest(http.MethodPost, "/shell/run", strings.NewReader(string(body))))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+		}
+		var resp ShellRunResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp
+	}
+
+	// A 512 MiB buffer is fine without limits...
+	const allocate = "dd if=/dev/zero of=/dev/null bs=512M count=1 2>/dev/null && echo allocated"
+	setShellLimits(t, ShellLimits{})
+	if resp := run(allocate); resp.ExitCode != 0 || resp.Stdout != "allocated\n" {
+		t.Skipf("can't allocate 512 MiB without a limit here: %+v", resp)
+	}
+
+	// ...but not under a 128 MiB memory limit
+	setShellLimits(t, ShellLimits{MemoryMB: 128, OpenFiles: 64})
+	if resp := run(allocate); resp.ExitCode == 0 || strings.Contains(resp.Stdout, "allocated") {
+		t.Errorf("allocation beyond the memory limit succeeded: %+v", resp)
+	}
+	if resp := run("ulimit -n"); strings.TrimSpace(resp.Stdout) != "64" {
+		t.Errorf("open files limit = %q, want 64", resp.Stdout)
+	}
+
+	// A busy loop in bash itself is killed (SIGXCPU) once it has used its CPU time, well
+	// before the timeout; a signaled command reports exit code -1
+	setShellLimits(t, ShellLimits{CPUSeconds: 1})
+	if resp := run("while :; do :; done"); resp.ExitCode != -1 {
+		t.Errorf("busy loop exit code = %d, want -1 (killed)", resp.ExitCode)
+	}
+}
+
+func TestShellLimits_AppliedToExec(t *testing.T) {
+	// Prints the limits the local kubectl process runs under
+	installFakeKubectl(t, `[ "$1" = get ] && { echo '{}'; exit 0; }
+echo "nofile=$(ulimit -n) args=$*"
+`)
+	setShellLimits(t, ShellLimits{OpenFiles: 64})
+
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	defer sessionMgr.StopAll()
+	handler := &ExecHandler{sessionMgr: sessionMgr}
+	const want = "nofile=64 args=exec -i -n default -c app web -- ls -la"
+
+	decode := func(rec *httptest.ResponseRecorder) ExecResponse {
+		t.Helper()
+		var resp ExecResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp
+	}
+
+	rec := httptest.NewRecorder()
+	body := `{"namespace":"default","podName":"web","container":"app","command":["ls","-la"]}`
+	handler.Execute(rec, httptest.NewRequest(http.MethodPost, "/exec", strings.NewReader(body)))
+	if resp := decode(rec); strings.TrimSpace(resp.Output) != want {
+		t.Errorf("/exec output = %q, want %q", resp.Output, want)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ExecSimple(rec, httptest.NewRequest(http.MethodGet, "/exec/simple?namespace=default&pod=web&container=app&cmd=ls+-la", nil))
+	if resp := decode(rec); strings.TrimSpace(resp.Output) != want {
+		t.Errorf("/exec/simple output = %q, want %q", resp.Output, want)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.Start(rec, httptest.NewRequest(http.MethodPost, "/exec/start", strings.NewReader(body)))
+	var start ExecStartResponse
+	if err := json.NewDecoder(rec.Body).Decode(&start); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	sess, _ := sessionMgr.Get(start.SessionID)
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(sess.ReadOutput(), "\n") && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := strings.TrimSpace(sess.ReadOutput()); got != want {
+		t.Errorf("/exec/start output = %q, want %q", got, want)
+	}
+	// Listings show the kubectl command, not the bash wrapper that applies the limits
+	if len(sess.CommandLine) == 0 || !strings.HasSuffix(sess.CommandLine[0], "kubectl") {
+		t.Errorf("command line = %q, want it to start with kubectl", sess.CommandLine)
+	}
+}
+
+func TestShellLimitPrelude(t *testing.T) {
+	if got := shellLimitPrelude(ShellLimits{}); got != "" {
+		t.Errorf("no limits: prelude = %q", got)
+	}
+	want := "ulimit -v 2097152 2>/dev/null\nulimit -n 256 2>/dev/null\n"
+	if got := shellLimitPrelude(ShellLimits{MemoryMB: 2048, OpenFiles: 256}); got != want {
+		t.Errorf("prelude = %q, want %q", got, want)
+	}
+}
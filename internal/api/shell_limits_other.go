@@ -0,0 +1,12 @@
+//go:build !linux
+
+package api
+
+// shellLimitsSupported reports whether SetShellLimits has any effect on this platform
+// macOS ignores RLIMIT_AS, so the limits are not applied at all rather than only in part
+const shellLimitsSupported = false
+
+// shellLimitPrelude is a no-op; see shellLimitsSupported
+func shellLimitPrelude(limits ShellLimits) string {
+	return ""
+}
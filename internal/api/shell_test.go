@@ -1,7 +1,18 @@
 package api
 
 import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/kubedeskpro/kubedesk-helper/internal/session"
 )
 
 func TestInjectKubectlContext(t *testing.T) {
@@ -138,3 +149,266 @@ func TestInjectKubectlContext(t *testing.T) {
 	}
 }
 
+func TestInjectKubectlContext_Plugins(t *testing.T) {
+	installed := map[string]bool{"neat": true, "tree": true, "view_secret": true, "foo-bar": true}
+	orig := kubectlPluginExists
+	kubectlPluginExists = func(name string) bool { return installed[name] }
+	t.Cleanup(func() { kubectlPluginExists = orig })
+
+	tests := []struct {
+		name     string
+		command  string
+		expected string
+	}{
+		{"Plugin with args and flags", "kubectl neat get pod web -o yaml", "kubectl neat get pod web --context=prod -o yaml"},
+		{"Plugin alone", "kubectl neat", "kubectl neat --context=prod"},
+		{"Plugin with resource args", "kubectl tree deployment my-app", "kubectl tree deployment my-app --context=prod"},
+		{"Dashed plugin name", "kubectl view-secret db-creds | jq .", "kubectl view-secret db-creds --context=prod | jq ."},
+		{"Multi-word plugin", "kubectl foo bar baz", "kubectl foo bar baz --context=prod"},
+		{"Plugin and builtin chained", "kubectl get pods -o yaml && kubectl neat", "kubectl --context=prod get pods -o yaml && kubectl neat --context=prod"},
+		{"Plugin piped into builtin", "kubectl get pod web -o yaml | kubectl neat", "kubectl --context=prod get pod web -o yaml | kubectl neat --context=prod"},
+		{"Unknown subcommand is not a plugin", "kubectl frobnicate pods", "kubectl --context=prod frobnicate pods"},
+		{"Flag first stays in front", "kubectl -n default neat get pod web", "kubectl --context=prod -n default neat get pod web"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := injectKubectlContext(tt.command, "prod"); got != tt.expected {
+				t.Errorf("injectKubectlContext(%q) = %q, want %q", tt.command, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPluginOnPath(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "kubectl-neat"), []byte("#!/bin/sh\n"), 0o755)
+	os.WriteFile(filepath.Join(dir, "kubectl-notexec"), []byte("#!/bin/sh\n"), 0o644)
+	os.Mkdir(filepath.Join(dir, "kubectl-dir"), 0o755)
+	path := "/nonexistent::" + dir
+
+	for name, want := range map[string]bool{"neat": true, "notexec": false, "dir": false, "tree": false} {
+		if got := pluginOnPath(name, path); got != want {
+			t.Errorf("pluginOnPath(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestParseSignalName(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		want   syscall.Signal
+		wantOK bool
+	}{
+		{name: "Full name", input: "SIGINT", want: syscall.SIGINT, wantOK: true},
+		{name: "Lowercase", input: "sigterm", want: syscall.SIGTERM, wantOK: true},
+		{name: "Without SIG prefix", input: "HUP", want: syscall.SIGHUP, wantOK: true},
+		{name: "Surrounding whitespace", input: " SIGKILL ", want: syscall.SIGKILL, wantOK: true},
+		{name: "Empty", input: "", wantOK: false},
+		{name: "Unknown signal", input: "SIGFOO", wantOK: false},
+		{name: "Numeric not accepted", input: "9", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseSignalName(tt.input)
+			if ok != tt.wantOK {
+				t.Fatalf("parseSignalName(%q) ok = %v, want %v", tt.input, ok, tt.wantOK)
+			}
+			if ok && got != tt.want {
+				t.Errorf("parseSignalName(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+// waitShellStopped polls /shell/output until the session has stopped and returns the final response
+func waitShellStopped(t *testing.T, handler *ShellHandler, sessionID string) ShellOutputResponse {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/shell/output/"+sessionID, nil),
+			map[string]string{"sessionId": sessionID})
+		rec := httptest.NewRecorder()
+		handler.Output(rec, req)
+		var resp ShellOutputResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode output: %v", err)
+		}
+		if resp.Status == string(session.StatusStopped) {
+			return resp
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("shell session did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestShellOutput_Structured(t *testing.T) {
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	handler := &ShellHandler{sessionMgr: sessionMgr}
+
+	body, _ := json.Marshal(ShellStartRequest{Command: "echo one; echo two >&2", Structured: true})
+	rec := httptest.NewRecorder()
+	handler.Start(rec, httptest.NewRequest(http.MethodPost, "/shell/start", strings.NewReader(string(body))))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var start ShellStartResponse
+	if err := json.NewDecoder(rec.Body).Decode(&start); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	resp := waitShellStopped(t, handler, start.SessionID)
+
+	if resp.Output != "" {
+		t.Errorf("output = %q, want empty in structured mode", resp.Output)
+	}
+	got := map[string]string{}
+	for _, l := range resp.Lines {
+		got[l.Stream] += l.Line
+	}
+	if got[session.StreamStdout] != "one" || got[session.StreamStderr] != "two" || len(resp.Lines) != 2 {
+		t.Errorf("unexpected lines: %+v", resp.Lines)
+	}
+}
+
+func TestShellOutput_SeparatesStderr(t *testing.T) {
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	handler := &ShellHandler{sessionMgr: sessionMgr}
+
+	body, _ := json.Marshal(ShellStartRequest{Command: `echo '{"ok":true}'; echo 'warning: slow' >&2`})
+	rec := httptest.NewRecorder()
+	handler.Start(rec, httptest.NewRequest(http.MethodPost, "/shell/start", strings.NewReader(string(body))))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var start ShellStartResponse
+	if err := json.NewDecoder(rec.Body).Decode(&start); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	resp := waitShellStopped(t, handler, start.SessionID)
+
+	if resp.Stdout != "{\"ok\":true}\n" {
+		t.Errorf("stdout = %q", resp.Stdout)
+	}
+	if resp.Stderr != "warning: slow\n" {
+		t.Errorf("stderr = %q", resp.Stderr)
+	}
+	if !strings.Contains(resp.Output, "{\"ok\":true}") || !strings.Contains(resp.Output, "warning: slow") {
+		t.Errorf("combined output = %q, want both streams", resp.Output)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.List(rec, httptest.NewRequest(http.MethodGet, "/shell/list", nil))
+	if !strings.Contains(rec.Body.String(), `"stderrBytes":14`) {
+		t.Errorf("list = %s, want stderrBytes", rec.Body.String())
+	}
+}
+
+func TestShellOutput_LongPoll(t *testing.T) {
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	handler := &ShellHandler{sessionMgr: sessionMgr}
+
+	body, _ := json.Marshal(ShellStartRequest{Command: "sleep 0.2; echo hi; sleep 5"})
+	rec := httptest.NewRecorder()
+	handler.Start(rec, httptest.NewRequest(http.MethodPost, "/shell/start", strings.NewReader(string(body))))
+	var start ShellStartResponse
+	if err := json.NewDecoder(rec.Body).Decode(&start); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	defer sessionMgr.Stop(start.SessionID)
+
+	output := func(query string) (*httptest.ResponseRecorder, time.Duration) {
+		req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/shell/output/"+start.SessionID+query, nil),
+			map[string]string{"sessionId": start.SessionID})
+		rec := httptest.NewRecorder()
+		began := time.Now()
+		handler.Output(rec, req)
+		return rec, time.Since(began)
+	}
+
+	// Blocks until the echo arrives rather than returning the empty buffer
+	rec, elapsed := output("?offset=0&wait=5s")
+	var resp ShellOutputResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode output: %v", err)
+	}
+	if resp.Output != "hi\n" || resp.Offset != 3 {
+		t.Errorf("got output %q offset %d, want \"hi\\n\" 3", resp.Output, resp.Offset)
+	}
+	if elapsed < 100*time.Millisecond || elapsed > 3*time.Second {
+		t.Errorf("long-poll returned after %s", elapsed)
+	}
+
+	// Nothing new past the offset: waits out the timeout
+	rec, elapsed = output("?offset=3&wait=100ms")
+	if rec.Code != http.StatusOK || elapsed < 100*time.Millisecond {
+		t.Errorf("status %d after %s, want 200 after the wait", rec.Code, elapsed)
+	}
+
+	for _, query := range []string{"?wait=soon", "?wait=-1s", "?offset=-1", "?offset=x"} {
+		if rec, _ := output(query); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", query, rec.Code)
+		}
+	}
+}
+
+func TestShellRun(t *testing.T) {
+	// The shell env is cached per process, so put the fake kubectl on PATH in the command itself
+	kubectlDir := filepath.Dir(installFakeKubectl(t, `echo "$@"
+`))
+	handler := &ShellHandler{}
+
+	run := func(req ShellRunRequest) (*httptest.ResponseRecorder, ShellRunResponse) {
+		body, _ := json.Marshal(req)
+		rec := httptest.NewRecorder()
+		handler.Run(rec, httptest.NewRequest(http.MethodPost, "/shell/run", strings.NewReader(string(body))))
+		var resp ShellRunResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec, resp
+	}
+
+	rec, resp := run(ShellRunRequest{Command: "echo out; echo err >&2; exit 3"})
+	if rec.Code != http.StatusOK || resp.Stdout != "out\n" || resp.Stderr != "err\n" || resp.ExitCode != 3 {
+		t.Errorf("status %d, response %+v", rec.Code, resp)
+	}
+
+	// Context is injected into kubectl invocations, as for /shell/start
+	rec, resp = run(ShellRunRequest{Command: "PATH=" + kubectlDir + ":$PATH; kubectl get pods | cat", Context: "dev"})
+	if rec.Code != http.StatusOK || strings.TrimSpace(resp.Stdout) != "--context=dev get pods" {
+		t.Errorf("status %d, stdout %q", rec.Code, resp.Stdout)
+	}
+
+	// Timeout kills the whole pipeline, including background children
+	start := time.Now()
+	rec, resp = run(ShellRunRequest{Command: "echo started; sleep 30 & sleep 30", Timeout: 1})
+	if rec.Code != http.StatusGatewayTimeout || resp.ExitCode != -1 || resp.Stdout != "started\n" {
+		t.Errorf("status %d, response %+v", rec.Code, resp)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("timed-out command took %s to return", elapsed)
+	}
+
+	if rec, _ := run(ShellRunRequest{Command: "true", Context: "dev", ClusterHash: "0000000000000000"}); rec.Code != http.StatusBadRequest {
+		t.Errorf("hash mismatch: status = %d, want 400", rec.Code)
+	}
+	if rec, _ := run(ShellRunRequest{}); rec.Code != http.StatusBadRequest {
+		t.Errorf("empty command: status = %d, want 400", rec.Code)
+	}
+	if rec, _ := run(ShellRunRequest{Command: " \n\t"}); rec.Code != http.StatusBadRequest {
+		t.Errorf("whitespace command: status = %d, want 400", rec.Code)
+	}
+
+	// /shell/start rejects it before starting anything
+	startRec := httptest.NewRecorder()
+	handler.Start(startRec, httptest.NewRequest(http.MethodPost, "/shell/start", strings.NewReader(`{"command":"   "}`)))
+	if startRec.Code != http.StatusBadRequest || !strings.Contains(startRec.Body.String(), "only whitespace") {
+		t.Errorf("whitespace shell start: status %d, body %q", startRec.Code, startRec.Body.String())
+	}
+}
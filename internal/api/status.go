@@ -0,0 +1,77 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/cluster"
+	"github.com/kubedeskpro/kubedesk-helper/internal/session"
+)
+
+// StatusHandler handles /status endpoint
+// Unlike /health it gathers runtime stats, so it isn't meant for liveness probes
+type StatusHandler struct {
+	version    string
+	startedAt  time.Time
+	sessionMgr *session.Manager
+}
+
+// StatusResponse is a diagnostic snapshot of the helper
+type StatusResponse struct {
+	Version                string       `json:"version"`
+	StartedAt              time.Time    `json:"startedAt"`
+	UptimeSeconds          float64      `json:"uptimeSeconds"`
+	Sessions               SessionStats `json:"sessions"`
+	ClusterRegistryEntries int          `json:"clusterRegistryEntries"`
+	Goroutines             int          `json:"goroutines"`
+	Memory                 MemoryStats  `json:"memory"`
+}
+
+// SessionStats counts sessions by type and status
+type SessionStats struct {
+	Total  int                                                   `json:"total"`
+	ByType map[session.SessionType]map[session.SessionStatus]int `json:"byType"`
+}
+
+// MemoryStats is the subset of runtime.MemStats useful for spotting leaks
+type MemoryStats struct {
+	HeapAllocBytes uint64 `json:"heapAllocBytes"`
+	HeapInuseBytes uint64 `json:"heapInuseBytes"`
+	SysBytes       uint64 `json:"sysBytes"`
+	NumGC          uint32 `json:"numGC"`
+}
+
+// Handle processes status requests
+func (h *StatusHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	counts := h.sessionMgr.Counts()
+	total := 0
+	for _, byStatus := range counts {
+		for _, n := range byStatus {
+			total += n
+		}
+	}
+
+	// ReadMemStats briefly stops the world; fine for an on-demand diagnostic endpoint
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	response := StatusResponse{
+		Version:                h.version,
+		StartedAt:              h.startedAt,
+		UptimeSeconds:          time.Since(h.startedAt).Seconds(),
+		Sessions:               SessionStats{Total: total, ByType: counts},
+		ClusterRegistryEntries: cluster.GetRegistry().Len(),
+		Goroutines:             runtime.NumGoroutine(),
+		Memory: MemoryStats{
+			HeapAllocBytes: mem.HeapAlloc,
+			HeapInuseBytes: mem.HeapInuse,
+			SysBytes:       mem.Sys,
+			NumGC:          mem.NumGC,
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
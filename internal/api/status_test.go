@@ -0,0 +1,45 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/session"
+)
+
+func TestStatus(t *testing.T) {
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+
+	sessionMgr.Create(session.TypeProxy)
+	sessionMgr.Create(session.TypeProxy)
+	stopped, _ := sessionMgr.Create(session.TypeShell)
+	sessionMgr.SetStatus(stopped, session.StatusStopped)
+
+	handler := &StatusHandler{version: "1.2.3", startedAt: time.Now().Add(-time.Minute), sessionMgr: sessionMgr}
+	rec := httptest.NewRecorder()
+	handler.Handle(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var resp StatusResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if resp.Version != "1.2.3" || resp.UptimeSeconds < 60 {
+		t.Errorf("unexpected version/uptime: %q %.0fs", resp.Version, resp.UptimeSeconds)
+	}
+	if resp.Sessions.Total != 3 ||
+		resp.Sessions.ByType[session.TypeProxy][session.StatusRunning] != 2 ||
+		resp.Sessions.ByType[session.TypeShell][session.StatusStopped] != 1 {
+		t.Errorf("unexpected session stats: %+v", resp.Sessions)
+	}
+	if resp.Goroutines <= 0 || resp.Memory.SysBytes == 0 {
+		t.Errorf("expected runtime stats, got goroutines=%d memory=%+v", resp.Goroutines, resp.Memory)
+	}
+}
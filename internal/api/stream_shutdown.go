@@ -0,0 +1,27 @@
+package api
+
+import (
+	"context"
+	"net/http"
+)
+
+// streamsClosed is cancelled by CloseStreams when the server starts shutting down
+var streamsClosed, closeStreams = context.WithCancel(context.Background())
+
+// CloseStreams ends every open stream: /events, /watch, and proxied watches and log follows
+// Call it when shutdown starts. http.Server.Shutdown waits for active requests but never cancels
+// them, so a connected app would otherwise hold the drain until its deadline
+func CloseStreams() {
+	closeStreams()
+}
+
+// withStreamShutdown returns r with a context that CloseStreams also cancels
+// Only for responses that run until the client goes away; bounded requests keep draining normally
+func withStreamShutdown(r *http.Request) (*http.Request, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(r.Context())
+	stop := context.AfterFunc(streamsClosed, cancel)
+	return r.WithContext(ctx), func() {
+		stop()
+		cancel()
+	}
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"strings"
+	"sync"
+)
+
+// tailBuffer is a concurrency-safe writer that keeps only the last max bytes written
+// Used to capture a child process's stderr without unbounded memory growth
+type tailBuffer struct {
+	mu  sync.Mutex
+	buf []byte
+	max int
+}
+
+// newTailBuffer creates a tailBuffer retaining at most max bytes
+func newTailBuffer(max int) *tailBuffer {
+	return &tailBuffer{max: max}
+}
+
+// Write implements io.Writer
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.buf = append(b.buf, p...)
+	if over := len(b.buf) - b.max; over > 0 {
+		b.buf = append(b.buf[:0], b.buf[over:]...)
+	}
+	return len(p), nil
+}
+
+// LastLines returns up to n trailing non-empty lines, joined by newlines
+func (b *tailBuffer) LastLines(n int) string {
+	b.mu.Lock()
+	text := string(b.buf)
+	b.mu.Unlock()
+
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,25 @@
+package api
+
+import "testing"
+
+func TestTailBuffer_KeepsLastBytes(t *testing.T) {
+	b := newTailBuffer(8)
+	b.Write([]byte("0123456789"))
+	b.Write([]byte("ab"))
+
+	if got := string(b.buf); got != "456789ab" {
+		t.Errorf("buffer = %q, want %q", got, "456789ab")
+	}
+}
+
+func TestTailBuffer_LastLines(t *testing.T) {
+	b := newTailBuffer(1024)
+	b.Write([]byte("one\n\ntwo\nthree\n  \nfour\n"))
+
+	if got := b.LastLines(2); got != "three\nfour" {
+		t.Errorf("LastLines(2) = %q, want %q", got, "three\nfour")
+	}
+	if got := b.LastLines(10); got != "one\ntwo\nthree\nfour" {
+		t.Errorf("LastLines(10) = %q", got)
+	}
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/cluster"
+	"github.com/kubedeskpro/kubedesk-helper/internal/kubeconfig"
+	"github.com/kubedeskpro/kubedesk-helper/internal/kubectl"
+)
+
+// versionSkewHeader carries the version skew warning on proxied and /exec responses
+const versionSkewHeader = "X-Version-Skew"
+
+// Version skew checks run once per cluster and are cached; a failed check is retried sooner
+const (
+	versionSkewTTL      = time.Hour
+	versionSkewRetryTTL = time.Minute
+	versionSkewTimeout  = 10 * time.Second
+
+	// maxVersionSkew is the minor version difference kubectl supports against its cluster
+	maxVersionSkew = 1
+)
+
+// versionSkewCheck enables the check (KUBECTL_VERSION_CHECK)
+var versionSkewCheck atomic.Bool
+
+// SetVersionSkewCheck turns the kubectl/cluster version skew check on or off
+func SetVersionSkewCheck(enabled bool) {
+	versionSkewCheck.Store(enabled)
+}
+
+// versionSkew caches skew warnings for all handlers
+var versionSkew = &versionSkewChecker{}
+
+// versionSkewChecker caches, per cluster hash, whether kubectl is too far from the cluster's version
+type versionSkewChecker struct {
+	mu      sync.Mutex
+	entries map[string]*versionSkewEntry
+}
+
+// versionSkewEntry is the cached result for one cluster
+type versionSkewEntry struct {
+	warning  string    // Empty if the versions are compatible or unknown
+	expires  time.Time // When the next request starts a new check
+	checking bool
+}
+
+// warning returns the cached skew warning for clusterHash, or "" if there is none
+// A missing or stale result starts a check in the background, so requests never wait for
+// kubectl version; the first requests to a cluster go without a warning
+func (c *versionSkewChecker) warning(clusterHash, kubeconfigPath, contextName string) string {
+	if !versionSkewCheck.Load() || clusterHash == "" {
+		return ""
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := c.entryLocked(clusterHash)
+	if !entry.checking && time.Now().After(entry.expires) {
+		entry.checking = true
+		go c.check(clusterHash, kubeconfigPath, contextName)
+	}
+	return entry.warning
+}
+
+// check runs kubectl version against the cluster and caches the result
+// An inline kubeconfig is read from the cluster registry, where every request registers it
+func (c *versionSkewChecker) check(clusterHash, kubeconfigPath, contextName string) {
+	warning, err := checkVersionSkew(clusterHash, kubeconfigPath, contextName)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := c.entryLocked(clusterHash)
+	entry.checking = false
+	if err != nil {
+		slog.Debug("Version skew check failed", "clusterHash", clusterHash, "context", contextName, "error", err)
+		entry.expires = time.Now().Add(versionSkewRetryTTL)
+		return
+	}
+	if warning != "" && warning != entry.warning {
+		slog.Warn("kubectl version is outside the cluster's supported skew", "clusterHash", clusterHash, "context", contextName, "warning", warning)
+	}
+	entry.warning = warning
+	entry.expires = time.Now().Add(versionSkewTTL)
+}
+
+// entryLocked returns the entry for clusterHash, adding an empty one if there is none
+// Caller must hold c.mu
+func (c *versionSkewChecker) entryLocked(clusterHash string) *versionSkewEntry {
+	if c.entries == nil {
+		c.entries = make(map[string]*versionSkewEntry)
+	}
+	entry, ok := c.entries[clusterHash]
+	if !ok {
+		entry = &versionSkewEntry{}
+		c.entries[clusterHash] = entry
+	}
+	return entry
+}
+
+// checkVersionSkew runs "kubectl version" for the cluster and returns its skew warning
+func checkVersionSkew(clusterHash, kubeconfigPath, contextName string) (string, error) {
+	if kubeconfigPath == "" {
+		content, _, ok := cluster.GetRegistry().Lookup(clusterHash)
+		if !ok {
+			return "", fmt.Errorf("cluster %s is not registered", clusterHash)
+		}
+		if content != "" {
+			tmpFile, release, err := kubeconfig.GetTempManager().Acquire(clusterHash, content)
+			if err != nil {
+				return "", err
+			}
+			defer release()
+			kubeconfigPath = tmpFile
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), versionSkewTimeout)
+	defer cancel()
+	// Non-zero when the server is unreachable, but the output still has the client's version
+	result, err := kubectl.ExecuteWithKubeconfigFile(ctx, []string{"version", "-o", "json", "--request-timeout", "5s"}, kubeconfigPath, contextName)
+	if err != nil {
+		return "", err
+	}
+	return parseVersionSkew(result.Stdout)
+}
+
+// kubeVersion is one side of `kubectl version -o json`
+type kubeVersion struct {
+	Major      string `json:"major"`
+	Minor      string `json:"minor"`
+	GitVersion string `json:"gitVersion"`
+}
+
+// minor returns the numeric minor version; providers append "+" (e.g. EKS's "27+")
+func (v *kubeVersion) minor() (int, error) {
+	return strconv.Atoi(strings.TrimRight(v.Minor, "+"))
+}
+
+// parseVersionSkew returns a warning if the client and server in `kubectl version -o json`
+// output are more than maxVersionSkew minor versions apart, or "" if they are within it
+func parseVersionSkew(stdout string) (string, error) {
+	var out struct {
+		ClientVersion *kubeVersion `json:"clientVersion"`
+		ServerVersion *kubeVersion `json:"serverVersion"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &out); err != nil {
+		return "", fmt.Errorf("unexpected kubectl version output: %w", err)
+	}
+	if out.ClientVersion == nil || out.ServerVersion == nil {
+		return "", fmt.Errorf("kubectl version did not report both client and server versions")
+	}
+	client, server := out.ClientVersion, out.ServerVersion
+	clientMinor, err := client.minor()
+	if err != nil {
+		return "", fmt.Errorf("invalid client minor version %q", client.Minor)
+	}
+	serverMinor, err := server.minor()
+	if err != nil {
+		return "", fmt.Errorf("invalid server minor version %q", server.Minor)
+	}
+	if client.Major != server.Major {
+		return fmt.Sprintf("kubectl %s and the cluster's %s are different major versions", client.GitVersion, server.GitVersion), nil
+	}
+
+	skew := clientMinor - serverMinor
+	switch {
+	case skew > maxVersionSkew:
+		return fmt.Sprintf("kubectl %s is %d minor versions newer than the cluster (%s); kubectl supports a skew of +/-%d", client.GitVersion, skew, server.GitVersion, maxVersionSkew), nil
+	case skew < -maxVersionSkew:
+		return fmt.Sprintf("kubectl %s is %d minor versions older than the cluster (%s); kubectl supports a skew of +/-%d", client.GitVersion, -skew, server.GitVersion, maxVersionSkew), nil
+	}
+	return "", nil
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/cluster"
+	"github.com/kubedeskpro/kubedesk-helper/internal/session"
+)
+
+// versionOutput is `kubectl version -o json` for a 1.30 kubectl and an EKS 1.27 cluster
+const versionOutput = `{
+  "clientVersion": {"major": "1", "minor": "30", "gitVersion": "v1.30.2", "platform": "darwin/arm64"},
+  "kustomizeVersion": "v5.0.4-0.20230601165947-6ce0bf390ce3",
+  "serverVersion": {"major": "1", "minor": "27+", "gitVersion": "v1.27.16-eks-a18cd3a", "platform": "linux/amd64"}
+}`
+
+// enableVersionSkewCheck turns the check on for a test and forgets its cached results afterwards
+func enableVersionSkewCheck(t *testing.T) {
+	t.Helper()
+	SetVersionSkewCheck(true)
+	t.Cleanup(func() {
+		SetVersionSkewCheck(false)
+		versionSkew.mu.Lock()
+		versionSkew.entries = nil
+		versionSkew.mu.Unlock()
+	})
+}
+
+func TestParseVersionSkew(t *testing.T) {
+	version := func(client, server string) string {
+		return `{"clientVersion":{"major":"1","minor":"` + client + `","gitVersion":"v1.` + client + `.0"},` +
+			`"serverVersion":{"major":"1","minor":"` + server + `","gitVersion":"v1.` + server + `.0"}}`
+	}
+	tests := []struct {
+		name    string
+		stdout  string
+		want    string
+		wantErr bool
+	}{
+		{"Newer kubectl", versionOutput, "kubectl v1.30.2 is 3 minor versions newer than the cluster (v1.27.16-eks-a18cd3a)", false},
+		{"Same version", version("29", "29"), "", false},
+		{"One newer", version("30", "29"), "", false},
+		{"One older", version("28", "29"), "", false},
+		{"Two older", version("27", "29"), "kubectl v1.27.0 is 2 minor versions older than the cluster (v1.29.0)", false},
+		{"Server unreachable", `{"clientVersion":{"major":"1","minor":"30","gitVersion":"v1.30.2"}}`, "", true},
+		{"Not JSON", "Client Version: v1.30.2", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseVersionSkew(tt.stdout)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !strings.HasPrefix(got, tt.want) || (tt.want == "") != (got == "") {
+				t.Errorf("warning = %q, want it to start with %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVersionSkew_CheckedOncePerCluster(t *testing.T) {
+	calls := filepath.Join(t.TempDir(), "calls")
+	installFakeKubectl(t, "echo \"$@\" >> "+calls+"\ncat <<'EOF'\n"+versionOutput+"\nEOF\n")
+	enableVersionSkewCheck(t)
+	cluster.GetRegistry().Register("skew0000cluster", "", "dev")
+
+	// The first request only starts the check
+	if got := versionSkew.warning("skew0000cluster", "", "dev"); got != "" {
+		t.Errorf("first warning = %q, want none before the check ran", got)
+	}
+	var warning string
+	for deadline := time.Now().Add(5 * time.Second); warning == ""; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("no warning after the check")
+		}
+		warning = versionSkew.warning("skew0000cluster", "", "dev")
+	}
+	if !strings.Contains(warning, "3 minor versions newer") {
+		t.Errorf("warning = %q", warning)
+	}
+
+	for i := 0; i < 5; i++ {
+		versionSkew.warning("skew0000cluster", "", "dev")
+	}
+	data, _ := os.ReadFile(calls)
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 1 || lines[0] != "--context dev version -o json --request-timeout 5s" {
+		t.Errorf("kubectl calls = %q, want one version call", lines)
+	}
+
+	// Off: no warning even when one is cached
+	SetVersionSkewCheck(false)
+	if got := versionSkew.warning("skew0000cluster", "", "dev"); got != "" {
+		t.Errorf("warning with the check off = %q", got)
+	}
+}
+
+func TestExecute_ReportsVersionSkew(t *testing.T) {
+	installFakeKubectl(t, "case \"$*\" in\n*version*) cat <<'EOF'\n"+versionOutput+"\nEOF\n;;\n*) echo ok ;;\nesac\n")
+	enableVersionSkewCheck(t)
+
+	// Check the cluster up front, as an earlier request would have
+	hash := cluster.ComputeAndRegister("", "dev")
+	versionSkew.check(hash, "", "dev")
+
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	handler := &ExecHandler{sessionMgr: sessionMgr}
+
+	rec := httptest.NewRecorder()
+	body := `{"namespace":"default","podName":"web","container":"app","command":["ls"],"context":"dev"}`
+	handler.Execute(rec, httptest.NewRequest(http.MethodPost, "/exec", strings.NewReader(body)))
+	var resp ExecResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.ExitCode != 0 || !strings.Contains(resp.VersionSkew, "3 minor versions newer") {
+		t.Errorf("response = %+v, want a versionSkew warning", resp)
+	}
+	if rec.Header().Get(versionSkewHeader) != resp.VersionSkew {
+		t.Errorf("%s = %q, want the same warning", versionSkewHeader, rec.Header().Get(versionSkewHeader))
+	}
+}
@@ -0,0 +1,318 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/childproc"
+	"github.com/kubedeskpro/kubedesk-helper/internal/cluster"
+	"github.com/kubedeskpro/kubedesk-helper/internal/env"
+	"github.com/kubedeskpro/kubedesk-helper/internal/kubeconfig"
+	"github.com/kubedeskpro/kubedesk-helper/internal/kubectl"
+	"github.com/kubedeskpro/kubedesk-helper/internal/logging"
+	"github.com/kubedeskpro/kubedesk-helper/internal/session"
+)
+
+// Watch limits for GET /watch
+const (
+	maxWatchResources = 10
+	watchStderrLimit  = 4096 // kubectl stderr kept per watch for its end event
+)
+
+// watchAllNamespaces in a resource spec watches every namespace (kubectl -A)
+const watchAllNamespaces = "*"
+
+// Resource types and namespaces accepted in /watch specs; anything else (e.g. a flag) is rejected
+var (
+	watchTypeRe      = regexp.MustCompile(`^[a-z0-9]([-a-z0-9.]*[a-z0-9])?$`)
+	watchNamespaceRe = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+)
+
+// WatchHandler multiplexes several kubectl watches over one Server-Sent Events stream
+type WatchHandler struct {
+	sessionMgr *session.Manager
+}
+
+// watchSpec is one requested watch
+type watchSpec struct {
+	Resource  string // As requested; tags the watch's events
+	Type      string // e.g. "pods", "deployments.apps"
+	Namespace string // "" = kubectl's default, watchAllNamespaces = all
+}
+
+// WatchEvent is one Kubernetes watch event, tagged with the resource spec it belongs to
+type WatchEvent struct {
+	Resource string          `json:"resource"` // Spec as requested, e.g. "pods" or "kube-system/events"
+	Type     string          `json:"type"`     // ADDED, MODIFIED, DELETED, BOOKMARK or ERROR
+	Object   json.RawMessage `json:"object"`
+}
+
+// WatchEnd is sent when one watch's kubectl process exits; the other watches keep running
+type WatchEnd struct {
+	Resource string `json:"resource"`
+	Error    string `json:"error,omitempty"` // kubectl stderr or exit error, if any
+}
+
+// watchMessage carries an SSE event from a watch goroutine to the stream writer
+type watchMessage struct {
+	event string // "watch" or "watch-end"
+	sess  *session.Session
+	data  any
+}
+
+// parseWatchSpec parses "type" or "namespace/type"; a namespace of "*" watches all namespaces
+func parseWatchSpec(raw, defaultNamespace string) (watchSpec, error) {
+	spec := watchSpec{Resource: raw, Namespace: defaultNamespace}
+	spec.Type = raw
+	if ns, typ, ok := strings.Cut(raw, "/"); ok {
+		spec.Namespace, spec.Type = ns, typ
+	}
+	if !watchTypeRe.MatchString(spec.Type) {
+		return spec, fmt.Errorf("invalid resource type in %q", raw)
+	}
+	if spec.Namespace != "" && spec.Namespace != watchAllNamespaces && !watchNamespaceRe.MatchString(spec.Namespace) {
+		return spec, fmt.Errorf("invalid namespace in %q", raw)
+	}
+	return spec, nil
+}
+
+// args builds the kubectl arguments for the watch
+func (s watchSpec) args(kubeContext string) []string {
+	args := []string{"get", s.Type, "--watch", "--output-watch-events", "-o", "json"}
+	switch s.Namespace {
+	case "":
+	case watchAllNamespaces:
+		args = append(args, "-A")
+	default:
+		args = append(args, "-n", s.Namespace)
+	}
+	if kubeContext != "" {
+		args = append(args, "--context", kubeContext)
+	}
+	return args
+}
+
+// Stream handles GET /watch?resource=pods&resource=kube-system/events&namespace=&context=&clusterHash=&kubeconfigPath=
+// Each resource runs its own `kubectl get --watch` as a watch session; all of them are
+// stopped when the client disconnects
+func (h *WatchHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	r, endStream := withStreamShutdown(r)
+	defer endStream()
+	logger := logging.FromContext(r.Context())
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	q := r.URL.Query()
+	kubeContext := q.Get("context")
+	clusterHash := q.Get("clusterHash")
+	kubeconfigPath := q.Get("kubeconfigPath")
+
+	resources := q["resource"]
+	if len(resources) == 0 {
+		http.Error(w, "Missing required query parameter: resource", http.StatusBadRequest)
+		return
+	}
+	if len(resources) > maxWatchResources {
+		http.Error(w, fmt.Sprintf("Too many resources: %d (max %d)", len(resources), maxWatchResources), http.StatusBadRequest)
+		return
+	}
+	specs := make([]watchSpec, 0, len(resources))
+	for _, raw := range resources {
+		spec, err := parseWatchSpec(raw, q.Get("namespace"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		specs = append(specs, spec)
+	}
+
+	// Kubeconfig content can't travel in a query string, so it comes from kubeconfigPath or the cluster registry
+	var kubeconfigContent string
+	if status, msg := loadKubeconfigPath(&kubeconfigContent, kubeconfigPath); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+	if kubeconfigContent == "" {
+		var regContext string
+		if !resolveHashOnly(logger, &kubeconfigContent, &regContext, clusterHash) {
+			writeRegistryMiss(w, clusterHash)
+			return
+		}
+		if kubeContext == "" {
+			kubeContext = regContext
+		}
+	}
+	if err := checkKubeconfigContext(kubeconfigContent, kubeContext); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if clusterHash == "" {
+		clusterHash = cluster.ComputeHash(kubeconfigContent, kubeContext)
+	}
+	if !cluster.ValidateHash(clusterHash, kubeconfigContent, kubeContext) {
+		logger.Error("Cluster hash validation failed", "providedHash", clusterHash, "resources", resources)
+		http.Error(w, "Cluster hash validation failed", http.StatusBadRequest)
+		return
+	}
+
+	kubectlPath, err := exec.LookPath("kubectl")
+	if err != nil {
+		http.Error(w, "kubectl not found in PATH", http.StatusInternalServerError)
+		return
+	}
+
+	// One kubeconfig for the whole watch; released after every watch process is stopped
+	cmdEnv := env.GetShellEnvironment()
+	if kubeconfigContent != "" {
+		tmpFile, release, err := kubeconfig.GetTempManager().AcquireFile(clusterHash, kubeconfigContent, kubeconfigPath)
+		if err != nil {
+			logger.Error("Failed to write kubeconfig", "error", err)
+			http.Error(w, "Failed to write kubeconfig", http.StatusInternalServerError)
+			return
+		}
+		defer release()
+		cmdEnv = append(cmdEnv, fmt.Sprintf("KUBECONFIG=%s", tmpFile))
+	}
+
+	// Create every session before starting anything, so a session limit fails the request cleanly
+	sessions := make([]*session.Session, 0, len(specs))
+	defer func() {
+		for _, sess := range sessions {
+			h.sessionMgr.Stop(sess.ID)
+		}
+	}()
+	for _, spec := range specs {
+		sess, err := h.sessionMgr.CreateForCluster(session.TypeWatch, clusterHash)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+		sess.ResourceType = spec.Type
+		sess.Namespace = spec.Namespace
+		sess.Context = kubeContext
+		sessions = append(sessions, sess)
+	}
+
+	messages := make(chan watchMessage, 64)
+	done := r.Context().Done()
+	for i, spec := range specs {
+		sess := sessions[i]
+
+		cmd := exec.Command(kubectlPath, spec.args(kubeContext)...)
+		cmd.Env = cmdEnv
+		var stderr bytes.Buffer
+		cmd.Stderr = kubectl.NewOutputLimiter(watchStderrLimit, nil).Writer(&stderr)
+		cmd.WaitDelay = execOutputWaitDelay
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			http.Error(w, "Failed to create stdout pipe", http.StatusInternalServerError)
+			return
+		}
+		sess.Cmd = cmd
+		sess.CommandLine = redactCommandLine(cmd.Args)
+		if err := childproc.Start(cmd); err != nil {
+			logger.Error("Failed to start watch", "error", err, "resource", spec.Resource)
+			http.Error(w, fmt.Sprintf("Failed to start watch for %s: %v", spec.Resource, err), http.StatusInternalServerError)
+			return
+		}
+
+		go h.readWatch(logger, spec.Resource, sess, cmd, stdout, &stderr, messages, done)
+	}
+
+	// CRITICAL: The server's write timeout would otherwise cut the stream
+	clearWriteDeadline(logger, w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	logger.Info("Watch stream opened", "resources", resources, "clusterHash", clusterHash)
+	defer logger.Info("Watch stream closed", "resources", resources, "clusterHash", clusterHash)
+
+	keepalive := time.NewTicker(eventsKeepaliveInterval)
+	defer keepalive.Stop()
+
+	for running := len(specs); running > 0; {
+		select {
+		case <-done:
+			return
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case msg := <-messages:
+			if msg.event == "watch-end" {
+				running--
+			} else {
+				msg.sess.MarkActive() // Streamed events count as reads for inactivity cleanup
+			}
+			data, err := json.Marshal(msg.data)
+			if err != nil {
+				logger.Error("Failed to encode watch event", "error", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", msg.event, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// readWatch decodes kubectl's watch events until it exits, then reports the end of the watch
+func (h *WatchHandler) readWatch(logger *slog.Logger, resource string, sess *session.Session, cmd *exec.Cmd, stdout io.Reader, stderr *bytes.Buffer, messages chan<- watchMessage, done <-chan struct{}) {
+	send := func(msg watchMessage) bool {
+		select {
+		case messages <- msg:
+			return true
+		case <-done:
+			return false
+		}
+	}
+
+	dec := json.NewDecoder(stdout)
+	for {
+		var event struct {
+			Type   string          `json:"type"`
+			Object json.RawMessage `json:"object"`
+		}
+		if err := dec.Decode(&event); err != nil {
+			break
+		}
+		if !send(watchMessage{event: "watch", sess: sess, data: WatchEvent{Resource: resource, Type: event.Type, Object: event.Object}}) {
+			break
+		}
+	}
+
+	// Drain whatever is left so kubectl never blocks on a full pipe before being killed
+	io.Copy(io.Discard, stdout)
+	err := childproc.Wait(cmd)
+
+	end := WatchEnd{Resource: resource}
+	if err != nil {
+		h.sessionMgr.SetStatus(sess, session.StatusFailed)
+		end.Error = strings.TrimSpace(stderr.String())
+		if end.Error == "" {
+			end.Error = err.Error()
+		}
+	} else {
+		h.sessionMgr.SetStatus(sess, session.StatusStopped)
+	}
+	logger.Info("Watch ended", "sessionId", sess.ID, "resource", resource, "error", end.Error)
+	send(watchMessage{event: "watch-end", sess: sess, data: end})
+}
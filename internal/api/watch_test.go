@@ -0,0 +1,128 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/config"
+	"github.com/kubedeskpro/kubedesk-helper/internal/session"
+)
+
+func TestParseWatchSpec(t *testing.T) {
+	tests := []struct {
+		raw           string
+		wantType      string
+		wantNamespace string
+		wantErr       bool
+	}{
+		{"pods", "pods", "default", false},
+		{"kube-system/events", "events", "kube-system", false},
+		{"*/deployments.apps", "deployments.apps", "*", false},
+		{"--kubeconfig=/etc/x", "", "", true},
+		{"default/-A", "", "", true},
+		{"Bad_NS/pods", "", "", true},
+		{"", "", "", true},
+	}
+	for _, tt := range tests {
+		spec, err := parseWatchSpec(tt.raw, "default")
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseWatchSpec(%q) = %+v, want error", tt.raw, spec)
+			}
+			continue
+		}
+		if err != nil || spec.Type != tt.wantType || spec.Namespace != tt.wantNamespace || spec.Resource != tt.raw {
+			t.Errorf("parseWatchSpec(%q) = %+v, %v; want type %q namespace %q", tt.raw, spec, err, tt.wantType, tt.wantNamespace)
+		}
+	}
+}
+
+func TestWatch_MultiplexesAndStopsOnDisconnect(t *testing.T) {
+	installFakeKubectl(t, `case "$2" in
+  pods) echo '{"type":"ADDED","object":{"args":"'"$*"'"}}' ;;
+  events) printf '{\n  "type": "MODIFIED",\n  "object": {"args": "%s"}\n}\n' "$*" ;;
+  *) echo "error: the server doesn't have a resource type \"$2\"" >&2; exit 1 ;;
+esac
+exec sleep 30
+`)
+
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	defer sessionMgr.StopAll()
+	server := httptest.NewServer(NewRouter("test", sessionMgr, config.Default()))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/watch?namespace=default&resource=pods&resource=*/events&resource=bogus", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /watch: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("status %d, content type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	events := make(map[string]WatchEvent)
+	var ended WatchEnd
+	scanner := bufio.NewScanner(resp.Body)
+	var name string
+	for (len(events) < 2 || ended.Resource == "") && scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: ") && name == "watch":
+			var ev WatchEvent
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &ev); err != nil {
+				t.Fatalf("decode watch event: %v", err)
+			}
+			events[ev.Resource] = ev
+		case strings.HasPrefix(line, "data: ") && name == "watch-end":
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &ended); err != nil {
+				t.Fatalf("decode watch end: %v", err)
+			}
+		}
+	}
+
+	if ev := events["pods"]; ev.Type != "ADDED" || !strings.Contains(string(ev.Object), "--watch --output-watch-events -o json -n default") {
+		t.Errorf("pods event = %+v", ev)
+	}
+	if ev := events["*/events"]; ev.Type != "MODIFIED" || !strings.Contains(string(ev.Object), "-A") {
+		t.Errorf("events event = %+v", ev)
+	}
+	if ended.Resource != "bogus" || !strings.Contains(ended.Error, "doesn't have a resource type") {
+		t.Errorf("watch end = %+v", ended)
+	}
+
+	// Dropping the connection stops the remaining kubectl watches
+	cancel()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(sessionMgr.List(session.TypeWatch)) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d watch sessions still running after disconnect", len(sessionMgr.List(session.TypeWatch)))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWatch_InvalidRequest(t *testing.T) {
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	handler := &WatchHandler{sessionMgr: sessionMgr}
+
+	for _, query := range []string{"", "resource=--raw", "resource=pods" + strings.Repeat("&resource=pods", maxWatchResources)} {
+		rec := httptest.NewRecorder()
+		handler.Stream(rec, httptest.NewRequest(http.MethodGet, "/watch?"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("query %q: status = %d, want 400", query, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// clearWriteDeadline lifts the server's HTTP_WRITE_TIMEOUT for one response
+// Only for handlers that bound their own duration: streams that end when the client goes away,
+// long polls capped by maxOutputWait, and commands that run under a request timeout
+func clearWriteDeadline(logger *slog.Logger, w http.ResponseWriter) {
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		logger.Debug("Could not clear write deadline", "error", err)
+	}
+}
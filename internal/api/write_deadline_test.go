@@ -0,0 +1,105 @@
+package api
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/config"
+	"github.com/kubedeskpro/kubedesk-helper/internal/session"
+)
+
+// testWriteTimeout stands in for HTTP_WRITE_TIMEOUT; the streams below outlive it several times over
+const testWriteTimeout = 200 * time.Millisecond
+
+// newTimeoutTestServer serves the full router with the write timeout main.go configures
+func newTimeoutTestServer(t *testing.T, sessionMgr *session.Manager) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(NewRouter("test", sessionMgr, config.Default()))
+	srv.Config.WriteTimeout = testWriteTimeout
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestStreamsOutliveWriteTimeout(t *testing.T) {
+	sessionMgr := session.NewManager()
+	defer sessionMgr.Shutdown()
+	srv := newTimeoutTestServer(t, sessionMgr)
+
+	t.Run("Events", func(t *testing.T) {
+		resp, err := http.Get(srv.URL + "/events")
+		if err != nil {
+			t.Fatalf("GET /events: %v", err)
+		}
+		defer resp.Body.Close()
+
+		time.Sleep(3 * testWriteTimeout)
+		if _, err := sessionMgr.Create(session.TypeShell); err != nil {
+			t.Fatalf("create session: %v", err)
+		}
+
+		line, err := bufio.NewReader(resp.Body).ReadString('\n')
+		if err != nil || line != "event: created\n" {
+			t.Errorf("first line = %q, err = %v; the stream was cut by the write timeout", line, err)
+		}
+	})
+
+	t.Run("Proxied watch", func(t *testing.T) {
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("{\"type\":\"ADDED\"}\n"))
+			w.(http.Flusher).Flush()
+			time.Sleep(3 * testWriteTimeout)
+			w.Write([]byte("{\"type\":\"MODIFIED\"}\n"))
+		}))
+		defer upstream.Close()
+
+		_, portStr, _ := net.SplitHostPort(upstream.Listener.Addr().String())
+		sess, _ := sessionMgr.CreateForCluster(session.TypeProxy, "streamhash")
+		sess.Port, _ = strconv.Atoi(portStr)
+		defer sessionMgr.Stop(sess.ID)
+
+		resp, err := http.Get(srv.URL + "/proxy/streamhash/api/v1/pods?watch=true")
+		if err != nil {
+			t.Fatalf("GET watch: %v", err)
+		}
+		defer resp.Body.Close()
+
+		// The first event must arrive before the upstream finishes, not when the response ends
+		reader := bufio.NewReader(resp.Body)
+		firstLine := make(chan string, 1)
+		go func() {
+			line, _ := reader.ReadString('\n')
+			firstLine <- line
+		}()
+		select {
+		case line := <-firstLine:
+			if line != "{\"type\":\"ADDED\"}\n" {
+				t.Errorf("first event = %q", line)
+			}
+		case <-time.After(2 * testWriteTimeout):
+			t.Fatal("first watch event was not flushed to the client")
+		}
+
+		rest, err := io.ReadAll(reader)
+		if err != nil || string(rest) != "{\"type\":\"MODIFIED\"}\n" {
+			t.Errorf("rest of stream = %q, err = %v; the stream was cut by the write timeout", rest, err)
+		}
+
+		// Without ?watch the write timeout still applies
+		resp, err = http.Get(srv.URL + "/proxy/streamhash/api/v1/pods")
+		if err == nil {
+			body, readErr := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if readErr == nil && strings.Contains(string(body), "MODIFIED") {
+				t.Error("a plain request outlived the write timeout")
+			}
+		}
+	})
+}
@@ -0,0 +1,163 @@
+// Package childproc makes sure the processes the helper spawns don't outlive it
+//
+// Proxies, port-forwards and sessions keep kubectl running for as long as the app wants them,
+// holding ports and temp kubeconfigs. If the helper is killed (kill -9, a crash) they would be
+// left running:
+//   - On Linux the kernel sends them SIGKILL when the helper dies (Pdeathsig)
+//   - Elsewhere (macOS) a watchdog process kills the children the helper registered with it once
+//     the helper's end of its stdin pipe closes, which happens however the helper exits
+package childproc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+)
+
+// watchdogEnv is set, to the helper's PID, in the environment of the watchdog process
+const watchdogEnv = "KUBEDESK_HELPER_WATCHDOG"
+
+var (
+	mu       sync.Mutex
+	watchdog io.WriteCloser // The watchdog's stdin; nil if none is running
+)
+
+// Configure makes cmd's process die with the helper where the OS supports it; call before Start
+// Start does this already
+func Configure(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	setParentDeathSignal(cmd.SysProcAttr)
+}
+
+// Start configures and starts cmd and registers it with the watchdog, if one is running
+// Commands started this way must be waited for with Wait
+func Start(cmd *exec.Cmd) error {
+	Configure(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	notify('+', cmd.Process.Pid)
+	return nil
+}
+
+// Wait waits for a command started with Start and unregisters it from the watchdog
+func Wait(cmd *exec.Cmd) error {
+	err := cmd.Wait()
+	notify('-', cmd.Process.Pid)
+	return err
+}
+
+// Run starts cmd with Start and waits for it to complete, like cmd.Run
+func Run(cmd *exec.Cmd) error {
+	if err := Start(cmd); err != nil {
+		return err
+	}
+	return Wait(cmd)
+}
+
+// notify tells the watchdog a child started (+) or exited (-)
+func notify(op byte, pid int) {
+	mu.Lock()
+	defer mu.Unlock()
+	if watchdog == nil {
+		return
+	}
+	if _, err := fmt.Fprintf(watchdog, "%c%d\n", op, pid); err != nil {
+		slog.Error("Child process watchdog is gone; children will outlive a crash", "error", err)
+		watchdog.Close()
+		watchdog = nil
+	}
+}
+
+// StartWatchdog starts the watchdog process on platforms without a parent-death signal
+// The watchdog is a copy of the helper binary; main must call RunWatchdog first thing
+func StartWatchdog() error {
+	if !needsWatchdog {
+		return nil
+	}
+	return startWatchdog()
+}
+
+// startWatchdog re-executes the current binary with args as the watchdog
+func startWatchdog(args ...string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find helper binary: %w", err)
+	}
+
+	cmd := exec.Command(exe, args...)
+	cmd.Env = append(os.Environ(), watchdogEnv+"="+strconv.Itoa(os.Getpid()))
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("failed to create watchdog pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start watchdog: %w", err)
+	}
+	go cmd.Wait() // Reap it should it ever exit early
+
+	mu.Lock()
+	defer mu.Unlock()
+	watchdog = stdin
+	return nil
+}
+
+// RunWatchdog runs the watchdog if this process was started as one by StartWatchdog, and reports
+// whether it did; the watchdog only returns once the helper has exited
+func RunWatchdog() bool {
+	helperPID := os.Getenv(watchdogEnv)
+	if helperPID == "" {
+		return false
+	}
+
+	// Ctrl-C in a terminal, or pkill kubedesk-helper, signals the watchdog along with the helper
+	// It keeps running until the helper has exited, in case the helper's shutdown doesn't finish
+	signal.Ignore(syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+
+	if killed := watch(os.Stdin); killed > 0 {
+		slog.Warn("Helper exited without stopping its children - killed them", "helperPid", helperPID, "killed", killed)
+	}
+	return true
+}
+
+// watch tracks the children announced on r and, once r is closed, kills those still registered
+// Returns the number of children killed
+func watch(r io.Reader) int {
+	children := make(map[int]bool)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(line) < 2 {
+			continue
+		}
+		pid, err := strconv.Atoi(line[1:])
+		if err != nil || pid <= 0 {
+			continue
+		}
+		switch line[0] {
+		case '+':
+			children[pid] = true
+		case '-':
+			delete(children, pid)
+		}
+	}
+
+	// After a clean shutdown every child has already been stopped and unregistered
+	for pid := range children {
+		// Shell sessions lead their own process group; take the commands they started with them
+		syscall.Kill(-pid, syscall.SIGKILL)
+		syscall.Kill(pid, syscall.SIGKILL)
+	}
+	return len(children)
+}
@@ -0,0 +1,15 @@
+//go:build linux
+
+package childproc
+
+import "syscall"
+
+// The kernel kills children when the helper dies, so no watchdog is needed
+const needsWatchdog = false
+
+// setParentDeathSignal has the kernel SIGKILL the child when the helper exits
+// Strictly, when the thread that started it exits; the Go runtime keeps its threads for the
+// life of the process
+func setParentDeathSignal(attr *syscall.SysProcAttr) {
+	attr.Pdeathsig = syscall.SIGKILL
+}
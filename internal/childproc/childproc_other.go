@@ -0,0 +1,11 @@
+//go:build !linux
+
+package childproc
+
+import "syscall"
+
+// Without a parent-death signal, the watchdog kills children the helper leaves behind
+const needsWatchdog = true
+
+// setParentDeathSignal is a no-op; see StartWatchdog
+func setParentDeathSignal(attr *syscall.SysProcAttr) {}
@@ -0,0 +1,140 @@
+package childproc
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestHelperProcess stands in for the helper: it starts a long-lived child, prints its PID and
+// waits to be killed
+func TestHelperProcess(t *testing.T) {
+	mode := os.Getenv("CHILDPROC_TEST_HELPER")
+	if mode == "" {
+		return
+	}
+
+	child := exec.Command("sleep", "60")
+	var err error
+	switch mode {
+	case "default":
+		if err = StartWatchdog(); err == nil {
+			err = Start(child)
+		}
+	case "watchdog":
+		// Forced even where a parent-death signal exists, and without one set on the child
+		if err = startWatchdog("-test.run=^TestHelperWatchdog$"); err == nil {
+			if err = child.Start(); err == nil {
+				notify('+', child.Process.Pid)
+			}
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Println(child.Process.Pid)
+	time.Sleep(time.Hour)
+}
+
+// TestHelperWatchdog is the watchdog process started by TestHelperProcess
+func TestHelperWatchdog(t *testing.T) {
+	if RunWatchdog() {
+		os.Exit(0)
+	}
+}
+
+// processRunning reports whether pid is running; zombies waiting to be reaped don't count
+func processRunning(pid int) bool {
+	out, err := exec.Command("ps", "-o", "stat=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return false
+	}
+	stat := strings.TrimSpace(string(out))
+	return stat != "" && !strings.HasPrefix(stat, "Z")
+}
+
+func TestChildrenDieWithHelper(t *testing.T) {
+	for _, mode := range []string{"default", "watchdog"} {
+		t.Run(mode, func(t *testing.T) {
+			helper := exec.Command(os.Args[0], "-test.run=^TestHelperProcess$")
+			helper.Env = append(os.Environ(), "CHILDPROC_TEST_HELPER="+mode)
+			helper.Stderr = os.Stderr
+			stdout, err := helper.StdoutPipe()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := helper.Start(); err != nil {
+				t.Fatalf("start helper: %v", err)
+			}
+			defer helper.Process.Kill()
+
+			line, err := bufio.NewReader(stdout).ReadString('\n')
+			if err != nil {
+				t.Fatalf("read child PID: %v", err)
+			}
+			pid, err := strconv.Atoi(strings.TrimSpace(line))
+			if err != nil {
+				t.Fatalf("bad child PID %q", line)
+			}
+			t.Cleanup(func() { syscall.Kill(pid, syscall.SIGKILL) })
+			if !processRunning(pid) {
+				t.Fatal("child is not running")
+			}
+
+			// kill -9: the helper gets no chance to stop its children
+			helper.Process.Kill()
+			helper.Wait()
+
+			for deadline := time.Now().Add(5 * time.Second); processRunning(pid); {
+				if time.Now().After(deadline) {
+					t.Fatalf("child %d survived the helper", pid)
+				}
+				time.Sleep(20 * time.Millisecond)
+			}
+		})
+	}
+}
+
+func TestWatch_KillsChildrenStillRegistered(t *testing.T) {
+	start := func() (*exec.Cmd, <-chan struct{}) {
+		cmd := exec.Command("sleep", "60")
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		exited := make(chan struct{})
+		go func() {
+			cmd.Wait()
+			close(exited)
+		}()
+		t.Cleanup(func() {
+			cmd.Process.Kill()
+			<-exited
+		})
+		return cmd, exited
+	}
+	running, runningExited := start()
+	stopped, stoppedExited := start()
+
+	input := fmt.Sprintf("+%d\n+%d\ngarbage\n-%d\n", running.Process.Pid, stopped.Process.Pid, stopped.Process.Pid)
+	if killed := watch(strings.NewReader(input)); killed != 1 {
+		t.Errorf("watch killed %d children, want 1", killed)
+	}
+
+	select {
+	case <-runningExited:
+	case <-time.After(5 * time.Second):
+		t.Error("registered child still running")
+	}
+	select {
+	case <-stoppedExited:
+		t.Error("unregistered child was killed")
+	default:
+	}
+}
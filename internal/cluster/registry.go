@@ -1,20 +1,30 @@
 package cluster
 
 import (
+	"log/slog"
 	"sync"
+	"time"
 )
 
 // ClusterInfo stores the kubeconfig and context for a cluster hash
+// The kubeconfig is kept as bytes so it can be zeroed when the entry is evicted or replaced
 type ClusterInfo struct {
-	Kubeconfig string
+	kubeconfig []byte
 	Context    string
+
+	lastAccess time.Time // Updated on Register and Lookup; drives TTL and LRU eviction
 }
 
 // Registry stores the mapping of cluster hash to cluster info
 // This allows us to look up kubeconfig/context from just the hash
+// Entries hold full kubeconfig contents, so they are evicted once idle or over the size limit
 type Registry struct {
 	mu       sync.RWMutex
 	clusters map[string]ClusterInfo
+
+	maxEntries   int           // 0 = unlimited
+	ttl          time.Duration // Idle time before an entry expires, 0 = never
+	stopEviction chan struct{}
 }
 
 // Global registry instance
@@ -28,18 +38,24 @@ func GetRegistry() *Registry {
 }
 
 // Register stores the cluster info for a given hash
+// Evicts the least recently used entry if this pushes the registry over its size limit
 func (r *Registry) Register(hash, kubeconfig, context string) {
 	if hash == "" {
 		return
 	}
-	
+
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	
+
+	if old, ok := r.clusters[hash]; ok {
+		clear(old.kubeconfig)
+	}
 	r.clusters[hash] = ClusterInfo{
-		Kubeconfig: kubeconfig,
+		kubeconfig: []byte(kubeconfig),
 		Context:    context,
+		lastAccess: time.Now(),
 	}
+	r.evictOverflowLocked()
 }
 
 // Lookup retrieves the cluster info for a given hash
@@ -48,16 +64,131 @@ func (r *Registry) Lookup(hash string) (string, string, bool) {
 	if hash == "" {
 		return "", "", false
 	}
-	
-	r.mu.RLock()
-	defer r.mu.RUnlock()
-	
+
+	// Write lock: a hit refreshes the entry's last-access time
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	info, found := r.clusters[hash]
 	if !found {
 		return "", "", false
 	}
-	
-	return info.Kubeconfig, info.Context, true
+
+	// Expired entries are treated as gone even before the eviction loop removes them
+	now := time.Now()
+	if r.expiredLocked(info, now) {
+		r.removeLocked(hash)
+		return "", "", false
+	}
+
+	info.lastAccess = now
+	r.clusters[hash] = info
+	return string(info.kubeconfig), info.Context, true
+}
+
+// Len returns the number of registered clusters
+func (r *Registry) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.clusters)
+}
+
+// SetLimits sets the maximum entry count and idle TTL (0 disables either limit)
+func (r *Registry) SetLimits(maxEntries int, ttl time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.maxEntries = maxEntries
+	r.ttl = ttl
+	r.evictOverflowLocked()
+}
+
+// StartEviction runs a background loop that removes expired entries every interval
+// Stop it with StopEviction
+func (r *Registry) StartEviction(interval time.Duration) {
+	r.mu.Lock()
+	if r.stopEviction != nil {
+		r.mu.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	r.stopEviction = stop
+	r.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if n := r.evict(time.Now()); n > 0 {
+					slog.Debug("Evicted cluster registry entries", "count", n, "remaining", r.Len())
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// StopEviction stops the background eviction loop
+func (r *Registry) StopEviction() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stopEviction != nil {
+		close(r.stopEviction)
+		r.stopEviction = nil
+	}
+}
+
+// evict removes entries idle past the TTL as of now, then trims to the size limit
+// Returns the number of entries removed
+func (r *Registry) evict(now time.Time) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	removed := 0
+	for hash, info := range r.clusters {
+		if r.expiredLocked(info, now) {
+			r.removeLocked(hash)
+			removed++
+		}
+	}
+	return removed + r.evictOverflowLocked()
+}
+
+// expiredLocked reports whether info has been idle longer than the TTL
+// Caller must hold r.mu
+func (r *Registry) expiredLocked(info ClusterInfo, now time.Time) bool {
+	return r.ttl > 0 && now.Sub(info.lastAccess) > r.ttl
+}
+
+// evictOverflowLocked removes least recently used entries until the size limit is met
+// Caller must hold r.mu for writing
+func (r *Registry) evictOverflowLocked() int {
+	removed := 0
+	for r.maxEntries > 0 && len(r.clusters) > r.maxEntries {
+		var oldestHash string
+		var oldest time.Time
+		for hash, info := range r.clusters {
+			if oldestHash == "" || info.lastAccess.Before(oldest) {
+				oldestHash, oldest = hash, info.lastAccess
+			}
+		}
+		r.removeLocked(oldestHash)
+		removed++
+	}
+	return removed
+}
+
+// removeLocked deletes an entry after zeroing its kubeconfig bytes
+// Strings already returned by Lookup are copies and are left to the GC
+// Caller must hold r.mu for writing
+func (r *Registry) removeLocked(hash string) {
+	if info, ok := r.clusters[hash]; ok {
+		clear(info.kubeconfig)
+		delete(r.clusters, hash)
+	}
 }
 
 // ComputeAndRegister computes the hash and registers it in one operation
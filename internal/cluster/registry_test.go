@@ -2,6 +2,7 @@ package cluster
 
 import (
 	"testing"
+	"time"
 )
 
 func TestRegistry_RegisterAndLookup(t *testing.T) {
@@ -144,3 +145,111 @@ func TestValidateAndLookup(t *testing.T) {
 	}
 }
 
+
+func TestRegistry_EvictsLeastRecentlyUsed(t *testing.T) {
+	registry := &Registry{
+		clusters: make(map[string]ClusterInfo),
+	}
+	registry.SetLimits(2, 0)
+
+	registry.Register("a", "config-a", "ctx-a")
+	time.Sleep(time.Millisecond)
+	registry.Register("b", "config-b", "ctx-b")
+	time.Sleep(time.Millisecond)
+
+	// Touch "a" so "b" becomes the least recently used
+	if _, _, found := registry.Lookup("a"); !found {
+		t.Fatal("expected a to be registered")
+	}
+	time.Sleep(time.Millisecond)
+	registry.Register("c", "config-c", "ctx-c")
+
+	if n := registry.Len(); n != 2 {
+		t.Errorf("expected 2 entries, got %d", n)
+	}
+	if _, _, found := registry.Lookup("b"); found {
+		t.Errorf("expected b to be evicted")
+	}
+	for _, hash := range []string{"a", "c"} {
+		if _, _, found := registry.Lookup(hash); !found {
+			t.Errorf("expected %s to be kept", hash)
+		}
+	}
+}
+
+func TestRegistry_EvictsExpired(t *testing.T) {
+	registry := &Registry{
+		clusters: make(map[string]ClusterInfo),
+	}
+	registry.SetLimits(0, time.Hour)
+
+	registry.Register("old", "config-old", "ctx")
+	registry.Register("new", "config-new", "ctx")
+
+	// Age "old" past the TTL
+	registry.mu.Lock()
+	info := registry.clusters["old"]
+	info.lastAccess = time.Now().Add(-2 * time.Hour)
+	registry.clusters["old"] = info
+	registry.mu.Unlock()
+
+	// Lookup treats an expired entry as gone
+	if _, _, found := registry.Lookup("old"); found {
+		t.Errorf("expected expired entry to be hidden from Lookup")
+	}
+
+	// The eviction pass removes entries that are idle as of its clock
+	if n := registry.evict(time.Now().Add(2 * time.Hour)); n != 1 {
+		t.Errorf("expected 1 entry evicted, got %d", n)
+	}
+	if n := registry.Len(); n != 0 {
+		t.Errorf("expected empty registry, got %d entries", n)
+	}
+}
+
+func TestRegistry_EvictionLoop(t *testing.T) {
+	registry := &Registry{
+		clusters: make(map[string]ClusterInfo),
+	}
+	registry.SetLimits(0, 10*time.Millisecond)
+	registry.Register("a", "config-a", "ctx-a")
+
+	registry.StartEviction(5 * time.Millisecond)
+	defer registry.StopEviction()
+
+	deadline := time.Now().Add(time.Second)
+	for registry.Len() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected background loop to evict the expired entry")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRegistry_EvictionScrubsKubeconfig(t *testing.T) {
+	registry := &Registry{
+		clusters: make(map[string]ClusterInfo),
+	}
+	registry.SetLimits(1, 0)
+
+	registry.Register("a", "token: secret-a", "ctx")
+	stored := registry.clusters["a"].kubeconfig
+
+	// Registering a second entry evicts the first
+	registry.Register("b", "token: secret-b", "ctx")
+	if _, _, found := registry.Lookup("a"); found {
+		t.Fatal("expected a to be evicted")
+	}
+	for i, b := range stored {
+		if b != 0 {
+			t.Fatalf("expected evicted kubeconfig to be zeroed, byte %d = %q", i, b)
+		}
+	}
+
+	// Values returned by Lookup are copies and survive a later eviction
+	kubeconfig, _, _ := registry.Lookup("b")
+	registry.Register("c", "token: secret-c", "ctx")
+	if kubeconfig != "token: secret-b" {
+		t.Errorf("Lookup result changed after eviction: %q", kubeconfig)
+	}
+}
@@ -0,0 +1,443 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default proxy port range (helper itself listens on 47823)
+const (
+	DefaultProxyPortMin = 47824
+	DefaultProxyPortMax = 57823
+)
+
+// Default kubectl proxy readiness wait (previously a fixed 30x100ms)
+const (
+	DefaultProxyReadyTimeout  = 3 * time.Second
+	DefaultProxyReadyInterval = 100 * time.Millisecond
+)
+
+// DefaultMaxSessions caps running sessions so a client bug can't spawn unbounded kubectl processes
+const DefaultMaxSessions = 200
+
+// Default cluster registry limits; entries hold kubeconfig contents, so don't keep them forever
+const (
+	DefaultRegistryMaxEntries = 100
+	DefaultRegistryTTL        = time.Hour
+)
+
+// DefaultShutdownTimeout bounds graceful shutdown: draining requests, stopping sessions and flushing logs
+const DefaultShutdownTimeout = 10 * time.Second
+
+// Default HTTP server timeouts; streaming and long-poll endpoints lift the write timeout per request
+const (
+	DefaultHTTPReadTimeout  = 60 * time.Second
+	DefaultHTTPWriteTimeout = 15 * time.Second
+	DefaultHTTPIdleTimeout  = 60 * time.Second
+)
+
+// DefaultProxyPIDFile returns where the helper records running kubectl proxies unless PROXY_PID_FILE is set
+func DefaultProxyPIDFile() string {
+	return filepath.Join(os.TempDir(), "kubedesk-helper-proxies.json")
+}
+
+// DefaultMaxOutputBytes caps output buffered by /exec, /kubectl and /exec-auth so one huge
+// command can't exhaust the helper's memory
+const DefaultMaxOutputBytes = 64 << 20
+
+// DefaultExecAuthEnvAllow lists env vars /exec-auth passes to credential plugins
+// A trailing * matches any suffix
+var DefaultExecAuthEnvAllow = []string{
+	"AWS_*",
+	"GOOGLE_*",
+	"CLOUDSDK_*",
+	"AZURE_*",
+	"AAD_*",
+	"KUBERNETES_EXEC_INFO",
+}
+
+// deniedExecAuthEnv can alter which binary or library a plugin runs; never allowed, even if configured
+var deniedExecAuthEnv = []string{
+	"PATH",
+	"LD_*",
+	"DYLD_*",
+	"BASH_ENV",
+	"ENV",
+	"IFS",
+	"SHELLOPTS",
+	"PYTHONPATH",
+	"PYTHONSTARTUP",
+	"NODE_OPTIONS",
+	"PERL5OPT",
+	"RUBYOPT",
+}
+
+// envPatternRe matches an env var name, optionally ending in * for a prefix match
+var envPatternRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*\*?$`)
+
+// Bounds for any configured port (no privileged ports)
+const (
+	minAllowedPort = 1024
+	maxAllowedPort = 65535
+)
+
+// Config holds helper settings that can be overridden via environment variables
+type Config struct {
+	ProxyPortMin int // PROXY_PORT_MIN
+	ProxyPortMax int // PROXY_PORT_MAX
+
+	ProxyReadyTimeout  time.Duration // PROXY_READY_TIMEOUT, e.g. "5s"
+	ProxyReadyInterval time.Duration // PROXY_READY_INTERVAL, initial poll interval (backs off)
+
+	// PROXY_PID_FILE, where running kubectl proxies are recorded so the next start can stop any a crash
+	// left behind. Load defaults it to DefaultProxyPIDFile(); Default leaves it empty (not recorded)
+	// so routers built in tests never touch the running helper's file
+	ProxyPIDFile string
+
+	ProxyUserAgent bool // PROXY_USER_AGENT, prefix forwarded proxy requests' User-Agent with kubedesk-helper/<version>
+
+	MaxSessions int // MAX_SESSIONS, running sessions across all types; 0 = unlimited
+
+	MaxProxies int // MAX_PROXIES, running kubectl proxies; starting one more evicts the least recently used; 0 = unlimited
+
+	RegistryMaxEntries int           // REGISTRY_MAX_ENTRIES, cluster hashes kept for hash-only lookups; 0 = unlimited
+	RegistryTTL        time.Duration // REGISTRY_TTL, idle time before a registry entry is evicted; 0 = never
+
+	ExecAuthEnvAllow []string // EXEC_AUTH_ENV_ALLOW, comma-separated extra env patterns for /exec-auth (e.g. "OCI_*,VAULT_ADDR")
+
+	ResponseCacheTTL time.Duration // RESPONSE_CACHE_TTL, cache read-only proxy and /kubectl responses this long; 0 = disabled
+
+	KubectlStrictArgs bool // KUBECTL_STRICT_ARGS, reject /kubectl flags that override credentials or the server
+
+	KubectlVersionCheck bool // KUBECTL_VERSION_CHECK, warn on proxy and /exec responses when kubectl is too old or new for the cluster
+
+	MaxOutputBytes int // MAX_OUTPUT_BYTES, output kept from a synchronous command before it is killed; 0 = unlimited
+
+	// Resource limits for each /shell command and everything it starts, and for /exec kubectl processes; 0 = unlimited; Linux only
+	ShellMaxMemoryMB   int // SHELL_MAX_MEMORY_MB, virtual memory (RLIMIT_AS) in MiB
+	ShellMaxCPUSeconds int // SHELL_MAX_CPU_SECONDS, CPU time (RLIMIT_CPU) of each process
+	ShellMaxOpenFiles  int // SHELL_MAX_OPEN_FILES, open file descriptors (RLIMIT_NOFILE) of each process
+
+	ShutdownTimeout time.Duration // HELPER_SHUTDOWN_TIMEOUT, total time allowed for graceful shutdown
+
+	HTTPReadTimeout  time.Duration // HTTP_READ_TIMEOUT, time to read a whole request including its body; 0 = none
+	HTTPWriteTimeout time.Duration // HTTP_WRITE_TIMEOUT, time to write a response, except on streaming routes; 0 = none
+	HTTPIdleTimeout  time.Duration // HTTP_IDLE_TIMEOUT, how long an idle keep-alive connection stays open; 0 = HTTP_READ_TIMEOUT
+
+	DebugToken string // HELPER_DEBUG_TOKEN, bearer token for /debug endpoints; empty = disabled
+
+	AuthTokenFile string // HELPER_AUTH_TOKEN_FILE, where the API bearer token is written; empty = no token auth
+
+	ExtraPath []string // HELPER_EXTRA_PATH, colon-separated absolute directories put first on kubectl's PATH (e.g. kubectl plugins)
+
+	SkipShellEnv bool // HELPER_SKIP_SHELL_ENV, use the inherited environment instead of loading the user's login shell
+
+	LogLevel slog.Level // LOG_LEVEL, "debug", "info" or "warn"
+
+	File string // HELPER_CONFIG, the YAML or JSON file settings were read from; empty = environment only
+}
+
+// Default returns the built-in configuration
+func Default() *Config {
+	return &Config{
+		ProxyPortMin: DefaultProxyPortMin,
+		ProxyPortMax: DefaultProxyPortMax,
+
+		ProxyReadyTimeout:  DefaultProxyReadyTimeout,
+		ProxyReadyInterval: DefaultProxyReadyInterval,
+
+		ProxyUserAgent: true,
+
+		MaxSessions: DefaultMaxSessions,
+
+		RegistryMaxEntries: DefaultRegistryMaxEntries,
+		RegistryTTL:        DefaultRegistryTTL,
+
+		MaxOutputBytes: DefaultMaxOutputBytes,
+
+		ShutdownTimeout: DefaultShutdownTimeout,
+
+		HTTPReadTimeout:  DefaultHTTPReadTimeout,
+		HTTPWriteTimeout: DefaultHTTPWriteTimeout,
+		HTTPIdleTimeout:  DefaultHTTPIdleTimeout,
+	}
+}
+
+// Load builds the configuration from the HELPER_CONFIG file, if any, and environment
+// variables, which take precedence over the file, and validates it
+func Load() (*Config, error) {
+	path := os.Getenv("HELPER_CONFIG")
+	if path == "" {
+		return load(os.Getenv)
+	}
+	file, err := readConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := load(func(key string) string {
+		if v := os.Getenv(key); v != "" {
+			return v
+		}
+		return file[key]
+	})
+	if err != nil {
+		return nil, err
+	}
+	cfg.File = path
+	return cfg, nil
+}
+
+// load reads settings through getenv so tests don't have to touch the process env
+func load(getenv func(string) string) (*Config, error) {
+	cfg := Default()
+
+	if err := intFromEnv(getenv, "PROXY_PORT_MIN", &cfg.ProxyPortMin); err != nil {
+		return nil, err
+	}
+	if err := intFromEnv(getenv, "PROXY_PORT_MAX", &cfg.ProxyPortMax); err != nil {
+		return nil, err
+	}
+	if err := durationFromEnv(getenv, "PROXY_READY_TIMEOUT", &cfg.ProxyReadyTimeout); err != nil {
+		return nil, err
+	}
+	if err := durationFromEnv(getenv, "PROXY_READY_INTERVAL", &cfg.ProxyReadyInterval); err != nil {
+		return nil, err
+	}
+	if err := boolFromEnv(getenv, "PROXY_USER_AGENT", &cfg.ProxyUserAgent); err != nil {
+		return nil, err
+	}
+	if err := intFromEnv(getenv, "MAX_SESSIONS", &cfg.MaxSessions); err != nil {
+		return nil, err
+	}
+	if err := intFromEnv(getenv, "MAX_PROXIES", &cfg.MaxProxies); err != nil {
+		return nil, err
+	}
+	if err := intFromEnv(getenv, "REGISTRY_MAX_ENTRIES", &cfg.RegistryMaxEntries); err != nil {
+		return nil, err
+	}
+	if err := durationFromEnv(getenv, "REGISTRY_TTL", &cfg.RegistryTTL); err != nil {
+		return nil, err
+	}
+	if err := durationFromEnv(getenv, "RESPONSE_CACHE_TTL", &cfg.ResponseCacheTTL); err != nil {
+		return nil, err
+	}
+	if err := boolFromEnv(getenv, "KUBECTL_STRICT_ARGS", &cfg.KubectlStrictArgs); err != nil {
+		return nil, err
+	}
+	if err := boolFromEnv(getenv, "KUBECTL_VERSION_CHECK", &cfg.KubectlVersionCheck); err != nil {
+		return nil, err
+	}
+	if err := intFromEnv(getenv, "MAX_OUTPUT_BYTES", &cfg.MaxOutputBytes); err != nil {
+		return nil, err
+	}
+	if err := intFromEnv(getenv, "SHELL_MAX_MEMORY_MB", &cfg.ShellMaxMemoryMB); err != nil {
+		return nil, err
+	}
+	if err := intFromEnv(getenv, "SHELL_MAX_CPU_SECONDS", &cfg.ShellMaxCPUSeconds); err != nil {
+		return nil, err
+	}
+	if err := intFromEnv(getenv, "SHELL_MAX_OPEN_FILES", &cfg.ShellMaxOpenFiles); err != nil {
+		return nil, err
+	}
+	if err := durationFromEnv(getenv, "HELPER_SHUTDOWN_TIMEOUT", &cfg.ShutdownTimeout); err != nil {
+		return nil, err
+	}
+	if err := durationFromEnv(getenv, "HTTP_READ_TIMEOUT", &cfg.HTTPReadTimeout); err != nil {
+		return nil, err
+	}
+	if err := durationFromEnv(getenv, "HTTP_WRITE_TIMEOUT", &cfg.HTTPWriteTimeout); err != nil {
+		return nil, err
+	}
+	if err := durationFromEnv(getenv, "HTTP_IDLE_TIMEOUT", &cfg.HTTPIdleTimeout); err != nil {
+		return nil, err
+	}
+	if err := boolFromEnv(getenv, "HELPER_SKIP_SHELL_ENV", &cfg.SkipShellEnv); err != nil {
+		return nil, err
+	}
+	cfg.ProxyPIDFile = DefaultProxyPIDFile()
+	if raw := getenv("PROXY_PID_FILE"); raw != "" {
+		cfg.ProxyPIDFile = raw
+	}
+	cfg.DebugToken = getenv("HELPER_DEBUG_TOKEN")
+	cfg.AuthTokenFile = getenv("HELPER_AUTH_TOKEN_FILE")
+	cfg.LogLevel = ParseLogLevel(getenv("LOG_LEVEL"))
+	for _, dir := range filepath.SplitList(getenv("HELPER_EXTRA_PATH")) {
+		if dir != "" {
+			cfg.ExtraPath = append(cfg.ExtraPath, dir)
+		}
+	}
+	if raw := getenv("EXEC_AUTH_ENV_ALLOW"); raw != "" {
+		for _, pattern := range strings.Split(raw, ",") {
+			if pattern = strings.TrimSpace(pattern); pattern != "" {
+				cfg.ExecAuthEnvAllow = append(cfg.ExecAuthEnvAllow, pattern)
+			}
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate checks that the configuration is usable
+func (c *Config) Validate() error {
+	if c.ProxyPortMin < minAllowedPort || c.ProxyPortMin > maxAllowedPort {
+		return fmt.Errorf("PROXY_PORT_MIN must be between %d and %d, got %d", minAllowedPort, maxAllowedPort, c.ProxyPortMin)
+	}
+	if c.ProxyPortMax < minAllowedPort || c.ProxyPortMax > maxAllowedPort {
+		return fmt.Errorf("PROXY_PORT_MAX must be between %d and %d, got %d", minAllowedPort, maxAllowedPort, c.ProxyPortMax)
+	}
+	if c.ProxyPortMin >= c.ProxyPortMax {
+		return fmt.Errorf("PROXY_PORT_MIN (%d) must be less than PROXY_PORT_MAX (%d)", c.ProxyPortMin, c.ProxyPortMax)
+	}
+	if c.ProxyReadyTimeout <= 0 {
+		return fmt.Errorf("PROXY_READY_TIMEOUT must be positive, got %s", c.ProxyReadyTimeout)
+	}
+	if c.ProxyReadyInterval <= 0 || c.ProxyReadyInterval > c.ProxyReadyTimeout {
+		return fmt.Errorf("PROXY_READY_INTERVAL must be positive and at most PROXY_READY_TIMEOUT, got %s", c.ProxyReadyInterval)
+	}
+	if c.ProxyPIDFile != "" && !filepath.IsAbs(c.ProxyPIDFile) {
+		return fmt.Errorf("PROXY_PID_FILE must be an absolute path, got %q", c.ProxyPIDFile)
+	}
+	if c.AuthTokenFile != "" && !filepath.IsAbs(c.AuthTokenFile) {
+		return fmt.Errorf("HELPER_AUTH_TOKEN_FILE must be an absolute path, got %q", c.AuthTokenFile)
+	}
+	if c.MaxSessions < 0 {
+		return fmt.Errorf("MAX_SESSIONS must be 0 (unlimited) or positive, got %d", c.MaxSessions)
+	}
+	if c.MaxProxies < 0 {
+		return fmt.Errorf("MAX_PROXIES must be 0 (unlimited) or positive, got %d", c.MaxProxies)
+	}
+	if c.RegistryMaxEntries < 0 {
+		return fmt.Errorf("REGISTRY_MAX_ENTRIES must be 0 (unlimited) or positive, got %d", c.RegistryMaxEntries)
+	}
+	if c.RegistryTTL < 0 {
+		return fmt.Errorf("REGISTRY_TTL must be 0 (never expire) or positive, got %s", c.RegistryTTL)
+	}
+	if c.ResponseCacheTTL < 0 {
+		return fmt.Errorf("RESPONSE_CACHE_TTL must be 0 (disabled) or positive, got %s", c.ResponseCacheTTL)
+	}
+	if c.ShutdownTimeout <= 0 {
+		return fmt.Errorf("HELPER_SHUTDOWN_TIMEOUT must be positive, got %s", c.ShutdownTimeout)
+	}
+	for _, t := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"HTTP_READ_TIMEOUT", c.HTTPReadTimeout},
+		{"HTTP_WRITE_TIMEOUT", c.HTTPWriteTimeout},
+		{"HTTP_IDLE_TIMEOUT", c.HTTPIdleTimeout},
+	} {
+		if t.value < 0 {
+			return fmt.Errorf("%s must be 0 (no timeout) or positive, got %s", t.name, t.value)
+		}
+	}
+	if c.MaxOutputBytes < 0 {
+		return fmt.Errorf("MAX_OUTPUT_BYTES must be 0 (unlimited) or positive, got %d", c.MaxOutputBytes)
+	}
+	for _, limit := range []struct {
+		name  string
+		value int
+	}{
+		{"SHELL_MAX_MEMORY_MB", c.ShellMaxMemoryMB},
+		{"SHELL_MAX_CPU_SECONDS", c.ShellMaxCPUSeconds},
+		{"SHELL_MAX_OPEN_FILES", c.ShellMaxOpenFiles},
+	} {
+		if limit.value < 0 {
+			return fmt.Errorf("%s must be 0 (unlimited) or positive, got %d", limit.name, limit.value)
+		}
+	}
+	for _, dir := range c.ExtraPath {
+		if !filepath.IsAbs(dir) {
+			return fmt.Errorf("HELPER_EXTRA_PATH entries must be absolute directories, got %q", dir)
+		}
+	}
+	for _, pattern := range c.ExecAuthEnvAllow {
+		if !envPatternRe.MatchString(pattern) {
+			return fmt.Errorf("EXEC_AUTH_ENV_ALLOW entries must be env var names optionally ending in *, got %q", pattern)
+		}
+		if IsDeniedExecAuthEnv(strings.TrimSuffix(pattern, "*")) {
+			return fmt.Errorf("EXEC_AUTH_ENV_ALLOW must not include %q: it can hijack credential plugins", pattern)
+		}
+	}
+	return nil
+}
+
+// ParseLogLevel maps LOG_LEVEL to a slog level; anything but "debug" or "warn" is info
+func ParseLogLevel(raw string) slog.Level {
+	switch raw {
+	case "debug":
+		return slog.LevelDebug
+	case "warn":
+		return slog.LevelWarn
+	}
+	return slog.LevelInfo
+}
+
+// IsDeniedExecAuthEnv reports whether key must never be passed to an exec-auth plugin
+func IsDeniedExecAuthEnv(key string) bool {
+	return MatchesEnvPattern(strings.ToUpper(key), deniedExecAuthEnv)
+}
+
+// MatchesEnvPattern reports whether key equals a pattern or starts with a pattern's prefix before *
+func MatchesEnvPattern(key string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		} else if key == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// intFromEnv overwrites *dst with the integer value of key if it is set
+func intFromEnv(getenv func(string) string, key string, dst *int) error {
+	raw := getenv(key)
+	if raw == "" {
+		return nil
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil {
+		return fmt.Errorf("%s must be an integer, got %q", key, raw)
+	}
+	*dst = v
+	return nil
+}
+
+// boolFromEnv overwrites *dst with the boolean value of key ("true", "false", "1", "0") if it is set
+func boolFromEnv(getenv func(string) string, key string, dst *bool) error {
+	raw := getenv(key)
+	if raw == "" {
+		return nil
+	}
+	v, err := strconv.ParseBool(raw)
+	if err != nil {
+		return fmt.Errorf("%s must be true or false, got %q", key, raw)
+	}
+	*dst = v
+	return nil
+}
+
+// durationFromEnv overwrites *dst with the duration value of key (e.g. "500ms") if it is set
+func durationFromEnv(getenv func(string) string, key string, dst *time.Duration) error {
+	raw := getenv(key)
+	if raw == "" {
+		return nil
+	}
+	v, err := time.ParseDuration(raw)
+	if err != nil {
+		return fmt.Errorf("%s must be a duration like \"5s\", got %q", key, raw)
+	}
+	*dst = v
+	return nil
+}
@@ -0,0 +1,305 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func envFunc(env map[string]string) func(string) string {
+	return func(key string) string { return env[key] }
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	cfg, err := load(envFunc(nil))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.ProxyPortMin != DefaultProxyPortMin || cfg.ProxyPortMax != DefaultProxyPortMax {
+		t.Errorf("got range %d-%d, want %d-%d", cfg.ProxyPortMin, cfg.ProxyPortMax, DefaultProxyPortMin, DefaultProxyPortMax)
+	}
+	if cfg.MaxSessions != DefaultMaxSessions {
+		t.Errorf("got MaxSessions %d, want %d", cfg.MaxSessions, DefaultMaxSessions)
+	}
+}
+
+func TestLoad_ProxyPortRange(t *testing.T) {
+	cfg, err := load(envFunc(map[string]string{
+		"PROXY_PORT_MIN": "20000",
+		"PROXY_PORT_MAX": "20100",
+	}))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.ProxyPortMin != 20000 || cfg.ProxyPortMax != 20100 {
+		t.Errorf("got range %d-%d, want 20000-20100", cfg.ProxyPortMin, cfg.ProxyPortMax)
+	}
+}
+
+func TestLoad_ProxyReadyWait(t *testing.T) {
+	cfg, err := load(envFunc(map[string]string{
+		"PROXY_READY_TIMEOUT":  "10s",
+		"PROXY_READY_INTERVAL": "250ms",
+	}))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.ProxyReadyTimeout != 10*time.Second || cfg.ProxyReadyInterval != 250*time.Millisecond {
+		t.Errorf("got timeout %s interval %s, want 10s 250ms", cfg.ProxyReadyTimeout, cfg.ProxyReadyInterval)
+	}
+}
+
+func TestLoad_MaxProxies(t *testing.T) {
+	if cfg := Default(); cfg.MaxProxies != 0 {
+		t.Errorf("default MaxProxies = %d, want 0 (unlimited)", cfg.MaxProxies)
+	}
+	cfg, err := load(envFunc(map[string]string{"MAX_PROXIES": "8"}))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.MaxProxies != 8 {
+		t.Errorf("got %d, want 8", cfg.MaxProxies)
+	}
+}
+
+func TestLoad_Registry(t *testing.T) {
+	cfg, err := load(envFunc(map[string]string{
+		"REGISTRY_MAX_ENTRIES": "10",
+		"REGISTRY_TTL":         "15m",
+	}))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.RegistryMaxEntries != 10 || cfg.RegistryTTL != 15*time.Minute {
+		t.Errorf("got max %d ttl %s, want 10 15m", cfg.RegistryMaxEntries, cfg.RegistryTTL)
+	}
+}
+
+func TestLoad_ResponseCacheTTL(t *testing.T) {
+	if cfg := Default(); cfg.ResponseCacheTTL != 0 {
+		t.Errorf("default ResponseCacheTTL = %s, want 0 (disabled)", cfg.ResponseCacheTTL)
+	}
+	cfg, err := load(envFunc(map[string]string{"RESPONSE_CACHE_TTL": "5s"}))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.ResponseCacheTTL != 5*time.Second {
+		t.Errorf("got %s, want 5s", cfg.ResponseCacheTTL)
+	}
+}
+
+func TestLoad_KubectlStrictArgs(t *testing.T) {
+	cfg, err := load(envFunc(map[string]string{"KUBECTL_STRICT_ARGS": "true"}))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if !cfg.KubectlStrictArgs {
+		t.Error("expected KubectlStrictArgs to be enabled")
+	}
+}
+
+func TestLoad_KubectlVersionCheck(t *testing.T) {
+	if Default().KubectlVersionCheck {
+		t.Error("version check is on by default")
+	}
+	cfg, err := load(envFunc(map[string]string{"KUBECTL_VERSION_CHECK": "true"}))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if !cfg.KubectlVersionCheck {
+		t.Error("expected KubectlVersionCheck to be enabled")
+	}
+}
+
+func TestLoad_MaxOutputBytes(t *testing.T) {
+	if cfg := Default(); cfg.MaxOutputBytes != DefaultMaxOutputBytes {
+		t.Errorf("default MaxOutputBytes = %d, want %d", cfg.MaxOutputBytes, DefaultMaxOutputBytes)
+	}
+	cfg, err := load(envFunc(map[string]string{"MAX_OUTPUT_BYTES": "0"}))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.MaxOutputBytes != 0 {
+		t.Errorf("got %d, want 0 (unlimited)", cfg.MaxOutputBytes)
+	}
+}
+
+func TestLoad_ShellLimits(t *testing.T) {
+	if cfg := Default(); cfg.ShellMaxMemoryMB != 0 || cfg.ShellMaxCPUSeconds != 0 || cfg.ShellMaxOpenFiles != 0 {
+		t.Errorf("shell limits are on by default: %+v", cfg)
+	}
+	cfg, err := load(envFunc(map[string]string{"SHELL_MAX_MEMORY_MB": "2048", "SHELL_MAX_CPU_SECONDS": "600", "SHELL_MAX_OPEN_FILES": "1024"}))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.ShellMaxMemoryMB != 2048 || cfg.ShellMaxCPUSeconds != 600 || cfg.ShellMaxOpenFiles != 1024 {
+		t.Errorf("got %d MiB, %d s, %d files", cfg.ShellMaxMemoryMB, cfg.ShellMaxCPUSeconds, cfg.ShellMaxOpenFiles)
+	}
+}
+
+func TestLoad_ShutdownTimeout(t *testing.T) {
+	if cfg := Default(); cfg.ShutdownTimeout != 10*time.Second {
+		t.Errorf("default ShutdownTimeout = %s, want 10s", cfg.ShutdownTimeout)
+	}
+	cfg, err := load(envFunc(map[string]string{"HELPER_SHUTDOWN_TIMEOUT": "2s"}))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.ShutdownTimeout != 2*time.Second {
+		t.Errorf("got %s, want 2s", cfg.ShutdownTimeout)
+	}
+}
+
+func TestLoad_HTTPTimeouts(t *testing.T) {
+	cfg := Default()
+	if cfg.HTTPReadTimeout != DefaultHTTPReadTimeout || cfg.HTTPWriteTimeout != DefaultHTTPWriteTimeout || cfg.HTTPIdleTimeout != DefaultHTTPIdleTimeout {
+		t.Errorf("default timeouts = %s/%s/%s", cfg.HTTPReadTimeout, cfg.HTTPWriteTimeout, cfg.HTTPIdleTimeout)
+	}
+	cfg, err := load(envFunc(map[string]string{
+		"HTTP_READ_TIMEOUT":  "5m",
+		"HTTP_WRITE_TIMEOUT": "0",
+		"HTTP_IDLE_TIMEOUT":  "30s",
+	}))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.HTTPReadTimeout != 5*time.Minute || cfg.HTTPWriteTimeout != 0 || cfg.HTTPIdleTimeout != 30*time.Second {
+		t.Errorf("got %s/%s/%s, want 5m0s/0s/30s", cfg.HTTPReadTimeout, cfg.HTTPWriteTimeout, cfg.HTTPIdleTimeout)
+	}
+}
+
+func TestLoad_ProxyPIDFile(t *testing.T) {
+	if cfg := Default(); cfg.ProxyPIDFile != "" {
+		t.Errorf("Default() ProxyPIDFile = %q, want empty (not recorded)", cfg.ProxyPIDFile)
+	}
+	cfg, err := load(envFunc(nil))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.ProxyPIDFile != DefaultProxyPIDFile() {
+		t.Errorf("got %q, want %q", cfg.ProxyPIDFile, DefaultProxyPIDFile())
+	}
+	cfg, err = load(envFunc(map[string]string{"PROXY_PID_FILE": "/var/run/kubedesk/proxies.json"}))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.ProxyPIDFile != "/var/run/kubedesk/proxies.json" {
+		t.Errorf("got %q, want /var/run/kubedesk/proxies.json", cfg.ProxyPIDFile)
+	}
+}
+
+func TestLoad_ProxyUserAgent(t *testing.T) {
+	if cfg := Default(); !cfg.ProxyUserAgent {
+		t.Error("ProxyUserAgent should default to true")
+	}
+	cfg, err := load(envFunc(map[string]string{"PROXY_USER_AGENT": "false"}))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.ProxyUserAgent {
+		t.Error("PROXY_USER_AGENT=false should disable it")
+	}
+}
+
+func TestLoad_DebugToken(t *testing.T) {
+	if cfg := Default(); cfg.DebugToken != "" {
+		t.Errorf("default DebugToken = %q, want empty (disabled)", cfg.DebugToken)
+	}
+	cfg, err := load(envFunc(map[string]string{"HELPER_DEBUG_TOKEN": "s3cr3t"}))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.DebugToken != "s3cr3t" {
+		t.Errorf("got %q, want s3cr3t", cfg.DebugToken)
+	}
+}
+
+func TestLoad_ExecAuthEnvAllow(t *testing.T) {
+	cfg, err := load(envFunc(map[string]string{"EXEC_AUTH_ENV_ALLOW": "OCI_*, VAULT_ADDR,"}))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(cfg.ExecAuthEnvAllow) != 2 || cfg.ExecAuthEnvAllow[0] != "OCI_*" || cfg.ExecAuthEnvAllow[1] != "VAULT_ADDR" {
+		t.Errorf("got %q, want [OCI_* VAULT_ADDR]", cfg.ExecAuthEnvAllow)
+	}
+}
+
+func TestLoad_ExtraPath(t *testing.T) {
+	if cfg := Default(); len(cfg.ExtraPath) != 0 {
+		t.Errorf("default ExtraPath = %q, want none", cfg.ExtraPath)
+	}
+	cfg, err := load(envFunc(map[string]string{"HELPER_EXTRA_PATH": "/opt/plugins/bin::/home/me/bin"}))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(cfg.ExtraPath) != 2 || cfg.ExtraPath[0] != "/opt/plugins/bin" || cfg.ExtraPath[1] != "/home/me/bin" {
+		t.Errorf("got %q, want [/opt/plugins/bin /home/me/bin]", cfg.ExtraPath)
+	}
+}
+
+func TestMatchesEnvPattern(t *testing.T) {
+	patterns := []string{"AWS_*", "KUBERNETES_EXEC_INFO"}
+	for key, want := range map[string]bool{
+		"AWS_PROFILE":            true,
+		"KUBERNETES_EXEC_INFO":   true,
+		"KUBERNETES_EXEC_INFO_X": false,
+		"AWS":                    false,
+		"PATH":                   false,
+	} {
+		if got := MatchesEnvPattern(key, patterns); got != want {
+			t.Errorf("MatchesEnvPattern(%q) = %v, want %v", key, got, want)
+		}
+	}
+	for _, key := range []string{"PATH", "LD_PRELOAD", "ld_library_path", "DYLD_INSERT_LIBRARIES"} {
+		if !IsDeniedExecAuthEnv(key) {
+			t.Errorf("expected %s to be denied", key)
+		}
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{"not a number", map[string]string{"PROXY_PORT_MIN": "abc"}, "must be an integer"},
+		{"min below 1024", map[string]string{"PROXY_PORT_MIN": "80"}, "PROXY_PORT_MIN must be between"},
+		{"max above 65535", map[string]string{"PROXY_PORT_MAX": "70000"}, "PROXY_PORT_MAX must be between"},
+		{"min equals max", map[string]string{"PROXY_PORT_MIN": "30000", "PROXY_PORT_MAX": "30000"}, "must be less than"},
+		{"min above max", map[string]string{"PROXY_PORT_MIN": "30001", "PROXY_PORT_MAX": "30000"}, "must be less than"},
+		{"bad ready timeout", map[string]string{"PROXY_READY_TIMEOUT": "3"}, "must be a duration"},
+		{"zero ready timeout", map[string]string{"PROXY_READY_TIMEOUT": "0s"}, "PROXY_READY_TIMEOUT must be positive"},
+		{"negative max sessions", map[string]string{"MAX_SESSIONS": "-1"}, "MAX_SESSIONS must be"},
+		{"negative max proxies", map[string]string{"MAX_PROXIES": "-1"}, "MAX_PROXIES must be"},
+		{"negative registry size", map[string]string{"REGISTRY_MAX_ENTRIES": "-5"}, "REGISTRY_MAX_ENTRIES must be"},
+		{"negative registry ttl", map[string]string{"REGISTRY_TTL": "-1m"}, "REGISTRY_TTL must be"},
+		{"negative response cache ttl", map[string]string{"RESPONSE_CACHE_TTL": "-1s"}, "RESPONSE_CACHE_TTL must be"},
+		{"zero shutdown timeout", map[string]string{"HELPER_SHUTDOWN_TIMEOUT": "0s"}, "HELPER_SHUTDOWN_TIMEOUT must be positive"},
+		{"negative write timeout", map[string]string{"HTTP_WRITE_TIMEOUT": "-1s"}, "HTTP_WRITE_TIMEOUT must be"},
+		{"bad read timeout", map[string]string{"HTTP_READ_TIMEOUT": "60"}, "must be a duration"},
+		{"negative max output", map[string]string{"MAX_OUTPUT_BYTES": "-1"}, "MAX_OUTPUT_BYTES must be"},
+		{"negative shell memory limit", map[string]string{"SHELL_MAX_MEMORY_MB": "-1"}, "SHELL_MAX_MEMORY_MB must be"},
+		{"bad shell cpu limit", map[string]string{"SHELL_MAX_CPU_SECONDS": "1m"}, "must be an integer"},
+		{"bad strict args flag", map[string]string{"KUBECTL_STRICT_ARGS": "yes"}, "KUBECTL_STRICT_ARGS must be true or false"},
+		{"bad proxy user agent flag", map[string]string{"PROXY_USER_AGENT": "on"}, "PROXY_USER_AGENT must be true or false"},
+		{"bad skip shell env flag", map[string]string{"HELPER_SKIP_SHELL_ENV": "maybe"}, "HELPER_SKIP_SHELL_ENV must be true or false"},
+		{"malformed env pattern", map[string]string{"EXEC_AUTH_ENV_ALLOW": "OCI-*"}, "EXEC_AUTH_ENV_ALLOW entries must be"},
+		{"bare wildcard", map[string]string{"EXEC_AUTH_ENV_ALLOW": "*"}, "EXEC_AUTH_ENV_ALLOW entries must be"},
+		{"denied env var", map[string]string{"EXEC_AUTH_ENV_ALLOW": "VAULT_ADDR,LD_PRELOAD"}, "must not include \"LD_PRELOAD\""},
+		{"denied env prefix", map[string]string{"EXEC_AUTH_ENV_ALLOW": "DYLD_*"}, "must not include"},
+		{"relative proxy PID file", map[string]string{"PROXY_PID_FILE": "proxies.json"}, "PROXY_PID_FILE must be an absolute path"},
+		{"relative auth token file", map[string]string{"HELPER_AUTH_TOKEN_FILE": "token"}, "HELPER_AUTH_TOKEN_FILE must be an absolute path"},
+		{"relative extra path", map[string]string{"HELPER_EXTRA_PATH": "/opt/bin:bin"}, "HELPER_EXTRA_PATH entries must be absolute"},
+		{"interval above timeout", map[string]string{"PROXY_READY_TIMEOUT": "1s", "PROXY_READY_INTERVAL": "2s"}, "PROXY_READY_INTERVAL must be"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := load(envFunc(tt.env))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("load() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
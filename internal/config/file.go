@@ -0,0 +1,71 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// readConfigFile reads a YAML or JSON config file (HELPER_CONFIG) into environment form, keyed
+// by env var name, so it goes through the same parsing and validation as the environment
+// Unknown keys are rejected so a typo doesn't silently leave a default in place
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("HELPER_CONFIG: %w", err)
+	}
+	var raw map[string]any
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("HELPER_CONFIG %s: %w", path, err)
+	}
+
+	byFileKey := make(map[string]setting, len(settings))
+	for _, s := range settings {
+		byFileKey[s.fileKey] = s
+	}
+	values := make(map[string]string, len(raw))
+	for key, v := range raw {
+		s, ok := byFileKey[key]
+		if !ok {
+			return nil, fmt.Errorf("HELPER_CONFIG %s: unknown setting %q", path, key)
+		}
+		value, err := fileValue(v, s.listSep)
+		if err != nil {
+			return nil, fmt.Errorf("HELPER_CONFIG %s: %s %w", path, key, err)
+		}
+		values[s.key] = value
+	}
+	return values, nil
+}
+
+// fileValue converts a decoded config file value to its environment form
+// Lists are only accepted for settings with a separator
+func fileValue(v any, listSep string) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case []any:
+		if listSep == "" {
+			return "", fmt.Errorf("must be a single value, not a list")
+		}
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return "", fmt.Errorf("must be a list of strings")
+			}
+			items = append(items, s)
+		}
+		return strings.Join(items, listSep), nil
+	}
+	return "", fmt.Errorf("has an unsupported value %v", v)
+}
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfigFile writes a HELPER_CONFIG file and points the env var at it
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HELPER_CONFIG", path)
+	return path
+}
+
+func TestLoad_YAMLFile(t *testing.T) {
+	path := writeConfigFile(t, "helper.yaml", `
+# Tunables for the helper
+logLevel: debug
+proxyPortMin: 30000
+proxyPortMax: 30100
+proxyReadyTimeout: 5s
+kubectlStrictArgs: true
+execAuthEnvAllow:
+  - OCI_*
+  - VAULT_ADDR
+extraPath: [/opt/bin, /usr/local/krew/bin]
+`)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.File != path {
+		t.Errorf("File = %q, want %q", cfg.File, path)
+	}
+	if cfg.ProxyPortMin != 30000 || cfg.ProxyPortMax != 30100 || cfg.ProxyReadyTimeout != 5*time.Second || !cfg.KubectlStrictArgs {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+	if strings.Join(cfg.ExecAuthEnvAllow, ",") != "OCI_*,VAULT_ADDR" || strings.Join(cfg.ExtraPath, ",") != "/opt/bin,/usr/local/krew/bin" {
+		t.Errorf("got ExecAuthEnvAllow %q, ExtraPath %q", cfg.ExecAuthEnvAllow, cfg.ExtraPath)
+	}
+	// Untouched settings keep their defaults
+	if cfg.MaxSessions != DefaultMaxSessions {
+		t.Errorf("MaxSessions = %d, want default %d", cfg.MaxSessions, DefaultMaxSessions)
+	}
+}
+
+func TestLoad_JSONFile(t *testing.T) {
+	writeConfigFile(t, "helper.json", `{"maxSessions": 50, "registryTtl": "10m", "proxyUserAgent": false}`)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.MaxSessions != 50 || cfg.RegistryTTL != 10*time.Minute || cfg.ProxyUserAgent {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+}
+
+func TestLoad_EnvOverridesConfigFile(t *testing.T) {
+	writeConfigFile(t, "helper.yaml", "maxSessions: 50\nmaxProxies: 4\n")
+	t.Setenv("MAX_SESSIONS", "10")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.MaxSessions != 10 || cfg.MaxProxies != 4 {
+		t.Errorf("got MaxSessions %d, MaxProxies %d; want 10, 4", cfg.MaxSessions, cfg.MaxProxies)
+	}
+}
+
+func TestLoad_InvalidConfigFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"unknown key", "maxSession: 5\n", `unknown setting "maxSession"`},
+		{"not a mapping", "- maxSessions\n", "HELPER_CONFIG"},
+		{"malformed", "maxSessions: [\n", "HELPER_CONFIG"},
+		{"list for a scalar", "maxSessions: [1, 2]\n", "maxSessions must be a single value"},
+		{"nested value", "proxyPortMin: {value: 1}\n", "proxyPortMin has an unsupported value"},
+		{"invalid value", "proxyPortMin: 80\n", "PROXY_PORT_MIN must be between"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeConfigFile(t, "helper.yaml", tt.content)
+			if _, err := Load(); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Setenv("HELPER_CONFIG", filepath.Join(t.TempDir(), "missing.yaml"))
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "HELPER_CONFIG") {
+		t.Errorf("missing file: got %v", err)
+	}
+}
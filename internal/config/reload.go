@@ -0,0 +1,101 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// setting describes one configuration key for the config file and reload diffs
+type setting struct {
+	key        string // environment variable
+	fileKey    string // key in the HELPER_CONFIG file
+	listSep    string // the file may give a list, joined with this into the env form; empty = scalar only
+	reloadable bool   // applied on SIGHUP; otherwise a change only takes effect after a restart
+	secret     bool   // value is never logged
+	value      func(*Config) any
+}
+
+// settings lists every key Load reads, in the order changes are reported
+var settings = []setting{
+	{key: "LOG_LEVEL", fileKey: "logLevel", reloadable: true, value: func(c *Config) any { return c.LogLevel }},
+	{key: "MAX_OUTPUT_BYTES", fileKey: "maxOutputBytes", reloadable: true, value: func(c *Config) any { return c.MaxOutputBytes }},
+	{key: "MAX_SESSIONS", fileKey: "maxSessions", reloadable: true, value: func(c *Config) any { return c.MaxSessions }},
+	{key: "REGISTRY_MAX_ENTRIES", fileKey: "registryMaxEntries", reloadable: true, value: func(c *Config) any { return c.RegistryMaxEntries }},
+	{key: "REGISTRY_TTL", fileKey: "registryTtl", reloadable: true, value: func(c *Config) any { return c.RegistryTTL }},
+	{key: "EXEC_AUTH_ENV_ALLOW", fileKey: "execAuthEnvAllow", listSep: ",", reloadable: true, value: func(c *Config) any { return strings.Join(c.ExecAuthEnvAllow, ",") }},
+	{key: "HELPER_SHUTDOWN_TIMEOUT", fileKey: "shutdownTimeout", reloadable: true, value: func(c *Config) any { return c.ShutdownTimeout }},
+	{key: "SHELL_MAX_MEMORY_MB", fileKey: "shellMaxMemoryMb", reloadable: true, value: func(c *Config) any { return c.ShellMaxMemoryMB }},
+	{key: "SHELL_MAX_CPU_SECONDS", fileKey: "shellMaxCpuSeconds", reloadable: true, value: func(c *Config) any { return c.ShellMaxCPUSeconds }},
+	{key: "KUBECTL_VERSION_CHECK", fileKey: "kubectlVersionCheck", reloadable: true, value: func(c *Config) any { return c.KubectlVersionCheck }},
+	{key: "SHELL_MAX_OPEN_FILES", fileKey: "shellMaxOpenFiles", reloadable: true, value: func(c *Config) any { return c.ShellMaxOpenFiles }},
+
+	{key: "PROXY_PORT_MIN", fileKey: "proxyPortMin", value: func(c *Config) any { return c.ProxyPortMin }},
+	{key: "PROXY_PORT_MAX", fileKey: "proxyPortMax", value: func(c *Config) any { return c.ProxyPortMax }},
+	{key: "PROXY_READY_TIMEOUT", fileKey: "proxyReadyTimeout", value: func(c *Config) any { return c.ProxyReadyTimeout }},
+	{key: "PROXY_READY_INTERVAL", fileKey: "proxyReadyInterval", value: func(c *Config) any { return c.ProxyReadyInterval }},
+	{key: "PROXY_PID_FILE", fileKey: "proxyPidFile", value: func(c *Config) any { return c.ProxyPIDFile }},
+	{key: "PROXY_USER_AGENT", fileKey: "proxyUserAgent", value: func(c *Config) any { return c.ProxyUserAgent }},
+	{key: "MAX_PROXIES", fileKey: "maxProxies", value: func(c *Config) any { return c.MaxProxies }},
+	{key: "RESPONSE_CACHE_TTL", fileKey: "responseCacheTtl", value: func(c *Config) any { return c.ResponseCacheTTL }},
+	{key: "KUBECTL_STRICT_ARGS", fileKey: "kubectlStrictArgs", value: func(c *Config) any { return c.KubectlStrictArgs }},
+	{key: "HTTP_READ_TIMEOUT", fileKey: "httpReadTimeout", value: func(c *Config) any { return c.HTTPReadTimeout }},
+	{key: "HTTP_WRITE_TIMEOUT", fileKey: "httpWriteTimeout", value: func(c *Config) any { return c.HTTPWriteTimeout }},
+	{key: "HTTP_IDLE_TIMEOUT", fileKey: "httpIdleTimeout", value: func(c *Config) any { return c.HTTPIdleTimeout }},
+	{key: "HELPER_DEBUG_TOKEN", fileKey: "debugToken", secret: true, value: func(c *Config) any { return c.DebugToken }},
+	{key: "HELPER_AUTH_TOKEN_FILE", fileKey: "authTokenFile", value: func(c *Config) any { return c.AuthTokenFile }},
+	{key: "HELPER_EXTRA_PATH", fileKey: "extraPath", listSep: string(os.PathListSeparator), value: func(c *Config) any { return strings.Join(c.ExtraPath, string(os.PathListSeparator)) }},
+	{key: "HELPER_SKIP_SHELL_ENV", fileKey: "skipShellEnv", value: func(c *Config) any { return c.SkipShellEnv }},
+}
+
+// redacted replaces secret values in a Change
+const redacted = "[redacted]"
+
+// Change is one setting whose value differs between two configurations
+type Change struct {
+	Key        string
+	Old        string
+	New        string
+	Reloadable bool // false: the running helper keeps Old until it is restarted
+}
+
+// Diff returns the settings that differ between old and next
+func Diff(old, next *Config) []Change {
+	var changes []Change
+	for _, s := range settings {
+		before, after := fmt.Sprint(s.value(old)), fmt.Sprint(s.value(next))
+		if before == after {
+			continue
+		}
+		if s.secret {
+			before, after = redacted, redacted
+		}
+		changes = append(changes, Change{Key: s.key, Old: before, New: after, Reloadable: s.reloadable})
+	}
+	return changes
+}
+
+// Reload loads the configuration again (environment and HELPER_CONFIG) for a SIGHUP
+// The returned config keeps current's values for settings that need a restart, so it always
+// describes what the running helper uses; the changes include those settings too
+func Reload(current *Config) (*Config, []Change, error) {
+	loaded, err := Load()
+	if err != nil {
+		return nil, nil, err
+	}
+	changes := Diff(current, loaded)
+
+	next := *current
+	next.LogLevel = loaded.LogLevel
+	next.MaxOutputBytes = loaded.MaxOutputBytes
+	next.MaxSessions = loaded.MaxSessions
+	next.RegistryMaxEntries = loaded.RegistryMaxEntries
+	next.RegistryTTL = loaded.RegistryTTL
+	next.ExecAuthEnvAllow = loaded.ExecAuthEnvAllow
+	next.ShutdownTimeout = loaded.ShutdownTimeout
+	next.ShellMaxMemoryMB = loaded.ShellMaxMemoryMB
+	next.ShellMaxCPUSeconds = loaded.ShellMaxCPUSeconds
+	next.ShellMaxOpenFiles = loaded.ShellMaxOpenFiles
+	next.KubectlVersionCheck = loaded.KubectlVersionCheck
+	return &next, changes, nil
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDiff(t *testing.T) {
+	old := Default()
+	next := Default()
+	next.LogLevel = slog.LevelDebug
+	next.ProxyPortMin = 30000
+	next.DebugToken = "s3cr3t"
+
+	changes := Diff(old, next)
+	want := []Change{
+		{Key: "LOG_LEVEL", Old: "INFO", New: "DEBUG", Reloadable: true},
+		{Key: "PROXY_PORT_MIN", Old: "47824", New: "30000"},
+		{Key: "HELPER_DEBUG_TOKEN", Old: redacted, New: redacted},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("got %+v, want %+v", changes, want)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("change %d = %+v, want %+v", i, changes[i], want[i])
+		}
+	}
+	if len(Diff(old, Default())) != 0 {
+		t.Error("identical configs should have no changes")
+	}
+}
+
+func TestReload_KeepsRestartOnlySettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "helper.yaml")
+	if err := os.WriteFile(path, []byte("maxSessions: 5\nhttpWriteTimeout: 1m\nlogLevel: warn\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HELPER_CONFIG", path)
+
+	current, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	current.MaxSessions = 1
+	current.HTTPWriteTimeout = time.Second
+
+	next, changes, err := Reload(current)
+	if err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if next.MaxSessions != 5 || next.LogLevel != slog.LevelWarn {
+		t.Errorf("reloadable settings not applied: MaxSessions %d, LogLevel %s", next.MaxSessions, next.LogLevel)
+	}
+	if next.HTTPWriteTimeout != time.Second {
+		t.Errorf("HTTPWriteTimeout = %s, want the running value 1s", next.HTTPWriteTimeout)
+	}
+	if len(changes) != 2 || changes[0].Key != "MAX_SESSIONS" || changes[1].Key != "HTTP_WRITE_TIMEOUT" || changes[1].Reloadable {
+		t.Errorf("unexpected changes: %+v", changes)
+	}
+
+	// An invalid file is reported and the caller keeps its config
+	if err := os.WriteFile(path, []byte("maxSessions: -1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Reload(current); err == nil {
+		t.Error("expected an error for an invalid config")
+	}
+}
@@ -0,0 +1,29 @@
+package env
+
+import (
+	"sort"
+	"strings"
+)
+
+// WithOverrides returns a copy of environ with each of vars set, replacing any existing entry
+// for the same key instead of appending a duplicate, so a child (and anything it runs, like
+// a credential plugin reading KUBERNETES_EXEC_INFO) sees exactly one value per key
+func WithOverrides(environ []string, vars map[string]string) []string {
+	result := make([]string, 0, len(environ)+len(vars))
+	for _, entry := range environ {
+		key, _, _ := strings.Cut(entry, "=")
+		if _, overridden := vars[key]; !overridden {
+			result = append(result, entry)
+		}
+	}
+
+	keys := make([]string, 0, len(vars))
+	for key := range vars {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		result = append(result, key+"="+vars[key])
+	}
+	return result
+}
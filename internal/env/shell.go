@@ -2,37 +2,64 @@ package env
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"log/slog"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
+	"time"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/childproc"
+)
+
+// Guards for the shell started to read the user's environment; an rc file that prompts or
+// hangs on the network must not block the first kubectl request forever
+var (
+	shellEnvTimeout  = 5 * time.Second
+	maxShellEnvBytes = 1 << 20
 )
 
+// errShellEnvTooLarge is returned when the shell prints more than maxShellEnvBytes
+var errShellEnvTooLarge = errors.New("shell environment output too large")
+
 var (
-	cachedEnv     []string
-	cachedEnvOnce sync.Once
+	cachedEnv             []string
+	cachedEnvOnce         sync.Once
+	defaultKubeconfigPath string // Set with cachedEnv
 )
 
+// extraPathDirs are prepended to PATH when the environment is loaded (HELPER_EXTRA_PATH)
+var extraPathDirs []string
+
+// skipShellEnv uses the inherited environment without starting the user's shell (HELPER_SKIP_SHELL_ENV)
+var skipShellEnv bool
+
+// SetExtraPath sets directories to put first on PATH for every command, e.g. for kubectl plugins
+// or a cloud SDK the shell profile doesn't add
+// Must be called before the first GetShellEnvironment
+func SetExtraPath(dirs []string) {
+	extraPathDirs = dirs
+}
+
+// SetSkipShellEnv makes the environment the helper inherited the base for every command,
+// instead of loading the user's login shell environment, e.g. when rc files are slow or flaky
+// Must be called before the first GetShellEnvironment
+func SetSkipShellEnv(skip bool) {
+	skipShellEnv = skip
+}
+
 // GetShellEnvironment returns the user's shell environment on macOS
 // This ensures we have access to tools installed via Homebrew, gcloud, etc.
 // The environment is loaded once and cached for performance.
 func GetShellEnvironment() []string {
 	cachedEnvOnce.Do(func() {
-		// Start with current environment
-		baseEnv := os.Environ()
-
-		// Try to get the user's shell environment
-		shellEnv := loadShellEnvironment()
+		cachedEnv = baseEnvironment()
 
-		if len(shellEnv) > 0 {
-			// Merge shell environment with base environment
-			// Shell environment takes precedence for PATH and other important vars
-			cachedEnv = mergeEnvironments(baseEnv, shellEnv)
-		} else {
-			// Fallback to base environment
-			cachedEnv = baseEnv
-		}
+		cachedEnv = withPathAdditions(cachedEnv)
 
 		// Log the PATH for debugging
 		for _, e := range cachedEnv {
@@ -41,11 +68,153 @@ func GetShellEnvironment() []string {
 				break
 			}
 		}
+
+		// Make kubectl's implicit ~/.kube/config explicit, so every command (and the app) knows
+		// which config a request without a kubeconfig uses, even if the shell env failed to load
+		if kubeconfigPath, ok := lookupEnv(cachedEnv, "KUBECONFIG"); ok && kubeconfigPath != "" {
+			defaultKubeconfigPath = kubeconfigPath
+			slog.Info("Using KUBECONFIG from environment as default kubeconfig", "kubeconfigPath", kubeconfigPath)
+		} else if home, ok := lookupEnv(cachedEnv, "HOME"); ok && home != "" {
+			defaultKubeconfigPath = filepath.Join(home, ".kube", "config")
+			cachedEnv = append(cachedEnv, "KUBECONFIG="+defaultKubeconfigPath)
+			slog.Info("KUBECONFIG not set, falling back to default kubeconfig", "kubeconfigPath", defaultKubeconfigPath)
+		} else {
+			slog.Warn("Neither KUBECONFIG nor HOME is set; kubectl may find no kubeconfig")
+		}
 	})
 
 	return cachedEnv
 }
 
+// baseEnvironment returns the helper's environment merged with the user's shell environment,
+// or the helper's alone if the shell isn't loaded or fails to load
+func baseEnvironment() []string {
+	// Start with current environment
+	baseEnv := os.Environ()
+	if skipShellEnv {
+		slog.Info("Skipping shell environment load (HELPER_SKIP_SHELL_ENV), using the inherited environment")
+		return baseEnv
+	}
+
+	// Try to get the user's shell environment
+	shellEnv := loadShellEnvironment()
+	if len(shellEnv) == 0 {
+		// Fallback to base environment
+		return baseEnv
+	}
+
+	// Merge shell environment with base environment
+	// Shell environment takes precedence for PATH and other important vars
+	return mergeEnvironments(baseEnv, shellEnv)
+}
+
+// DefaultKubeconfig returns the kubeconfig used by requests that send none: KUBECONFIG
+// from the environment (possibly a colon-separated list), else ~/.kube/config
+func DefaultKubeconfig() string {
+	GetShellEnvironment()
+	return defaultKubeconfigPath
+}
+
+// lookupEnv returns the value of key in a KEY=value list
+func lookupEnv(env []string, key string) (string, bool) {
+	for _, e := range env {
+		if v, ok := strings.CutPrefix(e, key+"="); ok {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// withPathAdditions adds krew's bin dir and the HELPER_EXTRA_PATH dirs to PATH in env
+func withPathAdditions(env []string) []string {
+	// krew installs plugins outside the usual PATH; add it in case the shell profile that
+	// normally does so didn't load
+	env = appendPath(env, krewPath(env)...)
+
+	// Configured dirs go first, so they win over any same-named tool elsewhere on PATH
+	return prependPath(env, existingDirs(extraPathDirs)...)
+}
+
+// krewPath returns krew's bin dir, if it exists
+// krew lives in $KREW_ROOT, or ~/.krew by default
+func krewPath(env []string) []string {
+	krewRoot, ok := lookupEnv(env, "KREW_ROOT")
+	if !ok || krewRoot == "" {
+		home, ok := lookupEnv(env, "HOME")
+		if !ok || home == "" {
+			return nil
+		}
+		krewRoot = filepath.Join(home, ".krew")
+	}
+	if krewBin := filepath.Join(krewRoot, "bin"); isDir(krewBin) {
+		return []string{krewBin}
+	}
+	return nil
+}
+
+// existingDirs returns the dirs that exist, logging the rest; a missing HELPER_EXTRA_PATH dir
+// is usually a typo or a tool that has since been uninstalled
+func existingDirs(dirs []string) []string {
+	var existing []string
+	for _, dir := range dirs {
+		if !isDir(dir) {
+			slog.Warn("Ignoring HELPER_EXTRA_PATH entry that is not a directory", "dir", dir)
+			continue
+		}
+		existing = append(existing, dir)
+	}
+	return existing
+}
+
+// isDir reports whether path is an existing directory
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// prependPath puts dirs at the start of PATH in env, in order, moving any already on it
+func prependPath(env []string, dirs ...string) []string {
+	if len(dirs) == 0 {
+		return env
+	}
+	current, _ := lookupEnv(env, "PATH")
+	entries := slices.Clone(dirs)
+	for _, entry := range filepath.SplitList(current) {
+		if !slices.Contains(dirs, entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return replacePath(env, entries)
+}
+
+// appendPath adds dirs to the end of PATH in env, skipping any already on it
+func appendPath(env []string, dirs ...string) []string {
+	if len(dirs) == 0 {
+		return env
+	}
+	current, _ := lookupEnv(env, "PATH")
+	entries := filepath.SplitList(current)
+	for _, dir := range dirs {
+		if !slices.Contains(entries, dir) {
+			entries = append(entries, dir)
+		}
+	}
+	return replacePath(env, entries)
+}
+
+// replacePath sets PATH in env to entries, moving it to the end
+func replacePath(env []string, entries []string) []string {
+	path := "PATH=" + strings.Join(entries, string(os.PathListSeparator))
+
+	result := make([]string, 0, len(env)+1)
+	for _, e := range env {
+		if !strings.HasPrefix(e, "PATH=") {
+			result = append(result, e)
+		}
+	}
+	return append(result, path)
+}
+
 // loadShellEnvironment loads environment from the user's login shell
 func loadShellEnvironment() []string {
 	// Get user's shell
@@ -54,50 +223,130 @@ func loadShellEnvironment() []string {
 		shell = "/bin/zsh" // Default to zsh on modern macOS
 	}
 
-	// Try interactive login shell first (loads both profile and rc files)
-	// This gives us the most complete environment
-	// -l: login shell (loads profile files like .zprofile, .bash_profile)
-	// -i: interactive shell (loads rc files like .zshrc, .bashrc)
-	// -c: execute command
-	cmd := exec.Command(shell, "-l", "-i", "-c", "env")
-
-	var stdout bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = nil // Ignore stderr to avoid noise from shell initialization
-
-	if err := cmd.Run(); err != nil {
-		slog.Warn("Failed to load interactive shell environment, trying login shell", "shell", shell, "error", err)
-
-		// Fallback to just login shell
-		cmd = exec.Command(shell, "-l", "-c", "env")
-		stdout.Reset()
-		cmd.Stdout = &stdout
-		cmd.Stderr = nil
+	// Try a plain login shell first (loads profile files like .zprofile, .bash_profile)
+	// Interactive rc files can print banners, run `clear` or refuse to start without a tty,
+	// so -i (which also loads .zshrc, .bashrc) is only the fallback
+	// env -0 separates variables with NUL, so values may contain newlines
+	stdout, err := runShellEnv(shell, "-l", "-c", "env -0")
+	if errors.Is(err, context.DeadlineExceeded) {
+		// A hanging profile would hang the interactive shell too; don't wait twice
+		slog.Warn("Timed out loading shell environment, using the helper's own environment", "shell", shell, "timeout", shellEnvTimeout)
+		return nil
+	}
+	if err != nil {
+		slog.Warn("Failed to load login shell environment, trying interactive shell", "shell", shell, "error", err)
 
-		if err := cmd.Run(); err != nil {
+		stdout, err = runShellEnv(shell, "-l", "-i", "-c", "env -0")
+		if err != nil {
 			slog.Warn("Failed to load shell environment", "shell", shell, "error", err)
 			return nil
 		}
 	}
 
-	// Parse environment variables
-	output := stdout.String()
-	lines := strings.Split(output, "\n")
+	env := parseEnvNul(stdout)
+	slog.Debug("Loaded shell environment", "shell", shell, "vars", len(env))
+	return env
+}
+
+// parseEnvNul parses `env -0` output into KEY=value entries
+// Anything an rc file printed before the first variable (a banner, escape sequences) is
+// dropped, as is anything after the last NUL
+func parseEnvNul(out string) []string {
+	entries := strings.Split(out, "\x00")
+	entries = entries[:len(entries)-1] // Unterminated trailing output isn't env's
 
 	var env []string
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" {
+	for i, entry := range entries {
+		if i == 0 {
+			// Only the first entry can carry output printed before env ran: skip to the first line that starts a variable
+			entry = trimShellOutput(entry)
+		}
+		key, _, ok := strings.Cut(entry, "=")
+		if !ok || !isEnvKey(key) {
 			continue
 		}
-		// Only include lines that look like environment variables
-		if strings.Contains(line, "=") {
-			env = append(env, line)
+		env = append(env, entry)
+	}
+	return env
+}
+
+// trimShellOutput drops whole lines before the first one that starts with KEY=
+func trimShellOutput(entry string) string {
+	for rest := entry; ; {
+		if key, _, ok := strings.Cut(rest, "="); ok && isEnvKey(key) {
+			return rest
+		}
+		nl := strings.IndexByte(rest, '\n')
+		if nl < 0 {
+			return entry
 		}
+		rest = rest[nl+1:]
 	}
+}
 
-	slog.Debug("Loaded shell environment", "shell", shell, "vars", len(env))
-	return env
+// isEnvKey reports whether key looks like a variable name, not leftover shell output
+// Bash exported functions (BASH_FUNC_name%% or, from older bash, BASH_FUNC_name()) are kept,
+// with their multi-line definitions intact, so shells started by /shell still see them
+func isEnvKey(key string) bool {
+	if rest, ok := strings.CutPrefix(key, "BASH_FUNC_"); ok {
+		name, ok := strings.CutSuffix(rest, "%%")
+		if !ok {
+			name, ok = strings.CutSuffix(rest, "()")
+		}
+		return ok && name != "" && !strings.ContainsAny(name, " \t\r\n")
+	}
+	if key == "" {
+		return false
+	}
+	for _, r := range key {
+		if r != '_' && !(r >= 'A' && r <= 'Z') && !(r >= 'a' && r <= 'z') && !(r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// runShellEnv runs the shell within shellEnvTimeout and returns its stdout, at most maxShellEnvBytes
+// A timeout is reported as context.DeadlineExceeded
+func runShellEnv(shell string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), shellEnvTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, shell, args...)
+	stdout := &cappedBuffer{limit: maxShellEnvBytes}
+	cmd.Stdout = stdout
+	cmd.Stderr = nil            // Ignore stderr to avoid noise from shell initialization
+	cmd.WaitDelay = time.Second // Don't wait on children of the shell that still hold stdout
+
+	err := childproc.Run(cmd)
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+	if stdout.exceeded {
+		return "", errShellEnvTooLarge
+	}
+	if err != nil {
+		return "", err
+	}
+	return stdout.buf.String(), nil
+}
+
+// cappedBuffer keeps up to limit bytes and drops the rest, so the pipe keeps draining
+type cappedBuffer struct {
+	buf      bytes.Buffer
+	limit    int
+	exceeded bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); len(p) > room {
+		b.exceeded = true
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
 }
 
 // mergeEnvironments merges two environment slices
@@ -134,6 +383,7 @@ func mergeEnvironments(baseEnv, shellEnv []string) []string {
 		"AWS_PROFILE",
 		"AWS_REGION",
 		"AWS_DEFAULT_REGION",
+		"KUBERNETES_EXEC_INFO", // Read by exec credential plugins
 	}
 	
 	// Merge: shell environment takes precedence for important vars
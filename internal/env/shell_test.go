@@ -0,0 +1,204 @@
+package env
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// installFakeShell points SHELL at a script and shortens the shell guards for the test
+func installFakeShell(t *testing.T, script string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "fake-shell")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SHELL", path)
+
+	origTimeout, origMax := shellEnvTimeout, maxShellEnvBytes
+	shellEnvTimeout = 300 * time.Millisecond
+	t.Cleanup(func() { shellEnvTimeout, maxShellEnvBytes = origTimeout, origMax })
+}
+
+func TestLoadShellEnvironment(t *testing.T) {
+	// A login shell that fails, then an interactive one that prints a banner first
+	installFakeShell(t, `[ "$2" = -i ] || exit 1
+echo 'Welcome back!'
+printf 'PATH=/opt/homebrew/bin:/usr/bin\0KUBECONFIG=/tmp/kc\0'
+`)
+
+	got := loadShellEnvironment()
+	want := []string{"PATH=/opt/homebrew/bin:/usr/bin", "KUBECONFIG=/tmp/kc"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("env = %q, want %q", got, want)
+	}
+}
+
+func TestBaseEnvironment_SkipShellEnv(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "shell-ran")
+	installFakeShell(t, "touch "+marker+"\nprintf 'PATH=/opt/homebrew/bin:/usr/bin\\0'\n")
+
+	// Default: the shell's PATH wins
+	if path, _ := lookupEnv(baseEnvironment(), "PATH"); path != "/opt/homebrew/bin:/usr/bin" {
+		t.Errorf("PATH = %q, want the shell's", path)
+	}
+	os.Remove(marker)
+
+	SetSkipShellEnv(true)
+	t.Cleanup(func() { SetSkipShellEnv(false) })
+	if got, want := baseEnvironment(), os.Environ(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("with HELPER_SKIP_SHELL_ENV got %q, want the inherited environment %q", got, want)
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Error("shell was started despite HELPER_SKIP_SHELL_ENV")
+	}
+}
+
+func TestParseEnvNul(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		want []string
+	}{
+		{"plain", "PATH=/usr/bin\x00HOME=/Users/me\x00", []string{"PATH=/usr/bin", "HOME=/Users/me"}},
+		{"value with newlines", "MOTD=line one\nline two\nKEY=not a var\x00HOME=/Users/me\x00", []string{"MOTD=line one\nline two\nKEY=not a var", "HOME=/Users/me"}},
+		{"value with equals", "OPTS=--a=1 --b=2\x00EMPTY=\x00", []string{"OPTS=--a=1 --b=2", "EMPTY="}},
+		{"banner", "\x1b[H\x1b[2JWelcome, 3 updates = ready\r\nPATH=/usr/bin\x00", []string{"PATH=/usr/bin"}},
+		{"trailing output", "PATH=/usr/bin\x00Bye=for now\n", []string{"PATH=/usr/bin"}},
+		{"not env -0 output", "PATH=/usr/bin\nHOME=/Users/me\n", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseEnvNul(tt.out)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") || len(got) != len(tt.want) {
+				t.Errorf("parseEnvNul(%q) = %q, want %q", tt.out, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadShellEnvironment_Timeout(t *testing.T) {
+	// An rc file that never returns, e.g. one waiting on a prompt
+	installFakeShell(t, "printf 'PATH=/late\\0'\nexec sleep 30\n")
+
+	start := time.Now()
+	got := loadShellEnvironment()
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("loadShellEnvironment took %v, want about the %v timeout", elapsed, shellEnvTimeout)
+	}
+	if got != nil {
+		t.Errorf("env = %q, want nil so the helper's own environment is used", got)
+	}
+}
+
+func TestLoadShellEnvironment_TooLarge(t *testing.T) {
+	installFakeShell(t, "printf 'PATH=/usr/bin\\0BIG=0123456789abcdef0123456789abcdef\\0'\n")
+	maxShellEnvBytes = 32
+
+	if got := loadShellEnvironment(); got != nil {
+		t.Errorf("env = %q, want nil for output over the size limit", got)
+	}
+}
+
+func TestParseEnvNul_MultiLineValues(t *testing.T) {
+	const cert = "-----BEGIN CERTIFICATE-----\nMIIB=abc\n-----END CERTIFICATE-----"
+	const fn = "() {  kubectl --context=prod \"$@\"\n}"
+	out := "CA_CERT=" + cert + "\x00BASH_FUNC_kprod%%=" + fn + "\x00BASH_FUNC_old()=" + fn + "\x00BASH_FUNC_%%=x\x00PATH=/usr/bin\x00"
+
+	got := parseEnvNul(out)
+	want := []string{"CA_CERT=" + cert, "BASH_FUNC_kprod%%=" + fn, "BASH_FUNC_old()=" + fn, "PATH=/usr/bin"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("parseEnvNul = %q, want %q", got, want)
+	}
+}
+
+func TestMergeEnvironments_KeepsFullValues(t *testing.T) {
+	const cert = "-----BEGIN CERTIFICATE-----\nMIIB=abc\n-----END CERTIFICATE-----"
+	const fn = "() {  echo hi\n}"
+	base := []string{"PATH=/usr/bin", "OPTS=--a=1"}
+	shell := []string{"PATH=/opt/homebrew/bin:/usr/bin", "CA_CERT=" + cert, "BASH_FUNC_hi%%=" + fn}
+
+	merged := mergeEnvironments(base, shell)
+	got := map[string]bool{}
+	for _, e := range merged {
+		got[e] = true
+	}
+	for _, want := range []string{"PATH=/opt/homebrew/bin:/usr/bin", "OPTS=--a=1", "CA_CERT=" + cert, "BASH_FUNC_hi%%=" + fn} {
+		if !got[want] {
+			t.Errorf("merged environment is missing %q: %q", want, merged)
+		}
+	}
+	if len(merged) != 4 {
+		t.Errorf("merged environment has %d entries, want 4: %q", len(merged), merged)
+	}
+}
+
+func TestMergeEnvironments_ExecInfoFromShell(t *testing.T) {
+	base := []string{"KUBERNETES_EXEC_INFO=stale"}
+	shell := []string{"KUBERNETES_EXEC_INFO={}"}
+
+	merged := mergeEnvironments(base, shell)
+	if len(merged) != 1 || merged[0] != "KUBERNETES_EXEC_INFO={}" {
+		t.Errorf("merged environment = %q, want the shell's KUBERNETES_EXEC_INFO", merged)
+	}
+}
+
+func TestWithOverrides(t *testing.T) {
+	environ := []string{"PATH=/usr/bin", "KUBERNETES_EXEC_INFO=stale", "AWS_PROFILE=default"}
+	got := WithOverrides(environ, map[string]string{"KUBERNETES_EXEC_INFO": `{"kind":"ExecCredential"}`, "AWS_REGION": "eu-west-1"})
+
+	want := []string{"PATH=/usr/bin", "AWS_PROFILE=default", "AWS_REGION=eu-west-1", `KUBERNETES_EXEC_INFO={"kind":"ExecCredential"}`}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("WithOverrides = %q, want %q", got, want)
+	}
+	if environ[1] != "KUBERNETES_EXEC_INFO=stale" {
+		t.Error("WithOverrides modified its input")
+	}
+}
+
+func TestPathAdditions(t *testing.T) {
+	home := t.TempDir()
+	krewBin := filepath.Join(home, ".krew", "bin")
+	plugins := t.TempDir()
+
+	// No krew install: nothing to add
+	env := []string{"HOME=" + home, "PATH=/usr/bin"}
+	if got := krewPath(env); len(got) != 0 {
+		t.Errorf("without krew: %q, want none", got)
+	}
+
+	if err := os.MkdirAll(krewBin, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	orig := extraPathDirs
+	SetExtraPath([]string{plugins, "/does/not/exist"})
+	t.Cleanup(func() { SetExtraPath(orig) })
+	got := withPathAdditions(env)
+	want := "PATH=" + plugins + ":/usr/bin:" + krewBin
+	if path := got[len(got)-1]; path != want {
+		t.Errorf("PATH = %q, want %q", path, want)
+	}
+
+	// Already on PATH (e.g. from the shell profile): not added twice
+	again := withPathAdditions(got)
+	if strings.Join(again, "|") != strings.Join(got, "|") {
+		t.Errorf("PATH extended twice: %q", again)
+	}
+
+	// An extra dir already later on PATH moves to the front
+	moved := prependPath([]string{"PATH=/usr/bin:" + plugins + ":/bin"}, plugins)
+	if moved[0] != "PATH="+plugins+":/usr/bin:/bin" {
+		t.Errorf("PATH = %q, want %s first", moved[0], plugins)
+	}
+
+	// KREW_ROOT overrides ~/.krew
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "bin"), 0o755)
+	env = append(env, "KREW_ROOT="+root)
+	if got := krewPath(env); len(got) != 1 || got[0] != filepath.Join(root, "bin") {
+		t.Errorf("with KREW_ROOT: %q, want krew bin under %s", got, root)
+	}
+}
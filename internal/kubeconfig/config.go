@@ -0,0 +1,112 @@
+package kubeconfig
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MaxSize is the largest kubeconfig the helper will parse (inline or from disk)
+const MaxSize = 4 << 20 // 4 MiB
+
+// Config is the subset of a kubeconfig the helper needs to inspect
+// Kubeconfigs are YAML or JSON; both parse with the YAML decoder
+type Config struct {
+	CurrentContext string         `yaml:"current-context"`
+	Contexts       []NamedContext `yaml:"contexts"`
+	Clusters       []NamedCluster `yaml:"clusters"`
+}
+
+// NamedContext is a context entry in a kubeconfig
+type NamedContext struct {
+	Name    string  `yaml:"name"`
+	Context Context `yaml:"context"`
+}
+
+// Context references the cluster, user and default namespace for a context
+type Context struct {
+	Cluster   string `yaml:"cluster"`
+	User      string `yaml:"user"`
+	Namespace string `yaml:"namespace"`
+}
+
+// NamedCluster is a cluster entry in a kubeconfig
+type NamedCluster struct {
+	Name    string  `yaml:"name"`
+	Cluster Cluster `yaml:"cluster"`
+}
+
+// Cluster holds the connection details for a cluster
+type Cluster struct {
+	Server string `yaml:"server"`
+}
+
+// Parse parses kubeconfig content
+func Parse(data []byte) (*Config, error) {
+	if len(data) == 0 {
+		return nil, errors.New("kubeconfig is empty")
+	}
+	if len(data) > MaxSize {
+		return nil, fmt.Errorf("kubeconfig is too large: %d bytes (max %d)", len(data), MaxSize)
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid kubeconfig: %w", err)
+	}
+	return &cfg, nil
+}
+
+// LoadFile reads and parses a kubeconfig file from disk
+func LoadFile(path string) (*Config, error) {
+	data, err := ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// ReadFile reads a kubeconfig file from disk after checking it is a regular file within MaxSize
+func ReadFile(path string) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read kubeconfig file: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("kubeconfig path is not a regular file: %s", path)
+	}
+	if info.Size() > MaxSize {
+		return nil, fmt.Errorf("kubeconfig is too large: %d bytes (max %d)", info.Size(), MaxSize)
+	}
+	if info.Size() == 0 {
+		return nil, errors.New("kubeconfig is empty")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read kubeconfig file: %w", err)
+	}
+	return data, nil
+}
+
+// FindContext returns the context with the given name
+func (c *Config) FindContext(name string) (*NamedContext, bool) {
+	for i := range c.Contexts {
+		if c.Contexts[i].Name == name {
+			return &c.Contexts[i], true
+		}
+	}
+	return nil, false
+}
+
+// FindCluster returns the cluster with the given name
+func (c *Config) FindCluster(name string) (*NamedCluster, bool) {
+	for i := range c.Clusters {
+		if c.Clusters[i].Name == name {
+			return &c.Clusters[i], true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,118 @@
+package kubeconfig
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+current-context: dev
+clusters:
+- name: dev-cluster
+  cluster:
+    server: https://dev.example.com
+- name: prod-cluster
+  cluster:
+    server: https://prod.example.com
+contexts:
+- name: dev
+  context:
+    cluster: dev-cluster
+    user: dev-user
+    namespace: team-a
+- name: prod
+  context:
+    cluster: prod-cluster
+    user: prod-user
+users:
+- name: dev-user
+  user:
+    token: secret
+`
+
+func TestParse(t *testing.T) {
+	cfg, err := Parse([]byte(testKubeconfig))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if cfg.CurrentContext != "dev" {
+		t.Errorf("CurrentContext = %q, want dev", cfg.CurrentContext)
+	}
+	if len(cfg.Contexts) != 2 {
+		t.Fatalf("got %d contexts, want 2", len(cfg.Contexts))
+	}
+
+	dev, ok := cfg.FindContext("dev")
+	if !ok {
+		t.Fatal("context dev not found")
+	}
+	if dev.Context.Cluster != "dev-cluster" || dev.Context.User != "dev-user" || dev.Context.Namespace != "team-a" {
+		t.Errorf("unexpected dev context: %+v", dev.Context)
+	}
+
+	if _, ok := cfg.FindContext("missing"); ok {
+		t.Error("FindContext found a context that doesn't exist")
+	}
+
+	cluster, ok := cfg.FindCluster("prod-cluster")
+	if !ok || cluster.Cluster.Server != "https://prod.example.com" {
+		t.Errorf("unexpected prod cluster: %+v (found %v)", cluster, ok)
+	}
+}
+
+func TestParse_JSON(t *testing.T) {
+	cfg, err := Parse([]byte(`{"current-context":"a","contexts":[{"name":"a","context":{"cluster":"c","user":"u"}}]}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if _, ok := cfg.FindContext("a"); !ok {
+		t.Error("context a not found in JSON kubeconfig")
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "Empty", data: ""},
+		{name: "Not YAML", data: "contexts: [unterminated"},
+		{name: "Wrong shape", data: "contexts: 42"},
+		{name: "Too large", data: strings.Repeat("#", MaxSize+1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse([]byte(tt.data)); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config")
+	if err := os.WriteFile(path, []byte(testKubeconfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	if cfg.CurrentContext != "dev" {
+		t.Errorf("CurrentContext = %q, want dev", cfg.CurrentContext)
+	}
+
+	if _, err := LoadFile(filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+	if _, err := LoadFile(dir); err == nil {
+		t.Error("expected an error for a directory")
+	}
+}
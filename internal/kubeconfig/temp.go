@@ -0,0 +1,327 @@
+package kubeconfig
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Name prefixes for temp kubeconfigs and the helper's private temp dirs
+const (
+	tempFilePrefix   = "kubeconfig-"
+	privateDirPrefix = "kubedesk-helper-"
+)
+
+// ownerFile holds the PID of the helper that owns a private temp dir, so the startup sweep
+// never removes the dir of a helper that is still running
+const ownerFile = "owner.pid"
+
+// StaleTempAge is how old a private temp dir without an owner file must be before the startup
+// sweep removes it
+const StaleTempAge = time.Hour
+
+// TempManager maintains reference-counted temp kubeconfig files keyed by cluster hash
+// Concurrent commands against the same cluster share one file, which is removed
+// when the last reference is released
+type TempManager struct {
+	mu         sync.Mutex
+	dir        string
+	privateDir bool // dir was created by UsePrivateDir and is removed on Close
+	files      map[string]*tempFile
+}
+
+// tempFile tracks a single temp kubeconfig and how many callers are using it
+type tempFile struct {
+	path string
+	refs int
+}
+
+// Global temp kubeconfig manager instance
+var globalTempManager = NewTempManager(os.TempDir())
+
+// GetTempManager returns the global temp kubeconfig manager
+func GetTempManager() *TempManager {
+	return globalTempManager
+}
+
+// NewTempManager creates a temp kubeconfig manager that writes files into dir
+func NewTempManager(dir string) *TempManager {
+	return &TempManager{
+		dir:   dir,
+		files: make(map[string]*tempFile),
+	}
+}
+
+// UsePrivateDir creates a directory only the current user can access (0700) and writes
+// all subsequent temp kubeconfigs into it. Called once at startup so credentials never
+// sit in the shared system temp dir under predictable names.
+func (m *TempManager) UsePrivateDir() (string, error) {
+	dir, err := os.MkdirTemp("", privateDirPrefix)
+	if err != nil {
+		return "", fmt.Errorf("failed to create private temp dir: %w", err)
+	}
+	// MkdirTemp already uses 0700, but don't depend on it
+	if err := os.Chmod(dir, 0700); err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("failed to secure private temp dir: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ownerFile), []byte(strconv.Itoa(os.Getpid())), 0600); err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("failed to write private temp dir owner: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dir = dir
+	m.privateDir = true
+	return dir, nil
+}
+
+// Dir returns the directory temp kubeconfigs are written to
+func (m *TempManager) Dir() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.dir
+}
+
+// Acquire returns the path of a temp kubeconfig for the cluster hash, writing it on first use
+// The returned release func drops the reference; it is safe to call more than once
+func (m *TempManager) Acquire(clusterHash, content string) (string, func(), error) {
+	key := clusterHash
+	if key == "" {
+		// Callers should always have a hash, but never share a file between unrelated configs
+		key = fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tf, ok := m.files[key]
+	if !ok {
+		path, err := m.writeLocked(content)
+		if err != nil {
+			return "", nil, err
+		}
+		tf = &tempFile{path: path}
+		m.files[key] = tf
+		slog.Debug("Created shared temp kubeconfig", "clusterHash", clusterHash, "file", path)
+	}
+	tf.refs++
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() { m.release(key, tf) })
+	}
+	return tf.path, release, nil
+}
+
+// AcquireFile is Acquire for requests that may reference a kubeconfig already on disk
+// A non-empty path is returned as-is and is never copied or deleted; otherwise content
+// is shared through Acquire
+func (m *TempManager) AcquireFile(clusterHash, content, path string) (string, func(), error) {
+	if path != "" {
+		return path, func() {}, nil
+	}
+	return m.Acquire(clusterHash, content)
+}
+
+// WriteFile writes an unshared temp kubeconfig with a random name; the caller removes it
+func (m *TempManager) WriteFile(content string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.writeLocked(content)
+}
+
+// writeLocked creates a new temp file containing the kubeconfig, readable only by the current user
+// Caller must hold m.mu
+func (m *TempManager) writeLocked(content string) (string, error) {
+	f, err := os.CreateTemp(m.dir, tempFilePrefix+"*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp kubeconfig: %w", err)
+	}
+	defer f.Close()
+
+	if err := f.Chmod(0600); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to set temp kubeconfig permissions: %w", err)
+	}
+	if _, err := f.WriteString(content); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to write kubeconfig: %w", err)
+	}
+	return f.Name(), nil
+}
+
+// release drops one reference and removes the file when none remain
+func (m *TempManager) release(key string, tf *tempFile) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tf.refs--
+	if tf.refs > 0 {
+		return
+	}
+
+	// Only forget the entry if it hasn't been replaced (e.g. after RemoveAll)
+	if current, ok := m.files[key]; ok && current == tf {
+		delete(m.files, key)
+	}
+	removeFile(tf.path)
+}
+
+// RemoveAll deletes every temp kubeconfig regardless of outstanding references
+// Called on shutdown after all sessions have been stopped
+func (m *TempManager) RemoveAll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, tf := range m.files {
+		removeFile(tf.path)
+		delete(m.files, key)
+	}
+}
+
+// Close removes every temp kubeconfig and, if one was created, the private temp dir
+func (m *TempManager) Close() {
+	m.RemoveAll()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.privateDir {
+		if err := os.RemoveAll(m.dir); err != nil {
+			slog.Warn("Failed to remove private temp dir", "dir", m.dir, "error", err)
+		}
+		m.privateDir = false
+	}
+}
+
+// SweepStale removes private temp dirs left in baseDir by a previous helper process that
+// crashed or was killed before it could clean up. A dir is only removed when the helper named
+// in its owner file is no longer running; dirs from helpers that predate the owner file fall
+// back to olderThan. The current private dir and anything outside helper-owned dirs (e.g.
+// other tools' kubeconfig-* files in a shared temp dir) are never touched
+// Returns the number of dirs removed
+func (m *TempManager) SweepStale(baseDir string, olderThan time.Duration) (int, error) {
+	entries, err := os.ReadDir(baseDir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read temp dir: %w", err)
+	}
+
+	currentDir := m.Dir()
+	cutoff := time.Now().Add(-olderThan)
+	removed := 0
+
+	for _, entry := range entries {
+		name := entry.Name()
+		path := filepath.Join(baseDir, name)
+		if !entry.IsDir() || !strings.HasPrefix(name, privateDirPrefix) || path == currentDir {
+			continue
+		}
+
+		owner, err := readOwner(path)
+		switch {
+		case err == nil:
+			if owner == os.Getpid() || processAlive(owner) {
+				continue
+			}
+		case errors.Is(err, os.ErrNotExist):
+			info, err := entry.Info()
+			if err != nil || info.ModTime().After(cutoff) {
+				continue
+			}
+		default:
+			// Unreadable (e.g. another user's dir) or garbled: leave it alone
+			slog.Debug("Could not read private temp dir owner", "path", path, "error", err)
+			continue
+		}
+
+		if err := os.RemoveAll(path); err != nil {
+			slog.Debug("Could not remove stale private temp dir", "path", path, "error", err)
+			continue
+		}
+		slog.Info("Removed stale private temp dir", "path", path, "owner", owner)
+		removed++
+	}
+
+	return removed, nil
+}
+
+// readOwner returns the PID recorded in a private temp dir's owner file
+func readOwner(dir string) (int, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ownerFile))
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid owner file: %w", err)
+	}
+	return pid, nil
+}
+
+// processAlive reports whether pid is a running process
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// probeSize is what Probe writes: about the size of a typical kubeconfig
+const probeSize = 4096
+
+// Probe checks that temp kubeconfigs can be written by writing, syncing and removing a probe file
+// A full or read-only temp dir otherwise only shows up when a request fails
+func (m *TempManager) Probe() error {
+	f, err := os.CreateTemp(m.Dir(), tempFilePrefix+"probe-*")
+	if err != nil {
+		return fmt.Errorf("failed to create probe file: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(make([]byte, probeSize))
+	if err == nil {
+		err = f.Sync() // A full disk may only fail once data is flushed
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write probe file: %w", err)
+	}
+	return nil
+}
+
+// FreeSpace returns the bytes available to the helper on the temp dir's filesystem
+func (m *TempManager) FreeSpace() (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(m.Dir(), &st); err != nil {
+		return 0, fmt.Errorf("failed to stat temp dir filesystem: %w", err)
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
+
+// Count returns the number of temp kubeconfig files currently held
+func (m *TempManager) Count() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.files)
+}
+
+// removeFile deletes a temp kubeconfig, ignoring files that are already gone
+func removeFile(path string) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		slog.Warn("Failed to remove temp kubeconfig", "file", path, "error", err)
+	} else {
+		slog.Debug("Removed temp kubeconfig", "file", path)
+	}
+}
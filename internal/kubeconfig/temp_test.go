@@ -0,0 +1,307 @@
+package kubeconfig
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTempManager_SharesFilePerClusterHash(t *testing.T) {
+	m := NewTempManager(t.TempDir())
+
+	path1, release1, err := m.Acquire("hash-a", "config-a")
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+	path2, release2, err := m.Acquire("hash-a", "config-a")
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+	if path1 != path2 {
+		t.Errorf("Expected same file for same hash, got %s and %s", path1, path2)
+	}
+
+	path3, release3, err := m.Acquire("hash-b", "config-b")
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+	if path3 == path1 {
+		t.Errorf("Expected different file for different hash")
+	}
+
+	data, err := os.ReadFile(path1)
+	if err != nil || string(data) != "config-a" {
+		t.Fatalf("Unexpected file content %q (err %v)", data, err)
+	}
+	info, err := os.Stat(path1)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("File permissions = %o, want 600", perm)
+	}
+
+	// First release keeps the file, second removes it
+	release1()
+	if _, err := os.Stat(path1); err != nil {
+		t.Errorf("File removed while still referenced: %v", err)
+	}
+
+	// Double release must not drop another caller's reference
+	release1()
+	if _, err := os.Stat(path1); err != nil {
+		t.Errorf("Repeated release removed a file still referenced: %v", err)
+	}
+
+	release2()
+	if _, err := os.Stat(path1); !os.IsNotExist(err) {
+		t.Errorf("File not removed after last release")
+	}
+
+	release3()
+	if m.Count() != 0 {
+		t.Errorf("Count = %d, want 0", m.Count())
+	}
+}
+
+func TestTempManager_ConcurrentAcquireRelease(t *testing.T) {
+	m := NewTempManager(t.TempDir())
+
+	const workers = 50
+	const iterations = 20
+	hashes := []string{"hash-a", "hash-b", "hash-c"}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			hash := hashes[i%len(hashes)]
+			for j := 0; j < iterations; j++ {
+				path, release, err := m.Acquire(hash, "config-"+hash)
+				if err != nil {
+					t.Errorf("Acquire failed: %v", err)
+					return
+				}
+				// The file must exist for as long as we hold a reference
+				if data, err := os.ReadFile(path); err != nil || string(data) != "config-"+hash {
+					t.Errorf("Referenced file unreadable or wrong content: %q (err %v)", data, err)
+				}
+				release()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if m.Count() != 0 {
+		t.Errorf("Count = %d after all releases, want 0", m.Count())
+	}
+	entries, err := os.ReadDir(m.dir)
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Leaked %d temp files", len(entries))
+	}
+}
+
+func TestTempManager_RemoveAll(t *testing.T) {
+	m := NewTempManager(t.TempDir())
+
+	path, release, err := m.Acquire("hash-a", "config-a")
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+
+	m.RemoveAll()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("File not removed by RemoveAll")
+	}
+
+	// Releasing after RemoveAll must be harmless
+	release()
+	if m.Count() != 0 {
+		t.Errorf("Count = %d, want 0", m.Count())
+	}
+}
+
+func TestTempManager_UsePrivateDir(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	m := NewTempManager(os.TempDir())
+
+	dir, err := m.UsePrivateDir()
+	if err != nil {
+		t.Fatalf("UsePrivateDir failed: %v", err)
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if !info.IsDir() {
+		t.Fatalf("%s is not a directory", dir)
+	}
+	if perm := info.Mode().Perm(); perm != 0700 {
+		t.Errorf("Dir permissions = %o, want 700", perm)
+	}
+
+	shared, release, err := m.Acquire("hash-a", "config-a")
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+	defer release()
+	unshared, err := m.WriteFile("config-b")
+	if err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	for _, path := range []string{shared, unshared} {
+		if filepath.Dir(path) != dir {
+			t.Errorf("File %s not inside private dir %s", path, dir)
+		}
+	}
+
+	// Names must not be predictable
+	other, err := m.WriteFile("config-b")
+	if err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if other == unshared {
+		t.Errorf("Expected randomized file names, got %s twice", other)
+	}
+
+	m.Close()
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("Private dir not removed on Close")
+	}
+}
+
+func TestTempManager_SweepStale(t *testing.T) {
+	base := t.TempDir()
+	current := filepath.Join(base, "kubedesk-helper-current")
+	m := NewTempManager(current)
+
+	old := time.Now().Add(-2 * time.Hour)
+	mk := func(name string, dir bool, owner int, mtime time.Time) string {
+		t.Helper()
+		path := filepath.Join(base, name)
+		if dir {
+			if err := os.MkdirAll(filepath.Join(path, "sub"), 0700); err != nil {
+				t.Fatal(err)
+			}
+			if owner != 0 {
+				if err := os.WriteFile(filepath.Join(path, ownerFile), []byte(strconv.Itoa(owner)), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+		} else if err := os.WriteFile(path, []byte("x"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	// A running helper's dir looks stale once it has been idle for an hour; its owner decides
+	alive := exec.Command("sleep", "30")
+	if err := alive.Start(); err != nil {
+		t.Fatalf("start sleep: %v", err)
+	}
+	defer func() {
+		alive.Process.Kill()
+		alive.Wait()
+	}()
+
+	deadOwnerDir := mk("kubedesk-helper-dead", true, deadPID(t), time.Now())
+	liveOwnerDir := mk("kubedesk-helper-live", true, alive.Process.Pid, old)
+	legacyStaleDir := mk("kubedesk-helper-999", true, 0, old)
+	legacyFreshDir := mk("kubedesk-helper-998", true, 0, time.Now())
+	currentDir := mk("kubedesk-helper-current", true, 0, old)
+	otherToolFile := mk("kubeconfig-123", false, 0, old)
+	unrelated := mk("other-file", false, 0, old)
+
+	removed, err := m.SweepStale(base, time.Hour)
+	if err != nil {
+		t.Fatalf("SweepStale: %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("Expected 2 entries removed, got %d", removed)
+	}
+
+	for _, path := range []string{deadOwnerDir, legacyStaleDir} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be removed", path)
+		}
+	}
+	for _, path := range []string{liveOwnerDir, legacyFreshDir, currentDir, otherToolFile, unrelated} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("Expected %s to be kept: %v", path, err)
+		}
+	}
+}
+
+func TestTempManager_UsePrivateDirSurvivesSweep(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	running := NewTempManager(os.TempDir())
+	dir, err := running.UsePrivateDir()
+	if err != nil {
+		t.Fatalf("UsePrivateDir failed: %v", err)
+	}
+	defer running.Close()
+
+	if owner, err := readOwner(dir); err != nil || owner != os.Getpid() {
+		t.Fatalf("readOwner = %d, %v; want %d", owner, err, os.Getpid())
+	}
+
+	// A second helper sweeping the same temp dir must keep the first one's dir, however old
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(dir, old, old); err != nil {
+		t.Fatal(err)
+	}
+	second := NewTempManager(os.TempDir())
+	if removed, err := second.SweepStale(os.TempDir(), time.Hour); err != nil || removed != 0 {
+		t.Fatalf("SweepStale = %d, %v; want 0 removed", removed, err)
+	}
+	if _, err := os.Stat(dir); err != nil {
+		t.Errorf("Running helper's private dir removed: %v", err)
+	}
+}
+
+// deadPID returns the PID of a process that has already exited
+func deadPID(t *testing.T) int {
+	t.Helper()
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("run true: %v", err)
+	}
+	return cmd.Process.Pid
+}
+
+func TestTempManager_Probe(t *testing.T) {
+	dir := t.TempDir()
+	m := NewTempManager(dir)
+
+	if err := m.Probe(); err != nil {
+		t.Fatalf("Probe failed on a writable dir: %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Probe left %d files behind", len(entries))
+	}
+	if free, err := m.FreeSpace(); err != nil || free == 0 {
+		t.Errorf("FreeSpace = %d, %v", free, err)
+	}
+
+	// A temp dir that went away (or can't be written) fails the probe
+	missing := NewTempManager(filepath.Join(dir, "missing"))
+	if err := missing.Probe(); err == nil {
+		t.Error("Probe succeeded on a missing dir")
+	}
+	if _, err := missing.FreeSpace(); err == nil {
+		t.Error("FreeSpace succeeded on a missing dir")
+	}
+}
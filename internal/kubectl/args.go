@@ -0,0 +1,75 @@
+package kubectl
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Limits on a single kubectl invocation's args; well below ARG_MAX on macOS and Linux
+const (
+	MaxArgs      = 1000
+	MaxArgsBytes = 128 * 1024
+)
+
+// strictDeniedFlags let a request point kubectl at other credentials or another server,
+// bypassing the kubeconfig/context the cluster hash was computed from
+var strictDeniedFlags = []string{
+	"--kubeconfig",
+	"--server",
+	"-s",
+	"--cluster",
+	"--user",
+	"--token",
+	"--username",
+	"--password",
+	"--as",
+	"--as-group",
+	"--as-uid",
+	"--client-certificate",
+	"--client-key",
+	"--certificate-authority",
+	"--insecure-skip-tls-verify",
+}
+
+// strictDeniedVerbs never return or need a terminal; they have dedicated endpoints instead
+var strictDeniedVerbs = map[string]bool{
+	"proxy":        true,
+	"port-forward": true,
+	"attach":       true,
+	"edit":         true,
+}
+
+// ValidateArgs checks args before they are passed to kubectl
+// Null bytes and oversized arg lists are always rejected; strict mode also rejects
+// flags that override credentials or the target server, and long-running or interactive verbs
+func ValidateArgs(args []string, strict bool) error {
+	if len(args) > MaxArgs {
+		return fmt.Errorf("too many arguments: %d (max %d)", len(args), MaxArgs)
+	}
+
+	total := 0
+	for i, arg := range args {
+		if strings.IndexByte(arg, 0) >= 0 {
+			return fmt.Errorf("argument %d contains a null byte", i)
+		}
+		total += len(arg)
+	}
+	if total > MaxArgsBytes {
+		return fmt.Errorf("arguments too long: %d bytes (max %d)", total, MaxArgsBytes)
+	}
+
+	if !strict {
+		return nil
+	}
+	if len(args) > 0 && strictDeniedVerbs[args[0]] {
+		return fmt.Errorf("kubectl %s is not allowed in strict mode", args[0])
+	}
+	for _, arg := range args {
+		for _, flag := range strictDeniedFlags {
+			if arg == flag || strings.HasPrefix(arg, flag+"=") {
+				return fmt.Errorf("flag %s is not allowed in strict mode", flag)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package kubectl
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateArgs(t *testing.T) {
+	manyArgs := make([]string, MaxArgs+1)
+	for i := range manyArgs {
+		manyArgs[i] = "x"
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		strict  bool
+		wantErr string
+	}{
+		{name: "Plain get", args: []string{"get", "pods", "-n", "default"}},
+		{name: "Null byte", args: []string{"get", "pods\x00"}, wantErr: "null byte"},
+		{name: "Too many args", args: manyArgs, wantErr: "too many arguments"},
+		{name: "Too long", args: []string{"get", strings.Repeat("a", MaxArgsBytes)}, wantErr: "too long"},
+		{name: "Kubeconfig override allowed by default", args: []string{"get", "pods", "--kubeconfig=/tmp/other"}},
+		{name: "Kubeconfig override in strict mode", args: []string{"get", "pods", "--kubeconfig=/tmp/other"}, strict: true, wantErr: "--kubeconfig"},
+		{name: "Server flag in strict mode", args: []string{"get", "pods", "-s", "https://evil"}, strict: true, wantErr: "-s"},
+		{name: "Proxy verb in strict mode", args: []string{"proxy"}, strict: true, wantErr: "not allowed"},
+		{name: "Similar flag name in strict mode", args: []string{"get", "pods", "--server-side"}, strict: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateArgs(tt.args, tt.strict)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
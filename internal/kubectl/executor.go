@@ -4,30 +4,71 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"log/slog"
-	"os"
 	"os/exec"
-	"path/filepath"
-	"time"
 
+	"github.com/kubedeskpro/kubedesk-helper/internal/childproc"
 	"github.com/kubedeskpro/kubedesk-helper/internal/env"
+	"github.com/kubedeskpro/kubedesk-helper/internal/kubeconfig"
 )
 
 // Result represents the result of a kubectl command execution
 type Result struct {
-	Stdout   string `json:"stdout"`
-	Stderr   string `json:"stderr"`
-	ExitCode int32  `json:"exitCode"`
+	Stdout    string `json:"stdout"`
+	Stderr    string `json:"stderr"`
+	ExitCode  int32  `json:"exitCode"`
+	Truncated bool   `json:"truncated,omitempty"` // Output exceeded MaxOutputBytes; the command was killed
 }
 
-// Execute runs a kubectl command and returns the result
-func Execute(ctx context.Context, args []string, kubeconfig, contextName string) (*Result, error) {
+// Execute runs a kubectl command with inline kubeconfig content and returns the result
+// Concurrent calls with the same content share one temp file; callers that already hold
+// a kubeconfig path (e.g. from the shared temp manager) should use ExecuteWithKubeconfigFile
+func Execute(ctx context.Context, args []string, kubeconfigContent, contextName string) (*Result, error) {
+	var kubeconfigPath string
+	if kubeconfigContent != "" {
+		tmpFile, release, err := kubeconfig.GetTempManager().Acquire("", kubeconfigContent)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		kubeconfigPath = tmpFile
+	}
+
+	return ExecuteWithKubeconfigFile(ctx, args, kubeconfigPath, contextName)
+}
+
+// WriteTempKubeconfig writes kubeconfig content to a temp file readable only by the current user
+// The file lands in the helper's private temp dir; the caller is responsible for removing it
+func WriteTempKubeconfig(content string) (string, error) {
+	return kubeconfig.GetTempManager().WriteFile(content)
+}
+
+// ExecuteWithKubeconfigFile runs a kubectl command against an already-written kubeconfig file
+// The file is used as-is and never removed. An empty kubeconfigPath uses the default
+// kubeconfig from the environment
+func ExecuteWithKubeconfigFile(ctx context.Context, args []string, kubeconfigPath, contextName string) (*Result, error) {
+	return ExecuteWithInput(ctx, args, nil, kubeconfigPath, contextName)
+}
+
+// ExecuteWithInput is ExecuteWithKubeconfigFile with stdin, e.g. a manifest for "apply -f -"
+// A nil stdin reads from the null device
+func ExecuteWithInput(ctx context.Context, args []string, stdin io.Reader, kubeconfigPath, contextName string) (*Result, error) {
 	// Find kubectl binary
 	kubectlPath, err := exec.LookPath("kubectl")
 	if err != nil {
 		return nil, fmt.Errorf("kubectl not found in PATH: %w", err)
 	}
 
+	// Set context if provided
+	if contextName != "" {
+		args = append([]string{"--context", contextName}, args...)
+	}
+
+	// Killed early if its output outgrows the cap
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	// Build command
 	cmd := exec.CommandContext(ctx, kubectlPath, args...)
 
@@ -35,32 +76,21 @@ func Execute(ctx context.Context, args []string, kubeconfig, contextName string)
 	cmd.Env = env.GetShellEnvironment()
 
 	// Set kubeconfig if provided
-	if kubeconfig != "" {
-		// Write kubeconfig to temp file
-		tmpDir := os.TempDir()
-		tmpFile := filepath.Join(tmpDir, fmt.Sprintf("kubeconfig-%d", time.Now().UnixNano()))
-		if err := os.WriteFile(tmpFile, []byte(kubeconfig), 0600); err != nil {
-			return nil, fmt.Errorf("failed to write kubeconfig: %w", err)
-		}
-		defer os.Remove(tmpFile)
-		cmd.Env = append(cmd.Env, fmt.Sprintf("KUBECONFIG=%s", tmpFile))
-	}
-
-	// Set context if provided
-	if contextName != "" {
-		args = append([]string{"--context", contextName}, args...)
-		cmd.Args = append([]string{kubectlPath}, args...)
+	if kubeconfigPath != "" {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("KUBECONFIG=%s", kubeconfigPath))
 	}
 
-	// Capture output
+	// Capture output, up to the configured cap
 	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	limiter := NewOutputLimiter(MaxOutputBytes(), cancel)
+	cmd.Stdin = stdin
+	cmd.Stdout = limiter.Writer(&stdout)
+	cmd.Stderr = limiter.Writer(&stderr)
 
 	slog.Debug("Executing kubectl", "args", args)
 
 	// Run command
-	err = cmd.Run()
+	err = childproc.Run(cmd)
 
 	result := &Result{
 		Stdout: stdout.String(),
@@ -77,6 +107,11 @@ func Execute(ctx context.Context, args []string, kubeconfig, contextName string)
 	} else {
 		result.ExitCode = 0
 	}
+	if limiter.Truncated() {
+		result.Truncated = true
+		result.ExitCode = -1
+		slog.Warn("Command output exceeded limit, killed", "limit", MaxOutputBytes(), "args", args)
+	}
 
 	slog.Debug("kubectl execution completed", "exitCode", result.ExitCode)
 	return result, nil
@@ -90,24 +125,27 @@ func ExecuteCommand(ctx context.Context, command string, args []string, envVars
 		return nil, fmt.Errorf("command not found in PATH: %s: %w", command, err)
 	}
 
+	// Killed early if its output outgrows the cap
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	// Build command
 	cmd := exec.CommandContext(ctx, cmdPath, args...)
 
-	// Set environment with user's shell environment
-	cmd.Env = env.GetShellEnvironment()
-	for k, v := range envVars {
-		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
-	}
+	// Set environment with user's shell environment; the request's vars (e.g. the
+	// KUBERNETES_EXEC_INFO a credential plugin reads) replace inherited ones
+	cmd.Env = env.WithOverrides(env.GetShellEnvironment(), envVars)
 
-	// Capture output
+	// Capture output, up to the configured cap
 	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	limiter := NewOutputLimiter(MaxOutputBytes(), cancel)
+	cmd.Stdout = limiter.Writer(&stdout)
+	cmd.Stderr = limiter.Writer(&stderr)
 
 	slog.Debug("Executing command", "command", command, "args", args)
 
 	// Run command
-	err = cmd.Run()
+	err = childproc.Run(cmd)
 
 	result := &Result{
 		Stdout: stdout.String(),
@@ -124,8 +162,12 @@ func ExecuteCommand(ctx context.Context, command string, args []string, envVars
 	} else {
 		result.ExitCode = 0
 	}
+	if limiter.Truncated() {
+		result.Truncated = true
+		result.ExitCode = -1
+		slog.Warn("Command output exceeded limit, killed", "limit", MaxOutputBytes(), "command", command)
+	}
 
 	slog.Debug("Command execution completed", "exitCode", result.ExitCode)
 	return result, nil
 }
-
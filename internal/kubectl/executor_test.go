@@ -0,0 +1,76 @@
+package kubectl
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// installFakeKubectl puts a kubectl script that prints KUBECONFIG and its contents first on PATH
+func installFakeKubectl(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	script := "#!/bin/sh\necho \"$KUBECONFIG\"\ncat \"$KUBECONFIG\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "kubectl"), []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake kubectl: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestExecute_InlineContent(t *testing.T) {
+	installFakeKubectl(t)
+
+	const content = "apiVersion: v1\nkind: Config\n# executor-inline-test"
+	result, err := Execute(context.Background(), []string{"version"}, content, "")
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	path, written, _ := strings.Cut(result.Stdout, "\n")
+	if result.ExitCode != 0 || strings.TrimSpace(written) != content {
+		t.Fatalf("kubectl did not see the inline kubeconfig: exit %d, output %q", result.ExitCode, result.Stdout)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected temp kubeconfig %s to be removed after Execute, got %v", path, err)
+	}
+}
+
+func TestExecuteWithKubeconfigFile_UsesPathInPlace(t *testing.T) {
+	installFakeKubectl(t)
+
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte("apiVersion: v1"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		result, err := ExecuteWithKubeconfigFile(context.Background(), []string{"version"}, path, "")
+		if err != nil {
+			t.Fatalf("ExecuteWithKubeconfigFile: %v", err)
+		}
+		if got, _, _ := strings.Cut(result.Stdout, "\n"); got != path {
+			t.Errorf("KUBECONFIG = %q, want %q", got, path)
+		}
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("caller's kubeconfig must not be removed: %v", err)
+	}
+}
+
+func TestExecuteWithInput_PassesStdin(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "kubectl"), []byte("#!/bin/sh\ncat\n"), 0755); err != nil {
+		t.Fatalf("Failed to write fake kubectl: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	const manifest = "apiVersion: v1\nkind: ConfigMap\n"
+	result, err := ExecuteWithInput(context.Background(), []string{"apply", "-f", "-"}, strings.NewReader(manifest), "", "")
+	if err != nil {
+		t.Fatalf("ExecuteWithInput: %v", err)
+	}
+	if result.Stdout != manifest {
+		t.Errorf("kubectl read %q from stdin, want %q", result.Stdout, manifest)
+	}
+}
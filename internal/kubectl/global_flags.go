@@ -0,0 +1,56 @@
+package kubectl
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// MaxGlobalFlags bounds the globalFlags list of one request
+const MaxGlobalFlags = 10
+
+// Values accepted by allowed global flags
+var (
+	boolFlagRe      = regexp.MustCompile(`^(true|false)$`)
+	durationFlagRe  = regexp.MustCompile(`^([0-9]+|([0-9]+(h|m|s|ms))+)$`) // e.g. "30", "30s", "1m30s"
+	verbosityFlagRe = regexp.MustCompile(`^([0-9]|10)$`)
+)
+
+// allowedGlobalFlags are the kubectl global flags a request may add, with the pattern their
+// value must match; boolean flags may also be given bare. Flags that choose the kubeconfig,
+// cluster, user or credentials are deliberately absent: they would escape the cluster the
+// request's hash was computed for
+var allowedGlobalFlags = map[string]*regexp.Regexp{
+	"--insecure-skip-tls-verify": boolFlagRe,
+	"--request-timeout":          durationFlagRe,
+	"--v":                        verbosityFlagRe,
+	"-v":                         verbosityFlagRe,
+	"--warnings-as-errors":       boolFlagRe,
+	"--match-server-version":     boolFlagRe,
+	"--disable-compression":      boolFlagRe,
+}
+
+// ValidateGlobalFlags checks a request's globalFlags against the allow-list
+// Values must be joined with '=' ("--v=6", not "--v", "6"), so no value can be read as another arg
+func ValidateGlobalFlags(flags []string) error {
+	if len(flags) > MaxGlobalFlags {
+		return fmt.Errorf("too many globalFlags: %d (max %d)", len(flags), MaxGlobalFlags)
+	}
+	for _, flag := range flags {
+		name, value, hasValue := strings.Cut(flag, "=")
+		valueRe, ok := allowedGlobalFlags[name]
+		if !ok {
+			return fmt.Errorf("global flag %q is not allowed", name)
+		}
+		if !hasValue {
+			if valueRe != boolFlagRe {
+				return fmt.Errorf("global flag %s requires a value, e.g. %s=<value>", name, name)
+			}
+			continue
+		}
+		if !valueRe.MatchString(value) {
+			return fmt.Errorf("invalid value for global flag %s: %q", name, value)
+		}
+	}
+	return nil
+}
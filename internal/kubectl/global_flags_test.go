@@ -0,0 +1,52 @@
+package kubectl
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateGlobalFlags(t *testing.T) {
+	tooMany := make([]string, MaxGlobalFlags+1)
+	for i := range tooMany {
+		tooMany[i] = "--v=1"
+	}
+
+	tests := []struct {
+		name    string
+		flags   []string
+		wantErr string
+	}{
+		{name: "None"},
+		{name: "Verbosity", flags: []string{"--v=6"}},
+		{name: "Short verbosity", flags: []string{"-v=10"}},
+		{name: "Request timeout", flags: []string{"--request-timeout=1m30s"}},
+		{name: "Request timeout in seconds", flags: []string{"--request-timeout=30"}},
+		{name: "Bare boolean", flags: []string{"--insecure-skip-tls-verify", "--warnings-as-errors"}},
+		{name: "Boolean with value", flags: []string{"--disable-compression=true", "--match-server-version=false"}},
+		{name: "Kubeconfig", flags: []string{"--kubeconfig=/tmp/other"}, wantErr: "not allowed"},
+		{name: "Server", flags: []string{"--server=https://evil.example.com"}, wantErr: "not allowed"},
+		{name: "Token", flags: []string{"--token=abc"}, wantErr: "not allowed"},
+		{name: "Not a flag", flags: []string{"get"}, wantErr: "not allowed"},
+		{name: "Separate value", flags: []string{"--v", "6"}, wantErr: "requires a value"},
+		{name: "Verbosity out of range", flags: []string{"--v=11"}, wantErr: "invalid value"},
+		{name: "Bad duration", flags: []string{"--request-timeout=abc"}, wantErr: "invalid value"},
+		{name: "Shell metacharacters", flags: []string{"--request-timeout=1s;id"}, wantErr: "invalid value"},
+		{name: "Bad boolean", flags: []string{"--warnings-as-errors=yes"}, wantErr: "invalid value"},
+		{name: "Too many", flags: tooMany, wantErr: "too many globalFlags"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateGlobalFlags(tt.flags)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package kubectl
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// MaxImpersonationGroups bounds the asGroup list of one request
+const MaxImpersonationGroups = 20
+
+// impersonationRe matches accepted user, group and UID values, e.g. "jane@example.com",
+// "system:serviceaccount:dev:builder" or "oidc:platform-team"; no whitespace or shell metacharacters,
+// since shell sessions splice them into the command line
+var impersonationRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9@._:/+=-]{0,252}$`)
+
+// Impersonation is the identity kubectl acts as (--as, --as-group, --as-uid)
+// The zero value runs as the kubeconfig's own user. Embedded in request types, so the
+// fields sit next to the request's own
+type Impersonation struct {
+	As      string   `json:"as,omitempty"`      // User to impersonate
+	AsGroup []string `json:"asGroup,omitempty"` // Groups to impersonate; requires as
+	AsUID   string   `json:"asUid,omitempty"`   // UID to impersonate; requires as
+}
+
+// IsZero reports whether no impersonation was requested
+func (i Impersonation) IsZero() bool {
+	return i.As == "" && len(i.AsGroup) == 0 && i.AsUID == ""
+}
+
+// Validate checks the values before they become kubectl flags
+func (i Impersonation) Validate() error {
+	if i.IsZero() {
+		return nil
+	}
+	// kubectl refuses groups or a UID without a user
+	if i.As == "" {
+		return errors.New("asGroup and asUid require as")
+	}
+	if !impersonationRe.MatchString(i.As) {
+		return fmt.Errorf("invalid as %q", i.As)
+	}
+	if len(i.AsGroup) > MaxImpersonationGroups {
+		return fmt.Errorf("too many asGroup values: %d (max %d)", len(i.AsGroup), MaxImpersonationGroups)
+	}
+	for _, group := range i.AsGroup {
+		if !impersonationRe.MatchString(group) {
+			return fmt.Errorf("invalid asGroup %q", group)
+		}
+	}
+	if i.AsUID != "" && !impersonationRe.MatchString(i.AsUID) {
+		return fmt.Errorf("invalid asUid %q", i.AsUID)
+	}
+	return nil
+}
+
+// Args returns the kubectl flags for the impersonation, or nil for the zero value
+// Values are joined with '=' so none can be read as a separate flag
+func (i Impersonation) Args() []string {
+	var args []string
+	if i.As != "" {
+		args = append(args, "--as="+i.As)
+	}
+	for _, group := range i.AsGroup {
+		args = append(args, "--as-group="+group)
+	}
+	if i.AsUID != "" {
+		args = append(args, "--as-uid="+i.AsUID)
+	}
+	return args
+}
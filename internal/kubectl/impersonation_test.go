@@ -0,0 +1,64 @@
+package kubectl
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestImpersonation_Validate(t *testing.T) {
+	tooManyGroups := make([]string, MaxImpersonationGroups+1)
+	for i := range tooManyGroups {
+		tooManyGroups[i] = "team"
+	}
+
+	tests := []struct {
+		name    string
+		imp     Impersonation
+		wantErr string
+	}{
+		{name: "None", imp: Impersonation{}},
+		{name: "User", imp: Impersonation{As: "jane@example.com"}},
+		{name: "Service account with groups and UID", imp: Impersonation{
+			As:      "system:serviceaccount:dev:builder",
+			AsGroup: []string{"system:serviceaccounts", "oidc:platform-team"},
+			AsUID:   "5f1c2a4e-8d0b-4c55-9a4e-0c1d2e3f4a5b",
+		}},
+		{name: "Group without user", imp: Impersonation{AsGroup: []string{"admins"}}, wantErr: "require as"},
+		{name: "UID without user", imp: Impersonation{AsUID: "1234"}, wantErr: "require as"},
+		{name: "Shell metacharacters", imp: Impersonation{As: "jane; rm -rf /"}, wantErr: "invalid as"},
+		{name: "Command substitution", imp: Impersonation{As: "$(id)"}, wantErr: "invalid as"},
+		{name: "Leading dash", imp: Impersonation{As: "-jane"}, wantErr: "invalid as"},
+		{name: "Whitespace in group", imp: Impersonation{As: "jane", AsGroup: []string{"Platform Team"}}, wantErr: "invalid asGroup"},
+		{name: "Quote in UID", imp: Impersonation{As: "jane", AsUID: `1"2`}, wantErr: "invalid asUid"},
+		{name: "Too many groups", imp: Impersonation{As: "jane", AsGroup: tooManyGroups}, wantErr: "too many asGroup"},
+		{name: "Too long", imp: Impersonation{As: strings.Repeat("a", 254)}, wantErr: "invalid as"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.imp.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestImpersonation_Args(t *testing.T) {
+	if args := (Impersonation{}).Args(); args != nil {
+		t.Errorf("Args() of zero value = %q, want nil", args)
+	}
+
+	imp := Impersonation{As: "jane", AsGroup: []string{"dev", "ops"}, AsUID: "42"}
+	want := []string{"--as=jane", "--as-group=dev", "--as-group=ops", "--as-uid=42"}
+	if got := imp.Args(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Args() = %q, want %q", got, want)
+	}
+}
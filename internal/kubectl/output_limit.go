@@ -0,0 +1,82 @@
+package kubectl
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// maxOutputBytes caps the output kept from one synchronous command; 0 = unlimited
+var maxOutputBytes atomic.Int64
+
+// SetMaxOutputBytes sets the cap on output buffered from a synchronous command (MAX_OUTPUT_BYTES)
+// Commands that exceed it are killed and their output truncated; 0 disables the cap
+func SetMaxOutputBytes(n int) {
+	maxOutputBytes.Store(int64(n))
+}
+
+// MaxOutputBytes returns the current output cap; 0 means unlimited
+func MaxOutputBytes() int {
+	return int(maxOutputBytes.Load())
+}
+
+// OutputLimiter caps the combined bytes kept from a command's stdout and stderr
+// Once the cap is reached it calls onExceed (usually to kill the command) and drops the rest
+type OutputLimiter struct {
+	mu        sync.Mutex
+	limit     int // 0 = unlimited
+	written   int
+	truncated bool
+	onExceed  func()
+}
+
+// NewOutputLimiter returns a limiter for limit bytes; limit <= 0 never truncates
+func NewOutputLimiter(limit int, onExceed func()) *OutputLimiter {
+	return &OutputLimiter{limit: limit, onExceed: onExceed}
+}
+
+// Writer returns a writer into dst that counts against the shared limit
+func (l *OutputLimiter) Writer(dst io.Writer) io.Writer {
+	return &limitedWriter{limiter: l, dst: dst}
+}
+
+// Truncated reports whether output was dropped because the limit was reached
+func (l *OutputLimiter) Truncated() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.truncated
+}
+
+// limitedWriter forwards writes to dst until the limiter's cap is reached
+type limitedWriter struct {
+	limiter *OutputLimiter
+	dst     io.Writer
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	l := w.limiter
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.limit <= 0 {
+		return w.dst.Write(p)
+	}
+	if l.truncated {
+		return len(p), nil // Keep draining the pipe until the process dies
+	}
+
+	keep := p
+	if room := l.limit - l.written; len(p) > room {
+		keep = p[:room]
+		l.truncated = true
+	}
+	n, err := w.dst.Write(keep)
+	l.written += n
+	if err != nil {
+		return n, err
+	}
+	if l.truncated && l.onExceed != nil {
+		l.onExceed()
+	}
+	return len(p), nil
+}
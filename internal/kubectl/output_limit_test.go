@@ -0,0 +1,52 @@
+package kubectl
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestOutputLimiter_SharedCap(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	exceeded := 0
+	limiter := NewOutputLimiter(10, func() { exceeded++ })
+	out, errw := limiter.Writer(&stdout), limiter.Writer(&stderr)
+
+	out.Write([]byte("123456"))
+	errw.Write([]byte("abcdef"))
+	if n, err := out.Write([]byte("more")); n != 4 || err != nil {
+		t.Errorf("write after cap = %d, %v; want 4, nil so the pipe keeps draining", n, err)
+	}
+
+	if stdout.String() != "123456" || stderr.String() != "abcd" {
+		t.Errorf("stdout %q stderr %q, want %q and %q", stdout.String(), stderr.String(), "123456", "abcd")
+	}
+	if !limiter.Truncated() || exceeded != 1 {
+		t.Errorf("truncated = %v, onExceed calls = %d; want true, 1", limiter.Truncated(), exceeded)
+	}
+}
+
+func TestOutputLimiter_Unlimited(t *testing.T) {
+	var buf bytes.Buffer
+	limiter := NewOutputLimiter(0, nil)
+	limiter.Writer(&buf).Write([]byte(strings.Repeat("x", 1<<16)))
+	if buf.Len() != 1<<16 || limiter.Truncated() {
+		t.Errorf("got %d bytes, truncated %v; want all output kept", buf.Len(), limiter.Truncated())
+	}
+}
+
+func TestExecuteCommand_KillsOversizedOutput(t *testing.T) {
+	orig := MaxOutputBytes()
+	SetMaxOutputBytes(4096)
+	defer SetMaxOutputBytes(orig)
+
+	// yes never exits on its own; the cap has to kill it
+	result, err := ExecuteCommand(context.Background(), "yes", nil, nil)
+	if err != nil {
+		t.Fatalf("ExecuteCommand: %v", err)
+	}
+	if !result.Truncated || result.ExitCode != -1 || len(result.Stdout) != 4096 {
+		t.Errorf("truncated %v, exit %d, %d bytes; want true, -1, 4096", result.Truncated, result.ExitCode, len(result.Stdout))
+	}
+}
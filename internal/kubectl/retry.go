@@ -0,0 +1,76 @@
+package kubectl
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// MaxRetries caps the retries a request may ask for
+const MaxRetries = 5
+
+// Backoff between retries: retryBaseDelay doubled per attempt, capped at retryMaxDelay
+const (
+	retryBaseDelay = 250 * time.Millisecond
+	retryMaxDelay  = 2 * time.Second
+)
+
+// transientPatterns are lowercase stderr fragments kubectl prints when it never got a
+// usable answer from the API server (network blips, credential plugin refreshes)
+// Server-side errors like NotFound or Forbidden are deliberately absent
+var transientPatterns = []string{
+	"unable to connect to the server",
+	"connection reset by peer",
+	"connection refused",
+	": eof",
+	"unexpected eof",
+	"i/o timeout",
+	"tls handshake timeout",
+	"you must be logged in to the server",
+}
+
+// IsTransient reports whether kubectl output looks like a transient connection or auth failure
+func IsTransient(output string) bool {
+	lower := strings.ToLower(output)
+	for _, pattern := range transientPatterns {
+		if strings.Contains(lower, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// WaitRetry sleeps before retry number attempt (1-based) and reports whether to go ahead
+// Returns false without waiting the full delay if ctx is done
+func WaitRetry(ctx context.Context, attempt int) bool {
+	delay := retryBaseDelay << (attempt - 1)
+	if delay > retryMaxDelay || delay <= 0 {
+		delay = retryMaxDelay
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Retry calls run until it succeeds, fails with a non-transient error, or retries are used up
+// Returns the last result and the number of attempts made
+func Retry(ctx context.Context, retries int, run func() (*Result, error)) (*Result, int, error) {
+	for attempt := 1; ; attempt++ {
+		result, err := run()
+		if err != nil || result.ExitCode == 0 || result.Truncated || attempt > retries || !IsTransient(result.Stderr) {
+			return result, attempt, err
+		}
+
+		slog.Warn("Transient kubectl failure, retrying", "attempt", attempt, "retries", retries)
+		if !WaitRetry(ctx, attempt) {
+			return result, attempt, nil
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package kubectl
+
+import (
+	"context"
+	"testing"
+)
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		output string
+		want   bool
+	}{
+		{"Unable to connect to the server: EOF", true},
+		{"error: You must be logged in to the server (Unauthorized)", true},
+		{"read tcp 10.0.0.1:5000->10.0.0.2:443: read: connection reset by peer", true},
+		{"Unable to connect to the server: net/http: TLS handshake timeout", true},
+		{`Error from server (NotFound): pods "web" not found`, false},
+		{`Error from server (Forbidden): pods is forbidden`, false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsTransient(tt.output); got != tt.want {
+			t.Errorf("IsTransient(%q) = %v, want %v", tt.output, got, tt.want)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	transient := &Result{ExitCode: 1, Stderr: "Unable to connect to the server: EOF"}
+	notFound := &Result{ExitCode: 1, Stderr: `Error from server (NotFound): pods "web" not found`}
+	ok := &Result{ExitCode: 0}
+
+	tests := []struct {
+		name         string
+		retries      int
+		results      []*Result
+		wantAttempts int
+		wantExit     int32
+	}{
+		{"succeeds after transient failure", 2, []*Result{transient, ok}, 2, 0},
+		{"retries off by default", 0, []*Result{transient, ok}, 1, 1},
+		{"gives up after retries", 1, []*Result{transient, transient, ok}, 2, 1},
+		{"no retry for server errors", 3, []*Result{notFound, ok}, 1, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			result, attempts, err := Retry(context.Background(), tt.retries, func() (*Result, error) {
+				calls++
+				return tt.results[calls-1], nil
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if attempts != tt.wantAttempts || calls != tt.wantAttempts || result.ExitCode != tt.wantExit {
+				t.Errorf("got attempts=%d calls=%d exit=%d, want attempts=%d exit=%d",
+					attempts, calls, result.ExitCode, tt.wantAttempts, tt.wantExit)
+			}
+		})
+	}
+}
+
+func TestWaitRetry_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if WaitRetry(ctx, 1) {
+		t.Error("expected WaitRetry to stop when the context is done")
+	}
+}
@@ -8,17 +8,25 @@ import (
 )
 
 // AsyncHandler wraps an slog.Handler and processes logs asynchronously
+// Once closed it writes records synchronously, so logs written after the final flush are never
+// lost; they don't wait for the worker, so a stuck flush can't block them
 type AsyncHandler struct {
 	handler slog.Handler
-	queue   chan *logEntry
-	wg      sync.WaitGroup
-	closed  bool
-	mu      sync.Mutex
+	state   *asyncState // Shared with handlers derived via WithAttrs/WithGroup
+}
+
+// asyncState is the queue and worker shared by an AsyncHandler and its derived handlers
+type asyncState struct {
+	queue  chan *logEntry
+	wg     sync.WaitGroup
+	closed bool
+	mu     sync.RWMutex
 }
 
 type logEntry struct {
-	ctx    context.Context
-	record slog.Record
+	handler slog.Handler
+	ctx     context.Context
+	record  slog.Record
 }
 
 // NewAsyncHandler creates a new async handler with a buffered queue
@@ -29,38 +37,39 @@ func NewAsyncHandler(handler slog.Handler, queueSize int) *AsyncHandler {
 
 	h := &AsyncHandler{
 		handler: handler,
-		queue:   make(chan *logEntry, queueSize),
+		state:   &asyncState{queue: make(chan *logEntry, queueSize)},
 	}
 
 	// Start background worker
-	h.wg.Add(1)
-	go h.worker()
+	h.state.wg.Add(1)
+	go h.state.worker()
 
 	return h
 }
 
 // worker processes log entries in the background
-func (h *AsyncHandler) worker() {
-	defer h.wg.Done()
+func (s *asyncState) worker() {
+	defer s.wg.Done()
 
-	for entry := range h.queue {
+	for entry := range s.queue {
 		// Process log entry (this is where the blocking I/O happens)
-		h.handler.Handle(entry.ctx, entry.record)
+		entry.handler.Handle(entry.ctx, entry.record)
 	}
 }
 
-// Handle queues the log record for async processing
+// Handle queues the log record for async processing, or writes it directly once closed
 func (h *AsyncHandler) Handle(ctx context.Context, r slog.Record) error {
-	h.mu.Lock()
-	if h.closed {
-		h.mu.Unlock()
-		return nil
+	s := h.state
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return h.handler.Handle(ctx, r)
 	}
-	h.mu.Unlock()
 
 	// Non-blocking send to queue
 	select {
-	case h.queue <- &logEntry{ctx: ctx, record: r}:
+	case s.queue <- &logEntry{handler: h.handler, ctx: ctx, record: r.Clone()}:
 		// Successfully queued
 	default:
 		// Queue is full, drop the log (or could block here if you prefer)
@@ -79,7 +88,7 @@ func (h *AsyncHandler) Enabled(ctx context.Context, level slog.Level) bool {
 func (h *AsyncHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
 	return &AsyncHandler{
 		handler: h.handler.WithAttrs(attrs),
-		queue:   h.queue,
+		state:   h.state,
 	}
 }
 
@@ -87,27 +96,49 @@ func (h *AsyncHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
 func (h *AsyncHandler) WithGroup(name string) slog.Handler {
 	return &AsyncHandler{
 		handler: h.handler.WithGroup(name),
-		queue:   h.queue,
+		state:   h.state,
 	}
 }
 
 // Close flushes all pending logs and stops the worker
+// Records handled after Close are written synchronously instead of being queued
 func (h *AsyncHandler) Close() {
-	h.mu.Lock()
-	if h.closed {
-		h.mu.Unlock()
+	s := h.state
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
 		return
 	}
-	h.closed = true
-	h.mu.Unlock()
+	s.closed = true
+	// No Handle can be mid-send here, so closing the queue is safe
+	close(s.queue)
+	s.mu.Unlock()
 
-	// Close the queue and wait for worker to finish
-	close(h.queue)
-	h.wg.Wait()
+	// Wait for the worker to write everything already queued
+	s.wg.Wait()
+}
+
+// CloseContext is Close bounded by ctx
+// Returns ctx.Err() if pending logs weren't flushed in time; the flush continues in the background
+// and later records are written directly, possibly ahead of ones still queued
+func (h *AsyncHandler) CloseContext(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		h.Close()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 // NewAsyncLogger creates a new logger with async JSON handler
-func NewAsyncLogger(w io.Writer, level slog.Level, queueSize int) *slog.Logger {
+// Pass a *slog.LevelVar as level to change it while the logger is in use
+func NewAsyncLogger(w io.Writer, level slog.Leveler, queueSize int) *slog.Logger {
 	jsonHandler := slog.NewJSONHandler(w, &slog.HandlerOptions{
 		Level: level,
 	})
@@ -0,0 +1,125 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer safe for the worker and the test to share
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestAsyncHandler_ShutdownLogsAppear(t *testing.T) {
+	var out syncBuffer
+	logger := NewAsyncLogger(&out, slog.LevelInfo, 10)
+	handler := logger.Handler().(*AsyncHandler)
+	sessionLogger := logger.With("component", "session")
+
+	logger.Info("Shutting down server...")
+	if err := handler.CloseContext(context.Background()); err != nil {
+		t.Fatalf("CloseContext: %v", err)
+	}
+
+	// Shutdown-path logs after the flush, more than the queue could ever hold
+	for i := 0; i < 100; i++ {
+		sessionLogger.Info("Stopped session", "n", i)
+	}
+	logger.Info("Server stopped")
+	handler.Close() // Idempotent
+
+	got := out.String()
+	for _, want := range []string{`"msg":"Shutting down server..."`, `"msg":"Server stopped"`, `"component":"session"`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output missing %s:\n%s", want, got)
+		}
+	}
+	if n := strings.Count(got, `"msg":"Stopped session"`); n != 100 {
+		t.Errorf("got %d session logs, want 100", n)
+	}
+	if first, last := strings.Index(got, "Shutting down"), strings.Index(got, "Server stopped"); first > last {
+		t.Errorf("logs out of order:\n%s", got)
+	}
+}
+
+func TestAsyncHandler_CloseContextTimeout(t *testing.T) {
+	blocked := make(chan struct{})
+	h := NewAsyncHandler(slog.NewJSONHandler(blockingWriter(blocked), nil), 10)
+	slog.New(h).Info("stuck")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := h.CloseContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("CloseContext = %v, want context.DeadlineExceeded", err)
+	}
+	close(blocked)
+}
+
+func TestAsyncHandler_LogsAfterTimedOutFlushDontWait(t *testing.T) {
+	var out syncBuffer
+	blocked := make(chan struct{})
+	defer close(blocked)
+	h := NewAsyncHandler(&stuckHandler{Handler: slog.NewJSONHandler(&out, nil), blocked: blocked}, 10)
+	logger := slog.New(h)
+	logger.Info("stuck")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := h.CloseContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("CloseContext = %v, want context.DeadlineExceeded", err)
+	}
+
+	// The worker is still stuck on the first record; later shutdown logs must not wait for it
+	done := make(chan struct{})
+	go func() {
+		logger.Info("Server stopped")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Logging after a timed-out flush blocked on the stuck worker")
+	}
+	if !strings.Contains(out.String(), `"msg":"Server stopped"`) {
+		t.Errorf("output missing the log written after close:\n%s", out.String())
+	}
+}
+
+// stuckHandler blocks on records with the message "stuck" until the channel is closed
+type stuckHandler struct {
+	slog.Handler
+	blocked chan struct{}
+}
+
+func (h *stuckHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Message == "stuck" {
+		<-h.blocked
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+// blockingWriter blocks every write until the channel is closed
+type blockingWriter chan struct{}
+
+func (w blockingWriter) Write(p []byte) (int, error) {
+	<-w
+	return len(p), nil
+}
@@ -0,0 +1,303 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Request sources recorded per cluster
+const (
+	SourceProxy   = "proxy"   // /proxy/{clusterHash}/...
+	SourceKubectl = "kubectl" // /kubectl
+	SourceExec    = "exec"    // /exec, and /exec/start sessions' output
+	SourceShell   = "shell"   // /shell/start sessions' output
+)
+
+// Defaults bounding how many clusters are tracked
+const (
+	DefaultMaxClusters = 50
+	DefaultTTL         = time.Hour
+)
+
+// Buckets are the latency histogram upper bounds, in seconds
+var Buckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// series is the counters of one (cluster, source) pair
+type series struct {
+	requests uint64
+	errors   uint64
+	sum      float64  // Total latency in seconds
+	buckets  []uint64 // Per-bucket (not cumulative) counts; the last slot is +Inf
+
+	outputBytes uint64 // Output produced by sessions, added as each one ends
+}
+
+// clusterMetrics holds everything recorded for one cluster hash
+type clusterMetrics struct {
+	context  string // Latest context name seen for the hash, used as a friendly label
+	sources  map[string]*series
+	lastSeen time.Time
+}
+
+// Recorder keeps per-cluster request counts, error counts and latency histograms
+// Clusters not seen within the TTL are dropped, and the least recently seen cluster is
+// evicted once maxClusters is reached, so the number of series stays bounded
+type Recorder struct {
+	mu       sync.Mutex
+	clusters map[string]*clusterMetrics
+
+	maxClusters int           // 0 = unlimited
+	ttl         time.Duration // 0 = never expire
+	now         func() time.Time
+}
+
+// Global recorder instance
+var globalRecorder = NewRecorder(DefaultMaxClusters, DefaultTTL)
+
+// GetRecorder returns the global metrics recorder
+func GetRecorder() *Recorder {
+	return globalRecorder
+}
+
+// NewRecorder creates a recorder tracking at most maxClusters clusters, each kept until idle for ttl
+func NewRecorder(maxClusters int, ttl time.Duration) *Recorder {
+	return &Recorder{
+		clusters:    make(map[string]*clusterMetrics),
+		maxClusters: maxClusters,
+		ttl:         ttl,
+		now:         time.Now,
+	}
+}
+
+// Observe records one request against a cluster
+// contextName is optional; when set it becomes the cluster's friendly label
+func (r *Recorder) Observe(clusterHash, contextName, source string, d time.Duration, failed bool) {
+	if clusterHash == "" {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := r.seriesLocked(clusterHash, contextName, source)
+	seconds := d.Seconds()
+	s.requests++
+	if failed {
+		s.errors++
+	}
+	s.sum += seconds
+	s.buckets[sort.SearchFloat64s(Buckets, seconds)]++
+}
+
+// AddOutput records n bytes of output produced by a session against a cluster
+func (r *Recorder) AddOutput(clusterHash, contextName, source string, n int64) {
+	if clusterHash == "" || n <= 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.seriesLocked(clusterHash, contextName, source).outputBytes += uint64(n)
+}
+
+// seriesLocked returns the series of a (cluster, source) pair, creating it if needed, and
+// marks the cluster as seen; r.mu must be held
+func (r *Recorder) seriesLocked(clusterHash, contextName, source string) *series {
+	now := r.now()
+	c, ok := r.clusters[clusterHash]
+	if !ok {
+		r.evictLocked(now)
+		c = &clusterMetrics{sources: make(map[string]*series)}
+		r.clusters[clusterHash] = c
+	}
+	c.lastSeen = now
+	if contextName != "" {
+		c.context = contextName
+	}
+
+	s, ok := c.sources[source]
+	if !ok {
+		s = &series{buckets: make([]uint64, len(Buckets)+1)}
+		c.sources[source] = s
+	}
+	return s
+}
+
+// evictLocked drops expired clusters and, if still full, the least recently seen one
+// Called with r.mu held, before a new cluster is added
+func (r *Recorder) evictLocked(now time.Time) {
+	r.expireLocked(now)
+	if r.maxClusters <= 0 || len(r.clusters) < r.maxClusters {
+		return
+	}
+	var oldest string
+	var oldestSeen time.Time
+	for hash, c := range r.clusters {
+		if oldest == "" || c.lastSeen.Before(oldestSeen) {
+			oldest, oldestSeen = hash, c.lastSeen
+		}
+	}
+	delete(r.clusters, oldest)
+}
+
+// expireLocked drops clusters not seen within the TTL; r.mu must be held
+func (r *Recorder) expireLocked(now time.Time) {
+	if r.ttl <= 0 {
+		return
+	}
+	for hash, c := range r.clusters {
+		if now.Sub(c.lastSeen) > r.ttl {
+			delete(r.clusters, hash)
+		}
+	}
+}
+
+// Reset drops everything recorded
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clusters = make(map[string]*clusterMetrics)
+}
+
+// SourceSnapshot is the recorded totals of one request source for a cluster
+type SourceSnapshot struct {
+	Requests uint64  `json:"requests"`
+	Errors   uint64  `json:"errors"`
+	AvgMs    float64 `json:"avgMs"`
+	P50Ms    float64 `json:"p50Ms"` // Estimated from the histogram buckets
+	P95Ms    float64 `json:"p95Ms"`
+
+	OutputBytes uint64 `json:"outputBytes,omitempty"` // Output produced by finished sessions
+}
+
+// ClusterSnapshot is the recorded totals of one cluster
+type ClusterSnapshot struct {
+	ClusterHash string                    `json:"clusterHash"`
+	Context     string                    `json:"context,omitempty"`
+	LastSeen    time.Time                 `json:"lastSeen"`
+	Sources     map[string]SourceSnapshot `json:"sources"`
+}
+
+// Snapshot returns the current totals of every tracked cluster, sorted by cluster hash
+func (r *Recorder) Snapshot() []ClusterSnapshot {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.expireLocked(r.now())
+	snapshots := make([]ClusterSnapshot, 0, len(r.clusters))
+	for hash, c := range r.clusters {
+		cs := ClusterSnapshot{
+			ClusterHash: hash,
+			Context:     c.context,
+			LastSeen:    c.lastSeen,
+			Sources:     make(map[string]SourceSnapshot, len(c.sources)),
+		}
+		for source, s := range c.sources {
+			ss := SourceSnapshot{
+				Requests: s.requests,
+				Errors:   s.errors,
+				P50Ms:    s.quantile(0.5) * 1000,
+				P95Ms:    s.quantile(0.95) * 1000,
+
+				OutputBytes: s.outputBytes,
+			}
+			if s.requests > 0 {
+				ss.AvgMs = s.sum / float64(s.requests) * 1000
+			}
+			cs.Sources[source] = ss
+		}
+		snapshots = append(snapshots, cs)
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].ClusterHash < snapshots[j].ClusterHash })
+	return snapshots
+}
+
+// quantile estimates the q-th latency quantile in seconds by linear interpolation within its bucket
+// Observations above the last bucket are reported as the last bucket's bound
+func (s *series) quantile(q float64) float64 {
+	if s.requests == 0 {
+		return 0
+	}
+	rank := q * float64(s.requests)
+	var cumulative uint64
+	for i, n := range s.buckets {
+		if float64(cumulative+n) < rank || n == 0 {
+			cumulative += n
+			continue
+		}
+		if i == len(Buckets) {
+			return Buckets[len(Buckets)-1]
+		}
+		lower := 0.0
+		if i > 0 {
+			lower = Buckets[i-1]
+		}
+		return lower + (Buckets[i]-lower)*(rank-float64(cumulative))/float64(n)
+	}
+	return Buckets[len(Buckets)-1]
+}
+
+// WritePrometheus writes every tracked series in the Prometheus text exposition format
+func (r *Recorder) WritePrometheus(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.expireLocked(r.now())
+
+	type row struct {
+		labels string
+		s      *series
+	}
+	var rows []row
+	for hash, c := range r.clusters {
+		for source, s := range c.sources {
+			labels := fmt.Sprintf(`cluster="%s",context="%s",source="%s"`, escapeLabel(hash), escapeLabel(c.context), escapeLabel(source))
+			rows = append(rows, row{labels: labels, s: s})
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].labels < rows[j].labels })
+
+	var b strings.Builder
+	b.WriteString("# HELP kubedesk_cluster_requests_total Requests handled per cluster.\n")
+	b.WriteString("# TYPE kubedesk_cluster_requests_total counter\n")
+	for _, row := range rows {
+		fmt.Fprintf(&b, "kubedesk_cluster_requests_total{%s} %d\n", row.labels, row.s.requests)
+	}
+	b.WriteString("# HELP kubedesk_cluster_request_errors_total Failed requests per cluster.\n")
+	b.WriteString("# TYPE kubedesk_cluster_request_errors_total counter\n")
+	for _, row := range rows {
+		fmt.Fprintf(&b, "kubedesk_cluster_request_errors_total{%s} %d\n", row.labels, row.s.errors)
+	}
+	b.WriteString("# HELP kubedesk_cluster_request_duration_seconds Request latency per cluster.\n")
+	b.WriteString("# TYPE kubedesk_cluster_request_duration_seconds histogram\n")
+	for _, row := range rows {
+		var cumulative uint64
+		for i, bound := range Buckets {
+			cumulative += row.s.buckets[i]
+			fmt.Fprintf(&b, "kubedesk_cluster_request_duration_seconds_bucket{%s,le=\"%g\"} %d\n", row.labels, bound, cumulative)
+		}
+		fmt.Fprintf(&b, "kubedesk_cluster_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", row.labels, row.s.requests)
+		fmt.Fprintf(&b, "kubedesk_cluster_request_duration_seconds_sum{%s} %g\n", row.labels, row.s.sum)
+		fmt.Fprintf(&b, "kubedesk_cluster_request_duration_seconds_count{%s} %d\n", row.labels, row.s.requests)
+	}
+	b.WriteString("# HELP kubedesk_cluster_output_bytes_total Output produced by exec and shell sessions per cluster.\n")
+	b.WriteString("# TYPE kubedesk_cluster_output_bytes_total counter\n")
+	for _, row := range rows {
+		fmt.Fprintf(&b, "kubedesk_cluster_output_bytes_total{%s} %d\n", row.labels, row.s.outputBytes)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// labelEscaper escapes a Prometheus label value
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
@@ -0,0 +1,186 @@
+package metrics
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRecorder_Observe(t *testing.T) {
+	r := NewRecorder(0, 0)
+
+	r.Observe("hash-a", "dev", SourceProxy, 20*time.Millisecond, false)
+	r.Observe("hash-a", "dev", SourceProxy, 40*time.Millisecond, true)
+	r.Observe("hash-a", "", SourceKubectl, 2*time.Second, false)
+	r.Observe("hash-b", "prod", SourceExec, time.Millisecond, true)
+	r.Observe("", "ignored", SourceProxy, time.Millisecond, false)
+
+	snap := r.Snapshot()
+	if len(snap) != 2 {
+		t.Fatalf("Expected 2 clusters, got %d: %+v", len(snap), snap)
+	}
+
+	a := snap[0]
+	if a.ClusterHash != "hash-a" || a.Context != "dev" {
+		t.Errorf("Expected hash-a labeled dev, got %q labeled %q", a.ClusterHash, a.Context)
+	}
+	proxy := a.Sources[SourceProxy]
+	if proxy.Requests != 2 || proxy.Errors != 1 {
+		t.Errorf("Expected 2 proxy requests with 1 error, got %+v", proxy)
+	}
+	if math.Abs(proxy.AvgMs-30) > 0.001 {
+		t.Errorf("Expected 30ms average, got %v", proxy.AvgMs)
+	}
+	if kubectl := a.Sources[SourceKubectl]; kubectl.Requests != 1 || kubectl.Errors != 0 {
+		t.Errorf("Expected 1 kubectl request without errors, got %+v", kubectl)
+	}
+
+	if exec := snap[1].Sources[SourceExec]; snap[1].Context != "prod" || exec.Requests != 1 || exec.Errors != 1 {
+		t.Errorf("Expected 1 failed exec request for prod, got %+v", snap[1])
+	}
+}
+
+func TestRecorder_Quantiles(t *testing.T) {
+	r := NewRecorder(0, 0)
+	// 90 fast requests and 10 slow ones: p50 lands in the first bucket, p95 in the 1-2.5s bucket
+	for i := 0; i < 90; i++ {
+		r.Observe("hash", "", SourceProxy, 2*time.Millisecond, false)
+	}
+	for i := 0; i < 10; i++ {
+		r.Observe("hash", "", SourceProxy, 2*time.Second, false)
+	}
+
+	s := r.Snapshot()[0].Sources[SourceProxy]
+	if s.P50Ms <= 0 || s.P50Ms > 5 {
+		t.Errorf("Expected p50 within the 5ms bucket, got %vms", s.P50Ms)
+	}
+	if s.P95Ms <= 1000 || s.P95Ms > 2500 {
+		t.Errorf("Expected p95 within the 1-2.5s bucket, got %vms", s.P95Ms)
+	}
+}
+
+func TestRecorder_EvictsLeastRecentlySeen(t *testing.T) {
+	r := NewRecorder(2, 0)
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	r.Observe("old", "", SourceProxy, time.Millisecond, false)
+	now = now.Add(time.Second)
+	r.Observe("kept", "", SourceProxy, time.Millisecond, false)
+	now = now.Add(time.Second)
+	r.Observe("new", "", SourceProxy, time.Millisecond, false)
+
+	snap := r.Snapshot()
+	if len(snap) != 2 {
+		t.Fatalf("Expected 2 clusters, got %d", len(snap))
+	}
+	for _, c := range snap {
+		if c.ClusterHash == "old" {
+			t.Errorf("Expected the least recently seen cluster to be evicted")
+		}
+	}
+}
+
+func TestRecorder_ExpiresIdleClusters(t *testing.T) {
+	r := NewRecorder(0, time.Minute)
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	r.Observe("idle", "", SourceProxy, time.Millisecond, false)
+	now = now.Add(30 * time.Second)
+	r.Observe("active", "", SourceProxy, time.Millisecond, false)
+	now = now.Add(45 * time.Second)
+
+	snap := r.Snapshot()
+	if len(snap) != 1 || snap[0].ClusterHash != "active" {
+		t.Errorf("Expected only the active cluster after the TTL, got %+v", snap)
+	}
+
+	var b strings.Builder
+	r.WritePrometheus(&b)
+	if strings.Contains(b.String(), `cluster="idle"`) {
+		t.Errorf("Expected expired cluster to be dropped from the exposition:\n%s", b.String())
+	}
+}
+
+func TestRecorder_WritePrometheus(t *testing.T) {
+	r := NewRecorder(0, 0)
+	r.Observe("hash", `ctx "quoted"`, SourceKubectl, 30*time.Millisecond, false)
+	r.Observe("hash", "", SourceKubectl, 3*time.Second, true)
+
+	var b strings.Builder
+	if err := r.WritePrometheus(&b); err != nil {
+		t.Fatalf("WritePrometheus failed: %v", err)
+	}
+	out := b.String()
+
+	labels := `cluster="hash",context="ctx \"quoted\"",source="kubectl"`
+	for _, want := range []string{
+		"# TYPE kubedesk_cluster_requests_total counter",
+		"kubedesk_cluster_requests_total{" + labels + "} 2",
+		"kubedesk_cluster_request_errors_total{" + labels + "} 1",
+		"# TYPE kubedesk_cluster_request_duration_seconds histogram",
+		"kubedesk_cluster_request_duration_seconds_bucket{" + labels + `,le="0.025"} 0`,
+		"kubedesk_cluster_request_duration_seconds_bucket{" + labels + `,le="0.05"} 1`,
+		"kubedesk_cluster_request_duration_seconds_bucket{" + labels + `,le="2.5"} 1`,
+		"kubedesk_cluster_request_duration_seconds_bucket{" + labels + `,le="5"} 2`,
+		"kubedesk_cluster_request_duration_seconds_bucket{" + labels + `,le="+Inf"} 2`,
+		"kubedesk_cluster_request_duration_seconds_sum{" + labels + "} 3.03",
+		"kubedesk_cluster_request_duration_seconds_count{" + labels + "} 2",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected exposition to contain %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestRecorder_AddOutput(t *testing.T) {
+	r := NewRecorder(0, 0)
+	r.AddOutput("hash", "dev", SourceShell, 1000)
+	r.AddOutput("hash", "", SourceShell, 24)
+	r.AddOutput("hash", "dev", SourceExec, 0)
+	r.AddOutput("", "ignored", SourceShell, 10)
+
+	snap := r.Snapshot()
+	if len(snap) != 1 || snap[0].Context != "dev" {
+		t.Fatalf("Expected 1 cluster labeled dev, got %+v", snap)
+	}
+	if shell := snap[0].Sources[SourceShell]; shell.OutputBytes != 1024 || shell.Requests != 0 {
+		t.Errorf("Expected 1024 shell output bytes and no requests, got %+v", shell)
+	}
+	if _, ok := snap[0].Sources[SourceExec]; ok {
+		t.Error("Expected no exec series for an empty output")
+	}
+
+	var b strings.Builder
+	if err := r.WritePrometheus(&b); err != nil {
+		t.Fatalf("WritePrometheus failed: %v", err)
+	}
+	if want := `kubedesk_cluster_output_bytes_total{cluster="hash",context="dev",source="shell"} 1024`; !strings.Contains(b.String(), want) {
+		t.Errorf("Expected exposition to contain %q:\n%s", want, b.String())
+	}
+}
+
+func TestRecorder_ConcurrentObserve(t *testing.T) {
+	r := NewRecorder(3, time.Hour)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			hash := string(rune('a' + i))
+			for j := 0; j < 100; j++ {
+				r.Observe(hash, "", SourceProxy, time.Millisecond, j%10 == 0)
+				r.Snapshot()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if n := len(r.Snapshot()); n > 3 {
+		t.Errorf("Expected at most 3 clusters, got %d", n)
+	}
+}
@@ -0,0 +1,115 @@
+package session
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultStopGrace is how long DeactivateCluster waits after SIGTERM before sending SIGKILL
+const DefaultStopGrace = 5 * time.Second
+
+// stopPollInterval is how often a terminated process is checked for exit
+const stopPollInterval = 50 * time.Millisecond
+
+// StopReason says how DeactivateCluster ended a session's process
+type StopReason string
+
+const (
+	StopReasonExited     StopReason = "exited"     // No process was running
+	StopReasonTerminated StopReason = "terminated" // Exited after SIGTERM, within the grace period
+	StopReasonKilled     StopReason = "killed"     // Still running after the grace period, so sent SIGKILL
+)
+
+// StopResult describes one session stopped by DeactivateCluster
+type StopResult struct {
+	SessionID     string        `json:"sessionId"`
+	Type          SessionType   `json:"type"`
+	Status        SessionStatus `json:"status"` // Status before it was stopped
+	Reason        StopReason    `json:"reason"`
+	DrainTimedOut bool          `json:"drainTimedOut,omitempty"` // In-flight proxied requests were cut off
+	Error         string        `json:"error,omitempty"`         // Signalling the process failed
+}
+
+// DeactivateCluster gracefully stops and removes all sessions for a cluster
+// Like CleanupByClusterHash, sessions are unlisted and drained of in-flight requests first;
+// their processes then get SIGTERM and, if still running after grace, SIGKILL
+func (m *Manager) DeactivateCluster(clusterHash string, grace time.Duration) []StopResult {
+	m.mu.Lock()
+	var removed []*Session
+	results := []StopResult{}
+	for id, session := range m.sessions {
+		if session.ClusterHash == clusterHash {
+			delete(m.sessions, id)
+			removed = append(removed, session)
+			results = append(results, StopResult{SessionID: session.ID, Type: session.Type, Status: session.Status})
+			session.Status = StatusStopped
+		}
+	}
+	deadline := time.Now().Add(m.drainTimeout)
+	onCleanup := m.onSessionCleanup
+	m.mu.Unlock()
+
+	// Sessions stop concurrently, so the whole call takes at most the drain timeout plus grace
+	var wg sync.WaitGroup
+	for i, session := range removed {
+		wg.Add(1)
+		go func(session *Session, result *StopResult) {
+			defer wg.Done()
+			result.DrainTimedOut = !session.drain(time.Until(deadline))
+
+			reason, err := terminate(session, grace)
+			result.Reason = reason
+			if err != nil {
+				result.Error = err.Error()
+				slog.Warn("Failed to stop process during cluster deactivation", "id", session.ID, "error", err)
+			}
+
+			m.cleanupSessionFiles(session)
+			if onCleanup != nil {
+				onCleanup(session.ID)
+			}
+			m.publishRemoved(EventStopped, session, "cluster deactivated")
+		}(session, &results[i])
+	}
+	wg.Wait()
+
+	if len(removed) > 0 {
+		slog.Info("Cluster deactivated", "clusterHash", clusterHash, "sessionsStopped", len(removed))
+	}
+	return results
+}
+
+// terminate sends SIGTERM to a session's process and SIGKILL if it hasn't exited after grace
+// Exit is noticed once the session's monitor goroutine has reaped the process
+func terminate(session *Session, grace time.Duration) (StopReason, error) {
+	if session.Cmd == nil || session.Cmd.Process == nil {
+		return StopReasonExited, nil
+	}
+	process := session.Cmd.Process
+
+	if err := process.Signal(syscall.SIGTERM); err != nil {
+		if errors.Is(err, os.ErrProcessDone) {
+			return StopReasonExited, nil
+		}
+		// SIGTERM couldn't be sent; don't leave the process running
+		return StopReasonKilled, process.Kill()
+	}
+
+	for deadline := time.Now().Add(grace); time.Now().Before(deadline); {
+		time.Sleep(stopPollInterval)
+		if errors.Is(process.Signal(syscall.Signal(0)), os.ErrProcessDone) {
+			return StopReasonTerminated, nil
+		}
+	}
+	if err := process.Kill(); err != nil {
+		if errors.Is(err, os.ErrProcessDone) {
+			return StopReasonTerminated, nil
+		}
+		return StopReasonKilled, err
+	}
+	return StopReasonKilled, nil
+}
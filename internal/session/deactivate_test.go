@@ -0,0 +1,78 @@
+package session
+
+import (
+	"os/exec"
+	"testing"
+	"time"
+)
+
+// startProcess runs a shell script as the session's process and reaps it like the handlers' monitors do
+func startProcess(t *testing.T, s *Session, script string) {
+	t.Helper()
+	cmd := exec.Command("/bin/sh", "-c", script)
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	s.Cmd = cmd
+	go cmd.Wait()
+}
+
+func TestManager_DeactivateCluster(t *testing.T) {
+	m := NewManager()
+	defer m.Shutdown()
+
+	terminated, _ := m.CreateForCluster(TypePortForward, "old")
+	startProcess(t, terminated, "exec sleep 30")
+	stubborn, _ := m.CreateForCluster(TypeExec, "old")
+	startProcess(t, stubborn, `trap "" TERM; while :; do sleep 0.05; done`)
+	noProcess, _ := m.CreateForCluster(TypeProxy, "old")
+	var released bool
+	noProcess.AddRelease(func() { released = true })
+	kept, _ := m.CreateForCluster(TypeProxy, "new")
+
+	events, cancel := m.Subscribe()
+	defer cancel()
+
+	// Let the trap be installed before SIGTERM arrives
+	time.Sleep(100 * time.Millisecond)
+
+	const grace = 300 * time.Millisecond
+	start := time.Now()
+	results := m.DeactivateCluster("old", grace)
+	if elapsed := time.Since(start); elapsed > grace+time.Second {
+		t.Errorf("deactivation took %s; sessions should stop concurrently", elapsed)
+	}
+
+	want := map[string]StopReason{
+		terminated.ID: StopReasonTerminated,
+		stubborn.ID:   StopReasonKilled,
+		noProcess.ID:  StopReasonExited,
+	}
+	if len(results) != len(want) {
+		t.Fatalf("got %d results, want %d: %+v", len(results), len(want), results)
+	}
+	for _, r := range results {
+		if r.Reason != want[r.SessionID] || r.Status != StatusRunning || r.Error != "" {
+			t.Errorf("session %s (%s): got %+v, want reason %s", r.SessionID, r.Type, r, want[r.SessionID])
+		}
+	}
+
+	if _, ok := m.Get(terminated.ID); ok {
+		t.Error("deactivated session is still listed")
+	}
+	if _, ok := m.Get(kept.ID); !ok {
+		t.Error("session for another cluster was stopped")
+	}
+	if !released {
+		t.Error("session resources were not released")
+	}
+	for range want {
+		if e := nextEvent(t, events); e.Kind != EventStopped || e.ClusterHash != "old" || e.Reason != "cluster deactivated" {
+			t.Errorf("unexpected event: %+v", e)
+		}
+	}
+
+	if results := m.DeactivateCluster("old", grace); len(results) != 0 {
+		t.Errorf("second deactivation stopped %d sessions", len(results))
+	}
+}
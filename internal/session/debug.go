@@ -0,0 +1,144 @@
+package session
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// DebugInfo is a point-in-time copy of a session's internal state, for support bundles
+// It never includes kubeconfig content or output
+type DebugInfo struct {
+	ID            string        `json:"id"`
+	Type          SessionType   `json:"type"`
+	Status        SessionStatus `json:"status"`
+	PID           int           `json:"pid,omitempty"` // 0 until the process has started
+	StartedAt     time.Time     `json:"startedAt"`
+	LastReadTime  time.Time     `json:"lastReadTime"`
+	ClusterHash   string        `json:"clusterHash,omitempty"`
+	Context       string        `json:"context,omitempty"`
+	Namespace     string        `json:"namespace,omitempty"`
+	PodName       string        `json:"podName,omitempty"`
+	Container     string        `json:"container,omitempty"`
+	ResourceType  string        `json:"resourceType,omitempty"`
+	ResourceName  string        `json:"resourceName,omitempty"`
+	LocalPort     string        `json:"localPort,omitempty"`
+	Port          int           `json:"port,omitempty"`
+	CommandLine   []string      `json:"commandLine,omitempty"` // Already redacted by the handler that set it
+	ExitCode      *int32        `json:"exitCode,omitempty"`
+	TempFiles     int           `json:"tempFiles"`
+	ReleaseHooks  int           `json:"releaseHooks"` // e.g. references to shared temp kubeconfigs
+	Released      bool          `json:"released"`
+	HasKubeconfig bool          `json:"hasKubeconfig"`
+	OutputLen     int           `json:"outputLen"` // Bytes buffered, or lines for structured sessions
+	AuthFailures  int           `json:"authFailures,omitempty"`
+	BytesProduced int64         `json:"bytesProduced"` // Total bytes of output ever written
+
+	// Identity kubectl impersonates, if any
+	As      string   `json:"as,omitempty"`
+	AsGroup []string `json:"asGroup,omitempty"`
+	AsUID   string   `json:"asUid,omitempty"`
+
+	GlobalFlags []string `json:"globalFlags,omitempty"`
+}
+
+// ManagerSettings are the manager's limits and timeouts
+type ManagerSettings struct {
+	InactivityTimeout time.Duration
+	CompletedTimeout  time.Duration
+	CleanupInterval   time.Duration
+	DrainTimeout      time.Duration
+	MaxSessions       int
+}
+
+// Settings returns the manager's current limits and timeouts
+func (m *Manager) Settings() ManagerSettings {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return ManagerSettings{
+		InactivityTimeout: m.inactivityTimeout,
+		CompletedTimeout:  m.completedTimeout,
+		CleanupInterval:   m.cleanupInterval,
+		DrainTimeout:      m.drainTimeout,
+		MaxSessions:       m.maxSessions,
+	}
+}
+
+// DebugSnapshot returns the internal state of every session, oldest first
+func (m *Manager) DebugSnapshot() []DebugInfo {
+	m.mu.RLock()
+	sessions := make([]*Session, 0, len(m.sessions))
+	statuses := make(map[*Session]SessionStatus, len(m.sessions))
+	localPorts := make(map[*Session]string, len(m.sessions))
+	for _, s := range m.sessions {
+		sessions = append(sessions, s)
+		statuses[s] = s.Status // Guarded by m.mu (see SetStatus)
+		localPorts[s] = s.LocalPort
+	}
+	m.mu.RUnlock()
+
+	infos := make([]DebugInfo, 0, len(sessions))
+	for _, s := range sessions {
+		info := s.debugInfo()
+		info.Status = statuses[s]
+		info.LocalPort = localPorts[s]
+		infos = append(infos, info)
+	}
+	sortDebugInfos(infos)
+	return infos
+}
+
+// debugInfo copies the session's state, taking each field's lock in turn
+func (s *Session) debugInfo() DebugInfo {
+	info := DebugInfo{
+		ID:           s.ID,
+		Type:         s.Type,
+		StartedAt:    s.StartedAt,
+		ClusterHash:  s.ClusterHash,
+		Context:      s.Context,
+		Namespace:    s.Namespace,
+		PodName:      s.PodName,
+		Container:    s.Container,
+		ResourceType: s.ResourceType,
+		ResourceName: s.ResourceName,
+		Port:         s.Port,
+		CommandLine:  s.CommandLine,
+		ExitCode:     s.ExitCode,
+		AuthFailures: s.AuthFailures(),
+
+		BytesProduced: s.BytesProduced(),
+
+		As:      s.ImpersonateUser,
+		AsGroup: s.ImpersonateGroups,
+		AsUID:   s.ImpersonateUID,
+
+		GlobalFlags: s.GlobalFlags,
+	}
+	if s.Cmd != nil && s.Cmd.Process != nil {
+		info.PID = s.Cmd.Process.Pid
+	}
+
+	s.outputMutex.RLock()
+	info.LastReadTime = s.lastReadTime
+	info.OutputLen = s.outputLenLocked()
+	s.outputMutex.RUnlock()
+
+	s.releaseMutex.Lock()
+	info.TempFiles = len(s.tempFiles)
+	info.ReleaseHooks = len(s.releaseFuncs)
+	info.Released = s.released
+	info.HasKubeconfig = len(s.kubeconfig) > 0
+	s.releaseMutex.Unlock()
+
+	return info
+}
+
+// sortDebugInfos orders sessions by start time, then ID
+func sortDebugInfos(infos []DebugInfo) {
+	slices.SortFunc(infos, func(a, b DebugInfo) int {
+		if c := a.StartedAt.Compare(b.StartedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+}
@@ -0,0 +1,83 @@
+package session
+
+import (
+	"sync"
+	"time"
+)
+
+// EventKind identifies a session lifecycle transition
+type EventKind string
+
+const (
+	EventCreated       EventKind = "created"
+	EventStatusChanged EventKind = "status-changed"
+	EventStopped       EventKind = "stopped"
+	EventCleanedUp     EventKind = "cleaned-up"
+)
+
+// eventBufferSize is the per-subscriber queue; slow subscribers drop events rather than block sessions
+const eventBufferSize = 256
+
+// Event describes a session lifecycle change
+type Event struct {
+	Kind        EventKind     `json:"event"`
+	SessionID   string        `json:"sessionId"`
+	SessionType SessionType   `json:"sessionType"`
+	ClusterHash string        `json:"clusterHash,omitempty"`
+	Status      SessionStatus `json:"status"`
+	Reason      string        `json:"reason,omitempty"`
+	Timestamp   time.Time     `json:"timestamp"`
+}
+
+// eventBus fans lifecycle events out to subscribers
+type eventBus struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+}
+
+// Subscribe registers for session lifecycle events
+// The returned cancel func unsubscribes and closes the channel
+func (m *Manager) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, eventBufferSize)
+
+	m.events.mu.Lock()
+	if m.events.subscribers == nil {
+		m.events.subscribers = make(map[chan Event]struct{})
+	}
+	m.events.subscribers[ch] = struct{}{}
+	m.events.mu.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			m.events.mu.Lock()
+			delete(m.events.subscribers, ch)
+			m.events.mu.Unlock()
+			close(ch)
+		})
+	}
+	return ch, cancel
+}
+
+// publish sends an event for the session to every subscriber without blocking
+func (m *Manager) publish(kind EventKind, s *Session, reason string) {
+	event := Event{
+		Kind:        kind,
+		SessionID:   s.ID,
+		SessionType: s.Type,
+		ClusterHash: s.ClusterHash,
+		Status:      s.Status,
+		Reason:      reason,
+		Timestamp:   time.Now(),
+	}
+
+	m.events.mu.Lock()
+	defer m.events.mu.Unlock()
+	for ch := range m.events.subscribers {
+		select {
+		case ch <- event:
+		default:
+			// Subscriber is not keeping up; drop rather than stall session operations
+		}
+	}
+}
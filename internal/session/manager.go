@@ -2,11 +2,15 @@ package session
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"io"
 	"log/slog"
+	"math/rand"
 	"os"
 	"os/exec"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -20,6 +24,7 @@ const (
 	TypeExec        SessionType = "exec"
 	TypeProxy       SessionType = "proxy"
 	TypeShell       SessionType = "shell"
+	TypeWatch       SessionType = "watch"
 )
 
 // SessionStatus represents the status of a session
@@ -31,50 +36,107 @@ const (
 	StatusFailed  SessionStatus = "failed"
 )
 
+// ErrTooManySessions is returned by Create when the running-session limit is reached
+var ErrTooManySessions = errors.New("too many sessions")
+
 // Session represents a long-running kubectl process
 type Session struct {
 	ID           string
 	Type         SessionType
-	Status       SessionStatus
+	Status       SessionStatus // Guarded by Manager.mu once listed; read it with Manager.StatusOf
 	StartedAt    time.Time
 	Cmd          *exec.Cmd
 	Namespace    string
 	ResourceType string
 	ResourceName string
 	ServicePort  string
-	LocalPort    string
+	LocalPort    string // Guarded by Manager.mu once listed; see SetLocalPort and LocalPortOf
 	PodName      string
 	Container    string
 	Command      []string
+	CommandLine  []string // Resolved argv, secrets and kubeconfig paths redacted; for support/debugging
 	Port         int
 	Context      string
-	Kubeconfig   string
 	ClusterHash  string // Hash of kubeconfig+context for cluster isolation
 
+	// Kubeconfig kubectl reads: the request's kubeconfigPath or the default; "" for an inline temp copy
+	KubeconfigPath string
+
+	// For proxy sessions with a default Namespace: reject requests into other namespaces
+	NamespaceScoped bool
+
+	// Identity kubectl impersonates (--as, --as-group, --as-uid); empty for the kubeconfig's own user
+	ImpersonateUser   string
+	ImpersonateGroups []string
+	ImpersonateUID    string
+
+	// Allow-listed kubectl global flags added to each invocation, e.g. "--v=6"
+	GlobalFlags []string
+
 	// For exec and shell sessions
 	stdin        io.WriteCloser
-	outputBuffer *bytes.Buffer
+	outputBuffer *bytes.Buffer // stdout and stderr interleaved
+	stdoutBuffer *bytes.Buffer // Per-stream copies, filled by StreamWriter
+	stderrBuffer *bytes.Buffer
 	outputMutex  sync.RWMutex
+	outputCond   *sync.Cond // Signaled on new output and on CloseOutput; uses outputMutex
+	outputDone   bool       // Set by CloseOutput once the process has exited
 	lastReadTime time.Time
 	WriteInput   func(string) error
 
+	// Structured (line-framed) output, used instead of outputBuffer when enabled; guarded by outputMutex
+	structured   bool
+	outputLines  []OutputLine
+	partialLines map[string]*bytes.Buffer
+
 	// For shell sessions
 	ShellCommand string
 	ExitCode     *int32
 
-	// Temporary files to clean up when session ends
-	TempFiles []string
+	// Temporary files to clean up when session ends, and release hooks for shared
+	// resources (e.g. ref-counted temp kubeconfigs); all guarded by releaseMutex
+	// since the monitor goroutine and the manager may release concurrently
+	tempFiles    []string
+	releaseFuncs []func()
+	released     bool
+	releaseMutex sync.Mutex
+
+	// Kubeconfig content (may hold tokens/certs); kept as bytes so Release can zero it
+	kubeconfig []byte
+
+	// In-flight proxied requests; cluster cleanup drains them before killing the process
+	inFlight sync.WaitGroup
+	draining bool
+	useMutex sync.Mutex
+
+	uses int // In-flight count, guarded by useMutex
+
+	// Consecutive 401/403 responses from a proxy's API server; reset by any other status
+	authFailures atomic.Int32
+
+	// Requests routed through a proxy session, and when the last one arrived (unix nanoseconds)
+	proxyRequests    atomic.Int64
+	lastProxyRequest atomic.Int64
+
+	// Total bytes ever written to the session's output, whether or not they are still buffered
+	bytesProduced atomic.Int64
+
+	// Why the session failed, set by Manager.Fail
+	failReason atomic.Pointer[string]
 }
 
 // Manager manages all active sessions
 type Manager struct {
-	sessions              map[string]*Session
-	mu                    sync.RWMutex
-	inactivityTimeout     time.Duration
-	completedTimeout      time.Duration
-	cleanupInterval       time.Duration
-	stopCleanup           chan struct{}
-	onSessionCleanup      func(string) // Callback for cleanup (e.g., delete temp files)
+	sessions          map[string]*Session
+	mu                sync.RWMutex
+	inactivityTimeout time.Duration
+	completedTimeout  time.Duration
+	cleanupInterval   time.Duration
+	stopCleanup       chan struct{}
+	onSessionCleanup  func(string)  // Callback for cleanup (e.g., delete temp files)
+	maxSessions       int           // Max running sessions, 0 = unlimited
+	drainTimeout      time.Duration // Max wait for in-flight requests during cluster cleanup
+	events            eventBus      // Lifecycle event subscribers (see Subscribe)
 }
 
 // NewManager creates a new session manager
@@ -84,6 +146,7 @@ func NewManager() *Manager {
 		inactivityTimeout: 30 * time.Minute, // Remove inactive sessions after 30 minutes
 		completedTimeout:  5 * time.Minute,  // Remove completed sessions after 5 minutes
 		cleanupInterval:   1 * time.Minute,  // Check every minute
+		drainTimeout:      30 * time.Second, // Wait for in-flight proxy requests on cluster cleanup
 		stopCleanup:       make(chan struct{}),
 	}
 
@@ -107,6 +170,20 @@ func (m *Manager) SetCompletedTimeout(timeout time.Duration) {
 	m.completedTimeout = timeout
 }
 
+// SetMaxSessions sets the maximum number of running sessions (0 = unlimited)
+func (m *Manager) SetMaxSessions(max int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.maxSessions = max
+}
+
+// SetDrainTimeout sets how long cluster cleanup waits for in-flight requests on a session
+func (m *Manager) SetDrainTimeout(timeout time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.drainTimeout = timeout
+}
+
 // SetCleanupCallback sets a callback function that's called when a session is cleaned up
 func (m *Manager) SetCleanupCallback(callback func(string)) {
 	m.mu.Lock()
@@ -120,22 +197,106 @@ func (m *Manager) Shutdown() {
 }
 
 // Create creates a new session
-func (m *Manager) Create(sessionType SessionType) *Session {
+func (m *Manager) Create(sessionType SessionType) (*Session, error) {
+	return m.CreateForCluster(sessionType, "")
+}
+
+// CreateForCluster creates a new session tied to a cluster hash
+// Setting the hash up front lets the "created" event carry it
+// Returns ErrTooManySessions if the running-session limit is reached
+func (m *Manager) CreateForCluster(sessionType SessionType, clusterHash string) (*Session, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	// Only running sessions count; finished ones hold no process and are swept by cleanup
+	if m.maxSessions > 0 {
+		running := 0
+		for _, s := range m.sessions {
+			if s.Status == StatusRunning {
+				running++
+			}
+		}
+		if running >= m.maxSessions {
+			slog.Warn("Session limit reached", "type", sessionType, "running", running, "max", m.maxSessions)
+			return nil, fmt.Errorf("%w: limit of %d running sessions reached", ErrTooManySessions, m.maxSessions)
+		}
+	}
+
 	session := &Session{
 		ID:           uuid.New().String(),
 		Type:         sessionType,
 		Status:       StatusRunning,
 		StartedAt:    time.Now(),
+		ClusterHash:  clusterHash,
 		outputBuffer: &bytes.Buffer{},
+		stdoutBuffer: &bytes.Buffer{},
+		stderrBuffer: &bytes.Buffer{},
 		lastReadTime: time.Now(),
 	}
+	session.outputCond = sync.NewCond(&session.outputMutex)
 
 	m.sessions[session.ID] = session
 	slog.Info("Session created", "id", session.ID, "type", sessionType)
-	return session
+	m.publish(EventCreated, session, "")
+	return session, nil
+}
+
+// SetStatus updates a session's status and publishes a status-changed event
+// No event is published if the status is unchanged or the session was already removed
+// A failed session stays failed when its process is then reaped as stopped
+func (m *Manager) SetStatus(session *Session, status SessionStatus) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if session.Status == status || (session.Status == StatusFailed && status == StatusStopped) {
+		return
+	}
+	session.Status = status
+
+	if current, ok := m.sessions[session.ID]; ok && current == session {
+		m.publish(EventStatusChanged, session, "")
+	}
+}
+
+// StatusOf returns a session's status
+// Monitor goroutines change it through SetStatus, so it must not be read directly
+func (m *Manager) StatusOf(session *Session) SessionStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return session.Status
+}
+
+// SetLocalPort records the local port a port-forward session listens on
+func (m *Manager) SetLocalPort(session *Session, port string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session.LocalPort = port
+}
+
+// LocalPortOf returns the local port set by SetLocalPort
+func (m *Manager) LocalPortOf(session *Session) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return session.LocalPort
+}
+
+// Fail marks a running session failed with a reason for clients and subscribers
+// The caller kills its process; the session stays listed so the reason can be read
+// Returns false, changing nothing, if the session is no longer running
+func (m *Manager) Fail(session *Session, reason string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if session.Status != StatusRunning {
+		return false
+	}
+	session.Status = StatusFailed
+	session.failReason.Store(&reason)
+
+	if current, ok := m.sessions[session.ID]; ok && current == session {
+		m.publish(EventStatusChanged, session, reason)
+	}
+	return true
 }
 
 // Get retrieves a session by ID
@@ -185,6 +346,21 @@ func (m *Manager) List(sessionType SessionType) []*Session {
 	return result
 }
 
+// Counts returns the number of sessions by type and status
+func (m *Manager) Counts() map[SessionType]map[SessionStatus]int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	counts := make(map[SessionType]map[SessionStatus]int)
+	for _, session := range m.sessions {
+		if counts[session.Type] == nil {
+			counts[session.Type] = make(map[SessionStatus]int)
+		}
+		counts[session.Type][session.Status]++
+	}
+	return counts
+}
+
 // FindByClusterHash finds all sessions for a specific cluster hash
 func (m *Manager) FindByClusterHash(clusterHash string) []*Session {
 	m.mu.RLock()
@@ -201,128 +377,161 @@ func (m *Manager) FindByClusterHash(clusterHash string) []*Session {
 
 // CleanupByClusterHash stops and removes all sessions for a specific cluster hash
 // This is called when the app switches clusters
+// Sessions are unlisted first, then in-flight requests are given up to the drain timeout
+// to finish before processes are killed and temp kubeconfigs removed
 func (m *Manager) CleanupByClusterHash(clusterHash string) int {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	count := 0
+	var removed []*Session
 	for id, session := range m.sessions {
 		if session.ClusterHash == clusterHash {
-			// Kill process if running
-			if session.Cmd != nil && session.Cmd.Process != nil {
-				if err := session.Cmd.Process.Kill(); err != nil {
-					slog.Warn("Failed to kill process during cluster cleanup", "id", id, "error", err)
-				}
-			}
-
-			// Clean up temp files
-			m.cleanupSessionFiles(session)
-
-			// Remove from map
+			// Unlist first so the proxy router can't pick the session up while it drains
 			delete(m.sessions, id)
-			count++
-
-			slog.Info("Session cleaned up for cluster switch", "id", id, "clusterHash", clusterHash)
+			removed = append(removed, session)
+		}
+	}
+	deadline := time.Now().Add(m.drainTimeout)
+	onCleanup := m.onSessionCleanup
+	m.mu.Unlock()
+
+	// Wait outside the lock so other sessions stay usable meanwhile
+	for _, session := range removed {
+		if !session.drain(time.Until(deadline)) {
+			slog.Warn("Timed out waiting for in-flight requests before cluster cleanup",
+				"id", session.ID, "clusterHash", clusterHash)
 		}
 	}
 
-	if count > 0 {
-		slog.Info("Cluster cleanup completed", "clusterHash", clusterHash, "sessionsRemoved", count)
+	// Kill and release outside the lock, like Stop, so a cluster switch with many sessions
+	// doesn't stall other session calls
+	for _, session := range removed {
+		m.teardown(session, onCleanup)
+		m.publishRemoved(EventCleanedUp, session, "cluster cleanup")
+
+		slog.Info("Session cleaned up for cluster switch", "id", session.ID, "clusterHash", clusterHash)
 	}
 
-	return count
+	if len(removed) > 0 {
+		slog.Info("Cluster cleanup completed", "clusterHash", clusterHash, "sessionsRemoved", len(removed))
+	}
+
+	return len(removed)
 }
 
 // Stop stops a session and removes it
+// The session is unlisted under the lock; killing its process and deleting its files happen
+// after the lock is released, so a slow kill or disk doesn't block other session operations
 func (m *Manager) Stop(id string) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	return m.StopWithReason(id, "")
+}
 
+// StopWithReason stops a session like Stop, giving subscribers a reason in its stopped event
+func (m *Manager) StopWithReason(id, reason string) error {
+	m.mu.Lock()
 	session, ok := m.sessions[id]
 	if !ok {
+		m.mu.Unlock()
 		return nil // Already stopped
 	}
+	// Only the caller that unlists the session goes on to kill and release it
+	delete(m.sessions, id)
+	session.Status = StatusStopped
+	onCleanup := m.onSessionCleanup
+	m.mu.Unlock()
+
+	m.teardown(session, onCleanup)
 
+	slog.Info("Session stopped", "id", id)
+	m.publishRemoved(EventStopped, session, reason)
+	return nil
+}
+
+// teardown kills an unlisted session's process, removes its temp files and runs the cleanup callback
+// Must be called without m.mu held
+func (m *Manager) teardown(session *Session, onCleanup func(string)) {
 	if session.Cmd != nil && session.Cmd.Process != nil {
 		if err := session.Cmd.Process.Kill(); err != nil {
-			slog.Warn("Failed to kill process", "id", id, "error", err)
+			slog.Warn("Failed to kill process", "id", session.ID, "error", err)
 		}
 	}
 
-	session.Status = StatusStopped
-
-	// Clean up temporary files
+	// Clean up temporary files; Release is idempotent
 	m.cleanupSessionFiles(session)
 
-	// Call cleanup callback if set
-	if m.onSessionCleanup != nil {
-		m.onSessionCleanup(id)
+	if onCleanup != nil {
+		onCleanup(session.ID)
 	}
+}
 
-	delete(m.sessions, id)
-	slog.Info("Session stopped", "id", id)
-	return nil
+// publishRemoved publishes an event for a session that is no longer listed
+// The read lock keeps the event's status consistent with a concurrent SetStatus
+func (m *Manager) publishRemoved(kind EventKind, session *Session, reason string) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	m.publish(kind, session, reason)
 }
 
 // cleanupSessionFiles removes temporary files associated with a session
 func (m *Manager) cleanupSessionFiles(session *Session) {
-	for _, tmpFile := range session.TempFiles {
-		if err := os.Remove(tmpFile); err != nil && !os.IsNotExist(err) {
-			slog.Warn("Failed to remove temp file", "file", tmpFile, "error", err)
-		} else {
-			slog.Debug("Removed temp file", "file", tmpFile)
-		}
-	}
+	session.Release()
 }
 
 // StopAll stops all sessions
 func (m *Manager) StopAll() {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	for id, session := range m.sessions {
-		if session.Cmd != nil && session.Cmd.Process != nil {
-			if err := session.Cmd.Process.Kill(); err != nil {
-				slog.Warn("Failed to kill process", "id", id, "error", err)
-			}
-		}
+	sessions := m.sessions
+	m.sessions = make(map[string]*Session)
+	for _, session := range sessions {
 		session.Status = StatusStopped
+	}
+	onCleanup := m.onSessionCleanup
+	m.mu.Unlock()
 
-		// Clean up temporary files
-		m.cleanupSessionFiles(session)
-
-		// Call cleanup callback if set
-		if m.onSessionCleanup != nil {
-			m.onSessionCleanup(id)
-		}
+	for _, session := range sessions {
+		m.teardown(session, onCleanup)
+		m.publishRemoved(EventStopped, session, "shutdown")
 	}
 
-	m.sessions = make(map[string]*Session)
 	slog.Info("All sessions stopped")
 }
 
 // cleanupLoop runs in the background and removes inactive/completed sessions
 func (m *Manager) cleanupLoop() {
-	ticker := time.NewTicker(m.cleanupInterval)
-	defer ticker.Stop()
+	timer := time.NewTimer(m.nextCleanupDelay())
+	defer timer.Stop()
 
 	for {
 		select {
-		case <-ticker.C:
+		case <-timer.C:
 			m.cleanupInactiveSessions()
+			timer.Reset(m.nextCleanupDelay())
 		case <-m.stopCleanup:
 			return
 		}
 	}
 }
 
+// nextCleanupDelay returns the cleanup interval plus up to 10% random jitter, so helpers
+// started together don't all sweep (and delete temp files) at the same moment
+func (m *Manager) nextCleanupDelay() time.Duration {
+	interval := m.cleanupInterval
+	if jitter := int64(interval / 10); jitter > 0 {
+		return interval + time.Duration(rand.Int63n(jitter))
+	}
+	return interval
+}
+
 // cleanupInactiveSessions removes sessions that have been inactive or completed for too long
+// Sessions are unlisted under the lock; killing processes and deleting files happens after
+// it is released, so a large sweep doesn't stall other session operations
 func (m *Manager) cleanupInactiveSessions() {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	type removal struct {
+		session *Session
+		reason  string
+	}
 
+	m.mu.Lock()
 	now := time.Now()
-	var toRemove []string
+	var toRemove []removal
 
 	for id, session := range m.sessions {
 		var shouldRemove bool
@@ -343,7 +552,7 @@ func (m *Manager) cleanupInactiveSessions() {
 		}
 
 		if shouldRemove {
-			toRemove = append(toRemove, id)
+			toRemove = append(toRemove, removal{session: session, reason: reason})
 			slog.Info("Cleaning up session",
 				"id", id,
 				"type", session.Type,
@@ -353,34 +562,207 @@ func (m *Manager) cleanupInactiveSessions() {
 		}
 	}
 
-	// Remove sessions outside the iteration
-	for _, id := range toRemove {
-		session := m.sessions[id]
+	// Unlist first so no new request can pick up a session being torn down
+	for _, r := range toRemove {
+		delete(m.sessions, r.session.ID)
+	}
+	remaining := len(m.sessions)
+	onCleanup := m.onSessionCleanup
+	m.mu.Unlock()
 
-		// Kill the process if still running
-		if session.Cmd != nil && session.Cmd.Process != nil {
-			if err := session.Cmd.Process.Kill(); err != nil {
-				slog.Warn("Failed to kill process during cleanup", "id", id, "error", err)
-			}
-		}
+	for _, r := range toRemove {
+		m.teardown(r.session, onCleanup)
+		m.publishRemoved(EventCleanedUp, r.session, r.reason)
+	}
 
-		// Clean up temporary files
-		m.cleanupSessionFiles(session)
+	if len(toRemove) > 0 {
+		slog.Info("Cleanup completed", "removed", len(toRemove), "remaining", remaining)
+	}
+}
 
-		// Call cleanup callback if set
-		if m.onSessionCleanup != nil {
-			m.onSessionCleanup(id)
-		}
+// AddRelease registers a hook to run once when the session's resources are released
+// If the session has already been released, the hook runs immediately
+func (s *Session) AddRelease(fn func()) {
+	s.releaseMutex.Lock()
+	if s.released {
+		s.releaseMutex.Unlock()
+		fn()
+		return
+	}
+	s.releaseFuncs = append(s.releaseFuncs, fn)
+	s.releaseMutex.Unlock()
+}
 
-		delete(m.sessions, id)
+// AddTempFile registers a file to delete when the session is released
+// If the session was already released, the file is deleted immediately
+func (s *Session) AddTempFile(path string) {
+	s.releaseMutex.Lock()
+	if s.released {
+		s.releaseMutex.Unlock()
+		removeTempFile(path)
+		return
 	}
+	s.tempFiles = append(s.tempFiles, path)
+	s.releaseMutex.Unlock()
+}
 
-	if len(toRemove) > 0 {
-		slog.Info("Cleanup completed", "removed", len(toRemove), "remaining", len(m.sessions))
+// BeginUse marks the session as serving a request
+// Returns false once the session is draining for cleanup; otherwise the caller must call EndUse
+func (s *Session) BeginUse() bool {
+	s.useMutex.Lock()
+	defer s.useMutex.Unlock()
+	if s.draining {
+		return false
 	}
+	s.inFlight.Add(1)
+	s.uses++
+	return true
 }
 
+// EndUse marks a request started with BeginUse as finished
+func (s *Session) EndUse() {
+	s.useMutex.Lock()
+	s.uses--
+	s.useMutex.Unlock()
+	s.inFlight.Done()
+}
+
+// InUse reports whether the session is serving a request, e.g. a proxied watch
+func (s *Session) InUse() bool {
+	s.useMutex.Lock()
+	defer s.useMutex.Unlock()
+	return s.uses > 0
+}
 
+// RecordUpstreamStatus tracks consecutive 401/403 responses forwarded through a proxy session
+// Returns the current run length, which is 0 after any other status
+func (s *Session) RecordUpstreamStatus(code int) int {
+	if code == 401 || code == 403 {
+		return int(s.authFailures.Add(1))
+	}
+	s.authFailures.Store(0)
+	return 0
+}
+
+// RecordProxyRequest counts a request routed through a proxy session
+func (s *Session) RecordProxyRequest() {
+	s.proxyRequests.Add(1)
+	s.lastProxyRequest.Store(time.Now().UnixNano())
+}
+
+// ProxyRequests returns how many requests were routed through the session and when the
+// last one arrived; the time is zero if there were none
+func (s *Session) ProxyRequests() (int64, time.Time) {
+	n := s.proxyRequests.Load()
+	if n == 0 {
+		return 0, time.Time{}
+	}
+	return n, time.Unix(0, s.lastProxyRequest.Load())
+}
+
+// FailReason returns why the session was failed by Manager.Fail, or ""
+func (s *Session) FailReason() string {
+	if reason := s.failReason.Load(); reason != nil {
+		return *reason
+	}
+	return ""
+}
+
+// BytesProduced returns the total bytes written to the session's output so far
+// It only ever grows, so a runaway command (e.g. `yes`) shows up even if its output isn't kept
+func (s *Session) BytesProduced() int64 {
+	return s.bytesProduced.Load()
+}
+
+// AuthFailures returns the number of consecutive 401/403 upstream responses
+func (s *Session) AuthFailures() int {
+	return int(s.authFailures.Load())
+}
+
+// drain rejects new uses and waits up to timeout for in-flight ones to finish
+// Returns false if the timeout expired first
+func (s *Session) drain(timeout time.Duration) bool {
+	s.useMutex.Lock()
+	s.draining = true
+	s.useMutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.inFlight.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// SetKubeconfig stores a private copy of the session's kubeconfig content
+// The copy is zeroed on Release; the caller's string can't be scrubbed and is left to the GC
+func (s *Session) SetKubeconfig(content string) {
+	s.releaseMutex.Lock()
+	defer s.releaseMutex.Unlock()
+	if s.released || content == "" {
+		return
+	}
+	clear(s.kubeconfig)
+	s.kubeconfig = []byte(content)
+}
+
+// HasKubeconfig reports whether the session still holds kubeconfig content
+func (s *Session) HasKubeconfig() bool {
+	s.releaseMutex.Lock()
+	defer s.releaseMutex.Unlock()
+	return len(s.kubeconfig) > 0
+}
+
+// TempFiles returns a copy of the files to delete when the session is released
+func (s *Session) TempFiles() []string {
+	s.releaseMutex.Lock()
+	defer s.releaseMutex.Unlock()
+	return append([]string(nil), s.tempFiles...)
+}
+
+// Release removes the session's temp files and runs its release hooks
+// Safe to call from both the process monitor goroutine and the manager; only the first call does work
+func (s *Session) Release() {
+	s.releaseMutex.Lock()
+	if s.released {
+		s.releaseMutex.Unlock()
+		return
+	}
+	s.released = true
+	tempFiles := s.tempFiles
+	releaseFuncs := s.releaseFuncs
+	s.tempFiles = nil
+	s.releaseFuncs = nil
+
+	// Best-effort scrub of credentials so they don't linger in memory or core dumps
+	clear(s.kubeconfig)
+	s.kubeconfig = nil
+	s.releaseMutex.Unlock()
+
+	for _, tmpFile := range tempFiles {
+		removeTempFile(tmpFile)
+	}
+	for _, fn := range releaseFuncs {
+		fn()
+	}
+}
+
+// removeTempFile deletes a session temp file, ignoring files that are already gone
+func removeTempFile(path string) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		slog.Warn("Failed to remove temp file", "file", path, "error", err)
+	} else {
+		slog.Debug("Removed temp file", "file", path)
+	}
+}
 
 // ReadOutput reads output from an exec session and updates last read time
 func (s *Session) ReadOutput() string {
@@ -392,20 +774,32 @@ func (s *Session) ReadOutput() string {
 	return output
 }
 
+// MarkActive updates last read time for sessions whose output is consumed elsewhere (e.g. streamed watches)
+func (s *Session) MarkActive() {
+	s.outputMutex.Lock()
+	defer s.outputMutex.Unlock()
+	s.lastReadTime = time.Now()
+}
+
 // GetOutputBuffer returns the output buffer for writing
 func (s *Session) GetOutputBuffer() io.Writer {
-	return &threadSafeWriter{buffer: s.outputBuffer, mutex: &s.outputMutex}
+	return &threadSafeWriter{buffer: s.outputBuffer, mutex: &s.outputMutex, cond: s.outputCond, produced: &s.bytesProduced}
 }
 
 // threadSafeWriter wraps a buffer with a mutex for thread-safe writes
 type threadSafeWriter struct {
 	buffer *bytes.Buffer
 	mutex  *sync.RWMutex
+	cond   *sync.Cond // Wakes WaitOutput callers
+
+	produced *atomic.Int64 // The session's bytes-produced counter
 }
 
 func (w *threadSafeWriter) Write(p []byte) (n int, err error) {
 	w.mutex.Lock()
 	defer w.mutex.Unlock()
-	return w.buffer.Write(p)
+	w.produced.Add(int64(len(p)))
+	n, err = w.buffer.Write(p)
+	w.cond.Broadcast()
+	return n, err
 }
-
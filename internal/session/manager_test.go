@@ -0,0 +1,624 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func nextEvent(t *testing.T, events <-chan Event) Event {
+	t.Helper()
+	select {
+	case e := <-events:
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for event")
+		return Event{}
+	}
+}
+
+func TestManager_LifecycleEvents(t *testing.T) {
+	m := NewManager()
+	defer m.Shutdown()
+
+	events, cancel := m.Subscribe()
+	defer cancel()
+
+	s, _ := m.CreateForCluster(TypeProxy, "abc123")
+	e := nextEvent(t, events)
+	if e.Kind != EventCreated || e.SessionID != s.ID || e.SessionType != TypeProxy ||
+		e.ClusterHash != "abc123" || e.Status != StatusRunning {
+		t.Fatalf("unexpected created event: %+v", e)
+	}
+
+	m.SetStatus(s, StatusRunning) // unchanged, no event
+	m.SetStatus(s, StatusFailed)
+	e = nextEvent(t, events)
+	if e.Kind != EventStatusChanged || e.Status != StatusFailed {
+		t.Fatalf("unexpected status event: %+v", e)
+	}
+
+	if err := m.Stop(s.ID); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	e = nextEvent(t, events)
+	if e.Kind != EventStopped || e.SessionID != s.ID || e.Status != StatusStopped {
+		t.Fatalf("unexpected stopped event: %+v", e)
+	}
+
+	// Status changes on removed sessions are not published
+	m.SetStatus(s, StatusFailed)
+	select {
+	case e := <-events:
+		t.Fatalf("unexpected event after stop: %+v", e)
+	default:
+	}
+}
+
+func TestManager_Fail(t *testing.T) {
+	m := NewManager()
+	defer m.Shutdown()
+	events, cancel := m.Subscribe()
+	defer cancel()
+
+	s, _ := m.Create(TypeExec)
+	nextEvent(t, events) // created
+
+	if !m.Fail(s, "stuck") {
+		t.Fatal("Fail on a running session returned false")
+	}
+	if e := nextEvent(t, events); e.Kind != EventStatusChanged || e.Status != StatusFailed || e.Reason != "stuck" {
+		t.Fatalf("unexpected failed event: %+v", e)
+	}
+	if s.FailReason() != "stuck" {
+		t.Errorf("FailReason = %q", s.FailReason())
+	}
+
+	// Reaping the killed process keeps it failed, and a second Fail changes nothing
+	m.SetStatus(s, StatusStopped)
+	if m.Fail(s, "again") || s.Status != StatusFailed || s.FailReason() != "stuck" {
+		t.Errorf("status %s, reason %q after reaping", s.Status, s.FailReason())
+	}
+	select {
+	case e := <-events:
+		t.Fatalf("unexpected event: %+v", e)
+	default:
+	}
+}
+
+func TestManager_StatusAndLocalPortAccessors(t *testing.T) {
+	m := NewManager()
+	defer m.Shutdown()
+
+	s, _ := m.Create(TypePortForward)
+	m.SetLocalPort(s, "8080")
+
+	// A monitor goroutine updating the session while handlers read it (run with -race)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.SetLocalPort(s, "43210")
+		m.SetStatus(s, StatusStopped)
+	}()
+	for i := 0; i < 100; i++ {
+		m.StatusOf(s)
+		m.LocalPortOf(s)
+	}
+	<-done
+
+	if got := m.StatusOf(s); got != StatusStopped {
+		t.Errorf("StatusOf = %s, want %s", got, StatusStopped)
+	}
+	if got := m.LocalPortOf(s); got != "43210" {
+		t.Errorf("LocalPortOf = %q, want 43210", got)
+	}
+	if infos := m.DebugSnapshot(); len(infos) != 1 || infos[0].LocalPort != "43210" {
+		t.Errorf("DebugSnapshot = %+v, want local port 43210", infos)
+	}
+}
+
+func TestManager_CleanupByClusterHashEvents(t *testing.T) {
+	m := NewManager()
+	defer m.Shutdown()
+
+	m.CreateForCluster(TypeExec, "keep")
+	m.CreateForCluster(TypeExec, "drop")
+
+	events, cancel := m.Subscribe()
+	defer cancel()
+
+	if n := m.CleanupByClusterHash("drop"); n != 1 {
+		t.Fatalf("expected 1 session removed, got %d", n)
+	}
+	e := nextEvent(t, events)
+	if e.Kind != EventCleanedUp || e.ClusterHash != "drop" {
+		t.Fatalf("unexpected cleanup event: %+v", e)
+	}
+}
+
+func TestManager_SubscribeCancel(t *testing.T) {
+	m := NewManager()
+	defer m.Shutdown()
+
+	events, cancel := m.Subscribe()
+	cancel()
+	cancel() // idempotent
+
+	if _, ok := <-events; ok {
+		t.Fatal("expected channel to be closed after cancel")
+	}
+
+	// Publishing with no subscribers must not block or panic
+	m.Create(TypeShell)
+}
+
+func TestManager_MaxSessions(t *testing.T) {
+	m := NewManager()
+	defer m.Shutdown()
+	m.SetMaxSessions(3)
+
+	var created []*Session
+	for i := 0; i < 3; i++ {
+		s, err := m.Create(TypeExec)
+		if err != nil {
+			t.Fatalf("create %d: unexpected error %v", i, err)
+		}
+		created = append(created, s)
+	}
+
+	events, cancel := m.Subscribe()
+	defer cancel()
+
+	s, err := m.Create(TypeProxy)
+	if !errors.Is(err, ErrTooManySessions) || s != nil {
+		t.Fatalf("expected ErrTooManySessions and nil session, got %v, %v", s, err)
+	}
+	if n := len(m.List(TypeProxy)); n != 0 {
+		t.Errorf("rejected create leaked %d sessions", n)
+	}
+	select {
+	case e := <-events:
+		t.Errorf("rejected create published an event: %+v", e)
+	default:
+	}
+
+	// Finished sessions don't count toward the limit
+	m.SetStatus(created[0], StatusStopped)
+	if _, err := m.Create(TypeProxy); err != nil {
+		t.Errorf("expected room after a session stopped, got %v", err)
+	}
+}
+
+func TestSession_ConcurrentStopAndMonitorRelease(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		m := NewManager()
+		s, _ := m.Create(TypeExec)
+
+		var files []string
+		for j := 0; j < 3; j++ {
+			f, err := os.CreateTemp(t.TempDir(), "kubeconfig-*")
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+			files = append(files, f.Name())
+			s.AddTempFile(f.Name())
+		}
+
+		var releases int32
+		s.AddRelease(func() { atomic.AddInt32(&releases, 1) })
+
+		// The monitor goroutine releases when the process exits while the app calls Stop
+		var wg sync.WaitGroup
+		for j := 0; j < 4; j++ {
+			wg.Add(2)
+			go func() { defer wg.Done(); s.Release() }()
+			go func() { defer wg.Done(); m.Stop(s.ID) }()
+		}
+		wg.Wait()
+		m.Shutdown()
+
+		if n := atomic.LoadInt32(&releases); n != 1 {
+			t.Fatalf("expected release hook to run once, ran %d times", n)
+		}
+		for _, f := range files {
+			if _, err := os.Stat(f); !os.IsNotExist(err) {
+				t.Fatalf("expected temp file %s to be removed", f)
+			}
+		}
+		if len(s.TempFiles()) != 0 {
+			t.Fatalf("expected no tracked temp files after release")
+		}
+
+		// Late registrations are cleaned up immediately rather than leaked
+		late, _ := os.CreateTemp(t.TempDir(), "kubeconfig-*")
+		late.Close()
+		s.AddTempFile(late.Name())
+		if _, err := os.Stat(late.Name()); !os.IsNotExist(err) {
+			t.Fatalf("expected late temp file to be removed immediately")
+		}
+	}
+}
+
+func TestSession_ReleaseScrubsKubeconfig(t *testing.T) {
+	m := NewManager()
+	defer m.Shutdown()
+
+	s, _ := m.Create(TypeProxy)
+	s.SetKubeconfig("users:\n- user:\n    token: secret")
+	stored := s.kubeconfig
+
+	if err := m.Stop(s.ID); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if s.HasKubeconfig() {
+		t.Error("expected kubeconfig to be dropped on release")
+	}
+	for i, b := range stored {
+		if b != 0 {
+			t.Fatalf("expected stored kubeconfig to be zeroed, byte %d = %q", i, b)
+		}
+	}
+
+	// Setting after release must not retain credentials
+	s.SetKubeconfig("token: late")
+	if s.HasKubeconfig() {
+		t.Error("expected kubeconfig set after release to be discarded")
+	}
+}
+
+func TestManager_CleanupDrainTimeout(t *testing.T) {
+	m := NewManager()
+	defer m.Shutdown()
+	m.SetDrainTimeout(50 * time.Millisecond)
+
+	s, _ := m.CreateForCluster(TypeProxy, "stuck")
+	if !s.BeginUse() {
+		t.Fatal("expected BeginUse to succeed on a live session")
+	}
+	defer s.EndUse()
+
+	// A request that never finishes must not block cleanup forever
+	start := time.Now()
+	if n := m.CleanupByClusterHash("stuck"); n != 1 {
+		t.Fatalf("expected 1 session removed, got %d", n)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("cleanup took %s, expected it to give up after the drain timeout", elapsed)
+	}
+	if s.BeginUse() {
+		t.Error("expected BeginUse to fail after cleanup")
+	}
+}
+
+func TestManager_CleanupDoesNotBlockLookups(t *testing.T) {
+	m := NewManager()
+	defer m.Shutdown()
+	m.SetInactivityTimeout(0)
+
+	// Each release is slow, as deleting files on a busy disk can be
+	const sessions = 50
+	var released atomic.Int32
+	for i := 0; i < sessions; i++ {
+		s, _ := m.Create(TypeExec)
+		s.AddRelease(func() {
+			time.Sleep(10 * time.Millisecond)
+			released.Add(1)
+		})
+	}
+
+	done := make(chan struct{})
+	go func() {
+		m.cleanupInactiveSessions()
+		close(done)
+	}()
+
+	// Wait until the sweep is releasing, then make sure the lock is free
+	deadline := time.Now().Add(2 * time.Second)
+	for released.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	start := time.Now()
+	m.List(TypeExec)
+	m.Create(TypeShell)
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("lookups took %s during cleanup, expected them not to wait for releases", elapsed)
+	}
+
+	<-done
+	if n := released.Load(); n != sessions {
+		t.Errorf("released %d sessions, want %d", n, sessions)
+	}
+	if left := m.List(TypeExec); len(left) != 0 {
+		t.Errorf("expected inactive sessions to be removed, %d left", len(left))
+	}
+}
+
+func TestManager_ClusterCleanupDoesNotBlockLookups(t *testing.T) {
+	m := NewManager()
+	defer m.Shutdown()
+
+	const sessions = 50
+	var released atomic.Int32
+	for i := 0; i < sessions; i++ {
+		s, _ := m.CreateForCluster(TypeExec, "abc123")
+		s.AddRelease(func() {
+			time.Sleep(10 * time.Millisecond)
+			released.Add(1)
+		})
+	}
+	var cleanedUp atomic.Int32
+	m.SetCleanupCallback(func(string) { cleanedUp.Add(1) })
+
+	done := make(chan int)
+	go func() { done <- m.CleanupByClusterHash("abc123") }()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for released.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	start := time.Now()
+	m.List(TypeExec)
+	m.Create(TypeShell)
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("lookups took %s during cluster cleanup, expected them not to wait for releases", elapsed)
+	}
+
+	if n := <-done; n != sessions {
+		t.Errorf("CleanupByClusterHash = %d, want %d", n, sessions)
+	}
+	if n := released.Load(); n != sessions {
+		t.Errorf("released %d sessions, want %d", n, sessions)
+	}
+	if n := cleanedUp.Load(); n != sessions {
+		t.Errorf("cleanup callback ran %d times, want %d", n, sessions)
+	}
+}
+
+func TestManager_ConcurrentStopAndLookups(t *testing.T) {
+	m := NewManager()
+	defer m.Shutdown()
+
+	const sessions = 50
+	var releases atomic.Int32
+	ids := make([]string, 0, sessions)
+	for i := 0; i < sessions; i++ {
+		s, _ := m.Create(TypeExec)
+		s.AddRelease(func() {
+			time.Sleep(time.Millisecond)
+			releases.Add(1)
+		})
+		ids = append(ids, s.ID)
+	}
+
+	stop := make(chan struct{})
+	var readers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				for _, s := range m.List(TypeExec) {
+					m.Get(s.ID)
+				}
+				m.Counts()
+			}
+		}()
+	}
+
+	// Two callers per session: only one of them may tear it down
+	var stoppers sync.WaitGroup
+	for _, id := range ids {
+		for j := 0; j < 2; j++ {
+			stoppers.Add(1)
+			go func(id string) {
+				defer stoppers.Done()
+				m.Stop(id)
+			}(id)
+		}
+	}
+	stoppers.Wait()
+	close(stop)
+	readers.Wait()
+
+	if n := releases.Load(); n != sessions {
+		t.Errorf("release hooks ran %d times, want %d", n, sessions)
+	}
+	if left := m.List(TypeExec); len(left) != 0 {
+		t.Errorf("expected all sessions stopped, %d left", len(left))
+	}
+}
+
+func BenchmarkManager_GetDuringCleanup(b *testing.B) {
+	m := NewManager()
+	defer m.Shutdown()
+	m.SetInactivityTimeout(0)
+
+	s, _ := m.Create(TypeShell)
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			for i := 0; i < 100; i++ {
+				sess, _ := m.Create(TypeExec)
+				sess.AddRelease(func() { time.Sleep(100 * time.Microsecond) })
+			}
+			m.cleanupInactiveSessions()
+		}
+	}()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Get(s.ID)
+	}
+}
+
+func TestSession_StructuredOutputFraming(t *testing.T) {
+	m := NewManager()
+	defer m.Shutdown()
+
+	s, _ := m.Create(TypeShell)
+	s.EnableStructuredOutput()
+	stdout := s.StreamWriter(StreamStdout)
+	stderr := s.StreamWriter(StreamStderr)
+
+	stdout.Write([]byte("hel"))
+	stderr.Write([]byte("oops\r\n"))
+	stdout.Write([]byte("lo\nworld\n\ntail"))
+
+	lines := s.ReadLines()
+	want := []OutputLine{
+		{Stream: StreamStderr, Line: "oops"},
+		{Stream: StreamStdout, Line: "hello"},
+		{Stream: StreamStdout, Line: "world"},
+		{Stream: StreamStdout, Line: ""},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("got %d lines, want %d: %+v", len(lines), len(want), lines)
+	}
+	for i, l := range lines {
+		if l.Stream != want[i].Stream || l.Line != want[i].Line || l.Timestamp.IsZero() {
+			t.Errorf("line %d = %+v, want %+v", i, l, want[i])
+		}
+	}
+
+	// The unterminated trailing line is recorded once the process exits
+	s.FlushOutput()
+	lines = s.ReadLines()
+	if last := lines[len(lines)-1]; last.Stream != StreamStdout || last.Line != "tail" {
+		t.Errorf("last line = %+v, want stdout \"tail\"", last)
+	}
+	if s.ReadOutput() != "" {
+		t.Error("expected raw output buffer to stay empty in structured mode")
+	}
+}
+
+func TestSession_SeparateStreams(t *testing.T) {
+	m := NewManager()
+	defer m.Shutdown()
+
+	s, _ := m.Create(TypeShell)
+	stdout := s.StreamWriter(StreamStdout)
+	stderr := s.StreamWriter(StreamStderr)
+
+	stdout.Write([]byte(`{"items":`))
+	stderr.Write([]byte("warning: deprecated\n"))
+	stdout.Write([]byte("[]}\n"))
+
+	out, errOut := s.ReadStreams()
+	if out != "{\"items\":[]}\n" {
+		t.Errorf("stdout = %q", out)
+	}
+	if errOut != "warning: deprecated\n" {
+		t.Errorf("stderr = %q", errOut)
+	}
+	if combined := s.ReadOutput(); combined != "{\"items\":warning: deprecated\n[]}\n" {
+		t.Errorf("combined = %q, want writes interleaved in arrival order", combined)
+	}
+	if o, e := s.StreamSizes(); o != len(out) || e != len(errOut) {
+		t.Errorf("StreamSizes = %d, %d", o, e)
+	}
+}
+
+func TestSession_BytesProduced(t *testing.T) {
+	m := NewManager()
+	defer m.Shutdown()
+
+	raw, _ := m.Create(TypeExec)
+	raw.GetOutputBuffer().Write([]byte("hello\n"))
+	raw.StreamWriter(StreamStderr).Write([]byte("oops\n"))
+	if got := raw.BytesProduced(); got != 11 {
+		t.Errorf("raw BytesProduced = %d, want 11", got)
+	}
+
+	// Structured sessions keep lines, not bytes: newlines, carriage returns and the
+	// unterminated tail aren't in the buffered output, but still count
+	structured, _ := m.Create(TypeShell)
+	structured.EnableStructuredOutput()
+	stdout := structured.StreamWriter(StreamStdout)
+	var written int64
+	for i := 0; i < 1000; i++ {
+		n, _ := stdout.Write([]byte("y\r\n"))
+		written += int64(n)
+	}
+	n, _ := stdout.Write([]byte("partial"))
+	written += int64(n)
+	if got := structured.BytesProduced(); got != written || got != 3007 {
+		t.Errorf("structured BytesProduced = %d, want %d", got, written)
+	}
+	if got := structured.OutputLen(); got != 1000 {
+		t.Errorf("OutputLen = %d, want 1000 lines", got)
+	}
+
+	// Reading the output doesn't reset the counter
+	structured.ReadLines()
+	structured.FlushOutput()
+	if got := structured.BytesProduced(); got != written {
+		t.Errorf("BytesProduced after read = %d, want %d", got, written)
+	}
+}
+
+func TestSession_WaitOutput(t *testing.T) {
+	m := NewManager()
+	defer m.Shutdown()
+
+	s, _ := m.Create(TypeExec)
+	out := s.GetOutputBuffer()
+
+	// Returns immediately when unread output is already past the offset
+	out.Write([]byte("abc"))
+	start := time.Now()
+	s.WaitOutput(context.Background(), 1, time.Second)
+	if time.Since(start) > 100*time.Millisecond {
+		t.Error("expected immediate return with unread output")
+	}
+
+	// Times out when nothing new arrives
+	start = time.Now()
+	s.WaitOutput(context.Background(), 3, 50*time.Millisecond)
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("returned after %s, before the wait elapsed", elapsed)
+	}
+
+	// Wakes on new output
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		out.Write([]byte("d"))
+	}()
+	start = time.Now()
+	s.WaitOutput(context.Background(), 3, 5*time.Second)
+	if time.Since(start) > time.Second || s.OutputLen() != 4 {
+		t.Errorf("expected wake on new output, len = %d", s.OutputLen())
+	}
+
+	// Wakes on context cancellation
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start = time.Now()
+	s.WaitOutput(ctx, 4, 5*time.Second)
+	if time.Since(start) > time.Second {
+		t.Error("expected wake on context cancellation")
+	}
+
+	// Never blocks once the output is closed
+	s.CloseOutput()
+	start = time.Now()
+	s.WaitOutput(context.Background(), 4, 5*time.Second)
+	if time.Since(start) > 100*time.Millisecond {
+		t.Error("expected immediate return after CloseOutput")
+	}
+}
@@ -0,0 +1,219 @@
+package session
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"time"
+)
+
+// Output stream names used in structured output records
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+// OutputLine is one line of structured session output
+type OutputLine struct {
+	Timestamp time.Time `json:"timestamp"`
+	Stream    string    `json:"stream"` // "stdout" or "stderr"
+	Line      string    `json:"line"`   // Line content without the trailing newline
+}
+
+// EnableStructuredOutput switches the session to line records instead of a raw buffer
+// Must be called before any output is written
+func (s *Session) EnableStructuredOutput() {
+	s.outputMutex.Lock()
+	defer s.outputMutex.Unlock()
+	s.structured = true
+	s.partialLines = make(map[string]*bytes.Buffer)
+}
+
+// IsStructured reports whether the session records structured output
+func (s *Session) IsStructured() bool {
+	s.outputMutex.RLock()
+	defer s.outputMutex.RUnlock()
+	return s.structured
+}
+
+// StreamWriter returns a writer for one output stream
+// In raw mode writes go to both the combined buffer and the stream's own buffer;
+// in structured mode they are framed into line records
+func (s *Session) StreamWriter(stream string) io.Writer {
+	if !s.IsStructured() {
+		return &streamWriter{session: s, stream: stream}
+	}
+	return &lineWriter{session: s, stream: stream}
+}
+
+// ReadStreams returns stdout and stderr separately and updates last read time
+// Only populated for output written through StreamWriter in raw mode
+func (s *Session) ReadStreams() (stdout, stderr string) {
+	s.outputMutex.Lock()
+	defer s.outputMutex.Unlock()
+
+	s.lastReadTime = time.Now() // Update activity timestamp
+	return s.stdoutBuffer.String(), s.stderrBuffer.String()
+}
+
+// StreamSizes returns the number of bytes captured on stdout and stderr
+func (s *Session) StreamSizes() (stdout, stderr int) {
+	s.outputMutex.RLock()
+	defer s.outputMutex.RUnlock()
+	return s.stdoutBuffer.Len(), s.stderrBuffer.Len()
+}
+
+// ReadLines returns a copy of the structured output records and updates last read time
+func (s *Session) ReadLines() []OutputLine {
+	s.outputMutex.Lock()
+	defer s.outputMutex.Unlock()
+
+	lines := make([]OutputLine, len(s.outputLines))
+	copy(lines, s.outputLines)
+	s.lastReadTime = time.Now() // Update activity timestamp
+	return lines
+}
+
+// FlushOutput records any unterminated trailing lines; call once the process has exited
+func (s *Session) FlushOutput() {
+	s.outputMutex.Lock()
+	defer s.outputMutex.Unlock()
+
+	// Flush in a fixed order so the result is deterministic
+	for _, stream := range []string{StreamStdout, StreamStderr} {
+		if buf := s.partialLines[stream]; buf != nil && buf.Len() > 0 {
+			s.appendLineLocked(stream, buf.String())
+			buf.Reset()
+		}
+	}
+}
+
+// CloseOutput marks the session output as complete and wakes any WaitOutput callers
+// Call once the process has exited and its exit code and status are recorded
+func (s *Session) CloseOutput() {
+	s.outputMutex.Lock()
+	defer s.outputMutex.Unlock()
+	s.outputDone = true
+	s.outputCond.Broadcast()
+}
+
+// OutputLen returns the current output length: bytes of combined output, or line records in structured mode
+func (s *Session) OutputLen() int {
+	s.outputMutex.RLock()
+	defer s.outputMutex.RUnlock()
+	return s.outputLenLocked()
+}
+
+// WaitOutput blocks until output grows past offset, the output is closed,
+// the timeout elapses, or ctx is cancelled, whichever comes first
+func (s *Session) WaitOutput(ctx context.Context, offset int, timeout time.Duration) {
+	s.outputMutex.Lock()
+	defer s.outputMutex.Unlock()
+
+	if s.outputDone || s.outputLenLocked() > offset || timeout <= 0 {
+		return
+	}
+
+	// sync.Cond has no deadline, so the timer and ctx wake this waiter explicitly
+	woken := false
+	wake := func() {
+		s.outputMutex.Lock()
+		woken = true
+		s.outputCond.Broadcast()
+		s.outputMutex.Unlock()
+	}
+	timer := time.AfterFunc(timeout, wake)
+	defer timer.Stop()
+	stopCtx := context.AfterFunc(ctx, wake)
+	defer stopCtx()
+
+	for !woken && !s.outputDone && s.outputLenLocked() <= offset {
+		s.outputCond.Wait()
+	}
+}
+
+// ReadOutputFrom returns the raw output past offset and whether the output is closed,
+// and updates last read time. Once done is true, nothing more will be written
+func (s *Session) ReadOutputFrom(offset int) (output []byte, done bool) {
+	s.outputMutex.Lock()
+	defer s.outputMutex.Unlock()
+
+	s.lastReadTime = time.Now() // Update activity timestamp
+	if offset < s.outputBuffer.Len() {
+		output = append([]byte(nil), s.outputBuffer.Bytes()[offset:]...)
+	}
+	return output, s.outputDone
+}
+
+// outputLenLocked returns the output length; caller must hold outputMutex
+func (s *Session) outputLenLocked() int {
+	if s.structured {
+		return len(s.outputLines)
+	}
+	return s.outputBuffer.Len()
+}
+
+// appendLineLocked stores one record; caller must hold outputMutex
+func (s *Session) appendLineLocked(stream, line string) {
+	s.outputLines = append(s.outputLines, OutputLine{
+		Timestamp: time.Now(),
+		Stream:    stream,
+		Line:      line,
+	})
+	s.outputCond.Broadcast()
+}
+
+// streamWriter writes one stream to its own buffer and to the combined buffer
+type streamWriter struct {
+	session *Session
+	stream  string
+}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	s := w.session
+	s.outputMutex.Lock()
+	defer s.outputMutex.Unlock()
+	s.bytesProduced.Add(int64(len(p)))
+
+	if w.stream == StreamStderr {
+		s.stderrBuffer.Write(p)
+	} else {
+		s.stdoutBuffer.Write(p)
+	}
+	n, err := s.outputBuffer.Write(p)
+	s.outputCond.Broadcast()
+	return n, err
+}
+
+// lineWriter splits writes on newlines, buffering a partial line until it is completed
+type lineWriter struct {
+	session *Session
+	stream  string
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	s := w.session
+	s.outputMutex.Lock()
+	defer s.outputMutex.Unlock()
+	s.bytesProduced.Add(int64(len(p)))
+
+	buf := s.partialLines[w.stream]
+	if buf == nil {
+		buf = &bytes.Buffer{}
+		s.partialLines[w.stream] = buf
+	}
+
+	rest := p
+	for {
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			buf.Write(rest)
+			break
+		}
+		buf.Write(rest[:i])
+		s.appendLineLocked(w.stream, string(bytes.TrimSuffix(buf.Bytes(), []byte("\r"))))
+		buf.Reset()
+		rest = rest[i+1:]
+	}
+	return len(p), nil
+}
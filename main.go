@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -12,6 +13,11 @@ import (
 	"time"
 
 	"github.com/kubedeskpro/kubedesk-helper/internal/api"
+	"github.com/kubedeskpro/kubedesk-helper/internal/childproc"
+	"github.com/kubedeskpro/kubedesk-helper/internal/cluster"
+	"github.com/kubedeskpro/kubedesk-helper/internal/config"
+	"github.com/kubedeskpro/kubedesk-helper/internal/env"
+	"github.com/kubedeskpro/kubedesk-helper/internal/kubeconfig"
 	"github.com/kubedeskpro/kubedesk-helper/internal/logging"
 	"github.com/kubedeskpro/kubedesk-helper/internal/session"
 )
@@ -21,71 +27,211 @@ var version = "dev"
 
 const (
 	port = 47823
+
+	// registryEvictionInterval is how often expired cluster registry entries are removed
+	registryEvictionInterval = time.Minute
+
+	// readHeaderTimeout bounds how long a client may take to send request headers
+	readHeaderTimeout = 15 * time.Second
+
+	// logFlushShare reserves 1/logFlushShare of HELPER_SHUTDOWN_TIMEOUT for the final log flush
+	logFlushShare = 5
 )
 
 func main() {
-	// Setup async structured logging for zero-overhead logging
-	logLevel := slog.LevelInfo
-	if os.Getenv("LOG_LEVEL") == "debug" {
-		logLevel = slog.LevelDebug
-	} else if os.Getenv("LOG_LEVEL") == "warn" {
-		logLevel = slog.LevelWarn
+	// The helper binary doubles as the watchdog that kills its children if it dies (macOS)
+	if childproc.RunWatchdog() {
+		return
 	}
 
+	// Setup async structured logging for zero-overhead logging
+	// The level is a LevelVar so SIGHUP can change it; a logLevel from the HELPER_CONFIG file
+	// applies once the config is loaded
+	logLevel := new(slog.LevelVar)
+	logLevel.Set(config.ParseLogLevel(os.Getenv("LOG_LEVEL")))
+
 	// Create async logger with 10000 entry queue
 	logger := logging.NewAsyncLogger(os.Stdout, logLevel, 10000)
 	slog.SetDefault(logger)
 
-	slog.Info("Starting KubeDesk Helper", "version", version, "port", port, "logLevel", logLevel.String())
+	slog.Info("Starting KubeDesk Helper", "version", version, "port", port, "logLevel", logLevel.Level().String())
+
+	// Load and validate environment overrides before starting anything
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	logLevel.Set(cfg.LogLevel)
+	if cfg.File != "" {
+		slog.Info("Loaded config file", "path", cfg.File)
+	}
+	slog.Info("Proxy port range", "min", cfg.ProxyPortMin, "max", cfg.ProxyPortMax)
+	slog.Info("HTTP timeouts", "read", cfg.HTTPReadTimeout, "write", cfg.HTTPWriteTimeout, "idle", cfg.HTTPIdleTimeout)
+
+	// Keep temp kubeconfigs in a private 0700 directory instead of the shared temp dir
+	if dir, err := kubeconfig.GetTempManager().UsePrivateDir(); err != nil {
+		slog.Error("Failed to create private temp dir, falling back to system temp dir", "error", err)
+	} else {
+		slog.Info("Using private temp dir for kubeconfigs", "dir", dir)
+	}
+
+	// A full or read-only temp dir would otherwise only show up as failing requests
+	if err := kubeconfig.GetTempManager().Probe(); err != nil {
+		slog.Error("Temp dir for kubeconfigs is not writable; requests with kubeconfig content will fail",
+			"dir", kubeconfig.GetTempManager().Dir(), "error", err)
+	} else if free, err := kubeconfig.GetTempManager().FreeSpace(); err == nil {
+		slog.Info("Temp dir for kubeconfigs is writable", "dir", kubeconfig.GetTempManager().Dir(), "freeBytes", free)
+	}
+
+	// Make sure kubectl children don't outlive the helper if it is killed or crashes
+	if err := childproc.StartWatchdog(); err != nil {
+		slog.Warn("Failed to start child process watchdog; children will outlive a crash", "error", err)
+	}
+
+	// Stop kubectl proxies a previous run left holding ports in the proxy range when it crashed
+	if stopped, err := api.StopOrphanedProxies(cfg.ProxyPIDFile); err != nil {
+		slog.Warn("Failed to stop orphaned kubectl proxies", "error", err)
+	} else if stopped > 0 {
+		slog.Info("Stopped orphaned kubectl proxies", "stopped", stopped)
+	}
+
+	// Extra PATH dirs (e.g. for kubectl plugins) and whether to load the login shell's env at
+	// all; must be set before the shell env is first loaded
+	env.SetExtraPath(cfg.ExtraPath)
+	env.SetSkipShellEnv(cfg.SkipShellEnv)
 
 	// Create session manager
 	sessionMgr := session.NewManager()
 
+	// Settings SIGHUP can change: session and output limits, how many kubeconfigs the cluster
+	// registry keeps in memory and for how long, and the /exec-auth env allow-list
+	api.ApplyConfig(cfg, sessionMgr)
+	cluster.GetRegistry().StartEviction(registryEvictionInterval)
+
 	// Create HTTP server
-	router := api.NewRouter(version, sessionMgr)
+	router := api.NewRouter(version, sessionMgr, cfg)
+
+	// Require a bearer token on the API; the app reads it from the token file
+	if cfg.AuthTokenFile != "" {
+		auth, err := api.NewTokenAuth(cfg.AuthTokenFile)
+		if err != nil {
+			log.Fatalf("Failed to set up token auth: %v", err)
+		}
+		auth.Register(router)
+		slog.Info("Token auth enabled", "tokenFile", cfg.AuthTokenFile)
+	}
+
 	server := &http.Server{
 		Addr:         fmt.Sprintf(":%d", port),
 		Handler:      router,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
+		ReadTimeout:  cfg.HTTPReadTimeout,
+		WriteTimeout: cfg.HTTPWriteTimeout,
+		IdleTimeout:  cfg.HTTPIdleTimeout,
+
+		// Request bodies (large manifests) get HTTP_READ_TIMEOUT, but headers must arrive promptly
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+
+	// Bind before touching anything shared, so a second helper launched by mistake fails here
+	// instead of sweeping the running helper's files
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		log.Fatalf("Server failed to start: %v", err)
+	}
+
+	// Remove private temp dirs leaked by previous runs that crashed before cleaning up
+	if removed, err := kubeconfig.GetTempManager().SweepStale(os.TempDir(), kubeconfig.StaleTempAge); err != nil {
+		slog.Warn("Failed to sweep stale temp kubeconfigs", "error", err)
+	} else if removed > 0 {
+		slog.Info("Swept stale temp kubeconfigs", "removed", removed)
 	}
 
 	// Start server in goroutine
 	go func() {
 		slog.Info("Server listening", "addr", server.Addr)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Server failed to start: %v", err)
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Server failed: %v", err)
 		}
 	}()
 
-	// Wait for interrupt signal
+	// Wait for interrupt signal; SIGHUP reloads the configuration instead
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for waiting := true; waiting; {
+		select {
+		case <-quit:
+			waiting = false
+		case <-hup:
+			cfg = reloadConfig(cfg, sessionMgr, logLevel)
+		}
+	}
+	signal.Stop(hup)
 
 	slog.Info("Shutting down server...")
 
-	// Graceful shutdown
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	shutdown(server, sessionMgr, cfg.ShutdownTimeout)
+}
+
+// shutdown stops the helper within timeout. Open streams are ended and in-flight requests drain first, while their sessions
+// and temp kubeconfigs still exist; then sessions are stopped, temp kubeconfigs removed and,
+// last, queued logs flushed. The flush gets its own share of timeout so a slow drain can't use it up
+func shutdown(server *http.Server, sessionMgr *session.Manager, timeout time.Duration) {
+	flushTimeout := timeout / logFlushShare
+	ctx, cancel := context.WithTimeout(context.Background(), timeout-flushTimeout)
 	defer cancel()
 
-	// Stop cleanup goroutine
+	// End open streams (/events, /watch, proxied watches) so they don't hold the drain
+	api.CloseStreams()
+
+	// Shutdown HTTP server; requests still running when the drain times out are cut off
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Error("Server forced to shutdown", "error", err)
+		server.Close()
+	}
+
+	// Stop cleanup goroutines
 	sessionMgr.Shutdown()
+	cluster.GetRegistry().StopEviction()
 
 	// Stop all sessions
 	sessionMgr.StopAll()
 
-	// Shutdown HTTP server
-	if err := server.Shutdown(ctx); err != nil {
-		slog.Error("Server forced to shutdown", "error", err)
-	}
+	// Remove any temp kubeconfigs still on disk along with the private temp dir
+	kubeconfig.GetTempManager().Close()
 
 	slog.Info("Server stopped")
 
-	// Flush async logs before exit
+	// Flush queued logs; anything logged after this is written synchronously
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancelFlush()
 	if asyncLogger, ok := slog.Default().Handler().(*logging.AsyncHandler); ok {
-		asyncLogger.Close()
+		if err := asyncLogger.CloseContext(flushCtx); err != nil {
+			fmt.Fprintln(os.Stderr, "Timed out flushing logs:", err)
+		}
 	}
 }
 
+// reloadConfig re-reads the configuration on SIGHUP and applies what can change without a
+// restart; running sessions are kept. An invalid configuration is logged and ignored
+func reloadConfig(cfg *config.Config, sessionMgr *session.Manager, logLevel *slog.LevelVar) *config.Config {
+	next, changes, err := config.Reload(cfg)
+	if err != nil {
+		slog.Error("Failed to reload configuration, keeping the current one", "error", err)
+		return cfg
+	}
+
+	logLevel.Set(next.LogLevel)
+	api.ApplyConfig(next, sessionMgr)
+
+	for _, c := range changes {
+		if c.Reloadable {
+			slog.Info("Reloaded setting", "key", c.Key, "old", c.Old, "new", c.New)
+		} else {
+			slog.Warn("Setting changed but requires a restart", "key", c.Key, "current", c.Old, "new", c.New)
+		}
+	}
+	slog.Info("Configuration reloaded", "changes", len(changes))
+	return next
+}
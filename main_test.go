@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kubedeskpro/kubedesk-helper/internal/api"
+	"github.com/kubedeskpro/kubedesk-helper/internal/config"
+	"github.com/kubedeskpro/kubedesk-helper/internal/logging"
+	"github.com/kubedeskpro/kubedesk-helper/internal/session"
+)
+
+// syncBuffer is a bytes.Buffer safe for the log worker and the test to share
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestShutdown_DrainsRequestsBeforeStoppingSessions(t *testing.T) {
+	var out syncBuffer
+	prev := slog.Default()
+	slog.SetDefault(logging.NewAsyncLogger(&out, slog.LevelInfo, 100))
+	defer slog.SetDefault(prev)
+
+	sessionMgr := session.NewManager()
+	sess, err := sessionMgr.Create(session.TypeExec)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	// An in-flight request that still needs its session when it finishes
+	started := make(chan struct{})
+	var sessionAlive bool
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		_, sessionAlive = sessionMgr.Get(sess.ID)
+		slog.Info("Request finished")
+	})}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	go server.Serve(listener)
+
+	go http.Get("http://" + listener.Addr().String())
+	<-started
+
+	slog.Info("Shutting down server...")
+	shutdown(server, sessionMgr, 5*time.Second)
+
+	if !sessionAlive {
+		t.Error("Session was stopped before the in-flight request finished")
+	}
+	if _, ok := sessionMgr.Get(sess.ID); ok {
+		t.Error("Session still registered after shutdown")
+	}
+
+	// Every shutdown-path log was flushed, in order
+	got := out.String()
+	last := -1
+	for _, msg := range []string{"Shutting down server...", "Request finished", "All sessions stopped", "Server stopped"} {
+		i := strings.Index(got, `"msg":"`+msg+`"`)
+		if i < 0 {
+			t.Fatalf("output missing %q:\n%s", msg, got)
+		}
+		if i < last {
+			t.Errorf("%q logged out of order:\n%s", msg, got)
+		}
+		last = i
+	}
+}
+
+func TestShutdown_EndsOpenEventStreams(t *testing.T) {
+	sessionMgr := session.NewManager()
+	server := &http.Server{Handler: api.NewRouter("test", sessionMgr, config.Default())}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	go server.Serve(listener)
+
+	// The app keeps /events open for as long as it runs
+	resp, err := http.Get("http://" + listener.Addr().String() + "/events")
+	if err != nil {
+		t.Fatalf("GET /events: %v", err)
+	}
+	defer resp.Body.Close()
+
+	const timeout = 10 * time.Second
+	start := time.Now()
+	shutdown(server, sessionMgr, timeout)
+	if elapsed := time.Since(start); elapsed > timeout/4 {
+		t.Errorf("shutdown took %s with an open event stream, want it to end the stream instead of waiting out the drain", elapsed)
+	}
+
+	// The stream ended cleanly rather than being cut off by a forced Close
+	reader := bufio.NewReader(resp.Body)
+	for {
+		if _, err := reader.ReadString('\n'); err != nil {
+			if err != io.EOF {
+				t.Errorf("event stream ended with %v, want EOF", err)
+			}
+			break
+		}
+	}
+}